@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// RunImport implements the "import" command, which uploads a CSV or NDJSON
+// file to a running backend's import endpoint and prints the result
+func RunImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	server := fs.String("server", "http://localhost:8080", "backend base URL")
+	file := fs.String("file", "", "CSV or NDJSON file to import (required)")
+	format := fs.String("format", "", "csv or ndjson (default: from file extension)")
+	deviceID := fs.String("device", "", "import every row into this device")
+	deviceColumn := fs.String("device-column", "", "column holding the device ID (default deviceId)")
+	tsColumn := fs.String("ts-column", "", "column holding the timestamp (default ts)")
+	tsFormat := fs.String("ts-format", "", "epoch_ms, epoch_s, rfc3339 or a Go time layout (default epoch_ms)")
+	timezone := fs.String("tz", "", "timezone for layouts without an offset (default UTC)")
+	keyColumn := fs.String("key-column", "", "long format: column holding the key name")
+	valueColumn := fs.String("value-column", "", "long format: column holding the value")
+	columns := fs.String("columns", "", "comma-separated source:key column mapping")
+	ignore := fs.String("ignore", "", "comma-separated columns to skip")
+	dryRun := fs.Bool("dry-run", false, "validate without storing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		fs.Usage()
+		return fmt.Errorf("-file is required")
+	}
+
+	options := models.ImportOptions{
+		Format:          *format,
+		DeviceID:        *deviceID,
+		DeviceColumn:    *deviceColumn,
+		TimestampColumn: *tsColumn,
+		TimestampFormat: *tsFormat,
+		Timezone:        *timezone,
+		KeyColumn:       *keyColumn,
+		ValueColumn:     *valueColumn,
+		DryRun:          *dryRun,
+	}
+	if options.Format == "" {
+		switch strings.ToLower(filepath.Ext(*file)) {
+		case ".ndjson", ".jsonl":
+			options.Format = models.ImportFormatNDJSON
+		default:
+			options.Format = models.ImportFormatCSV
+		}
+	}
+	query := options.QueryValues()
+	if *columns != "" {
+		query.Set("columns", *columns)
+	}
+	if *ignore != "" {
+		query.Set("ignoreColumns", *ignore)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType := "text/csv"
+	if options.Format == models.ImportFormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+
+	url := strings.TrimRight(*server, "/") + "/api/v1/telemetry/import?" + query.Encode()
+	client := &http.Client{Timeout: 30 * time.Minute}
+	resp, err := client.Post(url, contentType, f)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope struct {
+		Success bool                 `json:"success"`
+		Error   string               `json:"error"`
+		Data    *models.ImportResult `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("unexpected response (%s): %s", resp.Status, body)
+	}
+	if !envelope.Success || envelope.Data == nil {
+		return fmt.Errorf("import failed: %s", envelope.Error)
+	}
+
+	result := envelope.Data
+	fmt.Printf("Rows read:       %d\n", result.RowsRead)
+	fmt.Printf("Rows imported:   %d\n", result.RowsImported)
+	fmt.Printf("Rows rejected:   %d\n", result.RowsRejected)
+	fmt.Printf("Points imported: %d\n", result.PointsImported)
+	if result.PointsEvicted > 0 {
+		fmt.Printf("Points evicted:  %d (older than telemetry.retention.raw, kept as rollups only)\n", result.PointsEvicted)
+	}
+	if result.DryRun {
+		fmt.Println("Dry run: nothing was stored")
+	}
+	for _, rowError := range result.Errors {
+		if rowError.Column != "" {
+			fmt.Printf("  row %d, %s: %s\n", rowError.Row, rowError.Column, rowError.Message)
+		} else {
+			fmt.Printf("  row %d: %s\n", rowError.Row, rowError.Message)
+		}
+	}
+	if result.ErrorCount > len(result.Errors) {
+		fmt.Printf("  ... and %d more errors\n", result.ErrorCount-len(result.Errors))
+	}
+
+	if result.RowsRejected > 0 {
+		return fmt.Errorf("%d rows rejected", result.RowsRejected)
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Config represents the full backend configuration loaded from config.yaml
+type Config struct {
+	Server        ServerConfig        `mapstructure:"server"`
+	CORS          CORSConfig          `mapstructure:"cors"`
+	WebSocket     WebSocketConfig     `mapstructure:"websocket"`
+	Stream        StreamConfig        `mapstructure:"stream"`
+	Telemetry     TelemetryConfig     `mapstructure:"telemetry"`
+	Logging       LoggingConfig       `mapstructure:"logging"`
+	Alarms        AlarmsConfig        `mapstructure:"alarms"`
+	Dashboards    DashboardsConfig    `mapstructure:"dashboards"`
+	Assets        AssetsConfig        `mapstructure:"assets"`
+	Connectivity  ConnectivityConfig  `mapstructure:"connectivity"`
+	Webhooks      WebhooksConfig      `mapstructure:"webhooks"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	Anomalies     AnomaliesConfig     `mapstructure:"anomalies"`
+	Forecasting   ForecastingConfig   `mapstructure:"forecasting"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port int    `mapstructure:"port"`
+	Host string `mapstructure:"host"` // empty listens on all interfaces
+}
+
+// Addr returns the listen address for the HTTP server
+func (sc ServerConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", sc.Host, sc.Port)
+}
+
+// CORSConfig holds cross-origin settings
+type CORSConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+// WebSocketConfig holds WebSocket settings
+type WebSocketConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	BufferSize       int           `mapstructure:"buffer_size"`       // broadcasts kept for resume
+	Compression      bool          `mapstructure:"compression"`       // negotiate permessage-deflate
+	CompressionLevel int           `mapstructure:"compression_level"` // flate level, -2 (Huffman only) to 9
+	PingInterval     time.Duration `mapstructure:"ping_interval"`     // protocol-level ping period
+	PongTimeout      time.Duration `mapstructure:"pong_timeout"`      // close when nothing, not even a pong, arrives for this long
+	WriteTimeout     time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout      time.Duration `mapstructure:"idle_timeout"`     // close clients sending no messages for this long, 0 disables
+	MaxMessageSize   int64         `mapstructure:"max_message_size"` // bytes, larger client messages close the connection
+}
+
+// StreamConfig holds Server-Sent Events stream settings
+type StreamConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	BufferSize        int           `mapstructure:"buffer_size"` // events kept for Last-Event-ID resume
+}
+
+// TelemetryConfig holds simulation settings, retention, device profiles and the device list
+type TelemetryConfig struct {
+	SimulationInterval time.Duration          `mapstructure:"simulation_interval"`
+	Retention          RetentionConfig        `mapstructure:"retention"`
+	Profiles           []models.DeviceProfile `mapstructure:"profiles"` // empty uses the built-in profiles of the demo devices
+	Devices            []DeviceConfig         `mapstructure:"devices"`
+}
+
+// RollupTiers lists the rollup tiers, finest first
+var RollupTiers = []RollupTier{
+	{Name: "1m", Size: time.Minute},
+	{Name: "1h", Size: time.Hour},
+	{Name: "1d", Size: 24 * time.Hour},
+}
+
+// RollupTier is a fixed bucket size telemetry is aggregated into
+type RollupTier struct {
+	Name string
+	Size time.Duration
+}
+
+// RetentionConfig holds how long raw readings and each rollup tier are kept
+type RetentionConfig struct {
+	Raw      time.Duration            `mapstructure:"raw"`
+	Rollups  map[string]time.Duration `mapstructure:"rollups"` // tier name -> retention, 0 disables the tier
+	Policies []RetentionPolicy        `mapstructure:"policies"`
+}
+
+// RetentionPolicy overrides the default retention for a device type, a key
+// or both. A zero raw retention and missing rollup tiers inherit the defaults.
+type RetentionPolicy struct {
+	DeviceType string                   `mapstructure:"device_type"`
+	Key        string                   `mapstructure:"key"`
+	Raw        time.Duration            `mapstructure:"raw"`
+	Rollups    map[string]time.Duration `mapstructure:"rollups"`
+}
+
+// DeviceConfig describes a simulated device
+type DeviceConfig struct {
+	ID       string `mapstructure:"id"`
+	Name     string `mapstructure:"name"`
+	Type     string `mapstructure:"type"`
+	Location string `mapstructure:"location"`
+	Profile  string `mapstructure:"profile"` // device profile name, empty picks one from the ID or type
+	EntityID string `mapstructure:"entity_id"`
+}
+
+// ToModel converts the device configuration to a device model
+func (dc DeviceConfig) ToModel() models.Device {
+	return models.Device{
+		ID:       dc.ID,
+		Name:     dc.Name,
+		Type:     dc.Type,
+		Location: dc.Location,
+		Profile:  dc.Profile,
+	}
+}
+
+// AlarmRules returns the global alarm rules followed by the rules of every
+// device profile, each restricted to the devices using its profile
+func (c *Config) AlarmRules() []models.AlarmRule {
+	rules := append([]models.AlarmRule(nil), c.Alarms.Rules...)
+	for _, profile := range c.Telemetry.Profiles {
+		for _, rule := range profile.AlarmRules {
+			rule.Profile = profile.Name
+			rules = append(rules, rule)
+		}
+	}
+	for _, detector := range c.Anomalies.Detectors {
+		if rule, ok := detector.AlarmRule(); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// LoggingConfig holds logger settings
+type LoggingConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+// AlarmsConfig holds the alarm rule set
+type AlarmsConfig struct {
+	Rules []models.AlarmRule `mapstructure:"rules"`
+}
+
+// DashboardsConfig holds dashboard storage settings
+type DashboardsConfig struct {
+	StorageFile string `mapstructure:"storage_file"` // JSON file dashboards are persisted to, empty keeps them in memory
+}
+
+// AssetsConfig holds asset and relation storage settings
+type AssetsConfig struct {
+	StorageFile string `mapstructure:"storage_file"` // JSON file assets and relations are persisted to, empty keeps them in memory
+}
+
+// ConnectivityConfig holds device activity tracking settings
+type ConnectivityConfig struct {
+	InactivityTimeout time.Duration `mapstructure:"inactivity_timeout"` // devices without readings for this long become inactive
+}
+
+// WebhooksConfig holds outbound webhook targets and delivery settings
+type WebhooksConfig struct {
+	Targets        []models.WebhookTarget `mapstructure:"targets"`
+	Workers        int                    `mapstructure:"workers"`          // concurrent deliveries
+	QueueSize      int                    `mapstructure:"queue_size"`       // pending deliveries, overflow goes to the dead-letter queue
+	LogSize        int                    `mapstructure:"log_size"`         // delivery attempts kept in the delivery log
+	DeadLetterSize int                    `mapstructure:"dead_letter_size"` // failed deliveries kept for inspection and replay
+}
+
+// NotificationsConfig holds email and SMS alarm notification settings
+type NotificationsConfig struct {
+	Timezone  string                      `mapstructure:"timezone"` // IANA zone quiet hours are read in, e.g. Asia/Ho_Chi_Minh
+	SMTP      SMTPConfig                  `mapstructure:"smtp"`
+	SMS       SMSConfig                   `mapstructure:"sms"`
+	RateLimit RateLimitConfig             `mapstructure:"rate_limit"`
+	Groups    []models.RecipientGroup     `mapstructure:"groups"`
+	Policies  []models.NotificationPolicy `mapstructure:"policies"`
+	LogSize   int                         `mapstructure:"log_size"` // notifications kept in the notification log
+}
+
+// SMTPConfig holds the mail server used for the EMAIL channel. An empty host disables email.
+type SMTPConfig struct {
+	Host     string        `mapstructure:"host"`
+	Port     int           `mapstructure:"port"`
+	Username string        `mapstructure:"username"` // PLAIN auth when set; STARTTLS is used whenever the server offers it
+	Password string        `mapstructure:"password"`
+	From     string        `mapstructure:"from"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// SMSConfig selects and configures the SMS provider
+type SMSConfig struct {
+	Provider string            `mapstructure:"provider"` // log (writes messages to the log) or http (posts them to a gateway)
+	URL      string            `mapstructure:"url"`
+	From     string            `mapstructure:"from"`
+	Headers  map[string]string `mapstructure:"headers"` // e.g. the gateway's Authorization header
+	Timeout  time.Duration     `mapstructure:"timeout"`
+}
+
+// RateLimitConfig caps notifications per recipient and channel in a sliding window
+type RateLimitConfig struct {
+	MaxNotifications int           `mapstructure:"max_notifications"` // 0 disables the limit
+	Window           time.Duration `mapstructure:"window"`
+}
+
+// AnomaliesConfig holds the streaming anomaly detectors
+type AnomaliesConfig struct {
+	Timezone     string                   `mapstructure:"timezone"`       // IANA zone seasonal baselines read the hour of day in
+	History      time.Duration            `mapstructure:"history"`        // stored telemetry replayed to seed a new baseline
+	EventLogSize int                      `mapstructure:"event_log_size"` // anomaly events kept
+	Detectors    []models.AnomalyDetector `mapstructure:"detectors"`
+}
+
+// ForecastingConfig holds the settings of forecasts requested through the timeseries API
+type ForecastingConfig struct {
+	History    time.Duration `mapstructure:"history"`    // stored telemetry forecasting models are fitted on
+	Confidence float64       `mapstructure:"confidence"` // default probability covered by confidence bands
+	MaxSteps   int           `mapstructure:"max_steps"`  // most interval buckets one forecast may cover
+}
+
+// setDefaults registers default values for every known setting
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.host", "")
+	v.SetDefault("cors.enabled", true)
+	v.SetDefault("cors.allowed_origins", []string{"*"})
+	v.SetDefault("websocket.enabled", true)
+	v.SetDefault("websocket.buffer_size", 1000)
+	v.SetDefault("websocket.compression", true)
+	v.SetDefault("websocket.compression_level", 1)
+	v.SetDefault("websocket.ping_interval", "30s")
+	v.SetDefault("websocket.pong_timeout", "60s")
+	v.SetDefault("websocket.write_timeout", "10s")
+	v.SetDefault("websocket.idle_timeout", "0s")
+	v.SetDefault("websocket.max_message_size", 65536)
+	v.SetDefault("stream.enabled", true)
+	v.SetDefault("stream.heartbeat_interval", "15s")
+	v.SetDefault("stream.buffer_size", 1000)
+	v.SetDefault("telemetry.simulation_interval", "5s")
+	v.SetDefault("telemetry.retention.raw", "24h")
+	v.SetDefault("telemetry.retention.rollups", map[string]string{"1m": "7d", "1h": "90d", "1d": "1825d"})
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("logging.format", "json")
+	v.SetDefault("dashboards.storage_file", "dashboards.json")
+	v.SetDefault("assets.storage_file", "assets.json")
+	v.SetDefault("connectivity.inactivity_timeout", "30s")
+	v.SetDefault("webhooks.workers", 4)
+	v.SetDefault("webhooks.queue_size", 1000)
+	v.SetDefault("webhooks.log_size", 1000)
+	v.SetDefault("webhooks.dead_letter_size", 500)
+	v.SetDefault("notifications.timezone", "Local")
+	v.SetDefault("notifications.smtp.port", 25)
+	v.SetDefault("notifications.smtp.timeout", "10s")
+	v.SetDefault("notifications.sms.provider", "log")
+	v.SetDefault("notifications.sms.timeout", "10s")
+	v.SetDefault("notifications.rate_limit.max_notifications", 10)
+	v.SetDefault("notifications.rate_limit.window", "10m")
+	v.SetDefault("notifications.log_size", 1000)
+	v.SetDefault("anomalies.timezone", "Local")
+	v.SetDefault("anomalies.history", "7d")
+	v.SetDefault("anomalies.event_log_size", 1000)
+	v.SetDefault("forecasting.history", "28d")
+	v.SetDefault("forecasting.confidence", 0.95)
+	v.SetDefault("forecasting.max_steps", 2000)
+}
+
+// decode reads the current viper state into a Config
+func decode(v *viper.Viper) (*Config, error) {
+	var cfg Config
+	hook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		stringToDurationHook,
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := v.Unmarshal(&cfg, hook); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	cfg.Logging.Level = strings.ToLower(strings.TrimSpace(cfg.Logging.Level))
+	cfg.Logging.Format = strings.ToLower(strings.TrimSpace(cfg.Logging.Format))
+	normalizeAlarmRules(cfg.Alarms.Rules)
+	if len(cfg.Telemetry.Profiles) == 0 {
+		cfg.Telemetry.Profiles = defaultProfiles()
+	}
+	for i := range cfg.Telemetry.Profiles {
+		profile := &cfg.Telemetry.Profiles[i]
+		for j := range profile.Keys {
+			profile.Keys[j].Type = strings.ToLower(strings.TrimSpace(profile.Keys[j].Type))
+		}
+		normalizeAlarmRules(profile.AlarmRules)
+		profile.Transport.Type = strings.ToUpper(strings.TrimSpace(profile.Transport.Type))
+		if profile.Transport.Type == "" {
+			profile.Transport.Type = models.TransportDefault
+		}
+		profile.Transport.PayloadType = strings.ToUpper(strings.TrimSpace(profile.Transport.PayloadType))
+		if profile.Transport.PayloadType == "" {
+			profile.Transport.PayloadType = models.PayloadJSON
+		}
+	}
+
+	for i := range cfg.Webhooks.Targets {
+		applyWebhookDefaults(&cfg.Webhooks.Targets[i])
+	}
+	normalizeNotifications(&cfg.Notifications)
+	for i := range cfg.Anomalies.Detectors {
+		applyDetectorDefaults(&cfg.Anomalies.Detectors[i])
+	}
+
+	return &cfg, nil
+}
+
+// applyWebhookDefaults fills in the optional delivery settings of a webhook target
+func applyWebhookDefaults(target *models.WebhookTarget) {
+	for i := range target.Events {
+		target.Events[i] = strings.ToUpper(strings.TrimSpace(target.Events[i]))
+	}
+	if target.ContentType == "" {
+		target.ContentType = "application/json"
+	}
+	if target.MaxAttempts == 0 {
+		target.MaxAttempts = 5
+	}
+	if target.InitialBackoff == 0 {
+		target.InitialBackoff = time.Second
+	}
+	if target.MaxBackoff == 0 {
+		target.MaxBackoff = time.Minute
+	}
+	if target.Timeout == 0 {
+		target.Timeout = 10 * time.Second
+	}
+}
+
+// applyDetectorDefaults fills in the optional settings of an anomaly detector
+// with defaults suited to its method
+func applyDetectorDefaults(detector *models.AnomalyDetector) {
+	detector.Method = strings.ToLower(strings.TrimSpace(detector.Method))
+	detector.AlarmSeverity = strings.ToUpper(strings.TrimSpace(detector.AlarmSeverity))
+	if detector.Window == 0 {
+		switch detector.Method {
+		case models.AnomalyMethodZScore:
+			detector.Window = 60
+		case models.AnomalyMethodSeasonal:
+			detector.Window = 1000
+		}
+	}
+	if detector.Alpha == 0 && detector.Method == models.AnomalyMethodEWMA {
+		detector.Alpha = 0.1
+	}
+	if detector.Threshold == 0 {
+		detector.Threshold = 3
+	}
+	if detector.MinSamples == 0 {
+		detector.MinSamples = 20
+	}
+	if detector.ScoreKey == "" {
+		detector.ScoreKey = detector.Key + "_anomaly_" + detector.Method
+	}
+}
+
+// normalizeNotifications upper-cases channels and severities; steps without
+// channels notify on every channel
+func normalizeNotifications(notifications *NotificationsConfig) {
+	notifications.SMS.Provider = strings.ToLower(strings.TrimSpace(notifications.SMS.Provider))
+	for i := range notifications.Groups {
+		if quiet := notifications.Groups[i].QuietHours; quiet != nil {
+			upperAll(quiet.AllowSeverities)
+		}
+	}
+	for i := range notifications.Policies {
+		policy := &notifications.Policies[i]
+		upperAll(policy.Severities)
+		for j := range policy.Steps {
+			step := &policy.Steps[j]
+			if len(step.Channels) == 0 {
+				step.Channels = []string{models.ChannelEmail, models.ChannelSMS}
+			}
+			upperAll(step.Channels)
+		}
+	}
+}
+
+// upperAll trims and upper-cases every value in place
+func upperAll(values []string) {
+	for i := range values {
+		values[i] = strings.ToUpper(strings.TrimSpace(values[i]))
+	}
+}
+
+// normalizeAlarmRules lower-cases conditions and upper-cases severities
+func normalizeAlarmRules(rules []models.AlarmRule) {
+	for i := range rules {
+		rules[i].Condition = strings.ToLower(strings.TrimSpace(rules[i].Condition))
+		rules[i].Severity = strings.ToUpper(strings.TrimSpace(rules[i].Severity))
+	}
+}
+
+// dayUnits matches day and week amounts, which time.ParseDuration lacks
+var dayUnits = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// ParseDuration parses a Go duration that may also use d (days) and w (weeks),
+// e.g. 7d or 1w12h
+func ParseDuration(text string) (time.Duration, error) {
+	expanded := dayUnits.ReplaceAllStringFunc(text, func(match string) string {
+		parts := dayUnits.FindStringSubmatch(match)
+		amount, _ := strconv.ParseFloat(parts[1], 64)
+		hours := amount * 24
+		if parts[2] == "w" {
+			hours *= 7
+		}
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	return time.ParseDuration(expanded)
+}
+
+// stringToDurationHook decodes durations with ParseDuration
+func stringToDurationHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+	return ParseDuration(data.(string))
+}
+
+// Apply configures the global logger from the logging settings
+func (lc LoggingConfig) Apply() {
+	if lc.Format == "text" {
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	} else {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	}
+
+	level, err := logrus.ParseLevel(lc.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logrus.SetLevel(level)
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ReloadFunc is called after a changed configuration passed validation
+type ReloadFunc func(previous, current *Config)
+
+// Manager loads, validates and live-reloads the configuration
+type Manager struct {
+	v         *viper.Viper
+	current   *Config
+	listeners []ReloadFunc
+	mutex     sync.RWMutex
+}
+
+// NewManager creates a configuration manager backed by the given viper instance
+func NewManager(v *viper.Viper) *Manager {
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(".")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	setDefaults(v)
+
+	return &Manager{v: v}
+}
+
+// Load reads the config file, validates it and stores it as the current configuration
+func (m *Manager) Load() (*Config, error) {
+	if err := m.v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, err
+		}
+		logrus.Warn("No config file found, using defaults")
+	}
+
+	cfg, err := decode(m.v)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.current = cfg
+	m.mutex.Unlock()
+
+	return cfg, nil
+}
+
+// Current returns the active configuration
+func (m *Manager) Current() *Config {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.current
+}
+
+// OnReload registers a listener for validated configuration changes
+func (m *Manager) OnReload(fn ReloadFunc) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Watch starts watching the config file and reloads it on change
+func (m *Manager) Watch() {
+	if m.v.ConfigFileUsed() == "" {
+		return
+	}
+
+	m.v.OnConfigChange(func(e fsnotify.Event) {
+		m.reload()
+	})
+	m.v.WatchConfig()
+	logrus.Infof("Watching %s for configuration changes", m.v.ConfigFileUsed())
+}
+
+// reload decodes and validates the changed file; invalid configurations are
+// rejected and the previous configuration stays active
+func (m *Manager) reload() {
+	cfg, err := decode(m.v)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		logrus.Errorf("Configuration reload rejected, keeping previous settings: %v", err)
+		return
+	}
+
+	m.mutex.Lock()
+	previous := m.current
+	m.current = cfg
+	listeners := append([]ReloadFunc(nil), m.listeners...)
+	m.mutex.Unlock()
+
+	for _, field := range restartRequired(previous, cfg) {
+		logrus.Warnf("Configuration change to %s requires a restart to take effect", field)
+	}
+
+	for _, listener := range listeners {
+		listener(previous, cfg)
+	}
+	logrus.Info("Configuration reloaded")
+}
+
+// restartRequired lists changed settings that cannot be applied at runtime
+func restartRequired(previous, current *Config) []string {
+	if previous == nil {
+		return nil
+	}
+
+	var fields []string
+	if previous.Server != current.Server {
+		fields = append(fields, "server")
+	}
+	if previous.CORS.Enabled != current.CORS.Enabled {
+		fields = append(fields, "cors.enabled")
+	}
+	if previous.WebSocket != current.WebSocket {
+		fields = append(fields, "websocket")
+	}
+	if previous.Stream != current.Stream {
+		fields = append(fields, "stream")
+	}
+	if previous.Dashboards != current.Dashboards {
+		fields = append(fields, "dashboards")
+	}
+	if previous.Assets != current.Assets {
+		fields = append(fields, "assets")
+	}
+	if previous.Webhooks.Workers != current.Webhooks.Workers {
+		fields = append(fields, "webhooks.workers")
+	}
+	if previous.Webhooks.QueueSize != current.Webhooks.QueueSize {
+		fields = append(fields, "webhooks.queue_size")
+	}
+	if previous.Webhooks.LogSize != current.Webhooks.LogSize {
+		fields = append(fields, "webhooks.log_size")
+	}
+	if previous.Webhooks.DeadLetterSize != current.Webhooks.DeadLetterSize {
+		fields = append(fields, "webhooks.dead_letter_size")
+	}
+	if previous.Notifications.LogSize != current.Notifications.LogSize {
+		fields = append(fields, "notifications.log_size")
+	}
+	if previous.Anomalies.EventLogSize != current.Anomalies.EventLogSize {
+		fields = append(fields, "anomalies.event_log_size")
+	}
+	if !reflect.DeepEqual(previous.Telemetry.Devices, current.Telemetry.Devices) {
+		fields = append(fields, "telemetry.devices")
+	}
+	return fields
+}
@@ -0,0 +1,73 @@
+package config
+
+import "thingsboard-widget-backend/models"
+
+// defaultProfiles returns the device profiles of the built-in demo devices,
+// used when telemetry.profiles is not configured
+func defaultProfiles() []models.DeviceProfile {
+	defaultTransport := models.TransportSettings{
+		Type:        models.TransportDefault,
+		PayloadType: models.PayloadJSON,
+	}
+
+	return []models.DeviceProfile{
+		{
+			Name:        "temperature_sensor",
+			Description: "Indoor temperature and humidity sensor",
+			Keys: []models.TelemetryKey{
+				{Name: "temperature", Type: "numeric", Unit: "°C", MinValue: -10, MaxValue: 50},
+				{Name: "humidity", Type: "numeric", Unit: "%", MinValue: 0, MaxValue: 100},
+			},
+			Transport: defaultTransport,
+		},
+		{
+			Name:        "humidity_sensor",
+			Description: "Humidity and barometric pressure sensor",
+			Keys: []models.TelemetryKey{
+				{Name: "humidity", Type: "numeric", Unit: "%", MinValue: 0, MaxValue: 100},
+				{Name: "pressure", Type: "numeric", Unit: "hPa", MinValue: 900, MaxValue: 1100},
+			},
+			Transport: defaultTransport,
+		},
+		{
+			Name:        "power_meter",
+			Description: "Three-phase power meter for distribution rooms",
+			Keys: []models.TelemetryKey{
+				{Name: "voltage", Type: "numeric", Unit: "V", MinValue: 200, MaxValue: 250},
+				{Name: "current", Type: "numeric", Unit: "A", MinValue: 0, MaxValue: 100},
+				{Name: "power", Type: "numeric", Unit: "kW", MinValue: 0, MaxValue: 25},
+				{Name: "energy", Type: "numeric", Unit: "kWh", MinValue: 0, MaxValue: 1000000, Cumulative: true},
+			},
+			Transport: defaultTransport,
+		},
+		{
+			Name:        "smart_power_meter",
+			Description: "Single-phase smart meter with billing",
+			Keys: []models.TelemetryKey{
+				{Name: "voltage", Type: "numeric", Unit: "V", MinValue: 220, MaxValue: 240},
+				{Name: "current", Type: "numeric", Unit: "A", MinValue: 0, MaxValue: 50},
+				{Name: "power", Type: "numeric", Unit: "kW", MinValue: 0, MaxValue: 5},
+				{Name: "energy", Type: "numeric", Unit: "kWh", MinValue: 0, MaxValue: 1000000, Cumulative: true},
+				{Name: "cost", Type: "numeric", Unit: "VND", MinValue: 0, MaxValue: 1000000, Cumulative: true},
+				{Name: "tariff", Type: "json"},
+			},
+			Transport: models.TransportSettings{
+				Type:            models.TransportMQTT,
+				PayloadType:     models.PayloadJSON,
+				TelemetryTopic:  "v1/devices/me/telemetry",
+				AttributesTopic: "v1/devices/me/attributes",
+			},
+		},
+		{
+			Name:        "water_flow_sensor",
+			Description: "Pump station flow sensor with pump state",
+			Keys: []models.TelemetryKey{
+				{Name: "flow_rate", Type: "numeric", Unit: "L/min", MinValue: 0, MaxValue: 1000},
+				{Name: "total_volume", Type: "numeric", Unit: "L", MinValue: 0, MaxValue: 1000000, Cumulative: true},
+				{Name: "pump_status", Type: "boolean", Default: false},
+				{Name: "pump_mode", Type: "string", Default: "idle"},
+			},
+			Transport: defaultTransport,
+		},
+	}
+}
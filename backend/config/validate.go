@@ -0,0 +1,571 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// MinSimulationInterval is the smallest accepted simulation tick
+const MinSimulationInterval = 100 * time.Millisecond
+
+// MinRawRetention is the shortest accepted raw data retention
+const MinRawRetention = time.Minute
+
+// MinWebSocketPingInterval is the smallest accepted WebSocket ping interval
+const MinWebSocketPingInterval = time.Second
+
+// MinWebSocketMessageSize is the smallest accepted limit for client messages
+const MinWebSocketMessageSize = 512
+
+// MinStreamHeartbeatInterval is the smallest accepted SSE heartbeat interval
+const MinStreamHeartbeatInterval = time.Second
+
+// supportedDeviceTypes lists device types the simulator knows how to generate
+var supportedDeviceTypes = map[string]bool{
+	"sensor": true,
+	"meter":  true,
+}
+
+// phoneNumber matches E.164 phone numbers
+var phoneNumber = regexp.MustCompile(`^\+?[1-9][0-9]{5,14}$`)
+
+// ValidationError collects every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (ve *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(ve.Problems, "; ")
+}
+
+func (ve *ValidationError) add(field, format string, args ...interface{}) {
+	ve.Problems = append(ve.Problems, field+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every offending field, or nil if the configuration is usable
+func (c *Config) Validate() error {
+	ve := &ValidationError{}
+
+	// Server
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		ve.add("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+
+	// CORS
+	if c.CORS.Enabled && len(c.CORS.AllowedOrigins) == 0 {
+		ve.add("cors.allowed_origins", "must list at least one origin when cors.enabled is true")
+	}
+	for i, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			ve.add(fmt.Sprintf("cors.allowed_origins[%d]", i), "%q must be \"*\" or start with http:// or https://", origin)
+		}
+	}
+
+	// WebSocket
+	if c.WebSocket.Enabled && c.WebSocket.BufferSize < 1 {
+		ve.add("websocket.buffer_size", "must be at least 1, got %d", c.WebSocket.BufferSize)
+	}
+	if c.WebSocket.CompressionLevel < -2 || c.WebSocket.CompressionLevel > 9 {
+		ve.add("websocket.compression_level", "must be between -2 and 9, got %d", c.WebSocket.CompressionLevel)
+	}
+	if c.WebSocket.Enabled {
+		ws := c.WebSocket
+		if ws.PingInterval < MinWebSocketPingInterval {
+			ve.add("websocket.ping_interval", "must be at least %s, got %s", MinWebSocketPingInterval, ws.PingInterval)
+		}
+		if ws.PongTimeout <= ws.PingInterval {
+			ve.add("websocket.pong_timeout", "must be longer than websocket.ping_interval (%s), got %s", ws.PingInterval, ws.PongTimeout)
+		}
+		if ws.WriteTimeout <= 0 {
+			ve.add("websocket.write_timeout", "must be positive, got %s", ws.WriteTimeout)
+		}
+		if ws.IdleTimeout < 0 {
+			ve.add("websocket.idle_timeout", "must not be negative, got %s", ws.IdleTimeout)
+		}
+		if ws.MaxMessageSize < MinWebSocketMessageSize {
+			ve.add("websocket.max_message_size", "must be at least %d bytes, got %d", MinWebSocketMessageSize, ws.MaxMessageSize)
+		}
+	}
+
+	// Stream
+	if c.Stream.Enabled {
+		if c.Stream.HeartbeatInterval < MinStreamHeartbeatInterval {
+			ve.add("stream.heartbeat_interval", "must be at least %s, got %s", MinStreamHeartbeatInterval, c.Stream.HeartbeatInterval)
+		}
+		if c.Stream.BufferSize < 1 {
+			ve.add("stream.buffer_size", "must be at least 1, got %d", c.Stream.BufferSize)
+		}
+	}
+
+	// Telemetry
+	if c.Telemetry.SimulationInterval < MinSimulationInterval {
+		ve.add("telemetry.simulation_interval", "must be at least %s, got %s", MinSimulationInterval, c.Telemetry.SimulationInterval)
+	}
+	retention := c.Telemetry.Retention
+	if retention.Raw < MinRawRetention {
+		ve.add("telemetry.retention.raw", "must be at least %s, got %s", MinRawRetention, retention.Raw)
+	}
+	validateRollups(ve, "telemetry.retention.rollups", retention.Rollups)
+	for i, policy := range retention.Policies {
+		field := fmt.Sprintf("telemetry.retention.policies[%d]", i)
+		if policy.DeviceType == "" && policy.Key == "" {
+			ve.add(field, "must set device_type, key or both")
+		}
+		if policy.DeviceType != "" && !supportedDeviceTypes[policy.DeviceType] {
+			ve.add(field+".device_type", "unsupported device type %q (expected sensor or meter)", policy.DeviceType)
+		}
+		if policy.Raw != 0 && policy.Raw < MinRawRetention {
+			ve.add(field+".raw", "must be at least %s, got %s", MinRawRetention, policy.Raw)
+		}
+		validateRollups(ve, field+".rollups", policy.Rollups)
+	}
+	seenProfiles := make(map[string]int)
+	for i, profile := range c.Telemetry.Profiles {
+		field := fmt.Sprintf("telemetry.profiles[%d]", i)
+		if profile.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		} else if prev, dup := seenProfiles[profile.Name]; dup {
+			ve.add(field+".name", "%q duplicates telemetry.profiles[%d]", profile.Name, prev)
+		} else {
+			seenProfiles[profile.Name] = i
+		}
+		validateProfileKeys(ve, field+".keys", profile.Keys)
+		if !models.IsValidTransportType(profile.Transport.Type) {
+			ve.add(field+".transport.type", "unknown transport %q (expected DEFAULT, MQTT or COAP)", profile.Transport.Type)
+		}
+		if !models.IsValidPayloadType(profile.Transport.PayloadType) {
+			ve.add(field+".transport.payload_type", "unknown payload type %q (expected JSON or PROTOBUF)", profile.Transport.PayloadType)
+		}
+	}
+	seenDevices := make(map[string]int)
+	for i, device := range c.Telemetry.Devices {
+		field := fmt.Sprintf("telemetry.devices[%d]", i)
+		if device.ID == "" {
+			ve.add(field+".id", "must not be empty")
+		} else if prev, dup := seenDevices[device.ID]; dup {
+			ve.add(field+".id", "%q duplicates telemetry.devices[%d]", device.ID, prev)
+		} else {
+			seenDevices[device.ID] = i
+		}
+		if device.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		}
+		if !supportedDeviceTypes[device.Type] {
+			ve.add(field+".type", "unsupported device type %q (expected sensor or meter)", device.Type)
+		}
+		if device.Profile != "" {
+			if _, ok := seenProfiles[device.Profile]; !ok {
+				ve.add(field+".profile", "references unknown device profile %q", device.Profile)
+			}
+		}
+		if device.EntityID != "" {
+			if _, err := uuid.Parse(device.EntityID); err != nil {
+				ve.add(field+".entity_id", "%q is not a valid UUID", device.EntityID)
+			}
+		}
+	}
+
+	// Logging
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		ve.add("logging.level", "unknown level %q", c.Logging.Level)
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		ve.add("logging.format", "must be json or text, got %q", c.Logging.Format)
+	}
+
+	// Alarms
+	seenRules := make(map[string]string)
+	for i, rule := range c.Alarms.Rules {
+		field := fmt.Sprintf("alarms.rules[%d]", i)
+		c.validateAlarmRule(ve, field, rule, seenRules, seenDevices)
+		if rule.Profile != "" {
+			if _, ok := seenProfiles[rule.Profile]; !ok {
+				ve.add(field+".profile", "references unknown device profile %q", rule.Profile)
+			}
+		}
+	}
+	for i, profile := range c.Telemetry.Profiles {
+		for j, rule := range profile.AlarmRules {
+			field := fmt.Sprintf("telemetry.profiles[%d].alarm_rules[%d]", i, j)
+			c.validateAlarmRule(ve, field, rule, seenRules, seenDevices)
+			if rule.Key != "" {
+				if _, ok := profile.Key(rule.Key); !ok {
+					ve.add(field+".key", "%q is not a key of device profile %q", rule.Key, profile.Name)
+				}
+			}
+		}
+	}
+
+	// Anomaly detection. Services load configured timezones without
+	// checking them again.
+	if _, err := time.LoadLocation(c.Anomalies.Timezone); err != nil {
+		ve.add("anomalies.timezone", "%v", err)
+	}
+	if c.Anomalies.History < 0 {
+		ve.add("anomalies.history", "must not be negative, got %s", c.Anomalies.History)
+	}
+	if c.Anomalies.EventLogSize < 1 {
+		ve.add("anomalies.event_log_size", "must be at least 1, got %d", c.Anomalies.EventLogSize)
+	}
+	seenDetectors := make(map[string]int)
+	for i, detector := range c.Anomalies.Detectors {
+		field := fmt.Sprintf("anomalies.detectors[%d]", i)
+		if detector.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		} else if prev, dup := seenDetectors[detector.Name]; dup {
+			ve.add(field+".name", "%q duplicates anomalies.detectors[%d]", detector.Name, prev)
+		} else {
+			seenDetectors[detector.Name] = i
+		}
+		if detector.Key == "" {
+			ve.add(field+".key", "must not be empty")
+		}
+		if detector.DeviceID != "" && len(c.Telemetry.Devices) > 0 {
+			if _, ok := seenDevices[detector.DeviceID]; !ok {
+				ve.add(field+".device_id", "references unknown device %q", detector.DeviceID)
+			}
+		}
+		if detector.Profile != "" {
+			if _, ok := seenProfiles[detector.Profile]; !ok {
+				ve.add(field+".profile", "references unknown device profile %q", detector.Profile)
+			}
+		}
+		switch detector.Method {
+		case models.AnomalyMethodZScore, models.AnomalyMethodSeasonal:
+			if detector.Window < 2 {
+				ve.add(field+".window", "must be at least 2, got %d", detector.Window)
+			}
+		case models.AnomalyMethodEWMA:
+			if detector.Alpha <= 0 || detector.Alpha > 1 {
+				ve.add(field+".alpha", "must be in (0, 1], got %g", detector.Alpha)
+			}
+		default:
+			ve.add(field+".method", "unknown method %q (expected zscore, seasonal or ewma)", detector.Method)
+		}
+		if detector.Threshold <= 0 {
+			ve.add(field+".threshold", "must be positive, got %g", detector.Threshold)
+		}
+		if detector.MinSamples < 2 {
+			ve.add(field+".min_samples", "must be at least 2, got %d", detector.MinSamples)
+		}
+		if detector.ScoreKey == detector.Key {
+			ve.add(field+".score_key", "must differ from key %q", detector.Key)
+		}
+		if detector.AlarmSeverity != "" {
+			// The detector's alarm rule is named after it
+			if prev, dup := seenRules[detector.Name]; dup {
+				ve.add(field+".name", "%q duplicates %s; detectors raising alarms need a unique alarm rule name", detector.Name, prev)
+			} else {
+				seenRules[detector.Name] = field
+			}
+			if !models.IsValidAlarmSeverity(detector.AlarmSeverity) {
+				ve.add(field+".alarm_severity", "unknown severity %q", detector.AlarmSeverity)
+			}
+		}
+	}
+
+	// Forecasting
+	if c.Forecasting.History <= 0 {
+		ve.add("forecasting.history", "must be positive, got %s", c.Forecasting.History)
+	}
+	if c.Forecasting.Confidence <= 0 || c.Forecasting.Confidence >= 1 {
+		ve.add("forecasting.confidence", "must be in (0, 1), got %g", c.Forecasting.Confidence)
+	}
+	if c.Forecasting.MaxSteps < 1 {
+		ve.add("forecasting.max_steps", "must be at least 1, got %d", c.Forecasting.MaxSteps)
+	}
+
+	// Connectivity
+	if c.Connectivity.InactivityTimeout <= c.Telemetry.SimulationInterval {
+		ve.add("connectivity.inactivity_timeout", "must be longer than telemetry.simulation_interval (%s), got %s", c.Telemetry.SimulationInterval, c.Connectivity.InactivityTimeout)
+	}
+
+	// Webhooks
+	if c.Webhooks.Workers < 1 {
+		ve.add("webhooks.workers", "must be at least 1, got %d", c.Webhooks.Workers)
+	}
+	if c.Webhooks.QueueSize < 1 {
+		ve.add("webhooks.queue_size", "must be at least 1, got %d", c.Webhooks.QueueSize)
+	}
+	if c.Webhooks.LogSize < 1 {
+		ve.add("webhooks.log_size", "must be at least 1, got %d", c.Webhooks.LogSize)
+	}
+	if c.Webhooks.DeadLetterSize < 1 {
+		ve.add("webhooks.dead_letter_size", "must be at least 1, got %d", c.Webhooks.DeadLetterSize)
+	}
+	seenTargets := make(map[string]int)
+	for i, target := range c.Webhooks.Targets {
+		field := fmt.Sprintf("webhooks.targets[%d]", i)
+		if target.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		} else if prev, dup := seenTargets[target.Name]; dup {
+			ve.add(field+".name", "%q duplicates webhooks.targets[%d]", target.Name, prev)
+		} else {
+			seenTargets[target.Name] = i
+		}
+		if parsed, err := url.Parse(target.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			ve.add(field+".url", "%q must be an absolute http:// or https:// URL", target.URL)
+		}
+		for j, eventType := range target.Events {
+			if !models.IsValidEventType(eventType) {
+				ve.add(fmt.Sprintf("%s.events[%d]", field, j), "unknown event %q (expected ALARM, CONNECTIVITY, RPC_RESULT or ANOMALY)", eventType)
+			}
+		}
+		if target.Template != "" {
+			if _, err := template.New(target.Name).Funcs(models.TemplateFuncs).Parse(target.Template); err != nil {
+				ve.add(field+".template", "%v", err)
+			}
+		}
+		if target.MaxAttempts < 1 {
+			ve.add(field+".max_attempts", "must be at least 1, got %d", target.MaxAttempts)
+		}
+		if target.InitialBackoff <= 0 {
+			ve.add(field+".initial_backoff", "must be positive, got %s", target.InitialBackoff)
+		}
+		if target.MaxBackoff < target.InitialBackoff {
+			ve.add(field+".max_backoff", "must not be below initial_backoff (%s), got %s", target.InitialBackoff, target.MaxBackoff)
+		}
+		if target.Timeout <= 0 {
+			ve.add(field+".timeout", "must be positive, got %s", target.Timeout)
+		}
+	}
+
+	c.validateNotifications(ve)
+
+	if len(ve.Problems) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// validateNotifications checks channels, recipient groups and escalation policies
+func (c *Config) validateNotifications(ve *ValidationError) {
+	n := c.Notifications
+	if _, err := time.LoadLocation(n.Timezone); err != nil {
+		ve.add("notifications.timezone", "%v", err)
+	}
+	if n.SMTP.Host != "" {
+		if n.SMTP.Port < 1 || n.SMTP.Port > 65535 {
+			ve.add("notifications.smtp.port", "must be between 1 and 65535, got %d", n.SMTP.Port)
+		}
+		if _, err := mail.ParseAddress(n.SMTP.From); err != nil {
+			ve.add("notifications.smtp.from", "%q is not an email address", n.SMTP.From)
+		}
+		if n.SMTP.Timeout <= 0 {
+			ve.add("notifications.smtp.timeout", "must be positive, got %s", n.SMTP.Timeout)
+		}
+	}
+	switch n.SMS.Provider {
+	case "log":
+	case "http":
+		if parsed, err := url.Parse(n.SMS.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			ve.add("notifications.sms.url", "%q must be an absolute http:// or https:// URL", n.SMS.URL)
+		}
+	default:
+		ve.add("notifications.sms.provider", "unknown provider %q (expected log or http)", n.SMS.Provider)
+	}
+	if n.SMS.Timeout <= 0 {
+		ve.add("notifications.sms.timeout", "must be positive, got %s", n.SMS.Timeout)
+	}
+	if n.RateLimit.MaxNotifications < 0 {
+		ve.add("notifications.rate_limit.max_notifications", "must not be negative, got %d", n.RateLimit.MaxNotifications)
+	}
+	if n.RateLimit.MaxNotifications > 0 && n.RateLimit.Window <= 0 {
+		ve.add("notifications.rate_limit.window", "must be positive, got %s", n.RateLimit.Window)
+	}
+	if n.LogSize < 1 {
+		ve.add("notifications.log_size", "must be at least 1, got %d", n.LogSize)
+	}
+
+	groups := make(map[string]int)
+	for i, group := range n.Groups {
+		field := fmt.Sprintf("notifications.groups[%d]", i)
+		if group.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		} else if prev, dup := groups[group.Name]; dup {
+			ve.add(field+".name", "%q duplicates notifications.groups[%d]", group.Name, prev)
+		} else {
+			groups[group.Name] = i
+		}
+		if len(group.Emails) == 0 && len(group.Phones) == 0 {
+			ve.add(field, "must list at least one email or phone")
+		}
+		for j, email := range group.Emails {
+			if _, err := mail.ParseAddress(email); err != nil {
+				ve.add(fmt.Sprintf("%s.emails[%d]", field, j), "%q is not an email address", email)
+			}
+		}
+		for j, phone := range group.Phones {
+			if !phoneNumber.MatchString(phone) {
+				ve.add(fmt.Sprintf("%s.phones[%d]", field, j), "%q is not an E.164 phone number", phone)
+			}
+		}
+		if quiet := group.QuietHours; quiet != nil {
+			start, startErr := time.Parse("15:04", quiet.Start)
+			if startErr != nil {
+				ve.add(field+".quiet_hours.start", "%q must be HH:MM", quiet.Start)
+			}
+			end, endErr := time.Parse("15:04", quiet.End)
+			if endErr != nil {
+				ve.add(field+".quiet_hours.end", "%q must be HH:MM", quiet.End)
+			}
+			if startErr == nil && endErr == nil && start.Equal(end) {
+				ve.add(field+".quiet_hours", "start and end must differ")
+			}
+			for j, severity := range quiet.AllowSeverities {
+				if !models.IsValidAlarmSeverity(severity) {
+					ve.add(fmt.Sprintf("%s.quiet_hours.allow_severities[%d]", field, j), "unknown severity %q", severity)
+				}
+			}
+		}
+	}
+
+	rules := make(map[string]bool)
+	for _, rule := range c.AlarmRules() {
+		rules[rule.Name] = true
+	}
+	policies := make(map[string]int)
+	for i, policy := range n.Policies {
+		field := fmt.Sprintf("notifications.policies[%d]", i)
+		if policy.Name == "" {
+			ve.add(field+".name", "must not be empty")
+		} else if prev, dup := policies[policy.Name]; dup {
+			ve.add(field+".name", "%q duplicates notifications.policies[%d]", policy.Name, prev)
+		} else {
+			policies[policy.Name] = i
+		}
+		for j, rule := range policy.Rules {
+			if !rules[rule] {
+				ve.add(fmt.Sprintf("%s.rules[%d]", field, j), "references unknown alarm rule %q", rule)
+			}
+		}
+		for j, severity := range policy.Severities {
+			if !models.IsValidAlarmSeverity(severity) {
+				ve.add(fmt.Sprintf("%s.severities[%d]", field, j), "unknown severity %q", severity)
+			}
+		}
+		if len(policy.Steps) == 0 {
+			ve.add(field+".steps", "must not be empty")
+		}
+		for j, step := range policy.Steps {
+			stepField := fmt.Sprintf("%s.steps[%d]", field, j)
+			if step.After < 0 {
+				ve.add(stepField+".after", "must not be negative, got %s", step.After)
+			} else if j > 0 && step.After < policy.Steps[j-1].After {
+				ve.add(stepField+".after", "must not be before the previous step (%s), got %s", policy.Steps[j-1].After, step.After)
+			}
+			if len(step.Groups) == 0 {
+				ve.add(stepField+".groups", "must not be empty")
+			}
+			email := false
+			for _, channel := range step.Channels {
+				if !models.IsValidChannel(channel) {
+					ve.add(stepField+".channels", "unknown channel %q (expected EMAIL or SMS)", channel)
+				}
+				email = email || channel == models.ChannelEmail
+			}
+			for k, name := range step.Groups {
+				index, exists := groups[name]
+				if !exists {
+					ve.add(fmt.Sprintf("%s.groups[%d]", stepField, k), "references unknown recipient group %q", name)
+					continue
+				}
+				if email && len(n.Groups[index].Emails) > 0 && n.SMTP.Host == "" {
+					ve.add(fmt.Sprintf("%s.groups[%d]", stepField, k), "group %q has emails but notifications.smtp.host is not set", name)
+				}
+			}
+		}
+	}
+}
+
+// validateAlarmRule checks one alarm rule. Rule names must be unique across
+// the global rules and every profile's rules, since they identify alarms.
+func (c *Config) validateAlarmRule(ve *ValidationError, field string, rule models.AlarmRule, seenRules map[string]string, seenDevices map[string]int) {
+	if rule.Name == "" {
+		ve.add(field+".name", "must not be empty")
+	} else if prev, dup := seenRules[rule.Name]; dup {
+		ve.add(field+".name", "%q duplicates %s", rule.Name, prev)
+	} else {
+		seenRules[rule.Name] = field
+	}
+	if rule.Key == "" {
+		ve.add(field+".key", "must not be empty")
+	}
+	if rule.DeviceID != "" && len(c.Telemetry.Devices) > 0 {
+		if _, ok := seenDevices[rule.DeviceID]; !ok {
+			ve.add(field+".device_id", "references unknown device %q", rule.DeviceID)
+		}
+	}
+	if !models.IsValidAlarmCondition(rule.Condition) {
+		ve.add(field+".condition", "unknown condition %q (expected gt, gte, lt, lte, eq or neq)", rule.Condition)
+	}
+	if !models.IsValidAlarmSeverity(rule.Severity) {
+		ve.add(field+".severity", "unknown severity %q", rule.Severity)
+	}
+}
+
+// validateProfileKeys checks the key schema of a device profile
+func validateProfileKeys(ve *ValidationError, field string, keys []models.TelemetryKey) {
+	if len(keys) == 0 {
+		ve.add(field, "must define at least one key")
+	}
+	seen := make(map[string]int)
+	for i, key := range keys {
+		keyField := fmt.Sprintf("%s[%d]", field, i)
+		if key.Name == "" {
+			ve.add(keyField+".name", "must not be empty")
+		} else if prev, dup := seen[key.Name]; dup {
+			ve.add(keyField+".name", "%q duplicates %s[%d]", key.Name, field, prev)
+		} else {
+			seen[key.Name] = i
+		}
+		if !models.IsValidKeyType(key.Type) {
+			ve.add(keyField+".type", "unknown key type %q (expected numeric, boolean, string or json)", key.Type)
+		}
+		if key.MaxValue < key.MinValue {
+			ve.add(keyField+".max_value", "must not be below min_value (%v), got %v", key.MinValue, key.MaxValue)
+		}
+		if key.Cumulative && key.Type != "numeric" {
+			ve.add(keyField+".cumulative", "only numeric keys can be cumulative, got type %q", key.Type)
+		}
+	}
+}
+
+// validateRollups checks rollup tier names and retentions
+func validateRollups(ve *ValidationError, field string, rollups map[string]time.Duration) {
+	names := make([]string, 0, len(rollups))
+	for name := range rollups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		retention := rollups[name]
+		known := false
+		for _, tier := range RollupTiers {
+			if tier.Name == name {
+				known = true
+			}
+		}
+		if !known {
+			ve.add(field+"."+name, "unknown rollup tier (expected 1m, 1h or 1d)")
+		} else if retention < 0 {
+			ve.add(field+"."+name, "must not be negative, got %s", retention)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlarmHandlers handles HTTP requests for alarms
+type AlarmHandlers struct {
+	alarmService *services.AlarmService
+}
+
+// NewAlarmHandlers creates new alarm handlers
+func NewAlarmHandlers(alarmService *services.AlarmService) *AlarmHandlers {
+	return &AlarmHandlers{
+		alarmService: alarmService,
+	}
+}
+
+// GetAlarms returns alarms, optionally filtered by deviceId and status query parameters
+func (ah *AlarmHandlers) GetAlarms(c *gin.Context) {
+	alarms := ah.alarmService.GetAlarms(c.Query("deviceId"), c.Query("status"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alarms,
+	})
+}
+
+// GetAlarm returns a specific alarm
+func (ah *AlarmHandlers) GetAlarm(c *gin.Context) {
+	alarm, exists := ah.alarmService.GetAlarm(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Alarm not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alarm,
+	})
+}
+
+// AcknowledgeAlarm acknowledges an alarm
+func (ah *AlarmHandlers) AcknowledgeAlarm(c *gin.Context) {
+	alarm, exists := ah.alarmService.AcknowledgeAlarm(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Alarm not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alarm,
+	})
+}
+
+// GetAlarmRules returns the active alarm rules
+func (ah *AlarmHandlers) GetAlarmRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ah.alarmService.GetRules(),
+	})
+}
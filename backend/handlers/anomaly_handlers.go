@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnomalyHandlers handles HTTP requests for anomaly detection
+type AnomalyHandlers struct {
+	anomalyService *services.AnomalyService
+}
+
+// NewAnomalyHandlers creates new anomaly handlers
+func NewAnomalyHandlers(anomalyService *services.AnomalyService) *AnomalyHandlers {
+	return &AnomalyHandlers{
+		anomalyService: anomalyService,
+	}
+}
+
+// GetAnomalies returns anomaly events, optionally filtered by deviceId, key
+// and detector query parameters
+func (ah *AnomalyHandlers) GetAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ah.anomalyService.GetEvents(c.Query("deviceId"), c.Query("key"), c.Query("detector")),
+	})
+}
+
+// GetDetectors returns the anomaly detectors with their per-device baselines
+func (ah *AnomalyHandlers) GetDetectors(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ah.anomalyService.GetDetectors(),
+	})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssetHandlers handles HTTP requests for assets and entity relations
+type AssetHandlers struct {
+	assetService *services.AssetService
+}
+
+// NewAssetHandlers creates new asset handlers
+func NewAssetHandlers(assetService *services.AssetService) *AssetHandlers {
+	return &AssetHandlers{
+		assetService: assetService,
+	}
+}
+
+// GetAssets returns all assets, optionally filtered by the type query parameter
+func (ah *AssetHandlers) GetAssets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ah.assetService.GetAssets(strings.ToLower(c.Query("type"))),
+	})
+}
+
+// GetAsset returns a specific asset
+func (ah *AssetHandlers) GetAsset(c *gin.Context) {
+	asset, exists := ah.assetService.GetAsset(c.Param("id"))
+	if !exists {
+		assetNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    asset,
+	})
+}
+
+// CreateAsset stores a new asset
+func (ah *AssetHandlers) CreateAsset(c *gin.Context) {
+	var asset models.Asset
+	if err := c.ShouldBindJSON(&asset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	created, err := ah.assetService.CreateAsset(asset)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// UpdateAsset replaces an asset
+func (ah *AssetHandlers) UpdateAsset(c *gin.Context) {
+	var asset models.Asset
+	if err := c.ShouldBindJSON(&asset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	updated, exists, err := ah.assetService.UpdateAsset(c.Param("id"), asset)
+	if !exists {
+		assetNotFound(c)
+		return
+	}
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteAsset removes an asset and its relations
+func (ah *AssetHandlers) DeleteAsset(c *gin.Context) {
+	exists, err := ah.assetService.DeleteAsset(c.Param("id"))
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+	if !exists {
+		assetNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// GetAssetDevices returns the devices below an asset. relationType selects the
+// relations followed, Contains by default.
+func (ah *AssetHandlers) GetAssetDevices(c *gin.Context) {
+	deviceIDs, exists := ah.assetService.GetAssetDevices(c.Param("id"), c.DefaultQuery("relationType", models.RelationContains))
+	if !exists {
+		assetNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    deviceIDs,
+	})
+}
+
+// GetAssetRollup aggregates the latest telemetry of the devices below an
+// asset, optionally only for the keys query parameter
+func (ah *AssetHandlers) GetAssetRollup(c *gin.Context) {
+	rollup, exists := ah.assetService.GetAssetRollup(c.Param("id"), c.DefaultQuery("relationType", models.RelationContains), queryList(c, "keys"))
+	if !exists {
+		assetNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rollup,
+	})
+}
+
+// GetRelations returns direct relations, filtered by the fromId/fromType,
+// toId/toType and relationType query parameters
+func (ah *AssetHandlers) GetRelations(c *gin.Context) {
+	relations := ah.assetService.GetRelations(entityParam(c, "from"), entityParam(c, "to"), c.Query("relationType"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    relations,
+	})
+}
+
+// CreateRelation stores a relation between two entities
+func (ah *AssetHandlers) CreateRelation(c *gin.Context) {
+	var relation models.EntityRelation
+	if err := c.ShouldBindJSON(&relation); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	created, err := ah.assetService.CreateRelation(relation)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// DeleteRelation removes the relation given by the fromId/fromType,
+// toId/toType and relationType query parameters
+func (ah *AssetHandlers) DeleteRelation(c *gin.Context) {
+	from, to, relationType := entityParam(c, "from"), entityParam(c, "to"), c.Query("relationType")
+	if from == nil || to == nil || relationType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "fromId, fromType, toId, toType and relationType are required",
+		})
+		return
+	}
+
+	exists, err := ah.assetService.DeleteRelation(*from, *to, relationType)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Relation not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// QueryRelations walks the relation graph from a root entity
+func (ah *AssetHandlers) QueryRelations(c *gin.Context) {
+	var query models.RelationsQuery
+	if err := c.ShouldBindJSON(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	related, err := ah.assetService.QueryRelations(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    related,
+	})
+}
+
+// assetError maps an asset service error to a response
+func assetError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, services.ErrAssetStorage) {
+		status = http.StatusInternalServerError
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
+func assetNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Asset not found",
+	})
+}
+
+// entityParam reads the <prefix>Id and <prefix>Type query parameters, or nil if the ID is missing
+func entityParam(c *gin.Context, prefix string) *models.EntityID {
+	entityID := c.Query(prefix + "Id")
+	if entityID == "" {
+		return nil
+	}
+	return &models.EntityID{
+		EntityType: strings.ToUpper(c.Query(prefix + "Type")),
+		ID:         entityID,
+	}
+}
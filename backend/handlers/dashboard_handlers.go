@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unsafeFilenameChars matches characters replaced in export file names
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DashboardHandlers handles HTTP requests for dashboard definitions
+type DashboardHandlers struct {
+	dashboardService *services.DashboardService
+}
+
+// NewDashboardHandlers creates new dashboard handlers
+func NewDashboardHandlers(dashboardService *services.DashboardService) *DashboardHandlers {
+	return &DashboardHandlers{
+		dashboardService: dashboardService,
+	}
+}
+
+// GetDashboards lists dashboard summaries, optionally filtered by customerId and a title search
+func (dh *DashboardHandlers) GetDashboards(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dh.dashboardService.ListDashboards(c.Query("customerId"), c.Query("search")),
+	})
+}
+
+// GetDashboard returns a dashboard definition
+func (dh *DashboardHandlers) GetDashboard(c *gin.Context) {
+	dashboard, exists := dh.dashboardService.GetDashboard(c.Param("id"))
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dashboard,
+	})
+}
+
+// CreateDashboard stores a new dashboard
+func (dh *DashboardHandlers) CreateDashboard(c *gin.Context) {
+	var dashboard models.Dashboard
+	if err := c.ShouldBindJSON(&dashboard); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	created, err := dh.dashboardService.CreateDashboard(dashboard)
+	if err != nil {
+		dashboardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// UpdateDashboard replaces a dashboard. A version in the body must match the
+// current version, otherwise 409 Conflict is returned.
+func (dh *DashboardHandlers) UpdateDashboard(c *gin.Context) {
+	var dashboard models.Dashboard
+	if err := c.ShouldBindJSON(&dashboard); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	updated, exists, err := dh.dashboardService.UpdateDashboard(c.Param("id"), dashboard)
+	respondDashboard(c, updated, exists, err)
+}
+
+// DeleteDashboard removes a dashboard and its version history
+func (dh *DashboardHandlers) DeleteDashboard(c *gin.Context) {
+	exists, err := dh.dashboardService.DeleteDashboard(c.Param("id"))
+	if err != nil {
+		dashboardError(c, err)
+		return
+	}
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// ResolveDashboardAliases resolves the dashboard's entity aliases to devices.
+// stateEntityId (and stateEntityType, DEVICE by default) select the entity
+// used by stateEntity and rootStateEntity filters.
+func (dh *DashboardHandlers) ResolveDashboardAliases(c *gin.Context) {
+	resolved, exists := dh.dashboardService.ResolveAliases(c.Param("id"), stateEntityParam(c))
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    resolved,
+	})
+}
+
+// GetDashboardVersions lists the stored versions of a dashboard, newest first
+func (dh *DashboardHandlers) GetDashboardVersions(c *gin.Context) {
+	versions, exists := dh.dashboardService.GetVersions(c.Param("id"))
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    versions,
+	})
+}
+
+// GetDashboardVersion returns a stored version of a dashboard
+func (dh *DashboardHandlers) GetDashboardVersion(c *gin.Context) {
+	version, ok := versionParam(c)
+	if !ok {
+		return
+	}
+
+	dashboard, exists := dh.dashboardService.GetVersion(c.Param("id"), version)
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dashboard,
+	})
+}
+
+// RestoreDashboardVersion makes a stored version the current one
+func (dh *DashboardHandlers) RestoreDashboardVersion(c *gin.Context) {
+	version, ok := versionParam(c)
+	if !ok {
+		return
+	}
+
+	restored, exists, err := dh.dashboardService.RestoreVersion(c.Param("id"), version)
+	respondDashboard(c, restored, exists, err)
+}
+
+// ImportDashboard creates a dashboard from a ThingsBoard dashboard JSON export
+func (dh *DashboardHandlers) ImportDashboard(c *gin.Context) {
+	var tb models.ThingsBoardDashboard
+	if err := c.ShouldBindJSON(&tb); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid ThingsBoard dashboard: " + err.Error(),
+		})
+		return
+	}
+
+	created, err := dh.dashboardService.ImportThingsBoard(tb)
+	if err != nil {
+		dashboardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// ExportDashboard downloads a dashboard as ThingsBoard dashboard JSON
+func (dh *DashboardHandlers) ExportDashboard(c *gin.Context) {
+	tb, exists, err := dh.dashboardService.ExportThingsBoard(c.Param("id"))
+	if err != nil {
+		dashboardError(c, err)
+		return
+	}
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+
+	filename := unsafeFilenameChars.ReplaceAllString(tb.Title, "_") + ".json"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, tb)
+}
+
+// AssignDashboardCustomer assigns a dashboard to a customer. An optional JSON
+// body may set the customer title.
+func (dh *DashboardHandlers) AssignDashboardCustomer(c *gin.Context) {
+	var customer models.CustomerInfo
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&customer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request format: " + err.Error(),
+			})
+			return
+		}
+	}
+	customer.CustomerID = c.Param("customerId")
+
+	dashboard, exists, err := dh.dashboardService.AssignCustomer(c.Param("id"), customer)
+	respondDashboard(c, dashboard, exists, err)
+}
+
+// UnassignDashboardCustomer removes a customer assignment from a dashboard
+func (dh *DashboardHandlers) UnassignDashboardCustomer(c *gin.Context) {
+	dashboard, exists, err := dh.dashboardService.UnassignCustomer(c.Param("id"), c.Param("customerId"))
+	respondDashboard(c, dashboard, exists, err)
+}
+
+// respondDashboard writes the result of a change to an existing dashboard
+func respondDashboard(c *gin.Context, dashboard *models.Dashboard, exists bool, err error) {
+	if !exists {
+		dashboardNotFound(c)
+		return
+	}
+	if err != nil {
+		dashboardError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dashboard,
+	})
+}
+
+// dashboardError maps a dashboard service error to a response
+func dashboardError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrDashboardVersionConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrDashboardStorage):
+		status = http.StatusInternalServerError
+	}
+
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
+func dashboardNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Dashboard not found",
+	})
+}
+
+// versionParam reads the version path parameter, responding with 400 if it is invalid
+func versionParam(c *gin.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "version must be a positive integer",
+		})
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EntityAliasHandlers handles HTTP requests for entity alias resolution
+type EntityAliasHandlers struct {
+	aliasResolver *services.EntityAliasResolver
+}
+
+// NewEntityAliasHandlers creates new entity alias handlers
+func NewEntityAliasHandlers(aliasResolver *services.EntityAliasResolver) *EntityAliasHandlers {
+	return &EntityAliasHandlers{
+		aliasResolver: aliasResolver,
+	}
+}
+
+// ResolveAlias resolves an alias filter to the devices it currently selects
+func (ah *EntityAliasHandlers) ResolveAlias(c *gin.Context) {
+	var request models.AliasResolveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if request.StateEntity != nil && request.StateEntity.EntityType == "" {
+		request.StateEntity.EntityType = models.EntityTypeDevice
+	}
+
+	devices, err := ah.aliasResolver.Resolve(request.Filter, request.StateEntity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    devices,
+	})
+}
+
+// stateEntityParam reads the stateEntityId and stateEntityType query parameters
+func stateEntityParam(c *gin.Context) *models.EntityID {
+	entityID := c.Query("stateEntityId")
+	if entityID == "" {
+		return nil
+	}
+	entityType := strings.ToUpper(c.Query("stateEntityType"))
+	if entityType == "" {
+		entityType = models.EntityTypeDevice
+	}
+	return &models.EntityID{EntityType: entityType, ID: entityID}
+}
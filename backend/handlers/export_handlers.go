@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportHandlers handles telemetry export downloads
+type ExportHandlers struct {
+	exportService *services.ExportService
+}
+
+// NewExportHandlers creates new export handlers
+func NewExportHandlers(exportService *services.ExportService) *ExportHandlers {
+	return &ExportHandlers{
+		exportService: exportService,
+	}
+}
+
+// ExportTelemetry streams historical telemetry as CSV, NDJSON or XLSX.
+// Query parameters: deviceId and keys (repeatable or comma separated), startTs,
+// endTs, format, tz, agg, interval and bom.
+func (eh *ExportHandlers) ExportTelemetry(c *gin.Context) {
+	request := models.ExportRequest{
+		DeviceIDs: queryList(c, "deviceId"),
+		Keys:      queryList(c, "keys"),
+		Format:    c.Query("format"),
+		Timezone:  c.Query("tz"),
+		Agg:       c.Query("agg"),
+		BOM:       c.Query("bom") == "true",
+	}
+
+	var err error
+	if request.StartTs, err = queryInt64(c, "startTs"); err == nil {
+		if request.EndTs, err = queryInt64(c, "endTs"); err == nil {
+			request.Interval, err = queryInt64(c, "interval")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	loc, err := eh.exportService.PrepareExport(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("telemetry_%d_%d.%s", request.StartTs, request.EndTs, request.Format)
+	c.Header("Content-Type", services.ExportContentType(request.Format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	if err := eh.exportService.Export(flushWriter{c.Writer}, request, loc); err != nil {
+		logrus.Errorf("Telemetry export failed: %v", err)
+		abortResponse(c)
+	}
+}
+
+// abortResponse closes the connection of a response whose headers are
+// already sent, so the client sees a truncated transfer instead of a
+// complete file with a 200 status
+func abortResponse(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		logrus.Warnf("Could not abort response: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+// flushWriter flushes the response after every write so exports reach the client as they are produced
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.w.Flush()
+	return n, err
+}
+
+// queryList reads a repeatable, comma-separated query parameter
+func queryList(c *gin.Context, name string) []string {
+	var values []string
+	for _, raw := range c.QueryArray(name) {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// queryInt64 reads an optional integer query parameter
+func queryInt64(c *gin.Context, name string) (int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAbortResponseTruncatesStartedResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/export", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		writer := flushWriter{c.Writer}
+		writer.Write([]byte("ts,temperature\n1000,21.5\n"))
+		abortResponse(c)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		t.Fatalf("read a complete body %q, want a truncated transfer", body)
+	}
+	if string(body) != "ts,temperature\n1000,21.5\n" {
+		t.Errorf("body before the abort = %q", body)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportHandlers handles bulk telemetry imports
+type ImportHandlers struct {
+	importService *services.ImportService
+}
+
+// NewImportHandlers creates new import handlers
+func NewImportHandlers(importService *services.ImportService) *ImportHandlers {
+	return &ImportHandlers{
+		importService: importService,
+	}
+}
+
+// ImportTelemetry imports historical telemetry from a CSV or NDJSON body.
+// The file is sent either as the raw request body or as the "file" field of a
+// multipart form; mapping options are passed as query parameters.
+func (ih *ImportHandlers) ImportTelemetry(c *gin.Context) {
+	options, err := models.ImportOptionsFromQuery(c.Request.URL.Query())
+	if err == nil {
+		err = ih.importService.PrepareImport(&options)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Missing file field: " + err.Error(),
+			})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Failed to open uploaded file: " + err.Error(),
+			})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	result, err := ih.importService.Import(body, options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationHandlers handles HTTP requests for email and SMS notifications
+type NotificationHandlers struct {
+	notificationService *services.NotificationService
+}
+
+// NewNotificationHandlers creates new notification handlers
+func NewNotificationHandlers(notificationService *services.NotificationService) *NotificationHandlers {
+	return &NotificationHandlers{
+		notificationService: notificationService,
+	}
+}
+
+// TestNotificationRequest selects the recipient group and channel of a test message
+type TestNotificationRequest struct {
+	Group   string `json:"group" binding:"required"`
+	Channel string `json:"channel"` // EMAIL or SMS, empty for both
+}
+
+// GetNotifications returns the notification log, optionally filtered by
+// alarmId, status and channel query parameters
+func (nh *NotificationHandlers) GetNotifications(c *gin.Context) {
+	notifications := nh.notificationService.GetNotifications(c.Query("alarmId"), strings.ToUpper(c.Query("status")), strings.ToUpper(c.Query("channel")))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    notifications,
+	})
+}
+
+// GetGroups returns the recipient groups
+func (nh *NotificationHandlers) GetGroups(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nh.notificationService.GetGroups(),
+	})
+}
+
+// GetPolicies returns the notification policies and their escalation steps
+func (nh *NotificationHandlers) GetPolicies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nh.notificationService.GetPolicies(),
+	})
+}
+
+// GetEscalations returns the running escalations
+func (nh *NotificationHandlers) GetEscalations(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nh.notificationService.GetEscalations(),
+	})
+}
+
+// TestNotification sends a test message to a recipient group and returns the outcome per recipient
+func (nh *NotificationHandlers) TestNotification(c *gin.Context) {
+	var request TestNotificationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	channel := strings.ToUpper(request.Channel)
+	if channel != "" && !models.IsValidChannel(channel) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Unknown channel " + request.Channel + " (expected EMAIL or SMS)",
+		})
+		return
+	}
+
+	results, exists := nh.notificationService.Test(request.Group, channel)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Recipient group not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results,
+	})
+}
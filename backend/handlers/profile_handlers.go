@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProfileHandlers handles HTTP requests for device profiles
+type ProfileHandlers struct {
+	telemetryService *services.TelemetryService
+}
+
+// NewProfileHandlers creates new device profile handlers
+func NewProfileHandlers(telemetryService *services.TelemetryService) *ProfileHandlers {
+	return &ProfileHandlers{
+		telemetryService: telemetryService,
+	}
+}
+
+// GetProfiles returns all device profiles
+func (ph *ProfileHandlers) GetProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ph.telemetryService.GetProfiles(),
+	})
+}
+
+// GetProfile returns a device profile with its key schema, alarm rules and transport settings
+func (ph *ProfileHandlers) GetProfile(c *gin.Context) {
+	profile, exists := ph.telemetryService.GetProfile(c.Param("name"))
+	if !exists {
+		profileNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// GetProfileDevices returns the devices using a device profile
+func (ph *ProfileHandlers) GetProfileDevices(c *gin.Context) {
+	devices, exists := ph.telemetryService.GetProfileDevices(c.Param("name"))
+	if !exists {
+		profileNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    devices,
+	})
+}
+
+func profileNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Device profile not found",
+	})
+}
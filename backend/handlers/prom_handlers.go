@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/promql"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromHandlers serves a read-only subset of the Prometheus HTTP API so that
+// Grafana can use the backend as a Prometheus datasource. Telemetry keys are
+// metric names labelled with device, type and location.
+type PromHandlers struct {
+	telemetryService *services.TelemetryService
+}
+
+// NewPromHandlers creates new Prometheus API handlers
+func NewPromHandlers(telemetryService *services.TelemetryService) *PromHandlers {
+	return &PromHandlers{
+		telemetryService: telemetryService,
+	}
+}
+
+// QueryRange evaluates query between start and end at every step
+func (ph *PromHandlers) QueryRange(c *gin.Context) {
+	expr, ok := ph.parseQuery(c)
+	if !ok {
+		return
+	}
+	start, err := parsePromTime(c.Request.FormValue("start"), time.Time{})
+	if err != nil {
+		promError(c, "invalid parameter \"start\": "+err.Error())
+		return
+	}
+	end, err := parsePromTime(c.Request.FormValue("end"), time.Time{})
+	if err != nil {
+		promError(c, "invalid parameter \"end\": "+err.Error())
+		return
+	}
+	step, err := parsePromDuration(c.Request.FormValue("step"))
+	if err != nil {
+		promError(c, "invalid parameter \"step\": "+err.Error())
+		return
+	}
+	if step < time.Millisecond {
+		promError(c, "invalid parameter \"step\": must be at least 1ms")
+		return
+	}
+
+	data, err := ph.telemetryService.PromQueryRange(expr, start, end, step)
+	if err != nil {
+		promError(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, models.PromResponse{Status: "success", Data: data})
+}
+
+// Query evaluates query at a single time (default now)
+func (ph *PromHandlers) Query(c *gin.Context) {
+	expr, ok := ph.parseQuery(c)
+	if !ok {
+		return
+	}
+	at, err := parsePromTime(c.Request.FormValue("time"), time.Now())
+	if err != nil {
+		promError(c, "invalid parameter \"time\": "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, models.PromResponse{Status: "success", Data: ph.telemetryService.PromQuery(expr, at)})
+}
+
+// Series lists the label sets of series matching one or more match[] selectors
+func (ph *PromHandlers) Series(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		promError(c, err.Error())
+		return
+	}
+	matches := c.Request.Form["match[]"]
+	if len(matches) == 0 {
+		promError(c, "no match[] parameter provided")
+		return
+	}
+
+	selectors := make([][]*promql.Matcher, 0, len(matches))
+	for _, match := range matches {
+		matchers, err := promql.ParseSelector(match)
+		if err != nil {
+			promError(c, err.Error())
+			return
+		}
+		selectors = append(selectors, matchers)
+	}
+
+	start, err := parsePromTime(c.Request.FormValue("start"), time.UnixMilli(0))
+	if err != nil {
+		promError(c, "invalid parameter \"start\": "+err.Error())
+		return
+	}
+	end, err := parsePromTime(c.Request.FormValue("end"), time.Now())
+	if err != nil {
+		promError(c, "invalid parameter \"end\": "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PromResponse{Status: "success", Data: ph.telemetryService.PromSeries(selectors, start, end)})
+}
+
+// Labels lists the label names
+func (ph *PromHandlers) Labels(c *gin.Context) {
+	c.JSON(http.StatusOK, models.PromResponse{Status: "success", Data: ph.telemetryService.PromLabelNames()})
+}
+
+// LabelValues lists the values of one label
+func (ph *PromHandlers) LabelValues(c *gin.Context) {
+	c.JSON(http.StatusOK, models.PromResponse{Status: "success", Data: ph.telemetryService.PromLabelValues(c.Param("name"))})
+}
+
+// parseQuery parses the query parameter, writing an error response on failure
+func (ph *PromHandlers) parseQuery(c *gin.Context) (promql.Expr, bool) {
+	text := c.Request.FormValue("query")
+	if text == "" {
+		promError(c, "missing parameter \"query\"")
+		return nil, false
+	}
+	expr, err := promql.ParseExpr(text)
+	if err != nil {
+		promError(c, err.Error())
+		return nil, false
+	}
+	return expr, true
+}
+
+// promError writes a Prometheus bad_data error
+func promError(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.PromResponse{
+		Status:    "error",
+		ErrorType: "bad_data",
+		Error:     message,
+	})
+}
+
+// parsePromTime accepts unix seconds (possibly fractional) or RFC 3339.
+// An empty value yields fallback, or an error if fallback is zero.
+func parsePromTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		if fallback.IsZero() {
+			return time.Time{}, fmt.Errorf("value is required")
+		}
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.UnixMilli(int64(math.Round(seconds * 1000))), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q to a valid timestamp", value)
+}
+
+// parsePromDuration accepts seconds (possibly fractional) or a duration such as 15s
+func parsePromDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, fmt.Errorf("value is required")
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		ns := seconds * float64(time.Second)
+		if math.IsNaN(ns) {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration", value)
+		}
+		if ns >= math.MaxInt64 || ns <= math.MinInt64 {
+			return 0, fmt.Errorf("cannot parse %q to a valid duration. It overflows int64", value)
+		}
+		return time.Duration(ns), nil
+	}
+	d, err := promql.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q to a valid duration", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestQueryRangeRejectsInvalidSteps(t *testing.T) {
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/query_range", NewPromHandlers(services.NewTelemetryService(cfg.Telemetry)).QueryRange)
+
+	tests := []struct {
+		step    string
+		wantErr string
+	}{
+		{"0.0001", "at least 1ms"},
+		{"0", "at least 1ms"},
+		{"-15", "at least 1ms"},
+		{"1e300", "overflows"},
+		{"NaN", "valid duration"},
+		{"0.001", "maximum resolution"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/query_range?query=temperature&start=0&end=3600&step="+tt.step, nil)
+			router.ServeHTTP(recorder, request)
+
+			var response models.PromResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding %q: %v", recorder.Body.String(), err)
+			}
+			if recorder.Code != http.StatusBadRequest || !strings.Contains(response.Error, tt.wantErr) {
+				t.Fatalf("got %d %q, want 400 with an error containing %q", recorder.Code, response.Error, tt.wantErr)
+			}
+		})
+	}
+}
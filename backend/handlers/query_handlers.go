@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/query"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryHandlers handles telemetry query language requests
+type QueryHandlers struct {
+	telemetryService *services.TelemetryService
+}
+
+// NewQueryHandlers creates new query handlers
+func NewQueryHandlers(telemetryService *services.TelemetryService) *QueryHandlers {
+	return &QueryHandlers{
+		telemetryService: telemetryService,
+	}
+}
+
+// RunQuery executes a query sent as JSON ({"query": "..."}) or as the q query parameter
+func (qh *QueryHandlers) RunQuery(c *gin.Context) {
+	var request models.QueryRequest
+	if c.Request.Method == http.MethodGet {
+		request.Query = c.Query("q")
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if request.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Query must not be empty",
+		})
+		return
+	}
+
+	response, err := qh.telemetryService.RunQuery(request.Query)
+	if err != nil {
+		var syntaxErr *query.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Syntax error at " + syntaxErr.Error(),
+				"pos":     syntaxErr.Pos,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RPCHandlers handles device RPC calls and connectivity queries
+type RPCHandlers struct {
+	rpcService          *services.RPCService
+	connectivityMonitor *services.ConnectivityMonitor
+}
+
+// NewRPCHandlers creates new RPC handlers
+func NewRPCHandlers(rpcService *services.RPCService, connectivityMonitor *services.ConnectivityMonitor) *RPCHandlers {
+	return &RPCHandlers{
+		rpcService:          rpcService,
+		connectivityMonitor: connectivityMonitor,
+	}
+}
+
+// CallDevice sends a two-way RPC to a device and returns its result. A
+// failed RPC is still a successful request; its status reports the failure.
+func (rh *RPCHandlers) CallDevice(c *gin.Context) {
+	var request models.RPCRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	result, exists := rh.rpcService.Call(c.Param("deviceId"), request)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Device not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetConnectivity returns the connectivity state of every device
+func (rh *RPCHandlers) GetConnectivity(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rh.connectivityMonitor.GetConnectivity(),
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// streamRetry is the reconnect delay suggested to EventSource clients
+const streamRetry = 3 * time.Second
+
+// StreamHandlers serves live updates as Server-Sent Events
+type StreamHandlers struct {
+	streamManager    *services.StreamManager
+	telemetryService *services.TelemetryService
+}
+
+// NewStreamHandlers creates new stream handlers
+func NewStreamHandlers(streamManager *services.StreamManager, telemetryService *services.TelemetryService) *StreamHandlers {
+	return &StreamHandlers{
+		streamManager:    streamManager,
+		telemetryService: telemetryService,
+	}
+}
+
+// Stream sends telemetry_update and alarm_update events as Server-Sent Events.
+// Query parameters: deviceId and keys (repeatable or comma separated). A
+// Last-Event-ID header (or lastEventId query parameter) replays the missed
+// events; when they are no longer buffered the latest telemetry of the
+// matching devices is sent as telemetry_data events instead.
+func (sh *StreamHandlers) Stream(c *gin.Context) {
+	filter := services.StreamFilter{
+		DeviceIDs: queryList(c, "deviceId"),
+		Keys:      queryList(c, "keys"),
+	}
+	for _, deviceID := range filter.DeviceIDs {
+		if !sh.telemetryService.HasSeries(deviceID) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Device not found: " + deviceID,
+			})
+			return
+		}
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var resumeFrom uint64
+	if lastEventID != "" {
+		var err error
+		if resumeFrom, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Last-Event-ID must be an event ID",
+			})
+			return
+		}
+	}
+
+	subscription, missed, resumed := sh.streamManager.Subscribe(filter, resumeFrom, lastEventID != "")
+	defer sh.streamManager.Unsubscribe(subscription)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+	if resumed {
+		for _, event := range missed {
+			if err := writeStreamEvent(w, event); err != nil {
+				return
+			}
+		}
+	} else if err := sh.writeSnapshot(w, filter); err != nil {
+		return
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(sh.streamManager.HeartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if subscription.ServerShutdown() {
+					return
+				}
+				// Too slow to keep up; the client reconnects with Last-Event-ID
+				logrus.Warn("Dropping slow stream client")
+				return
+			}
+			if err := writeStreamEvent(w, event); err != nil {
+				return
+			}
+			w.Flush()
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// writeSnapshot sends the latest telemetry of the requested devices, or of all
+// devices when no deviceId was given, without event IDs
+func (sh *StreamHandlers) writeSnapshot(w gin.ResponseWriter, filter services.StreamFilter) error {
+	deviceIDs := filter.DeviceIDs
+	if len(deviceIDs) == 0 {
+		for _, device := range sh.telemetryService.GetDevices() {
+			deviceIDs = append(deviceIDs, device.ID)
+		}
+	}
+
+	for _, deviceID := range deviceIDs {
+		latest, exists := sh.telemetryService.GetLatestTelemetry(deviceID)
+		if !exists {
+			continue
+		}
+		telemetryData := *latest
+		if len(filter.Keys) > 0 {
+			telemetryData.Values = make(map[string]interface{}, len(filter.Keys))
+			for _, key := range filter.Keys {
+				if value, ok := latest.Values[key]; ok {
+					telemetryData.Values[key] = value
+				}
+			}
+			if len(telemetryData.Values) == 0 {
+				continue
+			}
+		}
+		if err := writeStreamEvent(w, services.StreamEvent{Type: "telemetry_data", Payload: telemetryData}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStreamEvent writes one SSE event. Events without an ID (snapshots)
+// leave the client's last event ID unchanged.
+func writeStreamEvent(w gin.ResponseWriter, event services.StreamEvent) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+	if event.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
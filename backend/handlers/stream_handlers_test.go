@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestStreamEndsOnShutdown(t *testing.T) {
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	streamManager := services.NewStreamManager(cfg.Stream)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/stream", NewStreamHandlers(streamManager, services.NewTelemetryService(cfg.Telemetry)).Stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?deviceId=device_001")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	if line, err := body.ReadString('\n'); err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	} else if line != "retry: 3000\n" {
+		t.Fatalf("first line = %q", line)
+	}
+
+	// As in main: end the streams, then shut the HTTP server down
+	streamManager.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("server shutdown: %v", err)
+	}
+	if _, err := io.ReadAll(body); err != nil {
+		t.Errorf("stream did not end cleanly: %v", err)
+	}
+}
@@ -1,24 +1,35 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"thingsboard-widget-backend/models"
 	"thingsboard-widget-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Page size limits for entity history queries
+const (
+	defaultEntityHistoryLimit = 1000
+	maxEntityHistoryLimit     = 10000
 )
 
 // TelemetryHandlers handles HTTP requests for telemetry data
 type TelemetryHandlers struct {
 	telemetryService *services.TelemetryService
+	forecastService  *services.ForecastService
 }
 
 // NewTelemetryHandlers creates new telemetry handlers
-func NewTelemetryHandlers(telemetryService *services.TelemetryService) *TelemetryHandlers {
+func NewTelemetryHandlers(telemetryService *services.TelemetryService, forecastService *services.ForecastService) *TelemetryHandlers {
 	return &TelemetryHandlers{
 		telemetryService: telemetryService,
+		forecastService:  forecastService,
 	}
 }
 
@@ -52,7 +63,7 @@ func (th *TelemetryHandlers) GetDevice(c *gin.Context) {
 
 // GetLatestTelemetry returns the latest telemetry data for a device
 func (th *TelemetryHandlers) GetLatestTelemetry(c *gin.Context) {
-	deviceID := c.Param("id")
+	deviceID := c.Param("deviceId")
 	telemetryData, exists := th.telemetryService.GetLatestTelemetry(deviceID)
 
 	if !exists {
@@ -91,8 +102,27 @@ func (th *TelemetryHandlers) GetTimeSeriesData(c *gin.Context) {
 	if request.Interval == 0 {
 		request.Interval = 60000 // 1 minute default
 	}
+	if err := th.telemetryService.PrepareTimeSeriesQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if request.Forecast != nil {
+		if err := th.forecastService.PrepareForecast(request.Forecast); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
 
 	response := th.telemetryService.GetTimeSeriesData(request)
+	if request.Forecast != nil {
+		response.Forecasts = th.forecastService.Forecast(request.DeviceID, request.Keys, *request.Forecast)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -100,10 +130,39 @@ func (th *TelemetryHandlers) GetTimeSeriesData(c *gin.Context) {
 	})
 }
 
-// GetDeviceTelemetryKeys returns available telemetry keys for a device
+// GetBatchTimeSeriesData returns historical data for several devices and keys in one response
+func (th *TelemetryHandlers) GetBatchTimeSeriesData(c *gin.Context) {
+	var request models.BatchTimeSeriesRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if err := th.telemetryService.PrepareBatchQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	response := th.telemetryService.QueryTimeSeriesBatch(request)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// GetDeviceTelemetryKeys returns the keys of a device: those its profile
+// defines and those found in storage, with first/last seen timestamps
 func (th *TelemetryHandlers) GetDeviceTelemetryKeys(c *gin.Context) {
 	deviceID := c.Param("id")
-	device, exists := th.telemetryService.GetDevice(deviceID)
+	keys, exists := th.telemetryService.GetDeviceKeys(deviceID)
 
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -113,20 +172,15 @@ func (th *TelemetryHandlers) GetDeviceTelemetryKeys(c *gin.Context) {
 		return
 	}
 
-	// This would typically come from the telemetry service
-	// For now, return a mock response
-	keys := []models.TelemetryKey{
-		{Name: "temperature", Type: "numeric", Unit: "°C"},
-		{Name: "humidity", Type: "numeric", Unit: "%"},
-		{Name: "pressure", Type: "numeric", Unit: "hPa"},
+	// Virtual entities such as assets have keys but no device
+	data := gin.H{"keys": keys}
+	if device, exists := th.telemetryService.GetDevice(deviceID); exists {
+		data["device"] = device
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"device": device,
-			"keys":   keys,
-		},
+		"data":    data,
 	})
 }
 
@@ -142,23 +196,11 @@ func (th *TelemetryHandlers) GetSystemStatus(c *gin.Context) {
 	})
 }
 
-// GetTelemetryKeyMappings returns the mapping of telemetry keys to integer IDs
+// GetTelemetryKeyMappings returns the mapping of telemetry keys to integer IDs, sorted by ID
 func (th *TelemetryHandlers) GetTelemetryKeyMappings(c *gin.Context) {
-	keyMappings := th.telemetryService.GetKeyMappings()
-
-	// Convert to array format for easier frontend consumption
-	var mappings []models.TelemetryKeyMapping
-	for name, id := range keyMappings {
-		mappings = append(mappings, models.TelemetryKeyMapping{
-			ID:   id,
-			Name: name,
-			Type: "numeric", // Default type, could be enhanced
-		})
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    mappings,
+		"data":    th.telemetryService.GetTelemetryKeyMappings(),
 	})
 }
 
@@ -181,19 +223,49 @@ func (th *TelemetryHandlers) GetEntityMappings(c *gin.Context) {
 	})
 }
 
-// GetTelemetryEntityData returns telemetry data in the new entity format
+// GetTelemetryEntityData returns telemetry data in the new entity format.
+// The :id parameter is an entity UUID (a device ID is still accepted). Without
+// range parameters the latest snapshot is returned; with startTs, endTs or
+// cursor, a page of historical rows is returned. keys filters by integer key ID.
 func (th *TelemetryHandlers) GetTelemetryEntityData(c *gin.Context) {
-	deviceID := c.Param("id")
-	entityID, exists := th.telemetryService.GetEntityMappings()[deviceID]
+	id := c.Param("id")
+	var deviceID string
+	entityID, err := uuid.Parse(id)
+	if err == nil {
+		var exists bool
+		if deviceID, exists = th.telemetryService.GetDeviceByEntity(entityID); !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Entity not found",
+			})
+			return
+		}
+	} else {
+		var exists bool
+		deviceID = id
+		if entityID, exists = th.telemetryService.GetEntityMappings()[deviceID]; !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   "Entity mapping not found for device",
+			})
+			return
+		}
+	}
 
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
+	keyIDs, err := queryInts(c, "keys")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Entity mapping not found for device",
+			"error":   err.Error(),
 		})
 		return
 	}
 
+	if c.Query("startTs") != "" || c.Query("endTs") != "" || c.Query("cursor") != "" {
+		th.getEntityHistory(c, entityID, keyIDs)
+		return
+	}
+
 	telemetryData, exists := th.telemetryService.GetLatestTelemetry(deviceID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -206,29 +278,23 @@ func (th *TelemetryHandlers) GetTelemetryEntityData(c *gin.Context) {
 	// Convert to entity format
 	var entityTelemetry []models.Telemetry
 	keyMappings := th.telemetryService.GetKeyMappings()
+	wanted := make(map[int]bool, len(keyIDs))
+	for _, keyID := range keyIDs {
+		wanted[keyID] = true
+	}
 
 	for keyName, value := range telemetryData.Values {
 		if keyID, exists := keyMappings[keyName]; exists {
-			entity := models.Telemetry{
-				EntityID:  entityID,
-				Timestamp: telemetryData.Timestamp,
-				Key:       keyID,
+			if len(wanted) > 0 && !wanted[keyID] {
+				continue
 			}
-
-			// Set appropriate value field based on type
-			switch v := value.(type) {
-			case bool:
-				entity.BoolVal = &v
-			case int:
-				entity.IntVal = &v
-			case float64:
-				entity.DoubleVal = &v
-			case string:
-				entity.StringVal = &v
-			default:
-				// For complex types, use JSON
-				jsonStr := "{}" // Could be enhanced to serialize actual value
-				entity.JSONVal = &jsonStr
+			entity, err := models.NewTelemetryEntity(entityID, telemetryData.Timestamp, keyID, value)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"success": false,
+					"error":   err.Error(),
+				})
+				return
 			}
 
 			entityTelemetry = append(entityTelemetry, entity)
@@ -244,3 +310,65 @@ func (th *TelemetryHandlers) GetTelemetryEntityData(c *gin.Context) {
 		},
 	})
 }
+
+// getEntityHistory returns a page of historical entity rows
+func (th *TelemetryHandlers) getEntityHistory(c *gin.Context, entityID uuid.UUID, keyIDs []int) {
+	request := models.EntityHistoryRequest{
+		EntityID: entityID,
+		KeyIDs:   keyIDs,
+		Limit:    defaultEntityHistoryLimit,
+	}
+
+	var err error
+	if request.StartTs, err = queryInt64(c, "startTs"); err == nil {
+		request.EndTs, err = queryInt64(c, "endTs")
+	}
+	if err == nil && c.Query("limit") != "" {
+		request.Limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || request.Limit < 1 || request.Limit > maxEntityHistoryLimit {
+			err = fmt.Errorf("limit must be between 1 and %d", maxEntityHistoryLimit)
+		}
+	}
+	if err == nil && c.Query("cursor") != "" {
+		var cursor models.EntityCursor
+		cursor, err = models.ParseEntityCursor(c.Query("cursor"))
+		request.Cursor = &cursor
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+	if request.EndTs == 0 {
+		request.EndTs = time.Now().UnixMilli()
+	}
+
+	page, err := th.telemetryService.GetEntityHistory(request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    page,
+	})
+}
+
+// queryInts reads a repeatable, comma-separated list of integers
+func queryInts(c *gin.Context, name string) ([]int, error) {
+	var values []int
+	for _, raw := range queryList(c, name) {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must contain integer IDs, got %q", name, raw)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandlers handles HTTP requests for webhook targets and deliveries
+type WebhookHandlers struct {
+	webhookService *services.WebhookService
+}
+
+// NewWebhookHandlers creates new webhook handlers
+func NewWebhookHandlers(webhookService *services.WebhookService) *WebhookHandlers {
+	return &WebhookHandlers{
+		webhookService: webhookService,
+	}
+}
+
+// GetTargets returns the configured webhook targets without their secrets
+func (wh *WebhookHandlers) GetTargets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    wh.webhookService.GetTargets(),
+	})
+}
+
+// TestTarget queues a TEST event for a target and returns its delivery ID
+func (wh *WebhookHandlers) TestTarget(c *gin.Context) {
+	deliveryID, exists := wh.webhookService.Test(c.Param("name"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Webhook target not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    gin.H{"deliveryId": deliveryID},
+	})
+}
+
+// GetDeliveries returns the delivery log, optionally filtered by target,
+// status and deliveryId query parameters
+func (wh *WebhookHandlers) GetDeliveries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    wh.webhookService.GetDeliveries(c.Query("target"), c.Query("status"), c.Query("deliveryId")),
+	})
+}
+
+// GetDeadLetters returns the deliveries that failed every attempt, optionally filtered by target
+func (wh *WebhookHandlers) GetDeadLetters(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    wh.webhookService.GetDeadLetters(c.Query("target")),
+	})
+}
+
+// RetryDeadLetter delivers a dead letter again
+func (wh *WebhookHandlers) RetryDeadLetter(c *gin.Context) {
+	exists, err := wh.webhookService.RetryDeadLetter(c.Param("id"))
+	if !exists {
+		deadLetterNotFound(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+	})
+}
+
+// DeleteDeadLetter discards a dead letter
+func (wh *WebhookHandlers) DeleteDeadLetter(c *gin.Context) {
+	if !wh.webhookService.DeleteDeadLetter(c.Param("id")) {
+		deadLetterNotFound(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+func deadLetterNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"success": false,
+		"error":   "Dead letter not found",
+	})
+}
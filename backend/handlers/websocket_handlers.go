@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"thingsboard-widget-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocketHandlers handles HTTP requests about WebSocket connections
+type WebSocketHandlers struct {
+	websocketManager *services.WebSocketManager
+}
+
+// NewWebSocketHandlers creates new WebSocket handlers
+func NewWebSocketHandlers(websocketManager *services.WebSocketManager) *WebSocketHandlers {
+	return &WebSocketHandlers{
+		websocketManager: websocketManager,
+	}
+}
+
+// GetMetrics returns WebSocket connection lifecycle and traffic metrics
+func (wh *WebSocketHandlers) GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    wh.websocketManager.GetMetrics(),
+	})
+}
@@ -7,7 +7,11 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // embed the timezone database for export formatting
 
+	"thingsboard-widget-backend/cli"
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/middleware"
 	"thingsboard-widget-backend/routes"
 	"thingsboard-widget-backend/services"
 
@@ -17,74 +21,145 @@ import (
 )
 
 func main() {
-	// Load configuration
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AutomaticEnv()
-
-	// Set default values
-	viper.SetDefault("server.port", 8080)
-	viper.SetDefault("server.host", "localhost")
-	viper.SetDefault("cors.enabled", true)
-	viper.SetDefault("websocket.enabled", true)
-
-	// Read config file
-	if err := viper.ReadInConfig(); err != nil {
-		logrus.Warn("No config file found, using defaults")
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := cli.RunImport(os.Args[2:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	// Load and validate configuration
+	configManager := config.NewManager(viper.GetViper())
+	cfg, err := configManager.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Initialize logger
-	logrus.SetFormatter(&logrus.JSONFormatter{})
-	logrus.SetLevel(logrus.InfoLevel)
+	cfg.Logging.Apply()
 
 	// Create router
 	router := gin.Default()
 
 	// CORS middleware
-	if viper.GetBool("cors.enabled") {
-		router.Use(func(c *gin.Context) {
-			c.Header("Access-Control-Allow-Origin", "*")
-			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-
-			if c.Request.Method == "OPTIONS" {
-				c.AbortWithStatus(204)
-				return
-			}
-
-			c.Next()
-		})
+	cors := middleware.NewCORS(cfg.CORS.AllowedOrigins)
+	if cfg.CORS.Enabled {
+		router.Use(cors.Handler())
 	}
 
 	// Initialize services
-	telemetryService := services.NewTelemetryService()
-	websocketManager := services.NewWebSocketManager(telemetryService)
+	telemetryService := services.NewTelemetryService(cfg.Telemetry)
+	alarmService := services.NewAlarmService(cfg.AlarmRules())
+	telemetryService.AddListener(alarmService)
+
+	// Score live telemetry; scores are recorded as telemetry the alarm rules see
+	anomalyService := services.NewAnomalyService(telemetryService, cfg.Anomalies)
+	telemetryService.AddEnricher(anomalyService)
 
-	// Set WebSocket manager in telemetry service for broadcasting
-	telemetryService.SetBroadcaster(websocketManager)
+	assetService, err := services.NewAssetService(telemetryService, cfg.Assets)
+	if err != nil {
+		logrus.Fatalf("Failed to load assets: %v", err)
+	}
+	telemetryService.AddListener(assetService)
+	aliasResolver := services.NewEntityAliasResolver(telemetryService)
+	aliasResolver.SetRelationQuerier(assetService)
+	dashboardService, err := services.NewDashboardService(telemetryService, aliasResolver, cfg.Dashboards)
+	if err != nil {
+		logrus.Fatalf("Failed to load dashboards: %v", err)
+	}
+
+	connectivityMonitor := services.NewConnectivityMonitor(telemetryService, cfg.Connectivity)
+	telemetryService.AddListener(connectivityMonitor)
+	rpcService := services.NewRPCService(telemetryService)
+	forecastService := services.NewForecastService(telemetryService, cfg.Forecasting)
+
+	// Post alarms, connectivity changes and RPC results to webhook targets
+	webhookService := services.NewWebhookService(cfg.Webhooks)
+	alarmService.AddBroadcaster(webhookService)
+	connectivityMonitor.AddListener(webhookService)
+	rpcService.AddListener(webhookService)
+	anomalyService.AddListener(webhookService)
+
+	// Email and text recipient groups about alarms, escalating until acknowledged
+	notificationService := services.NewNotificationService(cfg.Notifications)
+	alarmService.AddBroadcaster(notificationService)
+
+	var websocketManager *services.WebSocketManager
+	if cfg.WebSocket.Enabled {
+		websocketManager = services.NewWebSocketManager(telemetryService, alarmService, cfg.WebSocket)
+		if cfg.CORS.Enabled {
+			websocketManager.SetOriginChecker(cors.CheckOrigin)
+		}
+
+		// Set WebSocket manager in telemetry and alarm services for broadcasting
+		telemetryService.AddBroadcaster(websocketManager)
+		alarmService.AddBroadcaster(websocketManager)
+	}
+
+	var streamManager *services.StreamManager
+	if cfg.Stream.Enabled {
+		streamManager = services.NewStreamManager(cfg.Stream)
+		telemetryService.AddBroadcaster(streamManager)
+		alarmService.AddBroadcaster(streamManager)
+	}
 
 	// Setup routes
-	routes.SetupRoutes(router, telemetryService, websocketManager)
+	routes.SetupRoutes(router, routes.Services{
+		TelemetryService:    telemetryService,
+		WebSocketManager:    websocketManager,
+		StreamManager:       streamManager,
+		AlarmService:        alarmService,
+		DashboardService:    dashboardService,
+		AliasResolver:       aliasResolver,
+		AssetService:        assetService,
+		RPCService:          rpcService,
+		ConnectivityMonitor: connectivityMonitor,
+		WebhookService:      webhookService,
+		NotificationService: notificationService,
+		AnomalyService:      anomalyService,
+		ForecastService:     forecastService,
+	})
+
+	// Apply safe settings on configuration change
+	configManager.OnReload(func(previous, current *config.Config) {
+		current.Logging.Apply()
+		telemetryService.SetSimulationInterval(current.Telemetry.SimulationInterval)
+		telemetryService.SetRetention(current.Telemetry.Retention)
+		cors.SetAllowedOrigins(current.CORS.AllowedOrigins)
+		telemetryService.SetProfiles(current.Telemetry.Profiles)
+		alarmService.SetRules(current.AlarmRules())
+		connectivityMonitor.SetInactivityTimeout(current.Connectivity.InactivityTimeout)
+		webhookService.SetTargets(current.Webhooks.Targets)
+		notificationService.SetConfig(current.Notifications)
+		anomalyService.SetConfig(current.Anomalies)
+		forecastService.SetConfig(current.Forecasting)
+	})
+	configManager.Watch()
 
 	// Start WebSocket manager
-	if viper.GetBool("websocket.enabled") {
+	if websocketManager != nil {
 		go websocketManager.Start()
 	}
 
 	// Start telemetry simulation
 	go telemetryService.StartSimulation()
 
+	// Start webhook delivery, connectivity tracking and alarm escalation
+	webhookService.Start()
+	go connectivityMonitor.Start()
+	go notificationService.Start()
+
 	// Create server
-	port := viper.GetString("server.port")
+	addr := cfg.Server.Addr()
 	server := &http.Server{
-		Addr:    ":" + port,
+		Addr:    addr,
 		Handler: router,
 	}
 
 	// Start server in goroutine
 	go func() {
-		logrus.Infof("Starting server on port %s", port)
+		logrus.Infof("Starting server on %s", addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logrus.Fatalf("Failed to start server: %v", err)
 		}
@@ -100,6 +175,14 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if websocketManager != nil {
+		websocketManager.Shutdown()
+	}
+	if streamManager != nil {
+		streamManager.Shutdown()
+	}
+	connectivityMonitor.Stop()
+	notificationService.Stop()
 	if err := server.Shutdown(ctx); err != nil {
 		logrus.Fatal("Server forced to shutdown:", err)
 	}
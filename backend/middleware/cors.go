@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS is a cross-origin middleware whose allowed origins can be changed at runtime
+type CORS struct {
+	origins  map[string]bool
+	allowAll bool
+	mutex    sync.RWMutex
+}
+
+// NewCORS creates a CORS middleware for the given origins ("*" allows any origin)
+func NewCORS(origins []string) *CORS {
+	cors := &CORS{}
+	cors.SetAllowedOrigins(origins)
+	return cors
+}
+
+// SetAllowedOrigins replaces the allowed origin list
+func (co *CORS) SetAllowedOrigins(origins []string) {
+	allowed := make(map[string]bool, len(origins))
+	allowAll := false
+	for _, origin := range origins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+
+	co.mutex.Lock()
+	co.origins = allowed
+	co.allowAll = allowAll
+	co.mutex.Unlock()
+}
+
+// IsAllowed reports whether requests from the origin are permitted.
+// Requests without an Origin header are always allowed.
+func (co *CORS) IsAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+
+	co.mutex.RLock()
+	defer co.mutex.RUnlock()
+	return co.allowAll || co.origins[origin]
+}
+
+// CheckOrigin can be used as a websocket.Upgrader origin check
+func (co *CORS) CheckOrigin(r *http.Request) bool {
+	return co.IsAllowed(r.Header.Get("Origin"))
+}
+
+// Handler returns the gin middleware
+func (co *CORS) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+
+		co.mutex.RLock()
+		allowAll := co.allowAll
+		co.mutex.RUnlock()
+
+		if allowAll {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && co.IsAllowed(origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	}
+}
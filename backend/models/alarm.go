@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+// Alarm conditions supported by alarm rules
+const (
+	AlarmConditionGreater      = "gt"
+	AlarmConditionGreaterEqual = "gte"
+	AlarmConditionLess         = "lt"
+	AlarmConditionLessEqual    = "lte"
+	AlarmConditionEqual        = "eq"
+	AlarmConditionNotEqual     = "neq"
+)
+
+// Alarm severities, matching ThingsBoard naming
+const (
+	AlarmSeverityCritical      = "CRITICAL"
+	AlarmSeverityMajor         = "MAJOR"
+	AlarmSeverityMinor         = "MINOR"
+	AlarmSeverityWarning       = "WARNING"
+	AlarmSeverityIndeterminate = "INDETERMINATE"
+)
+
+// Alarm statuses, matching ThingsBoard naming
+const (
+	AlarmStatusActiveUnack  = "ACTIVE_UNACK"
+	AlarmStatusActiveAck    = "ACTIVE_ACK"
+	AlarmStatusClearedUnack = "CLEARED_UNACK"
+	AlarmStatusClearedAck   = "CLEARED_ACK"
+)
+
+// AlarmRule describes a threshold rule evaluated against incoming telemetry
+type AlarmRule struct {
+	Name       string  `mapstructure:"name" json:"name"`
+	DeviceID   string  `mapstructure:"device_id" json:"deviceId,omitempty"`
+	DeviceType string  `mapstructure:"device_type" json:"deviceType,omitempty"`
+	Profile    string  `mapstructure:"profile" json:"profile,omitempty"` // only devices using this device profile
+	Key        string  `mapstructure:"key" json:"key"`
+	Condition  string  `mapstructure:"condition" json:"condition"`
+	Threshold  float64 `mapstructure:"threshold" json:"threshold"`
+	Severity   string  `mapstructure:"severity" json:"severity"`
+}
+
+// Alarm represents an alarm raised by a rule for a device
+type Alarm struct {
+	ID         string     `json:"id"`
+	RuleName   string     `json:"ruleName"`
+	DeviceID   string     `json:"deviceId"`
+	DeviceName string     `json:"deviceName"`
+	Key        string     `json:"key"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	Condition  string     `json:"condition"`
+	Severity   string     `json:"severity"`
+	Status     string     `json:"status"`
+	StartTs    time.Time  `json:"startTs"`
+	EndTs      *time.Time `json:"endTs,omitempty"`
+	AckTs      *time.Time `json:"ackTs,omitempty"`
+}
+
+// IsActive reports whether the alarm has not been cleared
+func (a *Alarm) IsActive() bool {
+	return a.Status == AlarmStatusActiveUnack || a.Status == AlarmStatusActiveAck
+}
+
+// IsAcknowledged reports whether the alarm has been acknowledged
+func (a *Alarm) IsAcknowledged() bool {
+	return a.Status == AlarmStatusActiveAck || a.Status == AlarmStatusClearedAck
+}
+
+// IsValidAlarmCondition reports whether the condition is supported
+func IsValidAlarmCondition(condition string) bool {
+	switch condition {
+	case AlarmConditionGreater, AlarmConditionGreaterEqual, AlarmConditionLess,
+		AlarmConditionLessEqual, AlarmConditionEqual, AlarmConditionNotEqual:
+		return true
+	}
+	return false
+}
+
+// IsValidAlarmSeverity reports whether the severity is supported
+func IsValidAlarmSeverity(severity string) bool {
+	switch severity {
+	case AlarmSeverityCritical, AlarmSeverityMajor, AlarmSeverityMinor,
+		AlarmSeverityWarning, AlarmSeverityIndeterminate:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Anomaly detection methods
+const (
+	AnomalyMethodZScore   = "zscore"   // distance from the mean of the last Window readings
+	AnomalyMethodSeasonal = "seasonal" // distance from the baseline of the same hour of day
+	AnomalyMethodEWMA     = "ewma"     // distance from an exponentially weighted moving average
+)
+
+// Anomaly directions relative to the expected value
+const (
+	AnomalyDirectionHigh = "HIGH"
+	AnomalyDirectionLow  = "LOW"
+)
+
+// IsValidAnomalyMethod reports whether an anomaly detection method is supported
+func IsValidAnomalyMethod(method string) bool {
+	switch method {
+	case AnomalyMethodZScore, AnomalyMethodSeasonal, AnomalyMethodEWMA:
+		return true
+	}
+	return false
+}
+
+// AnomalyDetector scores every reading of a key against what is expected for
+// it. The score is the distance from the expected value in standard
+// deviations; readings scoring at least Threshold are anomalous.
+type AnomalyDetector struct {
+	Name          string  `mapstructure:"name" json:"name"`
+	DeviceID      string  `mapstructure:"device_id" json:"deviceId,omitempty"`
+	DeviceType    string  `mapstructure:"device_type" json:"deviceType,omitempty"`
+	Profile       string  `mapstructure:"profile" json:"profile,omitempty"`
+	Key           string  `mapstructure:"key" json:"key"`
+	Method        string  `mapstructure:"method" json:"method"`
+	Window        int     `mapstructure:"window" json:"window,omitempty"` // zscore: readings in the rolling window; seasonal: readings remembered per hour
+	Alpha         float64 `mapstructure:"alpha" json:"alpha,omitempty"`   // ewma: weight of the newest reading
+	Threshold     float64 `mapstructure:"threshold" json:"threshold"`
+	MinSamples    int     `mapstructure:"min_samples" json:"minSamples"`                 // readings needed before scoring (per hour for seasonal)
+	ScoreKey      string  `mapstructure:"score_key" json:"scoreKey"`                     // telemetry key the score is recorded under
+	AlarmSeverity string  `mapstructure:"alarm_severity" json:"alarmSeverity,omitempty"` // raise an alarm named after the detector while anomalous
+}
+
+// AlarmRule returns the alarm rule raising the detector's alarm, if it has one
+func (ad *AnomalyDetector) AlarmRule() (AlarmRule, bool) {
+	if ad.AlarmSeverity == "" {
+		return AlarmRule{}, false
+	}
+	return AlarmRule{
+		Name:       ad.Name,
+		DeviceID:   ad.DeviceID,
+		DeviceType: ad.DeviceType,
+		Profile:    ad.Profile,
+		Key:        ad.ScoreKey,
+		Condition:  AlarmConditionGreaterEqual,
+		Threshold:  ad.Threshold,
+		Severity:   ad.AlarmSeverity,
+	}, true
+}
+
+// AnomalyEvent is raised when a key's readings become anomalous
+type AnomalyEvent struct {
+	ID         string    `json:"id"`
+	Detector   string    `json:"detector"`
+	Method     string    `json:"method"`
+	DeviceID   string    `json:"deviceId"`
+	DeviceName string    `json:"deviceName"`
+	Key        string    `json:"key"`
+	Value      float64   `json:"value"`
+	Expected   float64   `json:"expected"`
+	StdDev     float64   `json:"stdDev"`
+	Score      float64   `json:"score"`
+	Threshold  float64   `json:"threshold"`
+	Direction  string    `json:"direction"` // HIGH or LOW
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// AnomalyDetectorState is a detector's baseline for one device
+type AnomalyDetectorState struct {
+	DeviceID  string     `json:"deviceId"`
+	Samples   int        `json:"samples"` // readings seen, including those replayed from history
+	Ready     bool       `json:"ready"`   // enough readings to score the next one
+	Expected  *float64   `json:"expected,omitempty"`
+	StdDev    *float64   `json:"stdDev,omitempty"`
+	LastScore *float64   `json:"lastScore,omitempty"`
+	Anomalous bool       `json:"anomalous"`
+	LastTs    *time.Time `json:"lastTs,omitempty"`
+}
+
+// AnomalyDetectorStatus is a detector with its per-device baselines
+type AnomalyDetectorStatus struct {
+	AnomalyDetector
+	Devices []AnomalyDetectorState `json:"devices"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// Asset types, from the largest to the smallest part of a site
+const (
+	AssetTypeSite     = "site"
+	AssetTypeBuilding = "building"
+	AssetTypeFloor    = "floor"
+	AssetTypeRoom     = "room"
+	AssetTypePanel    = "panel"
+)
+
+// Relation types between assets and devices
+const (
+	RelationContains  = "Contains"  // from contains to, e.g. building Contains floor
+	RelationManages   = "Manages"   // from is responsible for to, e.g. a panel Manages a pump
+	RelationFeedsFrom = "FeedsFrom" // from is supplied by to, e.g. a meter FeedsFrom a panel
+)
+
+// Asset is a physical or logical grouping of devices, such as a building or an electrical panel
+type Asset struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Type        string        `json:"type"` // site, building, floor, room, panel
+	Label       string        `json:"label,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Series      []AssetSeries `json:"series,omitempty"` // virtual series aggregated from the devices below
+	CreatedTime time.Time     `json:"createdTime"`
+}
+
+// AssetSeries is a virtual asset key aggregating a device key over the devices
+// below the asset, e.g. total_power as the SUM of every meter's power
+type AssetSeries struct {
+	Key          string `json:"key"`                    // key of the asset series
+	SourceKey    string `json:"sourceKey"`              // device key that is aggregated
+	Agg          string `json:"agg"`                    // SUM, AVG, MIN, MAX or COUNT
+	RelationType string `json:"relationType,omitempty"` // relations followed to find the devices, Contains by default
+}
+
+// EntityRelation is a typed, directed relation between two entities
+type EntityRelation struct {
+	From        EntityID  `json:"from"`
+	To          EntityID  `json:"to"`
+	Type        string    `json:"type"` // Contains, Manages, FeedsFrom
+	CreatedTime time.Time `json:"createdTime"`
+}
+
+// RelationsQuery walks the relation graph from a root entity
+type RelationsQuery struct {
+	RootEntity         EntityID                   `json:"rootEntity"`
+	Direction          string                     `json:"direction"`          // FROM walks down (root is the from side), TO walks up
+	MaxLevel           int                        `json:"maxLevel,omitempty"` // 0 means unlimited
+	FetchLastLevelOnly bool                       `json:"fetchLastLevelOnly,omitempty"`
+	Filters            []RelationEntityTypeFilter `json:"filters,omitempty"` // relation types followed and entity types returned
+}
+
+// RelatedEntity is an entity found by a relation query
+type RelatedEntity struct {
+	Entity   EntityID       `json:"entity"`
+	Name     string         `json:"name"`
+	Type     string         `json:"type"` // asset or device type
+	Level    int            `json:"level"`
+	Relation EntityRelation `json:"relation"` // the relation the entity was reached through
+}
+
+// AssetKeyRollup aggregates one key's latest values over an asset's devices
+type AssetKeyRollup struct {
+	Sum   float64 `json:"sum"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"` // devices reporting the key
+}
+
+// AssetRollup aggregates the latest telemetry of the devices below an asset
+type AssetRollup struct {
+	AssetID   string                    `json:"assetId"`
+	DeviceIDs []string                  `json:"deviceIds"`
+	Timestamp time.Time                 `json:"timestamp"` // newest reading included
+	Values    map[string]AssetKeyRollup `json:"values"`
+}
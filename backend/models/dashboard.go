@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Datasource types supported by dashboard widgets
+const (
+	DatasourceTypeEntity = "entity" // devices resolved through an entity alias
+	DatasourceTypeDevice = "device" // a single device referenced by ID
+)
+
+// Dashboard is a stored dashboard definition: widgets with their datasources,
+// the layouts they are placed in, and the entity aliases the datasources use
+type Dashboard struct {
+	ID                string                    `json:"id"`
+	Title             string                    `json:"title"`
+	Description       string                    `json:"description,omitempty"`
+	Version           int                       `json:"version"` // incremented on every change
+	Widgets           []DashboardWidget         `json:"widgets"`
+	States            map[string]DashboardState `json:"states"` // state ID -> state, "default" is the root state
+	EntityAliases     []EntityAlias             `json:"entityAliases"`
+	Timewindow        json.RawMessage           `json:"timewindow,omitempty"`
+	Settings          json.RawMessage           `json:"settings,omitempty"`
+	AssignedCustomers []CustomerInfo            `json:"assignedCustomers"`
+	CreatedTime       time.Time                 `json:"createdTime"`
+	UpdatedTime       time.Time                 `json:"updatedTime"`
+}
+
+// DashboardWidget is a widget instance with its configuration
+type DashboardWidget struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type"`                  // timeseries, latest, rpc, static
+	TypeFullFqn string             `json:"typeFullFqn,omitempty"` // widget bundle reference, e.g. system.cards.value_card
+	Title       string             `json:"title,omitempty"`
+	Datasources []WidgetDatasource `json:"datasources"`
+	Config      json.RawMessage    `json:"config,omitempty"` // remaining widget settings, kept verbatim
+}
+
+// WidgetDatasource selects the entities and keys a widget displays
+type WidgetDatasource struct {
+	Type          string    `json:"type"`                    // entity or device
+	Name          string    `json:"name,omitempty"`          // display name
+	EntityAliasID string    `json:"entityAliasId,omitempty"` // entity datasources
+	DeviceID      string    `json:"deviceId,omitempty"`      // device datasources
+	DataKeys      []DataKey `json:"dataKeys"`
+}
+
+// DataKey is a telemetry key shown by a widget
+type DataKey struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"` // timeseries or attribute
+	Label    string          `json:"label,omitempty"`
+	Color    string          `json:"color,omitempty"`
+	Units    string          `json:"units,omitempty"`
+	Decimals *int            `json:"decimals,omitempty"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
+// DashboardState is a dashboard view with its layouts
+type DashboardState struct {
+	Name    string                     `json:"name"`
+	Root    bool                       `json:"root"`
+	Layouts map[string]DashboardLayout `json:"layouts"` // layout ID (main, right) -> layout
+}
+
+// DashboardLayout places widgets on a grid
+type DashboardLayout struct {
+	Widgets      map[string]WidgetPosition `json:"widgets"` // widget ID -> position
+	GridSettings json.RawMessage           `json:"gridSettings,omitempty"`
+}
+
+// WidgetPosition is a widget's cell and size on a layout grid
+type WidgetPosition struct {
+	SizeX int `json:"sizeX"`
+	SizeY int `json:"sizeY"`
+	Row   int `json:"row"`
+	Col   int `json:"col"`
+}
+
+// EntityAlias is a named entity selection shared by widget datasources
+type EntityAlias struct {
+	ID     string            `json:"id"`
+	Alias  string            `json:"alias"`
+	Filter EntityAliasFilter `json:"filter"`
+}
+
+// CustomerInfo identifies a customer a dashboard is assigned to
+type CustomerInfo struct {
+	CustomerID string `json:"customerId"`
+	Title      string `json:"title,omitempty"`
+}
+
+// DashboardInfo is the dashboard summary returned by list queries
+type DashboardInfo struct {
+	ID                string         `json:"id"`
+	Title             string         `json:"title"`
+	Version           int            `json:"version"`
+	WidgetCount       int            `json:"widgetCount"`
+	AssignedCustomers []CustomerInfo `json:"assignedCustomers"`
+	CreatedTime       time.Time      `json:"createdTime"`
+	UpdatedTime       time.Time      `json:"updatedTime"`
+}
+
+// DashboardVersionInfo describes a stored revision of a dashboard
+type DashboardVersionInfo struct {
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	UpdatedTime time.Time `json:"updatedTime"`
+}
+
+// Info returns the dashboard summary
+func (d *Dashboard) Info() DashboardInfo {
+	return DashboardInfo{
+		ID:                d.ID,
+		Title:             d.Title,
+		Version:           d.Version,
+		WidgetCount:       len(d.Widgets),
+		AssignedCustomers: d.AssignedCustomers,
+		CreatedTime:       d.CreatedTime,
+		UpdatedTime:       d.UpdatedTime,
+	}
+}
+
+// IsAssignedTo reports whether the dashboard is assigned to the customer
+func (d *Dashboard) IsAssignedTo(customerID string) bool {
+	for _, customer := range d.AssignedCustomers {
+		if customer.CustomerID == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+// ThingsBoardDashboard is the ThingsBoard dashboard export format
+type ThingsBoardDashboard struct {
+	Title             string                    `json:"title"`
+	Name              string                    `json:"name,omitempty"`
+	Configuration     ThingsBoardConfiguration  `json:"configuration"`
+	AssignedCustomers []ThingsBoardCustomerInfo `json:"assignedCustomers,omitempty"`
+}
+
+// ThingsBoardConfiguration is the configuration section of a ThingsBoard dashboard
+type ThingsBoardConfiguration struct {
+	Description   string                    `json:"description,omitempty"`
+	Widgets       json.RawMessage           `json:"widgets"` // widget ID -> widget, or a list in older exports
+	States        map[string]DashboardState `json:"states"`
+	EntityAliases map[string]EntityAlias    `json:"entityAliases"`
+	Timewindow    json.RawMessage           `json:"timewindow,omitempty"`
+	Settings      json.RawMessage           `json:"settings,omitempty"`
+}
+
+// ThingsBoardWidget is a widget in a ThingsBoard dashboard. Datasources and
+// the title are part of config.
+type ThingsBoardWidget struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	TypeFullFqn string          `json:"typeFullFqn,omitempty"`
+	Config      json.RawMessage `json:"config"`
+}
+
+// ThingsBoardCustomerInfo is a customer assignment in a ThingsBoard dashboard
+type ThingsBoardCustomerInfo struct {
+	CustomerID EntityID `json:"customerId"`
+	Title      string   `json:"title,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+// Transport types a device profile can declare, matching ThingsBoard naming
+const (
+	TransportDefault = "DEFAULT" // HTTP and the default MQTT topics
+	TransportMQTT    = "MQTT"
+	TransportCoAP    = "COAP"
+)
+
+// Payload types a device profile can declare
+const (
+	PayloadJSON     = "JSON"
+	PayloadProtobuf = "PROTOBUF"
+)
+
+// DeviceProfile owns the key schema, alarm rules and transport settings
+// shared by every device of one model. Devices reference a profile by name,
+// so two meter models can give the same key different units or ranges.
+type DeviceProfile struct {
+	Name        string            `mapstructure:"name" json:"name"`
+	Description string            `mapstructure:"description" json:"description,omitempty"`
+	Keys        []TelemetryKey    `mapstructure:"keys" json:"keys"`
+	AlarmRules  []AlarmRule       `mapstructure:"alarm_rules" json:"alarmRules,omitempty"` // apply only to devices using the profile
+	Transport   TransportSettings `mapstructure:"transport" json:"transport"`
+}
+
+// TransportSettings describes how devices of a profile report telemetry
+type TransportSettings struct {
+	Type            string `mapstructure:"type" json:"type"`                                  // DEFAULT, MQTT or COAP
+	PayloadType     string `mapstructure:"payload_type" json:"payloadType"`                   // JSON or PROTOBUF
+	TelemetryTopic  string `mapstructure:"telemetry_topic" json:"telemetryTopic,omitempty"`   // MQTT only
+	AttributesTopic string `mapstructure:"attributes_topic" json:"attributesTopic,omitempty"` // MQTT only
+}
+
+// Key returns the profile's definition of a telemetry key
+func (dp *DeviceProfile) Key(name string) (*TelemetryKey, bool) {
+	for i := range dp.Keys {
+		if dp.Keys[i].Name == name {
+			return &dp.Keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsValidKeyType reports whether a telemetry key type is supported
+func IsValidKeyType(keyType string) bool {
+	switch keyType {
+	case "numeric", "boolean", "string", "json":
+		return true
+	}
+	return false
+}
+
+// IsValidTransportType reports whether a transport type is supported
+func IsValidTransportType(transportType string) bool {
+	switch transportType {
+	case TransportDefault, TransportMQTT, TransportCoAP:
+		return true
+	}
+	return false
+}
+
+// IsValidPayloadType reports whether a payload type is supported
+func IsValidPayloadType(payloadType string) bool {
+	return payloadType == PayloadJSON || payloadType == PayloadProtobuf
+}
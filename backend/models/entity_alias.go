@@ -0,0 +1,75 @@
+package models
+
+// Entity alias filter types. All but location follow ThingsBoard's alias filters.
+const (
+	AliasFilterSingleEntity   = "singleEntity"   // one entity by ID
+	AliasFilterEntityList     = "entityList"     // a fixed list of entity IDs
+	AliasFilterEntityName     = "entityName"     // entities whose name starts with entityNameFilter
+	AliasFilterDeviceType     = "deviceType"     // devices of the listed types
+	AliasFilterLocation       = "location"       // devices at the listed locations
+	AliasFilterStateEntity    = "stateEntity"    // the entity the dashboard is opened for
+	AliasFilterRelationsQuery = "relationsQuery" // entities related to a root entity
+)
+
+// Entity types that can be referenced by aliases and relations
+const (
+	EntityTypeDevice   = "DEVICE"
+	EntityTypeAsset    = "ASSET"
+	EntityTypeCustomer = "CUSTOMER"
+)
+
+// Relation directions, seen from the root entity
+const (
+	RelationDirectionFrom = "FROM" // relations starting at the root, e.g. building Contains device
+	RelationDirectionTo   = "TO"   // relations ending at the root
+)
+
+// EntityID references an entity of a given type
+type EntityID struct {
+	EntityType string `json:"entityType"`
+	ID         string `json:"id"`
+}
+
+// EntityAliasFilter selects the devices an alias resolves to. Which fields
+// apply depends on Type.
+type EntityAliasFilter struct {
+	Type            string `json:"type"`
+	ResolveMultiple bool   `json:"resolveMultiple"` // false resolves to the first matching device only
+
+	SingleEntity     *EntityID `json:"singleEntity,omitempty"`     // singleEntity
+	EntityType       string    `json:"entityType,omitempty"`       // entityList, entityName
+	EntityList       []string  `json:"entityList,omitempty"`       // entityList
+	EntityNameFilter string    `json:"entityNameFilter,omitempty"` // entityName, case-insensitive prefix
+
+	DeviceType       string   `json:"deviceType,omitempty"`       // deviceType, single type form of older exports
+	DeviceTypes      []string `json:"deviceTypes,omitempty"`      // deviceType, location
+	DeviceNameFilter string   `json:"deviceNameFilter,omitempty"` // deviceType, location; case-insensitive prefix
+	Locations        []string `json:"locations,omitempty"`        // location, case-insensitive
+
+	RootStateEntity    bool                       `json:"rootStateEntity,omitempty"` // relationsQuery rooted at the state entity
+	RootEntity         *EntityID                  `json:"rootEntity,omitempty"`
+	Direction          string                     `json:"direction,omitempty"`
+	MaxLevel           int                        `json:"maxLevel,omitempty"` // 0 means unlimited
+	FetchLastLevelOnly bool                       `json:"fetchLastLevelOnly,omitempty"`
+	Filters            []RelationEntityTypeFilter `json:"filters,omitempty"`
+}
+
+// RelationEntityTypeFilter restricts a relation query to a relation type and target entity types
+type RelationEntityTypeFilter struct {
+	RelationType string   `json:"relationType,omitempty"` // empty matches any relation type
+	EntityTypes  []string `json:"entityTypes,omitempty"`  // empty matches any entity type
+}
+
+// AliasResolveRequest resolves an ad-hoc alias filter
+type AliasResolveRequest struct {
+	Filter      EntityAliasFilter `json:"filter"`
+	StateEntity *EntityID         `json:"stateEntity,omitempty"` // entity used by stateEntity and rootStateEntity filters
+}
+
+// ResolvedAlias is a dashboard alias with the devices it currently resolves to
+type ResolvedAlias struct {
+	AliasID string    `json:"aliasId"`
+	Alias   string    `json:"alias"`
+	Devices []*Device `json:"devices"`
+	Error   string    `json:"error,omitempty"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Device event types delivered to webhooks and notification channels
+const (
+	EventTypeAlarm        = "ALARM"        // an alarm was raised, changed, acknowledged or cleared
+	EventTypeConnectivity = "CONNECTIVITY" // a device became active or inactive
+	EventTypeRPC          = "RPC_RESULT"   // a device answered an RPC call
+	EventTypeAnomaly      = "ANOMALY"      // a key's readings became anomalous
+	EventTypeTest         = "TEST"         // sent on demand to check a target
+)
+
+// DeviceEvent is an event about a device. Exactly one of Alarm, Connectivity,
+// RPC and Anomaly is set, matching Type.
+type DeviceEvent struct {
+	ID           string             `json:"id"`
+	Type         string             `json:"type"`
+	Timestamp    time.Time          `json:"timestamp"`
+	DeviceID     string             `json:"deviceId,omitempty"`
+	DeviceName   string             `json:"deviceName,omitempty"`
+	Alarm        *Alarm             `json:"alarm,omitempty"`
+	Connectivity *ConnectivityEvent `json:"connectivity,omitempty"`
+	RPC          *RPCResult         `json:"rpc,omitempty"`
+	Anomaly      *AnomalyEvent      `json:"anomaly,omitempty"`
+}
+
+// IsValidEventType reports whether an event type can be subscribed to
+func IsValidEventType(eventType string) bool {
+	switch eventType {
+	case EventTypeAlarm, EventTypeConnectivity, EventTypeRPC, EventTypeAnomaly:
+		return true
+	}
+	return false
+}
+
+// ConnectivityEvent reports a device becoming active or inactive
+type ConnectivityEvent struct {
+	DeviceID       string    `json:"deviceId"`
+	DeviceName     string    `json:"deviceName"`
+	Active         bool      `json:"active"`
+	LastActivityTs time.Time `json:"lastActivityTs"` // latest reading before the change
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// DeviceConnectivity is the current connectivity state of a device
+type DeviceConnectivity struct {
+	DeviceID       string    `json:"deviceId"`
+	Active         bool      `json:"active"`
+	LastActivityTs time.Time `json:"lastActivityTs"`
+	Reporting      bool      `json:"reporting"` // false while reporting is disabled by RPC
+}
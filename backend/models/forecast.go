@@ -0,0 +1,38 @@
+package models
+
+// Forecasting methods
+const (
+	ForecastSeasonalNaive = "seasonal_naive" // repeats the latest season
+	ForecastHoltWinters   = "holt_winters"   // additive level, damped trend and seasonality
+)
+
+// IsValidForecastMethod reports whether a forecasting method is supported
+func IsValidForecastMethod(method string) bool {
+	return method == ForecastSeasonalNaive || method == ForecastHoltWinters
+}
+
+// ForecastOptions requests forecasts of a timeseries request's keys from
+// their latest reading on. Exactly one of Horizon and UntilTs is set.
+type ForecastOptions struct {
+	Method     string  `json:"method,omitempty"`     // holt_winters (default) or seasonal_naive
+	Horizon    int64   `json:"horizon,omitempty"`    // how far to forecast (ms)
+	UntilTs    int64   `json:"untilTs,omitempty"`    // forecast up to this timestamp, e.g. the end of the month
+	Interval   int64   `json:"interval,omitempty"`   // step in milliseconds, default 1 hour
+	Confidence float64 `json:"confidence,omitempty"` // probability covered by the bands, default from configuration
+}
+
+// Forecast is the forecast of one key. Data holds [timestamp, value, lower,
+// upper] per interval bucket, timestamped like aggregated history. Rate keys
+// forecast the bucket average; cumulative keys forecast the reading at the
+// end of the bucket, so the last point of a forecast until the end of the
+// month is the projected reading at that time.
+type Forecast struct {
+	Method     string       `json:"method"`
+	Interval   int64        `json:"interval"`
+	Season     int          `json:"season"` // steps per season; 1 when the history is too short for seasonality
+	Cumulative bool         `json:"cumulative"`
+	Confidence float64      `json:"confidence"`
+	Samples    int          `json:"samples"` // history buckets the model was fitted on
+	Data       SeriesPoints `json:"data"`
+	Error      string       `json:"error,omitempty"` // set when the key could not be forecast
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Import formats
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// Timestamp formats accepted by imports; any other value is used as a Go time layout
+const (
+	ImportTimestampEpochMs  = "epoch_ms"
+	ImportTimestampEpochSec = "epoch_s"
+	ImportTimestampRFC3339  = "rfc3339"
+)
+
+// ImportOptions describes how source columns map to devices, keys and timestamps.
+//
+// Wide files have one column per key: every column that is not the timestamp,
+// device or an ignored column becomes a key, renamed through Columns if mapped.
+// The device column is skipped even with a fixed DeviceID, and the "time"
+// column written by exports is skipped unless mapped.
+// Long files have one value per row: set KeyColumn and ValueColumn.
+type ImportOptions struct {
+	Format          string            `json:"format"`                    // csv or ndjson
+	DeviceID        string            `json:"deviceId,omitempty"`        // fixed device for every row
+	DeviceColumn    string            `json:"deviceColumn,omitempty"`    // column holding the device ID, defaults to "deviceId"
+	TimestampColumn string            `json:"timestampColumn,omitempty"` // defaults to "ts"
+	TimestampFormat string            `json:"timestampFormat,omitempty"` // epoch_ms (default), epoch_s, rfc3339 or a Go layout
+	Timezone        string            `json:"timezone,omitempty"`        // for layouts without an offset
+	KeyColumn       string            `json:"keyColumn,omitempty"`
+	ValueColumn     string            `json:"valueColumn,omitempty"`
+	Columns         map[string]string `json:"columns,omitempty"` // source column -> telemetry key
+	IgnoreColumns   []string          `json:"ignoreColumns,omitempty"`
+	DryRun          bool              `json:"dryRun,omitempty"` // validate without storing
+}
+
+// ImportRowError describes why a source row (or one of its values) was rejected
+type ImportRowError struct {
+	Row     int    `json:"row"` // 1-based CSV data row (header excluded) or NDJSON line
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportResult summarizes a bulk import
+type ImportResult struct {
+	RowsRead       int              `json:"rowsRead"`
+	RowsImported   int              `json:"rowsImported"`
+	RowsRejected   int              `json:"rowsRejected"`
+	PointsImported int              `json:"pointsImported"`
+	PointsEvicted  int              `json:"pointsEvicted"` // imported points already past raw retention, kept only as rollups
+	ErrorCount     int              `json:"errorCount"`
+	Errors         []ImportRowError `json:"errors"` // first errors only, see ErrorCount
+	DryRun         bool             `json:"dryRun"`
+}
+
+// QueryValues encodes the options as URL query parameters
+func (o ImportOptions) QueryValues() url.Values {
+	q := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	set("format", o.Format)
+	set("deviceId", o.DeviceID)
+	set("deviceColumn", o.DeviceColumn)
+	set("tsColumn", o.TimestampColumn)
+	set("tsFormat", o.TimestampFormat)
+	set("tz", o.Timezone)
+	set("keyColumn", o.KeyColumn)
+	set("valueColumn", o.ValueColumn)
+
+	if len(o.Columns) > 0 {
+		sources := make([]string, 0, len(o.Columns))
+		for source := range o.Columns {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		pairs := make([]string, 0, len(sources))
+		for _, source := range sources {
+			pairs = append(pairs, source+":"+o.Columns[source])
+		}
+		q.Set("columns", strings.Join(pairs, ","))
+	}
+	if len(o.IgnoreColumns) > 0 {
+		q.Set("ignoreColumns", strings.Join(o.IgnoreColumns, ","))
+	}
+	if o.DryRun {
+		q.Set("dryRun", "true")
+	}
+	return q
+}
+
+// ImportOptionsFromQuery decodes options encoded by QueryValues. The columns
+// parameter is a comma-separated list of source:key pairs.
+func ImportOptionsFromQuery(q url.Values) (ImportOptions, error) {
+	options := ImportOptions{
+		Format:          q.Get("format"),
+		DeviceID:        q.Get("deviceId"),
+		DeviceColumn:    q.Get("deviceColumn"),
+		TimestampColumn: q.Get("tsColumn"),
+		TimestampFormat: q.Get("tsFormat"),
+		Timezone:        q.Get("tz"),
+		KeyColumn:       q.Get("keyColumn"),
+		ValueColumn:     q.Get("valueColumn"),
+		DryRun:          q.Get("dryRun") == "true",
+	}
+
+	if raw := q.Get("columns"); raw != "" {
+		options.Columns = make(map[string]string)
+		for _, pair := range strings.Split(raw, ",") {
+			source, key, found := strings.Cut(pair, ":")
+			source, key = strings.TrimSpace(source), strings.TrimSpace(key)
+			if !found || source == "" || key == "" {
+				return options, fmt.Errorf("columns entry %q must be source:key", pair)
+			}
+			options.Columns[source] = key
+		}
+	}
+	if raw := q.Get("ignoreColumns"); raw != "" {
+		for _, column := range strings.Split(raw, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				options.IgnoreColumns = append(options.IgnoreColumns, column)
+			}
+		}
+	}
+	return options, nil
+}
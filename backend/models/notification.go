@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification channels
+const (
+	ChannelEmail = "EMAIL"
+	ChannelSMS   = "SMS"
+)
+
+// Notification outcomes recorded in the notification log
+const (
+	NotificationStatusSent        = "SENT"
+	NotificationStatusFailed      = "FAILED"
+	NotificationStatusQuietHours  = "QUIET_HOURS"  // suppressed, the group was in its quiet hours
+	NotificationStatusRateLimited = "RATE_LIMITED" // suppressed, the recipient reached the rate limit
+)
+
+// IsValidChannel reports whether a notification channel is supported
+func IsValidChannel(channel string) bool {
+	return channel == ChannelEmail || channel == ChannelSMS
+}
+
+// QuietHours is a daily window in which a recipient group is not notified,
+// except for the listed severities. The window may wrap past midnight.
+type QuietHours struct {
+	Start           string   `mapstructure:"start" json:"start"` // HH:MM
+	End             string   `mapstructure:"end" json:"end"`     // HH:MM
+	AllowSeverities []string `mapstructure:"allow_severities" json:"allowSeverities,omitempty"`
+}
+
+// RecipientGroup is a named set of email addresses and phone numbers
+type RecipientGroup struct {
+	Name       string      `mapstructure:"name" json:"name"`
+	Emails     []string    `mapstructure:"emails" json:"emails,omitempty"`
+	Phones     []string    `mapstructure:"phones" json:"phones,omitempty"` // E.164, e.g. +84901234567
+	QuietHours *QuietHours `mapstructure:"quiet_hours" json:"quietHours,omitempty"`
+}
+
+// EscalationStep notifies recipient groups once an alarm has stayed
+// unacknowledged for After since it was raised
+type EscalationStep struct {
+	After    time.Duration `mapstructure:"after" json:"-"`
+	Groups   []string      `mapstructure:"groups" json:"groups"`
+	Channels []string      `mapstructure:"channels" json:"channels"` // EMAIL, SMS
+}
+
+// MarshalJSON renders After as a Go duration string, e.g. "15m0s"
+func (es EscalationStep) MarshalJSON() ([]byte, error) {
+	type step EscalationStep
+	return json.Marshal(struct {
+		step
+		After string `json:"after"`
+	}{step(es), es.After.String()})
+}
+
+// NotificationPolicy is an escalation chain for the alarms it matches. An
+// alarm is escalated step by step until it is acknowledged or cleared.
+type NotificationPolicy struct {
+	Name          string           `mapstructure:"name" json:"name"`
+	Rules         []string         `mapstructure:"rules" json:"rules,omitempty"`           // alarm rule names, empty matches all
+	Severities    []string         `mapstructure:"severities" json:"severities,omitempty"` // empty matches all
+	Steps         []EscalationStep `mapstructure:"steps" json:"steps"`
+	NotifyOnClear bool             `mapstructure:"notify_on_clear" json:"notifyOnClear"` // tell the groups already notified when the alarm clears
+}
+
+// Matches reports whether the policy applies to an alarm
+func (np *NotificationPolicy) Matches(alarm Alarm) bool {
+	return matchesAny(np.Rules, alarm.RuleName) && matchesAny(np.Severities, alarm.Severity)
+}
+
+// matchesAny reports whether value is listed, treating an empty list as a wildcard
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is one message to one recipient in the notification log
+type Notification struct {
+	ID        string    `json:"id"`
+	AlarmID   string    `json:"alarmId,omitempty"`
+	Policy    string    `json:"policy,omitempty"`
+	Step      int       `json:"step"` // escalation step, starting at 1; 0 for clear notices and tests
+	Group     string    `json:"group"`
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Subject   string    `json:"subject,omitempty"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"` // SENT, FAILED, QUIET_HOURS or RATE_LIMITED
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Escalation is the progress of a policy's escalation chain for one alarm
+type Escalation struct {
+	AlarmID      string     `json:"alarmId"`
+	RuleName     string     `json:"ruleName"`
+	DeviceID     string     `json:"deviceId"`
+	Policy       string     `json:"policy"`
+	StartedAt    time.Time  `json:"startedAt"`
+	StepsDone    int        `json:"stepsDone"`
+	NextStepAt   *time.Time `json:"nextStepAt,omitempty"` // unset once every step has run or the alarm is acknowledged
+	Acknowledged bool       `json:"acknowledged"`         // escalation stopped; kept until the alarm clears for the clear notice
+}
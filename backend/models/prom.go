@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Prometheus HTTP API result types
+const (
+	PromResultMatrix = "matrix"
+	PromResultVector = "vector"
+	PromResultScalar = "scalar"
+)
+
+// PromResponse is the Prometheus HTTP API envelope expected by Grafana
+type PromResponse struct {
+	Status    string      `json:"status"` // success or error
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// PromQueryData is the data of a query or query_range response
+type PromQueryData struct {
+	ResultType string      `json:"resultType"`
+	Result     interface{} `json:"result"`
+}
+
+// PromSeries is one labelled series of a matrix or vector result
+type PromSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values []PromSample      `json:"values,omitempty"` // matrix
+	Value  *PromSample       `json:"value,omitempty"`  // vector
+}
+
+// PromSample is a sample encoded as [unix seconds, "value"]
+type PromSample struct {
+	Ts    int64 // milliseconds
+	Value float64
+}
+
+// MarshalJSON encodes the sample the way Prometheus does
+func (ps PromSample) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{
+		float64(ps.Ts) / 1000,
+		strconv.FormatFloat(ps.Value, 'f', -1, 64),
+	})
+}
@@ -0,0 +1,24 @@
+package models
+
+// QueryRequest represents a telemetry query language request
+type QueryRequest struct {
+	Query string `json:"query" binding:"required"`
+}
+
+// QueryResult holds the series of one group. Data uses the same
+// key -> [timestamp, value] layout as TimeSeriesResponse, keyed by the
+// selected expression, e.g. "avg(power)".
+type QueryResult struct {
+	Group     map[string]string      `json:"group"` // group-by attribute -> value
+	DeviceIDs []string               `json:"deviceIds"`
+	Data      map[string][][]float64 `json:"data"`
+}
+
+// QueryResponse represents the result of a telemetry query
+type QueryResponse struct {
+	Query    string        `json:"query"`
+	StartTs  int64         `json:"startTs"`
+	EndTs    int64         `json:"endTs"`
+	Interval int64         `json:"interval"` // bucket size in milliseconds
+	Results  []QueryResult `json:"results"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// RPC methods understood by the simulated devices
+const (
+	RPCMethodPing         = "ping"
+	RPCMethodGetTelemetry = "getTelemetry"
+	RPCMethodSetReporting = "setReporting" // params: {"enabled": bool}
+)
+
+// RPC result statuses, matching ThingsBoard naming
+const (
+	RPCStatusSuccessful = "SUCCESSFUL"
+	RPCStatusFailed     = "FAILED"
+)
+
+// RPCRequest is a two-way RPC call to a device
+type RPCRequest struct {
+	Method string                 `json:"method" binding:"required"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// RPCResult is a device's answer to an RPC call
+type RPCResult struct {
+	ID         string                 `json:"id"`
+	DeviceID   string                 `json:"deviceId"`
+	DeviceName string                 `json:"deviceName"`
+	Method     string                 `json:"method"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Status     string                 `json:"status"` // SUCCESSFUL or FAILED
+	Response   interface{}            `json:"response,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	RequestTs  time.Time              `json:"requestTs"`
+	ResponseTs time.Time              `json:"responseTs"`
+}
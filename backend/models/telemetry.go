@@ -1,6 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -26,52 +30,217 @@ type TelemetryData struct {
 	DeviceName string                 `json:"deviceName"`
 	DeviceType string                 `json:"deviceType"`
 	Location   string                 `json:"location"`
+	Profile    string                 `json:"profile,omitempty"` // device profile of the reporting device
 }
 
 // TimeSeriesRequest represents a request for historical telemetry data
 type TimeSeriesRequest struct {
-	DeviceID string   `json:"deviceId" binding:"required"`
-	Keys     []string `json:"keys" binding:"required"`
-	StartTs  int64    `json:"startTs"`
-	EndTs    int64    `json:"endTs"`
-	Interval int64    `json:"interval"` // in milliseconds
+	DeviceID   string           `json:"deviceId" binding:"required"`
+	Keys       []string         `json:"keys" binding:"required"`
+	StartTs    int64            `json:"startTs"`
+	EndTs      int64            `json:"endTs"`
+	Interval   int64            `json:"interval"`             // in milliseconds
+	Typed      bool             `json:"typed"`                // return Series with original value types instead of Data
+	Agg        string           `json:"agg,omitempty"`        // aggregate Data into interval buckets (AVG when only Fill is set)
+	Fill       string           `json:"fill,omitempty"`       // fill empty buckets: null, previous, linear or zero
+	StaleAfter int64            `json:"staleAfter,omitempty"` // report gaps without data longer than this (ms)
+	Forecast   *ForecastOptions `json:"forecast,omitempty"`   // also forecast the keys past their latest reading
 }
 
 // TimeSeriesResponse represents historical telemetry data response
 type TimeSeriesResponse struct {
-	DeviceID string                 `json:"deviceId"`
-	Data     map[string][][]float64 `json:"data"` // key -> [timestamp, value] pairs
+	DeviceID  string                       `json:"deviceId"`
+	Data      map[string]SeriesPoints      `json:"data"`                // key -> [timestamp, value] pairs, numeric and boolean keys only
+	Series    map[string][]TimeSeriesPoint `json:"series,omitempty"`    // key -> typed points, when Typed is requested
+	Types     map[string]string            `json:"types,omitempty"`     // key -> value type of its latest point, when Typed is requested
+	Gaps      map[string][]Gap             `json:"gaps,omitempty"`      // keys with periods without data longer than StaleAfter
+	Forecasts map[string]Forecast          `json:"forecasts,omitempty"` // key -> forecast series, when Forecast is requested
 }
 
-// WebSocketMessage represents a WebSocket message
+// SeriesPoints is a list of [timestamp, value] pairs. A NaN value marks a
+// bucket without data (null fill mode) and is encoded as JSON null.
+type SeriesPoints [][]float64
+
+// MarshalJSON encodes the points, writing NaN values as null
+func (sp SeriesPoints) MarshalJSON() ([]byte, error) {
+	if sp == nil {
+		return []byte("null"), nil
+	}
+	buf := make([]byte, 0, len(sp)*24+2)
+	buf = append(buf, '[')
+	for i, point := range sp {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, '[')
+		for j, value := range point {
+			if j > 0 {
+				buf = append(buf, ',')
+			}
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				buf = append(buf, "null"...)
+			} else {
+				buf = strconv.AppendFloat(buf, value, 'f', -1, 64)
+			}
+		}
+		buf = append(buf, ']')
+	}
+	return append(buf, ']'), nil
+}
+
+// Fill modes for empty interval buckets
+const (
+	FillNone     = ""         // omit empty buckets
+	FillNull     = "null"     // emit the bucket with a null value
+	FillPrevious = "previous" // repeat the previous value
+	FillLinear   = "linear"   // interpolate between the surrounding values
+	FillZero     = "zero"     // emit zero
+)
+
+// IsValidFill reports whether fill is a supported fill mode
+func IsValidFill(fill string) bool {
+	switch fill {
+	case FillNone, FillNull, FillPrevious, FillLinear, FillZero:
+		return true
+	}
+	return false
+}
+
+// Gap is a period in which a series had no data for longer than the
+// staleness threshold
+type Gap struct {
+	StartTs int64 `json:"startTs"`
+	EndTs   int64 `json:"endTs"`
+}
+
+// TimeSeriesPoint is a single typed telemetry point
+type TimeSeriesPoint struct {
+	Ts    int64       `json:"ts"`
+	Value interface{} `json:"value"`
+}
+
+// WebSocketMessage represents a WebSocket message. Broadcast updates carry a
+// monotonically increasing Seq that clients pass back in a resume command.
 type WebSocketMessage struct {
 	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
 	Payload interface{} `json:"payload"`
 }
 
+// TelemetryDelta is a telemetry update sent to WebSocket clients in delta mode.
+// Values holds only the keys that changed since the previous update for the
+// device; the device metadata is only set in the first update per device.
+type TelemetryDelta struct {
+	DeviceID   string                 `json:"deviceId"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Values     map[string]interface{} `json:"values"`
+	DeviceName string                 `json:"deviceName,omitempty"`
+	DeviceType string                 `json:"deviceType,omitempty"`
+	Location   string                 `json:"location,omitempty"`
+}
+
+// WebSocketSubscription is the payload of a WebSocket subscribe command. With
+// only DeviceID set the client receives the device's telemetry_update
+// messages; any other option produces subscription_update messages instead.
+type WebSocketSubscription struct {
+	SubscriptionID string   `json:"subscriptionId,omitempty"`
+	DeviceID       string   `json:"deviceId"`
+	Keys           []string `json:"keys,omitempty"`
+	MinInterval    int64    `json:"minInterval,omitempty"` // minimum time between updates (ms)
+	Window         int64    `json:"window,omitempty"`      // rolling aggregation window (ms)
+	Agg            string   `json:"agg,omitempty"`         // AVG (default), MIN, MAX or LAST over Window
+	OnChange       bool     `json:"onChange,omitempty"`    // only send keys whose value changed
+	Deadband       float64  `json:"deadband,omitempty"`    // numeric change needed to count as changed, implies OnChange
+}
+
+// SubscriptionUpdate is a telemetry update evaluated for a WebSocket subscription
+type SubscriptionUpdate struct {
+	SubscriptionID string                 `json:"subscriptionId"`
+	DeviceID       string                 `json:"deviceId"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Values         map[string]interface{} `json:"values"`
+}
+
+// WebSocketResume acknowledges a resume command after the missed broadcasts were replayed
+type WebSocketResume struct {
+	FromSeq  uint64 `json:"fromSeq"`
+	ToSeq    uint64 `json:"toSeq"`
+	Replayed int    `json:"replayed"`
+}
+
+// WebSocketMetrics reports WebSocket connection lifecycle and traffic counters
+type WebSocketMetrics struct {
+	ActiveConnections int                   `json:"activeConnections"`
+	TotalConnections  uint64                `json:"totalConnections"`
+	Disconnects       map[string]uint64     `json:"disconnects"` // reason -> count
+	MessagesSent      uint64                `json:"messagesSent"`
+	MessagesReceived  uint64                `json:"messagesReceived"`
+	BytesSent         uint64                `json:"bytesSent"`
+	PingsSent         uint64                `json:"pingsSent"`
+	WriteErrors       uint64                `json:"writeErrors"`
+	Clients           []WebSocketClientInfo `json:"clients"`
+}
+
+// WebSocketClientInfo describes a connected WebSocket client
+type WebSocketClientInfo struct {
+	ID               uint64    `json:"id"`
+	RemoteAddr       string    `json:"remoteAddr"`
+	Encoding         string    `json:"encoding"`
+	Delta            bool      `json:"delta"`
+	ConnectedAt      time.Time `json:"connectedAt"`
+	LastActivity     time.Time `json:"lastActivity"`
+	MessagesSent     uint64    `json:"messagesSent"`
+	MessagesReceived uint64    `json:"messagesReceived"`
+	BytesSent        uint64    `json:"bytesSent"`
+}
+
+// WebSocketSnapshot is the full state sent when missed broadcasts can no longer be replayed
+type WebSocketSnapshot struct {
+	Telemetry []TelemetryData `json:"telemetry"` // latest reading of every device
+	Alarms    []Alarm         `json:"alarms"`    // active alarms
+}
+
 // Device represents a device configuration
 type Device struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
 	Type     string `json:"type"`
 	Location string `json:"location"`
+	Profile  string `json:"profile,omitempty"` // name of the device profile owning the key schema
 }
 
 // TelemetryKey represents a telemetry key configuration
 type TelemetryKey struct {
-	Name     string      `json:"name"`
-	Type     string      `json:"type"` // numeric, boolean, string
-	Unit     string      `json:"unit,omitempty"`
-	MinValue float64     `json:"minValue,omitempty"`
-	MaxValue float64     `json:"maxValue,omitempty"`
-	Default  interface{} `json:"default,omitempty"`
+	Name       string      `mapstructure:"name" json:"name"`
+	Type       string      `mapstructure:"type" json:"type"` // numeric, boolean, string, json
+	Unit       string      `mapstructure:"unit" json:"unit,omitempty"`
+	MinValue   float64     `mapstructure:"min_value" json:"minValue,omitempty"`
+	MaxValue   float64     `mapstructure:"max_value" json:"maxValue,omitempty"`
+	Default    interface{} `mapstructure:"default" json:"default,omitempty"`
+	Cumulative bool        `mapstructure:"cumulative" json:"cumulative,omitempty"` // a counter such as energy, only ever increasing
+}
+
+// DeviceKey describes a telemetry key available for a device, combining its
+// device profile's schema with the readings found in storage
+type DeviceKey struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`                // numeric, boolean, string, json; from the profile, else inferred
+	ValueType string     `json:"valueType,omitempty"` // stored type of the latest raw value: BOOLEAN, LONG, DOUBLE, STRING, JSON
+	Unit      string     `json:"unit,omitempty"`
+	MinValue  float64    `json:"minValue,omitempty"`
+	MaxValue  float64    `json:"maxValue,omitempty"`
+	InProfile bool       `json:"inProfile"` // defined by the device's profile
+	Observed  bool       `json:"observed"`  // readings are stored, raw or as rollups
+	FirstSeen *time.Time `json:"firstSeen,omitempty"`
+	LastSeen  *time.Time `json:"lastSeen,omitempty"`
 }
 
 // TelemetryKeyMapping maps string keys to integer IDs
 type TelemetryKeyMapping struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
-	Type string `json:"type"`
+	Type string `json:"type"` // numeric, boolean, string, json
+	Unit string `json:"unit,omitempty"`
 }
 
 // DeviceEntityMapping maps device IDs to entity UUIDs
@@ -79,3 +248,138 @@ type DeviceEntityMapping struct {
 	DeviceID string    `json:"deviceId"`
 	EntityID uuid.UUID `json:"entityId"`
 }
+
+// Aggregation functions supported by historical queries
+const (
+	AggregationNone  = "NONE"
+	AggregationAvg   = "AVG"
+	AggregationMin   = "MIN"
+	AggregationMax   = "MAX"
+	AggregationSum   = "SUM"
+	AggregationCount = "COUNT"
+	AggregationLast  = "LAST"
+)
+
+// IsValidAggregation reports whether the aggregation function is supported
+func IsValidAggregation(agg string) bool {
+	switch agg {
+	case AggregationNone, AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationCount, AggregationLast:
+		return true
+	}
+	return false
+}
+
+// Export formats
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatXLSX   = "xlsx"
+)
+
+// ExportRequest represents a request to export historical telemetry
+type ExportRequest struct {
+	DeviceIDs []string `json:"deviceIds"`
+	Keys      []string `json:"keys"`
+	StartTs   int64    `json:"startTs"`
+	EndTs     int64    `json:"endTs"`
+	Format    string   `json:"format"`             // csv, ndjson or xlsx
+	Timezone  string   `json:"timezone,omitempty"` // IANA name used to format timestamps
+	Agg       string   `json:"agg,omitempty"`      // NONE, AVG, MIN, MAX, SUM, COUNT, LAST
+	Interval  int64    `json:"interval,omitempty"` // aggregation bucket in milliseconds
+	BOM       bool     `json:"bom,omitempty"`      // prefix CSV with a UTF-8 BOM for Excel
+}
+
+// EntityCursor marks the last row returned by an entity history page.
+// Rows are ordered by timestamp (ms) and then by key ID.
+type EntityCursor struct {
+	Ts  int64
+	Key int
+}
+
+// String encodes the cursor as "<ts>_<key>"
+func (ec EntityCursor) String() string {
+	return strconv.FormatInt(ec.Ts, 10) + "_" + strconv.Itoa(ec.Key)
+}
+
+// ParseEntityCursor decodes a cursor produced by EntityCursor.String
+func ParseEntityCursor(raw string) (EntityCursor, error) {
+	tsPart, keyPart, found := strings.Cut(raw, "_")
+	if !found {
+		return EntityCursor{}, fmt.Errorf("invalid cursor %q", raw)
+	}
+	ts, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return EntityCursor{}, fmt.Errorf("invalid cursor %q", raw)
+	}
+	key, err := strconv.Atoi(keyPart)
+	if err != nil {
+		return EntityCursor{}, fmt.Errorf("invalid cursor %q", raw)
+	}
+	return EntityCursor{Ts: ts, Key: key}, nil
+}
+
+// After reports whether a row sorts after the cursor
+func (ec EntityCursor) After(ts int64, key int) bool {
+	return ts > ec.Ts || (ts == ec.Ts && key > ec.Key)
+}
+
+// EntityHistoryRequest represents a range query in entity format
+type EntityHistoryRequest struct {
+	EntityID uuid.UUID
+	KeyIDs   []int // empty means all mapped keys
+	StartTs  int64
+	EndTs    int64
+	Cursor   *EntityCursor
+	Limit    int
+}
+
+// EntityHistoryPage is one page of telemetry rows in entity format, shaped
+// like ThingsBoard's ts_kv table
+type EntityHistoryPage struct {
+	EntityID   uuid.UUID   `json:"entityId"`
+	DeviceID   string      `json:"deviceId"`
+	Telemetry  []Telemetry `json:"telemetry"`
+	HasNext    bool        `json:"hasNext"`              // more rows are available now
+	NextCursor string      `json:"nextCursor,omitempty"` // resume point, also returned on the last page
+}
+
+// TimeSeriesSelector selects devices by ID, type and/or location (combined with AND) and the keys to read
+type TimeSeriesSelector struct {
+	DeviceID   string   `json:"deviceId,omitempty"`
+	DeviceType string   `json:"deviceType,omitempty"`
+	Location   string   `json:"location,omitempty"`
+	Keys       []string `json:"keys"`
+}
+
+// BatchTimeSeriesRequest represents a multi-device, multi-key historical query
+type BatchTimeSeriesRequest struct {
+	Selectors  []TimeSeriesSelector `json:"selectors" binding:"required"`
+	StartTs    int64                `json:"startTs"`
+	EndTs      int64                `json:"endTs"`
+	Interval   int64                `json:"interval"`             // bucket size in milliseconds, used when Agg is not NONE
+	Agg        string               `json:"agg"`                  // NONE (default), AVG, MIN, MAX, SUM, COUNT, LAST
+	Fill       string               `json:"fill,omitempty"`       // fill empty buckets: null (default with Agg), previous, linear or zero
+	StaleAfter int64                `json:"staleAfter,omitempty"` // report gaps without data longer than this (ms)
+}
+
+// SeriesResult is one device/key series of a batch query. Error is set when
+// the series could not be produced; other series are unaffected.
+type SeriesResult struct {
+	DeviceID string       `json:"deviceId,omitempty"`
+	Key      string       `json:"key,omitempty"`
+	Data     SeriesPoints `json:"data"` // [timestamp, value] pairs
+	Gapped   bool         `json:"gapped,omitempty"`
+	Gaps     []Gap        `json:"gaps,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// BatchTimeSeriesResponse represents the result of a batch query. With an
+// aggregation, every series has a point for each bucket from startTs to endTs;
+// empty buckets are null unless filled.
+type BatchTimeSeriesResponse struct {
+	StartTs  int64          `json:"startTs"`
+	EndTs    int64          `json:"endTs"`
+	Interval int64          `json:"interval"`
+	Agg      string         `json:"agg"`
+	Series   []SeriesResult `json:"series"`
+}
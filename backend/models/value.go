@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Telemetry value types, matching ThingsBoard's data types
+const (
+	ValueTypeBoolean = "BOOLEAN"
+	ValueTypeLong    = "LONG"
+	ValueTypeDouble  = "DOUBLE"
+	ValueTypeString  = "STRING"
+	ValueTypeJSON    = "JSON"
+)
+
+// ValueType returns the data type of a stored telemetry value
+func ValueType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return ValueTypeBoolean
+	case int, int64:
+		return ValueTypeLong
+	case float64:
+		return ValueTypeDouble
+	case string:
+		return ValueTypeString
+	default:
+		return ValueTypeJSON
+	}
+}
+
+// KeyType maps a stored value type to the key schema type: numeric, boolean, string or json
+func KeyType(valueType string) string {
+	switch valueType {
+	case ValueTypeBoolean:
+		return "boolean"
+	case ValueTypeLong, ValueTypeDouble:
+		return "numeric"
+	case ValueTypeString:
+		return "string"
+	default:
+		return "json"
+	}
+}
+
+// NewTelemetryEntity converts a telemetry value to the entity format,
+// setting the value column that matches its type
+func NewTelemetryEntity(entityID uuid.UUID, timestamp time.Time, keyID int, value interface{}) (Telemetry, error) {
+	entity := Telemetry{
+		EntityID:  entityID,
+		Timestamp: timestamp,
+		Key:       keyID,
+	}
+
+	switch v := value.(type) {
+	case bool:
+		entity.BoolVal = &v
+	case int:
+		entity.IntVal = &v
+	case int64:
+		i := int(v)
+		entity.IntVal = &i
+	case float64:
+		entity.DoubleVal = &v
+	case string:
+		entity.StringVal = &v
+	case json.RawMessage:
+		jsonStr := string(v)
+		entity.JSONVal = &jsonStr
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return entity, fmt.Errorf("failed to serialize value of key %d: %w", keyID, err)
+		}
+		jsonStr := string(encoded)
+		entity.JSONVal = &jsonStr
+	}
+
+	return entity, nil
+}
+
+// Value returns the typed value held by a telemetry entity
+func (t Telemetry) Value() interface{} {
+	switch {
+	case t.BoolVal != nil:
+		return *t.BoolVal
+	case t.IntVal != nil:
+		return *t.IntVal
+	case t.DoubleVal != nil:
+		return *t.DoubleVal
+	case t.StringVal != nil:
+		return *t.StringVal
+	case t.JSONVal != nil:
+		return json.RawMessage(*t.JSONVal)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook delivery attempt outcomes
+const (
+	DeliveryStatusDelivered = "DELIVERED"
+	DeliveryStatusRetrying  = "RETRYING" // failed, another attempt is scheduled
+	DeliveryStatusFailed    = "FAILED"   // failed for good, moved to the dead-letter queue
+)
+
+// TemplateFuncs are available to payload templates. json encodes a value,
+// so {"text": {{json .DeviceName}}} stays valid JSON whatever the name holds.
+var TemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// WebhookTarget is an outbound HTTP endpoint device events are posted to
+type WebhookTarget struct {
+	Name           string            `mapstructure:"name" json:"name"`
+	URL            string            `mapstructure:"url" json:"url"`
+	Events         []string          `mapstructure:"events" json:"events,omitempty"`     // ALARM, CONNECTIVITY, RPC_RESULT, ANOMALY; empty subscribes to all
+	Template       string            `mapstructure:"template" json:"template,omitempty"` // Go text/template for the body, empty posts the event JSON
+	ContentType    string            `mapstructure:"content_type" json:"contentType"`
+	Headers        map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	Secret         string            `mapstructure:"secret" json:"-"` // HMAC-SHA256 signing key, never returned by the API
+	MaxAttempts    int               `mapstructure:"max_attempts" json:"maxAttempts"`
+	InitialBackoff time.Duration     `mapstructure:"initial_backoff" json:"-"` // doubled after every failed attempt
+	MaxBackoff     time.Duration     `mapstructure:"max_backoff" json:"-"`
+	Timeout        time.Duration     `mapstructure:"timeout" json:"-"` // per attempt
+}
+
+// MarshalJSON renders the durations as Go duration strings, e.g. "30s"
+func (wt WebhookTarget) MarshalJSON() ([]byte, error) {
+	type target WebhookTarget
+	return json.Marshal(struct {
+		target
+		InitialBackoff string `json:"initialBackoff"`
+		MaxBackoff     string `json:"maxBackoff"`
+		Timeout        string `json:"timeout"`
+	}{target(wt), wt.InitialBackoff.String(), wt.MaxBackoff.String(), wt.Timeout.String()})
+}
+
+// Subscribes reports whether the target receives events of a type
+func (wt *WebhookTarget) Subscribes(eventType string) bool {
+	if len(wt.Events) == 0 || eventType == EventTypeTest {
+		return true
+	}
+	for _, subscribed := range wt.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAttempt is one delivery attempt in the delivery log
+type WebhookAttempt struct {
+	DeliveryID string    `json:"deliveryId"`
+	Target     string    `json:"target"`
+	EventID    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	DeviceID   string    `json:"deviceId,omitempty"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"` // DELIVERED, RETRYING or FAILED
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// WebhookDeadLetter is a delivery that failed every attempt
+type WebhookDeadLetter struct {
+	DeliveryID     string      `json:"deliveryId"`
+	Target         string      `json:"target"`
+	Event          DeviceEvent `json:"event"`
+	Payload        string      `json:"payload,omitempty"` // rendered body of the last attempt
+	Attempts       int         `json:"attempts"`
+	LastStatusCode int         `json:"lastStatusCode,omitempty"`
+	LastError      string      `json:"lastError"`
+	FailedAt       time.Time   `json:"failedAt"`
+}
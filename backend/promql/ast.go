@@ -0,0 +1,160 @@
+package promql
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ValueType is the type an expression evaluates to
+type ValueType string
+
+const (
+	ValueTypeScalar ValueType = "scalar"
+	ValueTypeVector ValueType = "vector"
+	ValueTypeMatrix ValueType = "matrix"
+)
+
+// MetricNameLabel is the label holding the metric (telemetry key) name
+const MetricNameLabel = "__name__"
+
+// Expr is a node of a parsed PromQL expression
+type Expr interface {
+	Type() ValueType
+}
+
+// NumberLiteral is a scalar constant
+type NumberLiteral struct {
+	Value float64
+}
+
+// VectorSelector selects the latest sample of every matching series
+type VectorSelector struct {
+	Matchers []*Matcher
+}
+
+// MatrixSelector selects all samples of matching series within Range
+type MatrixSelector struct {
+	Vector *VectorSelector
+	Range  time.Duration
+}
+
+// Call is a function call such as rate(x[5m])
+type Call struct {
+	Func string
+	Args []Expr
+}
+
+// AggregateExpr is an aggregation such as sum by (location) (x)
+type AggregateExpr struct {
+	Op       string
+	Grouping []string
+	Without  bool
+	Expr     Expr
+}
+
+// BinaryExpr is an arithmetic operation between scalars and/or vectors
+type BinaryExpr struct {
+	Op  string
+	LHS Expr
+	RHS Expr
+}
+
+func (*NumberLiteral) Type() ValueType  { return ValueTypeScalar }
+func (*VectorSelector) Type() ValueType { return ValueTypeVector }
+func (*MatrixSelector) Type() ValueType { return ValueTypeMatrix }
+func (*Call) Type() ValueType           { return ValueTypeVector }
+func (*AggregateExpr) Type() ValueType  { return ValueTypeVector }
+
+func (be *BinaryExpr) Type() ValueType {
+	if be.LHS.Type() == ValueTypeScalar && be.RHS.Type() == ValueTypeScalar {
+		return ValueTypeScalar
+	}
+	return ValueTypeVector
+}
+
+// Matcher is a label matcher inside a selector, e.g. location=~"Room.*"
+type Matcher struct {
+	Name  string
+	Op    string // =, !=, =~, !~
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher creates a matcher, compiling regular expressions fully anchored
+func NewMatcher(name, op, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Op: op, Value: value}
+	if op == "=~" || op == "!~" {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether a label value satisfies the matcher. A missing
+// label has the empty value.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// Functions lists the supported functions and their argument type
+var Functions = map[string]ValueType{
+	"rate":            ValueTypeMatrix,
+	"irate":           ValueTypeMatrix,
+	"increase":        ValueTypeMatrix,
+	"delta":           ValueTypeMatrix,
+	"avg_over_time":   ValueTypeMatrix,
+	"min_over_time":   ValueTypeMatrix,
+	"max_over_time":   ValueTypeMatrix,
+	"sum_over_time":   ValueTypeMatrix,
+	"count_over_time": ValueTypeMatrix,
+	"last_over_time":  ValueTypeMatrix,
+	"abs":             ValueTypeVector,
+	"ceil":            ValueTypeVector,
+	"floor":           ValueTypeVector,
+	"round":           ValueTypeVector,
+}
+
+// Aggregations lists the supported aggregation operators
+var Aggregations = map[string]bool{
+	"sum":   true,
+	"avg":   true,
+	"min":   true,
+	"max":   true,
+	"count": true,
+}
+
+// Selectors returns every vector selector in the expression, including
+// those wrapped in matrix selectors
+func Selectors(expr Expr) []*VectorSelector {
+	switch e := expr.(type) {
+	case *VectorSelector:
+		return []*VectorSelector{e}
+	case *MatrixSelector:
+		return []*VectorSelector{e.Vector}
+	case *Call:
+		var selectors []*VectorSelector
+		for _, arg := range e.Args {
+			selectors = append(selectors, Selectors(arg)...)
+		}
+		return selectors
+	case *AggregateExpr:
+		return Selectors(e.Expr)
+	case *BinaryExpr:
+		return append(Selectors(e.LHS), Selectors(e.RHS)...)
+	}
+	return nil
+}
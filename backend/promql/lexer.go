@@ -0,0 +1,259 @@
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tokenKind identifies the type of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenMatchOp // =, !=, =~, !~
+	tokenArithOp // +, -, *, /, %
+	tokenComma
+	tokenLParen
+	tokenRParen
+	tokenLBrace
+	tokenRBrace
+	tokenLBracket
+	tokenRBracket
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of input"
+	case tokenIdent:
+		return "identifier"
+	case tokenNumber:
+		return "number"
+	case tokenDuration:
+		return "duration"
+	case tokenString:
+		return "string"
+	case tokenMatchOp:
+		return "label matcher"
+	case tokenArithOp:
+		return "operator"
+	case tokenComma:
+		return "','"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	case tokenLBrace:
+		return "'{'"
+	case tokenRBrace:
+		return "'}'"
+	case tokenLBracket:
+		return "'['"
+	case tokenRBracket:
+		return "']'"
+	}
+	return "token"
+}
+
+// token is a lexical token with its 1-based column in the source
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%s %q", t.kind, t.text)
+}
+
+// ParseError reports a problem at a position in the expression
+type ParseError struct {
+	Pos     int
+	Message string
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("parse error at char %d: %s", pe.Pos, pe.Message)
+}
+
+// durationUnits are the suffixes accepted in PromQL durations, longest first
+var durationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"y", 365 * 24 * time.Hour},
+}
+
+// ParseDuration parses a PromQL duration such as 5m or 1h30m
+func ParseDuration(text string) (time.Duration, error) {
+	if text == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	var total time.Duration
+	rest := text
+	for rest != "" {
+		digits := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) })
+		if digits <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		amount, err := strconv.ParseInt(rest[:digits], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		rest = rest[digits:]
+
+		matched := false
+		for _, u := range durationUnits {
+			if strings.HasPrefix(rest, u.suffix) {
+				total += time.Duration(amount) * u.unit
+				rest = rest[len(u.suffix):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return 0, fmt.Errorf("invalid duration %q (units are ms, s, m, h, d, w, y)", text)
+		}
+	}
+	return total, nil
+}
+
+// lex splits a PromQL expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", start + 1})
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", start + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", start + 1})
+			i++
+		case r == '{':
+			tokens = append(tokens, token{tokenLBrace, "{", start + 1})
+			i++
+		case r == '}':
+			tokens = append(tokens, token{tokenRBrace, "}", start + 1})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{tokenLBracket, "[", start + 1})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{tokenRBracket, "]", start + 1})
+			i++
+
+		case r == '+' || r == '-' || r == '*' || r == '/' || r == '%':
+			tokens = append(tokens, token{tokenArithOp, string(r), start + 1})
+			i++
+
+		case r == '=' || r == '!':
+			i++
+			if i < len(runes) && (runes[i] == '~' || (r == '!' && runes[i] == '=')) {
+				i++
+			}
+			op := string(runes[start:i])
+			if op == "!" {
+				return nil, &ParseError{start + 1, "unexpected character '!'"}
+			}
+			if i < len(runes) && runes[i] == '=' {
+				return nil, &ParseError{start + 1, "comparison operators are not supported"}
+			}
+			tokens = append(tokens, token{tokenMatchOp, op, start + 1})
+
+		case r == '"' || r == '\'' || r == '`':
+			quote := r
+			i++
+			for i < len(runes) && runes[i] != quote {
+				if runes[i] == '\\' && quote != '`' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, &ParseError{start + 1, "unterminated string"}
+			}
+			i++
+			value, err := unquote(string(runes[start:i]))
+			if err != nil {
+				return nil, &ParseError{start + 1, "invalid string literal"}
+			}
+			tokens = append(tokens, token{tokenString, value, start + 1})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && unicode.IsLetter(runes[i]) {
+				for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+					i++
+				}
+				text := string(runes[start:i])
+				if _, err := ParseDuration(text); err != nil {
+					return nil, &ParseError{start + 1, err.Error()}
+				}
+				tokens = append(tokens, token{tokenDuration, text, start + 1})
+			} else {
+				tokens = append(tokens, token{tokenNumber, string(runes[start:i]), start + 1})
+			}
+
+		case unicode.IsLetter(r) || r == '_' || r == ':':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == ':') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i]), start + 1})
+
+		default:
+			return nil, &ParseError{start + 1, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+
+	tokens = append(tokens, token{tokenEOF, "", len(runes) + 1})
+	return tokens, nil
+}
+
+// unquote decodes a quoted PromQL string literal
+func unquote(literal string) (string, error) {
+	switch literal[0] {
+	case '`':
+		return literal[1 : len(literal)-1], nil
+	case '\'':
+		// Re-quote single-quoted strings so strconv handles the escapes
+		inner := strings.ReplaceAll(literal[1:len(literal)-1], `\'`, `'`)
+		inner = strings.ReplaceAll(inner, `"`, `\"`)
+		return strconv.Unquote(`"` + inner + `"`)
+	}
+	return strconv.Unquote(literal)
+}
@@ -0,0 +1,325 @@
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parser is a recursive-descent parser over the token stream
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// ParseExpr parses a PromQL expression. Only the subset listed in
+// Functions and Aggregations is supported, with +, -, *, / and %
+// arithmetic. Errors are returned as *ParseError.
+func ParseExpr(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t.describe())
+	}
+	return expr, nil
+}
+
+// ParseSelector parses a series selector such as power{location="Room 1"},
+// as used by the series API
+func ParseSelector(input string) ([]*Matcher, error) {
+	expr, err := ParseExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	vs, ok := expr.(*VectorSelector)
+	if !ok {
+		return nil, &ParseError{Pos: 1, Message: "expected a series selector"}
+	}
+	return vs.Matchers, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %s, got %s", kind, t.describe())
+	}
+	return t, nil
+}
+
+// precedence returns the binding strength of an arithmetic operator
+func precedence(op string) int {
+	if op == "+" || op == "-" {
+		return 1
+	}
+	return 2
+}
+
+func (p *parser) parseBinary(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenArithOp || precedence(t.text) < minPrec {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseBinary(precedence(t.text) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperand(t, lhs); err != nil {
+			return nil, err
+		}
+		if err := checkOperand(t, rhs); err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text, LHS: lhs, RHS: rhs}
+	}
+}
+
+// checkOperand rejects range vectors in arithmetic
+func checkOperand(op token, operand Expr) error {
+	if operand.Type() == ValueTypeMatrix {
+		return &ParseError{Pos: op.pos, Message: fmt.Sprintf("operator %q cannot be applied to a range vector", op.text)}
+	}
+	return nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokenArithOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperand(t, operand); err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return operand, nil
+		}
+		if number, ok := operand.(*NumberLiteral); ok {
+			return &NumberLiteral{Value: -number.Value}, nil
+		}
+		return &BinaryExpr{Op: "*", LHS: &NumberLiteral{Value: -1}, RHS: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return &NumberLiteral{Value: value}, nil
+
+	case tokenLParen:
+		p.next()
+		expr, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRParen); err != nil {
+			return nil, err
+		}
+		return expr, nil
+
+	case tokenLBrace:
+		return p.parseSelector("")
+
+	case tokenIdent:
+		name := t.text
+		following := p.tokens[p.pos+1]
+		lower := strings.ToLower(name)
+		if Aggregations[lower] && (following.kind == tokenLParen || isGroupingKeyword(following)) {
+			return p.parseAggregate()
+		}
+		if following.kind == tokenLParen {
+			return p.parseCall()
+		}
+		p.next()
+		return p.parseSelector(name)
+	}
+	return nil, p.errorf(t, "unexpected %s", t.describe())
+}
+
+func isGroupingKeyword(t token) bool {
+	return t.kind == tokenIdent && (strings.EqualFold(t.text, "by") || strings.EqualFold(t.text, "without"))
+}
+
+// parseSelector parses the optional {matchers} and [range] after a metric name
+func (p *parser) parseSelector(name string) (Expr, error) {
+	start := p.peek()
+	vs := &VectorSelector{}
+	if name != "" {
+		m, _ := NewMatcher(MetricNameLabel, "=", name)
+		vs.Matchers = append(vs.Matchers, m)
+	}
+
+	if p.peek().kind == tokenLBrace {
+		p.next()
+		for p.peek().kind != tokenRBrace {
+			label, err := p.expect(tokenIdent)
+			if err != nil {
+				return nil, err
+			}
+			op, err := p.expect(tokenMatchOp)
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.expect(tokenString)
+			if err != nil {
+				return nil, err
+			}
+			m, err := NewMatcher(label.text, op.text, value.text)
+			if err != nil {
+				return nil, p.errorf(value, "%v", err)
+			}
+			vs.Matchers = append(vs.Matchers, m)
+
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokenRBrace); err != nil {
+			return nil, err
+		}
+	}
+
+	// Like Prometheus, refuse selectors that would match every series
+	matchesEmpty := true
+	for _, m := range vs.Matchers {
+		if !m.Matches("") {
+			matchesEmpty = false
+		}
+	}
+	if matchesEmpty {
+		return nil, p.errorf(start, "vector selector must contain at least one non-empty matcher")
+	}
+
+	if p.peek().kind != tokenLBracket {
+		return vs, nil
+	}
+	p.next()
+	d, err := p.expect(tokenDuration)
+	if err != nil {
+		return nil, err
+	}
+	rng, _ := ParseDuration(d.text)
+	if rng <= 0 {
+		return nil, p.errorf(d, "range must be positive")
+	}
+	if _, err := p.expect(tokenRBracket); err != nil {
+		return nil, err
+	}
+	return &MatrixSelector{Vector: vs, Range: rng}, nil
+}
+
+func (p *parser) parseCall() (Expr, error) {
+	name := p.next()
+	argType, ok := Functions[strings.ToLower(name.text)]
+	if !ok {
+		return nil, p.errorf(name, "unknown or unsupported function %q", name.text)
+	}
+	p.next() // (
+
+	arg, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if arg.Type() != argType {
+		return nil, p.errorf(name, "function %q expects a %s argument, got %s", name.text, argType, arg.Type())
+	}
+	if _, err := p.expect(tokenRParen); err != nil {
+		return nil, err
+	}
+	return &Call{Func: strings.ToLower(name.text), Args: []Expr{arg}}, nil
+}
+
+// parseAggregate parses "op [by|without (labels)] (expr) [by|without (labels)]"
+func (p *parser) parseAggregate() (Expr, error) {
+	op := p.next()
+	agg := &AggregateExpr{Op: strings.ToLower(op.text)}
+
+	grouped := false
+	if isGroupingKeyword(p.peek()) {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+		grouped = true
+	}
+
+	if _, err := p.expect(tokenLParen); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Type() != ValueTypeVector {
+		return nil, p.errorf(op, "aggregation %q expects an instant vector, got %s", op.text, expr.Type())
+	}
+	if _, err := p.expect(tokenRParen); err != nil {
+		return nil, err
+	}
+	agg.Expr = expr
+
+	if !grouped && isGroupingKeyword(p.peek()) {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+func (p *parser) parseGrouping(agg *AggregateExpr) error {
+	keyword := p.next()
+	agg.Without = strings.EqualFold(keyword.text, "without")
+	if _, err := p.expect(tokenLParen); err != nil {
+		return err
+	}
+	for p.peek().kind != tokenRParen {
+		label, err := p.expect(tokenIdent)
+		if err != nil {
+			return err
+		}
+		agg.Grouping = append(agg.Grouping, label.text)
+		if p.peek().kind != tokenComma {
+			break
+		}
+		p.next()
+	}
+	_, err := p.expect(tokenRParen)
+	return err
+}
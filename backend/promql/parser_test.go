@@ -0,0 +1,193 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// format renders an expression in a canonical, fully parenthesized form
+func format(expr Expr) string {
+	switch e := expr.(type) {
+	case *NumberLiteral:
+		return fmt.Sprint(e.Value)
+	case *VectorSelector:
+		matchers := make([]string, 0, len(e.Matchers))
+		for _, m := range e.Matchers {
+			matchers = append(matchers, fmt.Sprintf("%s%s%q", m.Name, m.Op, m.Value))
+		}
+		return "{" + strings.Join(matchers, ",") + "}"
+	case *MatrixSelector:
+		return format(e.Vector) + "[" + e.Range.String() + "]"
+	case *Call:
+		args := make([]string, 0, len(e.Args))
+		for _, arg := range e.Args {
+			args = append(args, format(arg))
+		}
+		return e.Func + "(" + strings.Join(args, ",") + ")"
+	case *AggregateExpr:
+		grouping := "by"
+		if e.Without {
+			grouping = "without"
+		}
+		return fmt.Sprintf("%s %s(%s) (%s)", e.Op, grouping, strings.Join(e.Grouping, ","), format(e.Expr))
+	case *BinaryExpr:
+		return "(" + format(e.LHS) + " " + e.Op + " " + format(e.RHS) + ")"
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		typ   ValueType
+	}{
+		{"42", "42", ValueTypeScalar},
+		{"-.5 + 2", "(-0.5 + 2)", ValueTypeScalar},
+		{"power", `{__name__="power"}`, ValueTypeVector},
+		{`power{location="Room 1", type!~'meter|sensor'}`, `{__name__="power",location="Room 1",type!~"meter|sensor"}`, ValueTypeVector},
+		{`{__name__=~"temp.*"}`, `{__name__=~"temp.*"}`, ValueTypeVector},
+		{"power[1h30m]", `{__name__="power"}[1h30m0s]`, ValueTypeMatrix},
+		{"rate(total_volume[5m])", `rate({__name__="total_volume"}[5m0s])`, ValueTypeVector},
+		{"ROUND(power)", `round({__name__="power"})`, ValueTypeVector},
+		{"sum by (location) (power)", `sum by(location) ({__name__="power"})`, ValueTypeVector},
+		{"avg(power) without (device, type)", `avg without(device,type) ({__name__="power"})`, ValueTypeVector},
+		{"1 + 2 * power - 3", `((1 + (2 * {__name__="power"})) - 3)`, ValueTypeVector},
+		{"(1 + 2) * power % 7", `(((1 + 2) * {__name__="power"}) % 7)`, ValueTypeVector},
+		{"-power", `(-1 * {__name__="power"})`, ValueTypeVector},
+		{"power # trailing comment", `{__name__="power"}`, ValueTypeVector},
+		{`label{name="a\"b"}`, `{__name__="label",name="a\"b"}`, ValueTypeVector},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := ParseExpr(tt.input)
+			if err != nil {
+				t.Fatalf("ParseExpr: %v", err)
+			}
+			if got := format(expr); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if expr.Type() != tt.typ {
+				t.Errorf("got type %s, want %s", expr.Type(), tt.typ)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		want  string
+	}{
+		{"", 1, "unexpected end of input"},
+		{"power)", 6, `unexpected ')'`},
+		{"power == 1", 7, "comparison operators are not supported"},
+		{"power[5x]", 7, "invalid duration"},
+		{"power[0s]", 7, "range must be positive"},
+		{`{location=""}`, 1, "at least one non-empty matcher"},
+		{`power{location=~"("}`, 17, "invalid regular expression"},
+		{`power{location="Room 1}`, 16, "unterminated string"},
+		{"histogram_quantile(power)", 1, `unknown or unsupported function "histogram_quantile"`},
+		{"rate(power)", 1, `function "rate" expects a matrix argument, got vector`},
+		{"abs(power[5m])", 1, `function "abs" expects a vector argument, got matrix`},
+		{"sum(power[5m])", 1, "expects an instant vector, got matrix"},
+		{"power[5m] * 2", 11, "cannot be applied to a range vector"},
+		{"sum by (location power)", 18, "expected ')'"},
+		{"power @ 100", 7, "unexpected character '@'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseExpr(tt.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got error %v, want a *ParseError", err)
+			}
+			if parseErr.Pos != tt.pos || !strings.Contains(parseErr.Message, tt.want) {
+				t.Errorf("got %v, want char %d: ...%s...", err, tt.pos, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	matchers, err := ParseSelector(`power{location="Room 1"}`)
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+	if got := format(&VectorSelector{Matchers: matchers}); got != `{__name__="power",location="Room 1"}` {
+		t.Errorf("got %s", got)
+	}
+	if _, err := ParseSelector("rate(power[5m])"); err == nil || !strings.Contains(err.Error(), "expected a series selector") {
+		t.Errorf("got error %v for a function call, want expected a series selector", err)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		op, value, label string
+		want             bool
+	}{
+		{"=", "Room 1", "Room 1", true},
+		{"=", "Room 1", "", false},
+		{"!=", "Room 1", "Room 2", true},
+		{"=~", "Room.*", "Room 12", true},
+		{"=~", "Room", "Room 12", false}, // anchored
+		{"!~", "Room.*", "Lab", true},
+		{"!~", ".*", "", false},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher("location", tt.op, tt.value)
+		if err != nil {
+			t.Fatalf("NewMatcher(%s%q): %v", tt.op, tt.value, err)
+		}
+		if got := m.Matches(tt.label); got != tt.want {
+			t.Errorf("location%s%q matches %q = %v, want %v", tt.op, tt.value, tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	expr, err := ParseExpr("sum(rate(total_volume[5m])) / avg(power) + 1")
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+	var names []string
+	for _, selector := range Selectors(expr) {
+		names = append(names, selector.Matchers[0].Value)
+	}
+	if got := strings.Join(names, ","); got != "total_volume,power" {
+		t.Errorf("got selectors %s, want total_volume,power", got)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"500ms", 500 * time.Millisecond},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"1w1d", 8 * 24 * time.Hour},
+		{"1y", 365 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "5", "m", "1.5h", "5x", "1h-5m"} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Errorf("ParseDuration(%q) succeeded, want an error", input)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the type of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenOperator
+	tokenComma
+	tokenLParen
+	tokenRParen
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of query"
+	case tokenIdent:
+		return "identifier"
+	case tokenNumber:
+		return "number"
+	case tokenDuration:
+		return "duration"
+	case tokenString:
+		return "string"
+	case tokenOperator:
+		return "operator"
+	case tokenComma:
+		return "','"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	}
+	return "token"
+}
+
+// token is a lexical token with its 1-based column in the source
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%s %q", t.kind, t.text)
+}
+
+// SyntaxError reports a problem at a position in the query text
+type SyntaxError struct {
+	Pos     int    `json:"pos"` // 1-based column
+	Message string `json:"message"`
+}
+
+func (se *SyntaxError) Error() string {
+	return fmt.Sprintf("col %d: %s", se.Pos, se.Message)
+}
+
+// durationUnits are the suffixes accepted in durations such as 7d or 15m
+var durationUnits = map[string]bool{"ms": true, "s": true, "m": true, "h": true, "d": true, "w": true}
+
+// lex splits the query text into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", start + 1})
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", start + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", start + 1})
+			i++
+
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			op := string(runes[start:i])
+			if op == "!" {
+				return nil, &SyntaxError{start + 1, "expected '!='"}
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, token{tokenOperator, op, start + 1})
+
+		case r == '\'' || r == '"':
+			quote := r
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != quote {
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i == len(runes) {
+				return nil, &SyntaxError{start + 1, "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{tokenString, sb.String(), start + 1})
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			number := string(runes[start:i])
+			unitStart := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			if unit := strings.ToLower(string(runes[unitStart:i])); unit != "" {
+				if !durationUnits[unit] {
+					return nil, &SyntaxError{unitStart + 1, fmt.Sprintf("unknown duration unit %q (expected ms, s, m, h, d or w)", unit)}
+				}
+				tokens = append(tokens, token{tokenDuration, number + unit, start + 1})
+			} else {
+				tokens = append(tokens, token{tokenNumber, number, start + 1})
+			}
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i]), start + 1})
+
+		default:
+			return nil, &SyntaxError{start + 1, fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+
+	tokens = append(tokens, token{tokenEOF, "", len(runes) + 1})
+	return tokens, nil
+}
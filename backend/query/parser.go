@@ -0,0 +1,402 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregation functions usable in a query, mapped to the API aggregation names
+var aggregations = map[string]string{
+	"avg":   "AVG",
+	"min":   "MIN",
+	"max":   "MAX",
+	"sum":   "SUM",
+	"count": "COUNT",
+	"last":  "LAST",
+}
+
+// DeviceAttributes are the device fields usable in "by" and in device filters
+var DeviceAttributes = map[string]bool{
+	"device":   true,
+	"name":     true,
+	"type":     true,
+	"location": true,
+}
+
+// Query is the parsed form of a telemetry query such as
+//
+//	avg flow_rate by location over last 7d, 1h buckets where pump_status = true
+//
+// Key conditions in Filters are checked against each reading, so they only
+// match keys reported together with the selected keys by the same device.
+type Query struct {
+	Selects []Select
+	GroupBy []string
+	Range   TimeRange
+	Bucket  time.Duration // zero means one bucket spanning the whole range
+	Filters []Condition
+}
+
+// Select is one aggregated key, e.g. avg(power)
+type Select struct {
+	Agg string // API aggregation name, e.g. AVG
+	Key string
+}
+
+// Name returns the series name used in results, e.g. avg(power)
+func (s Select) Name() string {
+	return strings.ToLower(s.Agg) + "(" + s.Key + ")"
+}
+
+// TimeRange is either a window ending now (Last) or an absolute range
+type TimeRange struct {
+	Last  time.Duration
+	Start time.Time
+	End   time.Time
+}
+
+// IsAbsolute reports whether the range has explicit bounds
+func (tr TimeRange) IsAbsolute() bool {
+	return tr.Last == 0 && !tr.End.IsZero()
+}
+
+// Condition compares a device attribute or a telemetry key with a literal.
+// Value is a float64, bool or string. Key conditions apply per reading, not
+// per device.
+type Condition struct {
+	Field string
+	Op    string // =, !=, <, <=, >, >=
+	Value interface{}
+}
+
+// IsDeviceFilter reports whether the condition applies to a device attribute
+func (c Condition) IsDeviceFilter() bool {
+	return DeviceAttributes[c.Field]
+}
+
+// parser is a recursive-descent parser over the token stream
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses query text. Errors are returned as *SyntaxError.
+//
+// Grammar (keywords are case-insensitive, clauses may appear in any order and
+// may be separated by commas):
+//
+//	query  = select { "," select } { clause }
+//	select = agg ( "(" key ")" | key )
+//	clause = "by" attr { "," attr }
+//	       | "over" ( "last" duration | time "to" time )
+//	       | duration "buckets" | "every" duration
+//	       | "where" cond { "and" cond }
+//	cond   = field op ( number | string | true | false | ident )
+func Parse(input string) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.parseQuery()
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// isKeyword reports whether the token is the given keyword
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokenIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	t := p.next()
+	if !isKeyword(t, keyword) {
+		return p.errorf(t, "expected %q, got %s", keyword, t.describe())
+	}
+	return nil
+}
+
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+
+	for {
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		q.Selects = append(q.Selects, sel)
+
+		// A comma followed by another aggregation continues the select list
+		if p.peek().kind == tokenComma && p.isAggregationAt(p.pos+1) {
+			p.next()
+			continue
+		}
+		break
+	}
+
+	seen := make(map[string]bool)
+	for {
+		if p.peek().kind == tokenComma {
+			p.next()
+		}
+		t := p.peek()
+		if t.kind == tokenEOF {
+			break
+		}
+
+		clause := strings.ToLower(t.text)
+		if t.kind == tokenDuration || clause == "every" {
+			clause = "buckets"
+		}
+		if seen[clause] {
+			return nil, p.errorf(t, "duplicate %q clause", clause)
+		}
+		seen[clause] = true
+
+		var err error
+		switch {
+		case isKeyword(t, "by"):
+			err = p.parseGroupBy(q)
+		case isKeyword(t, "over"):
+			err = p.parseRange(q)
+		case isKeyword(t, "every"):
+			p.next()
+			q.Bucket, err = p.parseDuration()
+		case t.kind == tokenDuration:
+			q.Bucket, err = p.parseDuration()
+			if err == nil {
+				err = p.expectKeyword("buckets")
+			}
+		case isKeyword(t, "where"):
+			err = p.parseWhere(q)
+		default:
+			err = p.errorf(t, "unexpected %s (expected by, over, every, buckets or where)", t.describe())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Range.Last == 0 && q.Range.End.IsZero() {
+		return nil, &SyntaxError{Pos: p.peek().pos, Message: "missing time range (add \"over last <duration>\")"}
+	}
+	return q, nil
+}
+
+// isAggregationAt reports whether the token at index i starts a select
+func (p *parser) isAggregationAt(i int) bool {
+	if i >= len(p.tokens) || p.tokens[i].kind != tokenIdent {
+		return false
+	}
+	_, ok := aggregations[strings.ToLower(p.tokens[i].text)]
+	return ok
+}
+
+func (p *parser) parseSelect() (Select, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return Select{}, p.errorf(t, "expected aggregation (avg, min, max, sum, count, last), got %s", t.describe())
+	}
+	agg, ok := aggregations[strings.ToLower(t.text)]
+	if !ok {
+		return Select{}, p.errorf(t, "unknown aggregation %q (expected avg, min, max, sum, count or last)", t.text)
+	}
+
+	parenthesized := p.peek().kind == tokenLParen
+	if parenthesized {
+		p.next()
+	}
+	key := p.next()
+	if key.kind != tokenIdent {
+		return Select{}, p.errorf(key, "expected telemetry key after %q, got %s", t.text, key.describe())
+	}
+	if parenthesized {
+		if closing := p.next(); closing.kind != tokenRParen {
+			return Select{}, p.errorf(closing, "expected ')', got %s", closing.describe())
+		}
+	}
+	return Select{Agg: agg, Key: key.text}, nil
+}
+
+func (p *parser) parseGroupBy(q *Query) error {
+	p.next() // by
+	for {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return p.errorf(t, "expected device attribute after \"by\", got %s", t.describe())
+		}
+		attr := strings.ToLower(t.text)
+		if !DeviceAttributes[attr] {
+			return p.errorf(t, "cannot group by %q (expected device, name, type or location)", t.text)
+		}
+		q.GroupBy = append(q.GroupBy, attr)
+
+		// Continue the list only if the comma is followed by another attribute
+		if p.peek().kind == tokenComma && p.pos+1 < len(p.tokens) {
+			following := p.tokens[p.pos+1]
+			if following.kind == tokenIdent && DeviceAttributes[strings.ToLower(following.text)] {
+				p.next()
+				continue
+			}
+		}
+		return nil
+	}
+}
+
+func (p *parser) parseRange(q *Query) error {
+	p.next() // over
+	if isKeyword(p.peek(), "last") {
+		p.next()
+		last, err := p.parseDuration()
+		if err != nil {
+			return err
+		}
+		q.Range = TimeRange{Last: last}
+		return nil
+	}
+
+	start, err := p.parseTime()
+	if err != nil {
+		return err
+	}
+	if err := p.expectKeyword("to"); err != nil {
+		return err
+	}
+	end, err := p.parseTime()
+	if err != nil {
+		return err
+	}
+	if end.Before(start) {
+		return p.errorf(p.tokens[p.pos-1], "range end is before its start")
+	}
+	q.Range = TimeRange{Start: start, End: end}
+	return nil
+}
+
+func (p *parser) parseWhere(q *Query) error {
+	p.next() // where
+	for {
+		field := p.next()
+		if field.kind != tokenIdent {
+			return p.errorf(field, "expected field name in condition, got %s", field.describe())
+		}
+		op := p.next()
+		if op.kind != tokenOperator {
+			return p.errorf(op, "expected comparison operator after %q, got %s", field.text, op.describe())
+		}
+		value, err := p.parseLiteral()
+		if err != nil {
+			return err
+		}
+
+		name := field.text
+		if DeviceAttributes[strings.ToLower(name)] {
+			name = strings.ToLower(name)
+			if _, isString := value.(string); !isString {
+				return p.errorf(field, "device attribute %q must be compared with a string", name)
+			}
+			if op.text != "=" && op.text != "!=" {
+				return p.errorf(op, "device attribute %q only supports = and !=", name)
+			}
+		}
+		q.Filters = append(q.Filters, Condition{Field: name, Op: op.text, Value: value})
+
+		if !isKeyword(p.peek(), "and") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseLiteral() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return value, nil
+	case tokenString:
+		return t.text, nil
+	case tokenIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return t.text, nil
+	}
+	return nil, p.errorf(t, "expected value, got %s", t.describe())
+}
+
+func (p *parser) parseDuration() (time.Duration, error) {
+	t := p.next()
+	if t.kind != tokenDuration {
+		return 0, p.errorf(t, "expected duration such as 15m, 1h or 7d, got %s", t.describe())
+	}
+
+	split := strings.IndexFunc(t.text, func(r rune) bool { return r >= 'a' && r <= 'z' })
+	amount, err := strconv.ParseFloat(t.text[:split], 64)
+	if err != nil || amount <= 0 {
+		return 0, p.errorf(t, "invalid duration %q", t.text)
+	}
+
+	var unit time.Duration
+	switch t.text[split:] {
+	case "ms":
+		unit = time.Millisecond
+	case "s":
+		unit = time.Second
+	case "m":
+		unit = time.Minute
+	case "h":
+		unit = time.Hour
+	case "d":
+		unit = 24 * time.Hour
+	case "w":
+		unit = 7 * 24 * time.Hour
+	}
+	nanos := amount * float64(unit)
+	if math.IsInf(nanos, 0) || nanos >= math.MaxInt64 {
+		return 0, p.errorf(t, "duration %q is too long", t.text)
+	}
+	return time.Duration(nanos), nil
+}
+
+func (p *parser) parseTime() (time.Time, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		ms, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return time.Time{}, p.errorf(t, "invalid epoch milliseconds %q", t.text)
+		}
+		return time.UnixMilli(ms), nil
+	case tokenString:
+		parsed, err := time.Parse(time.RFC3339, t.text)
+		if err != nil {
+			return time.Time{}, p.errorf(t, "invalid RFC 3339 time %q", t.text)
+		}
+		return parsed, nil
+	}
+	return time.Time{}, p.errorf(t, "expected epoch milliseconds or quoted RFC 3339 time, got %s", t.describe())
+}
@@ -0,0 +1,121 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  *Query
+	}{
+		{
+			input: "avg flow_rate by location over last 7d, 1h buckets where pump_status = true",
+			want: &Query{
+				Selects: []Select{{Agg: "AVG", Key: "flow_rate"}},
+				GroupBy: []string{"location"},
+				Range:   TimeRange{Last: 7 * 24 * time.Hour},
+				Bucket:  time.Hour,
+				Filters: []Condition{{Field: "pump_status", Op: "=", Value: true}},
+			},
+		},
+		{
+			input: "MAX(temperature), min(humidity) over last 90m",
+			want: &Query{
+				Selects: []Select{{Agg: "MAX", Key: "temperature"}, {Agg: "MIN", Key: "humidity"}},
+				Range:   TimeRange{Last: 90 * time.Minute},
+			},
+		},
+		{
+			input: "sum power where Type = 'power_meter' and power >= 1.5 every 15m over last 1w by device, name",
+			want: &Query{
+				Selects: []Select{{Agg: "SUM", Key: "power"}},
+				GroupBy: []string{"device", "name"},
+				Range:   TimeRange{Last: 7 * 24 * time.Hour},
+				Bucket:  15 * time.Minute,
+				Filters: []Condition{
+					{Field: "type", Op: "=", Value: "power_meter"},
+					{Field: "power", Op: ">=", Value: 1.5},
+				},
+			},
+		},
+		{
+			input: `count temperature over 1700000000000 to "2023-11-14T23:00:00Z" where location != "Lab" and temperature == -2`,
+			want: &Query{
+				Selects: []Select{{Agg: "COUNT", Key: "temperature"}},
+				Range: TimeRange{
+					Start: time.UnixMilli(1700000000000),
+					End:   time.Date(2023, 11, 14, 23, 0, 0, 0, time.UTC),
+				},
+				Filters: []Condition{
+					{Field: "location", Op: "!=", Value: "Lab"},
+					{Field: "temperature", Op: "=", Value: -2.0},
+				},
+			},
+		},
+		{
+			input: "last pump_mode over last 500ms where pump_mode = auto",
+			want: &Query{
+				Selects: []Select{{Agg: "LAST", Key: "pump_mode"}},
+				Range:   TimeRange{Last: 500 * time.Millisecond},
+				Filters: []Condition{{Field: "pump_mode", Op: "=", Value: "auto"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		want  string
+	}{
+		{"", 1, "expected aggregation"},
+		{"median temperature over last 1h", 1, `unknown aggregation "median"`},
+		{"avg(temperature over last 1h", 17, "expected ')'"},
+		{"avg temperature", 16, "missing time range"},
+		{"avg temperature over last 1h over last 2h", 30, `duplicate "over" clause`},
+		{"avg temperature over last 1h by color", 33, `cannot group by "color"`},
+		{"avg temperature over last 1x", 28, `unknown duration unit "x"`},
+		{"avg temperature over last 0h", 27, `invalid duration "0h"`},
+		{"avg power over last 9999999999999999d", 21, `duration "9999999999999999d" is too long`},
+		{"avg power over last 1h, 300000w buckets", 25, `duration "300000w" is too long`},
+		{"avg temperature over 2000 to 1000", 30, "range end is before its start"},
+		{"avg temperature over '2023-11-14' to 1000", 22, "invalid RFC 3339 time"},
+		{"avg temperature over last 1h where location > 'Lab'", 45, "only supports = and !="},
+		{"avg temperature over last 1h where location = 3", 36, "must be compared with a string"},
+		{"avg temperature over last 1h where temperature ! 3", 48, "expected '!='"},
+		{"avg temperature over last 1h where name = 'Lab", 43, "unterminated string"},
+		{"avg temperature over last 1h; drop", 29, "unexpected character ';'"},
+		{"avg temperature over last 1h 5m", 32, `expected "buckets"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got error %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Pos != tt.pos || !strings.Contains(syntaxErr.Message, tt.want) {
+				t.Errorf("got %v, want col %d: ...%s...", err, tt.pos, tt.want)
+			}
+		})
+	}
+}
@@ -7,10 +7,40 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Services holds the services the API routes are served by.
+// A nil WebSocketManager or StreamManager leaves the WebSocket or SSE endpoint unregistered.
+type Services struct {
+	TelemetryService    *services.TelemetryService
+	WebSocketManager    *services.WebSocketManager
+	StreamManager       *services.StreamManager
+	AlarmService        *services.AlarmService
+	DashboardService    *services.DashboardService
+	AliasResolver       *services.EntityAliasResolver
+	AssetService        *services.AssetService
+	RPCService          *services.RPCService
+	ConnectivityMonitor *services.ConnectivityMonitor
+	WebhookService      *services.WebhookService
+	NotificationService *services.NotificationService
+	AnomalyService      *services.AnomalyService
+	ForecastService     *services.ForecastService
+}
+
 // SetupRoutes configures all API routes
-func SetupRoutes(router *gin.Engine, telemetryService *services.TelemetryService, websocketManager *services.WebSocketManager) {
+func SetupRoutes(router *gin.Engine, svc Services) {
 	// Create handlers
-	telemetryHandlers := handlers.NewTelemetryHandlers(telemetryService)
+	telemetryHandlers := handlers.NewTelemetryHandlers(svc.TelemetryService, svc.ForecastService)
+	alarmHandlers := handlers.NewAlarmHandlers(svc.AlarmService)
+	exportHandlers := handlers.NewExportHandlers(services.NewExportService(svc.TelemetryService))
+	importHandlers := handlers.NewImportHandlers(services.NewImportService(svc.TelemetryService))
+	queryHandlers := handlers.NewQueryHandlers(svc.TelemetryService)
+	promHandlers := handlers.NewPromHandlers(svc.TelemetryService)
+	dashboardHandlers := handlers.NewDashboardHandlers(svc.DashboardService)
+	assetHandlers := handlers.NewAssetHandlers(svc.AssetService)
+	profileHandlers := handlers.NewProfileHandlers(svc.TelemetryService)
+	rpcHandlers := handlers.NewRPCHandlers(svc.RPCService, svc.ConnectivityMonitor)
+	webhookHandlers := handlers.NewWebhookHandlers(svc.WebhookService)
+	notificationHandlers := handlers.NewNotificationHandlers(svc.NotificationService)
+	anomalyHandlers := handlers.NewAnomalyHandlers(svc.AnomalyService)
 
 	// API v1 group
 	v1 := router.Group("/api/v1")
@@ -23,6 +53,9 @@ func SetupRoutes(router *gin.Engine, telemetryService *services.TelemetryService
 			telemetry.GET("/latest/:deviceId", telemetryHandlers.GetLatestTelemetry)
 			telemetry.GET("/devices/:id/keys", telemetryHandlers.GetDeviceTelemetryKeys)
 			telemetry.POST("/timeseries", telemetryHandlers.GetTimeSeriesData)
+			telemetry.POST("/timeseries/batch", telemetryHandlers.GetBatchTimeSeriesData)
+			telemetry.GET("/export", exportHandlers.ExportTelemetry)
+			telemetry.POST("/import", importHandlers.ImportTelemetry)
 
 			// New entity-based endpoints
 			telemetry.GET("/keys/mappings", telemetryHandlers.GetTelemetryKeyMappings)
@@ -30,17 +63,129 @@ func SetupRoutes(router *gin.Engine, telemetryService *services.TelemetryService
 			telemetry.GET("/entities/:id/data", telemetryHandlers.GetTelemetryEntityData)
 		}
 
+		// Device profile endpoints
+		profiles := v1.Group("/profiles")
+		{
+			profiles.GET("", profileHandlers.GetProfiles)
+			profiles.GET("/:name", profileHandlers.GetProfile)
+			profiles.GET("/:name/devices", profileHandlers.GetProfileDevices)
+		}
+
+		// Query language endpoint
+		v1.GET("/query", queryHandlers.RunQuery)
+		v1.POST("/query", queryHandlers.RunQuery)
+
+		// Server-Sent Events alternative to the WebSocket endpoint
+		if svc.StreamManager != nil {
+			v1.GET("/stream", handlers.NewStreamHandlers(svc.StreamManager, svc.TelemetryService).Stream)
+		}
+
+		// Prometheus-compatible read endpoints
+		setupPromRoutes(v1.Group("/prom"), promHandlers)
+
+		// Alarm endpoints
+		alarms := v1.Group("/alarms")
+		{
+			alarms.GET("", alarmHandlers.GetAlarms)
+			alarms.GET("/rules", alarmHandlers.GetAlarmRules)
+			alarms.GET("/:id", alarmHandlers.GetAlarm)
+			alarms.POST("/:id/ack", alarmHandlers.AcknowledgeAlarm)
+		}
+
+		// Device RPC and connectivity endpoints
+		v1.POST("/rpc/:deviceId", rpcHandlers.CallDevice)
+		v1.GET("/connectivity", rpcHandlers.GetConnectivity)
+
+		// Webhook endpoints
+		webhooks := v1.Group("/webhooks")
+		{
+			webhooks.GET("/targets", webhookHandlers.GetTargets)
+			webhooks.POST("/targets/:name/test", webhookHandlers.TestTarget)
+			webhooks.GET("/deliveries", webhookHandlers.GetDeliveries)
+			webhooks.GET("/dead-letters", webhookHandlers.GetDeadLetters)
+			webhooks.POST("/dead-letters/:id/retry", webhookHandlers.RetryDeadLetter)
+			webhooks.DELETE("/dead-letters/:id", webhookHandlers.DeleteDeadLetter)
+		}
+
+		// Email and SMS notification endpoints
+		notifications := v1.Group("/notifications")
+		{
+			notifications.GET("", notificationHandlers.GetNotifications)
+			notifications.GET("/groups", notificationHandlers.GetGroups)
+			notifications.GET("/policies", notificationHandlers.GetPolicies)
+			notifications.GET("/escalations", notificationHandlers.GetEscalations)
+			notifications.POST("/test", notificationHandlers.TestNotification)
+		}
+
+		// Anomaly detection endpoints
+		anomalies := v1.Group("/anomalies")
+		{
+			anomalies.GET("", anomalyHandlers.GetAnomalies)
+			anomalies.GET("/detectors", anomalyHandlers.GetDetectors)
+		}
+
+		// Asset endpoints
+		assets := v1.Group("/assets")
+		{
+			assets.GET("", assetHandlers.GetAssets)
+			assets.POST("", assetHandlers.CreateAsset)
+			assets.GET("/:id", assetHandlers.GetAsset)
+			assets.PUT("/:id", assetHandlers.UpdateAsset)
+			assets.DELETE("/:id", assetHandlers.DeleteAsset)
+			assets.GET("/:id/devices", assetHandlers.GetAssetDevices)
+			assets.GET("/:id/rollup", assetHandlers.GetAssetRollup)
+		}
+
+		// Relation endpoints
+		relations := v1.Group("/relations")
+		{
+			relations.GET("", assetHandlers.GetRelations)
+			relations.POST("", assetHandlers.CreateRelation)
+			relations.DELETE("", assetHandlers.DeleteRelation)
+			relations.POST("/query", assetHandlers.QueryRelations)
+		}
+
+		// Entity alias resolution
+		v1.POST("/aliases/resolve", handlers.NewEntityAliasHandlers(svc.AliasResolver).ResolveAlias)
+
+		// Dashboard definition endpoints
+		dashboards := v1.Group("/dashboards")
+		{
+			dashboards.GET("", dashboardHandlers.GetDashboards)
+			dashboards.POST("", dashboardHandlers.CreateDashboard)
+			dashboards.POST("/import", dashboardHandlers.ImportDashboard)
+			dashboards.GET("/:id", dashboardHandlers.GetDashboard)
+			dashboards.PUT("/:id", dashboardHandlers.UpdateDashboard)
+			dashboards.DELETE("/:id", dashboardHandlers.DeleteDashboard)
+			dashboards.GET("/:id/export", dashboardHandlers.ExportDashboard)
+			dashboards.GET("/:id/aliases", dashboardHandlers.ResolveDashboardAliases)
+			dashboards.GET("/:id/versions", dashboardHandlers.GetDashboardVersions)
+			dashboards.GET("/:id/versions/:version", dashboardHandlers.GetDashboardVersion)
+			dashboards.POST("/:id/versions/:version/restore", dashboardHandlers.RestoreDashboardVersion)
+			dashboards.POST("/:id/customers/:customerId", dashboardHandlers.AssignDashboardCustomer)
+			dashboards.DELETE("/:id/customers/:customerId", dashboardHandlers.UnassignDashboardCustomer)
+		}
+
 		// System endpoints
 		system := v1.Group("/system")
 		{
 			system.GET("/status", telemetryHandlers.GetSystemStatus)
+			if svc.WebSocketManager != nil {
+				system.GET("/websocket", handlers.NewWebSocketHandlers(svc.WebSocketManager).GetMetrics)
+			}
 		}
 	}
 
+	// Grafana appends /api/v1/... to the datasource URL, so the same
+	// endpoints are served for a datasource URL of http://<host>/prom
+	setupPromRoutes(router.Group("/prom/api/v1"), promHandlers)
+
 	// WebSocket endpoint
-	router.GET("/ws", func(c *gin.Context) {
-		websocketManager.HandleWebSocket(c.Writer, c.Request)
-	})
+	if svc.WebSocketManager != nil {
+		router.GET("/ws", func(c *gin.Context) {
+			svc.WebSocketManager.HandleWebSocket(c.Writer, c.Request)
+		})
+	}
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -56,10 +201,24 @@ func SetupRoutes(router *gin.Engine, telemetryService *services.TelemetryService
 			"message": "ThingsBoard Widget Backend API",
 			"version": "1.0.0",
 			"endpoints": gin.H{
-				"api":       "/api/v1",
-				"websocket": "/ws",
-				"health":    "/health",
+				"api":        "/api/v1",
+				"websocket":  "/ws",
+				"stream":     "/api/v1/stream",
+				"dashboards": "/api/v1/dashboards",
+				"health":     "/health",
 			},
 		})
 	})
 }
+
+// setupPromRoutes registers the Prometheus HTTP API subset on a group
+func setupPromRoutes(group *gin.RouterGroup, promHandlers *handlers.PromHandlers) {
+	group.GET("/query", promHandlers.Query)
+	group.POST("/query", promHandlers.Query)
+	group.GET("/query_range", promHandlers.QueryRange)
+	group.POST("/query_range", promHandlers.QueryRange)
+	group.GET("/series", promHandlers.Series)
+	group.POST("/series", promHandlers.Series)
+	group.GET("/labels", promHandlers.Labels)
+	group.GET("/label/:name/values", promHandlers.LabelValues)
+}
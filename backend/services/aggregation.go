@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"thingsboard-widget-backend/models"
+)
+
+// aggregator accumulates numeric values for one bucket
+type aggregator struct {
+	sum    float64
+	min    float64
+	max    float64
+	last   float64
+	lastTs int64 // timestamp (ms) of last
+	count  int
+}
+
+// add accumulates a value read at ts (ms) into the bucket. Last stays the
+// value with the latest timestamp even when values arrive out of order; of
+// values sharing a timestamp the one added last wins.
+func (a *aggregator) add(ts int64, value float64) {
+	if a.count == 0 {
+		a.min = value
+		a.max = value
+	} else {
+		a.min = math.Min(a.min, value)
+		a.max = math.Max(a.max, value)
+	}
+	a.sum += value
+	if a.count == 0 || ts >= a.lastTs {
+		a.last = value
+		a.lastTs = ts
+	}
+	a.count++
+}
+
+// merge combines another accumulator into this one, keeping the newer last
+func (a *aggregator) merge(other aggregator) {
+	if other.count == 0 {
+		return
+	}
+	if a.count == 0 {
+		*a = other
+		return
+	}
+	a.min = math.Min(a.min, other.min)
+	a.max = math.Max(a.max, other.max)
+	a.sum += other.sum
+	if other.lastTs >= a.lastTs {
+		a.last = other.last
+		a.lastTs = other.lastTs
+	}
+	a.count += other.count
+}
+
+// result returns the aggregated value for the given function
+func (a *aggregator) result(agg string) float64 {
+	switch agg {
+	case models.AggregationMin:
+		return a.min
+	case models.AggregationMax:
+		return a.max
+	case models.AggregationSum:
+		return a.sum
+	case models.AggregationCount:
+		return float64(a.count)
+	case models.AggregationLast:
+		return a.last
+	default:
+		if a.count == 0 {
+			return 0
+		}
+		return a.sum / float64(a.count)
+	}
+}
+
+// bucketStart returns the start of the interval bucket containing ts (milliseconds)
+func bucketStart(ts, interval int64) int64 {
+	if interval <= 0 {
+		return ts
+	}
+	return ts - ((ts%interval)+interval)%interval
+}
+
+// bucketCount returns the number of interval buckets from the one containing
+// start to the one containing end, or math.MaxInt64 if that overflows
+func bucketCount(start, end, interval int64) int64 {
+	if end < start {
+		return 0
+	}
+	span := bucketStart(end, interval) - bucketStart(start, interval)
+	if span < 0 || span/interval == math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return span/interval + 1
+}
+
+// checkBucketCount rejects aggregated ranges with more than maxQueryBuckets buckets
+func checkBucketCount(start, end, interval int64) error {
+	if buckets := bucketCount(start, end, interval); buckets > maxQueryBuckets {
+		return fmt.Errorf("range would produce more than %d buckets per series; use a larger interval or a shorter range", maxQueryBuckets)
+	}
+	return nil
+}
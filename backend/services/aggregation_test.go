@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestAggregatorKeepsLatestLast(t *testing.T) {
+	var newer, older aggregator
+	newer.add(2000, 20)
+	newer.add(1500, 15) // out of order
+	older.add(1000, 10)
+
+	merged := newer
+	merged.merge(older)
+	if got := merged.result(models.AggregationLast); got != 20 {
+		t.Errorf("newer.merge(older) last = %v, want 20", got)
+	}
+	merged = older
+	merged.merge(newer)
+	if got := merged.result(models.AggregationLast); got != 20 {
+		t.Errorf("older.merge(newer) last = %v, want 20", got)
+	}
+	if merged.count != 3 || merged.min != 10 || merged.max != 20 || merged.sum != 45 {
+		t.Errorf("merged = %+v", merged)
+	}
+}
+
+func TestRunQueryLastAcrossDevices(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	bucket := bucketStart(time.Now().UnixMilli(), hour) - hour
+
+	for _, text := range []string{"last humidity over last 2h", "last humidity over last 2h, 1h buckets"} {
+		t.Run(text, func(t *testing.T) {
+			ts := newTestTelemetryService(t)
+			// device_002 is scanned after device_001 but reported earlier
+			ts.StoreHistorical([]models.TelemetryData{
+				{DeviceID: "device_001", Timestamp: time.UnixMilli(bucket + 40*time.Minute.Milliseconds()), Values: map[string]interface{}{"humidity": 60.0}},
+				{DeviceID: "device_002", Timestamp: time.UnixMilli(bucket + 20*time.Minute.Milliseconds()), Values: map[string]interface{}{"humidity": 50.0}},
+			})
+
+			response, err := ts.RunQuery(text)
+			if err != nil {
+				t.Fatalf("RunQuery: %v", err)
+			}
+			if len(response.Results) != 1 {
+				t.Fatalf("got %d groups, want 1", len(response.Results))
+			}
+			points := response.Results[0].Data["last(humidity)"]
+			if len(points) != 1 || points[0][1] != 60 {
+				t.Fatalf("last(humidity) = %v, want the newest reading 60", points)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxStoredAlarms bounds how many alarms are kept; the oldest cleared ones are dropped first
+const maxStoredAlarms = 1000
+
+// AlarmBroadcaster interface for broadcasting alarm changes
+type AlarmBroadcaster interface {
+	BroadcastAlarm(alarm models.Alarm)
+}
+
+// AlarmService evaluates alarm rules against live telemetry and tracks alarms
+type AlarmService struct {
+	rules        []models.AlarmRule
+	alarms       map[string]*models.Alarm // alarm ID -> alarm
+	active       map[string]string        // rule name + device ID -> active alarm ID
+	mutex        sync.RWMutex
+	broadcasters []AlarmBroadcaster
+}
+
+// NewAlarmService creates a new alarm service with the given rules
+func NewAlarmService(rules []models.AlarmRule) *AlarmService {
+	service := &AlarmService{
+		alarms: make(map[string]*models.Alarm),
+		active: make(map[string]string),
+	}
+	service.SetRules(rules)
+	return service
+}
+
+// SetRules replaces the alarm rule set. Active alarms whose rule was removed are cleared.
+func (as *AlarmService) SetRules(rules []models.AlarmRule) {
+	as.mutex.Lock()
+	as.rules = append([]models.AlarmRule(nil), rules...)
+
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = true
+	}
+
+	var cleared []models.Alarm
+	now := time.Now()
+	for activeKey, alarmID := range as.active {
+		alarm := as.alarms[alarmID]
+		if names[alarm.RuleName] {
+			continue
+		}
+		as.clearLocked(alarm, now)
+		delete(as.active, activeKey)
+		cleared = append(cleared, *alarm)
+	}
+	as.mutex.Unlock()
+
+	for _, alarm := range cleared {
+		as.broadcast(alarm)
+	}
+	logrus.Infof("Loaded %d alarm rules", len(rules))
+}
+
+// GetRules returns the current alarm rules
+func (as *AlarmService) GetRules() []models.AlarmRule {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	return append([]models.AlarmRule(nil), as.rules...)
+}
+
+// OnTelemetry evaluates all matching rules against a telemetry reading
+func (as *AlarmService) OnTelemetry(telemetryData models.TelemetryData) {
+	as.mutex.Lock()
+	var changed []models.Alarm
+
+	for _, rule := range as.rules {
+		if !ruleMatchesDevice(rule, telemetryData) {
+			continue
+		}
+		raw, exists := telemetryData.Values[rule.Key]
+		if !exists {
+			continue
+		}
+		value, ok := numericValue(raw)
+		if !ok {
+			continue
+		}
+
+		activeKey := rule.Name + "|" + telemetryData.DeviceID
+		alarmID, isActive := as.active[activeKey]
+
+		if evaluateCondition(rule.Condition, value, rule.Threshold) {
+			if isActive {
+				alarm := as.alarms[alarmID]
+				alarm.Value = value
+				if alarm.Severity != rule.Severity {
+					alarm.Severity = rule.Severity
+					changed = append(changed, *alarm)
+				}
+				continue
+			}
+
+			alarm := &models.Alarm{
+				ID:         uuid.NewString(),
+				RuleName:   rule.Name,
+				DeviceID:   telemetryData.DeviceID,
+				DeviceName: telemetryData.DeviceName,
+				Key:        rule.Key,
+				Value:      value,
+				Threshold:  rule.Threshold,
+				Condition:  rule.Condition,
+				Severity:   rule.Severity,
+				Status:     models.AlarmStatusActiveUnack,
+				StartTs:    telemetryData.Timestamp,
+			}
+			as.alarms[alarm.ID] = alarm
+			as.active[activeKey] = alarm.ID
+			changed = append(changed, *alarm)
+			logrus.Warnf("Alarm raised: %s on %s (%s=%v)", rule.Name, telemetryData.DeviceID, rule.Key, value)
+		} else if isActive {
+			alarm := as.alarms[alarmID]
+			alarm.Value = value
+			as.clearLocked(alarm, telemetryData.Timestamp)
+			delete(as.active, activeKey)
+			changed = append(changed, *alarm)
+			logrus.Infof("Alarm cleared: %s on %s", rule.Name, telemetryData.DeviceID)
+		}
+	}
+	as.pruneLocked()
+	as.mutex.Unlock()
+
+	for _, alarm := range changed {
+		as.broadcast(alarm)
+	}
+}
+
+// GetAlarms returns alarms filtered by device ID and status (empty matches all), newest first
+func (as *AlarmService) GetAlarms(deviceID, status string) []models.Alarm {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	alarms := make([]models.Alarm, 0, len(as.alarms))
+	for _, alarm := range as.alarms {
+		if deviceID != "" && alarm.DeviceID != deviceID {
+			continue
+		}
+		if status != "" && alarm.Status != status {
+			continue
+		}
+		alarms = append(alarms, *alarm)
+	}
+
+	sort.Slice(alarms, func(i, j int) bool {
+		return alarms[i].StartTs.After(alarms[j].StartTs)
+	})
+	return alarms
+}
+
+// GetAlarm returns a specific alarm
+func (as *AlarmService) GetAlarm(alarmID string) (*models.Alarm, bool) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	alarm, exists := as.alarms[alarmID]
+	if !exists {
+		return nil, false
+	}
+	copied := *alarm
+	return &copied, true
+}
+
+// AcknowledgeAlarm marks an alarm as acknowledged
+func (as *AlarmService) AcknowledgeAlarm(alarmID string) (*models.Alarm, bool) {
+	as.mutex.Lock()
+	alarm, exists := as.alarms[alarmID]
+	if !exists {
+		as.mutex.Unlock()
+		return nil, false
+	}
+
+	if !alarm.IsAcknowledged() {
+		now := time.Now()
+		alarm.AckTs = &now
+		if alarm.IsActive() {
+			alarm.Status = models.AlarmStatusActiveAck
+		} else {
+			alarm.Status = models.AlarmStatusClearedAck
+		}
+	}
+	copied := *alarm
+	as.mutex.Unlock()
+
+	as.broadcast(copied)
+	return &copied, true
+}
+
+// AddBroadcaster registers an alarm broadcaster.
+// Broadcasters must be added before the simulation starts.
+func (as *AlarmService) AddBroadcaster(broadcaster AlarmBroadcaster) {
+	as.broadcasters = append(as.broadcasters, broadcaster)
+}
+
+// clearLocked moves an alarm to its cleared status. Caller must hold as.mutex.
+func (as *AlarmService) clearLocked(alarm *models.Alarm, ts time.Time) {
+	alarm.EndTs = &ts
+	if alarm.IsAcknowledged() {
+		alarm.Status = models.AlarmStatusClearedAck
+	} else {
+		alarm.Status = models.AlarmStatusClearedUnack
+	}
+}
+
+// pruneLocked drops the oldest cleared alarms above maxStoredAlarms. Caller must hold as.mutex.
+func (as *AlarmService) pruneLocked() {
+	excess := len(as.alarms) - maxStoredAlarms
+	if excess <= 0 {
+		return
+	}
+
+	cleared := make([]*models.Alarm, 0, len(as.alarms))
+	for _, alarm := range as.alarms {
+		if !alarm.IsActive() {
+			cleared = append(cleared, alarm)
+		}
+	}
+	sort.Slice(cleared, func(i, j int) bool {
+		return cleared[i].EndTs.Before(*cleared[j].EndTs)
+	})
+	for i := 0; i < excess && i < len(cleared); i++ {
+		delete(as.alarms, cleared[i].ID)
+	}
+}
+
+func (as *AlarmService) broadcast(alarm models.Alarm) {
+	for _, broadcaster := range as.broadcasters {
+		broadcaster.BroadcastAlarm(alarm)
+	}
+}
+
+// ruleMatchesDevice reports whether a rule applies to the reading's device
+func ruleMatchesDevice(rule models.AlarmRule, telemetryData models.TelemetryData) bool {
+	if rule.DeviceID != "" && rule.DeviceID != telemetryData.DeviceID {
+		return false
+	}
+	if rule.DeviceType != "" && rule.DeviceType != telemetryData.DeviceType {
+		return false
+	}
+	if rule.Profile != "" && rule.Profile != telemetryData.Profile {
+		return false
+	}
+	return true
+}
+
+// numericValue converts a telemetry value to float64; booleans map to 1/0
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// evaluateCondition applies a rule condition to a value
+func evaluateCondition(condition string, value, threshold float64) bool {
+	switch condition {
+	case models.AlarmConditionGreater:
+		return value > threshold
+	case models.AlarmConditionGreaterEqual:
+		return value >= threshold
+	case models.AlarmConditionLess:
+		return value < threshold
+	case models.AlarmConditionLessEqual:
+		return value <= threshold
+	case models.AlarmConditionEqual:
+		return value == threshold
+	case models.AlarmConditionNotEqual:
+		return value != threshold
+	}
+	return false
+}
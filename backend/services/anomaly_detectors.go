@@ -0,0 +1,156 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// maxAnomalyScore caps scores of readings off a baseline without any spread
+const maxAnomalyScore = 1e6
+
+// baseline learns what a key's readings look like and predicts the next one
+type baseline interface {
+	// expected returns the expected value and standard deviation of a
+	// reading at t, and whether enough readings were seen to score it
+	expected(t time.Time) (mean, stdDev float64, ready bool)
+	// add learns a reading
+	add(t time.Time, value float64)
+	// samples returns how many readings were learned
+	samples() int
+}
+
+// newBaseline creates the baseline of a detector's method
+func newBaseline(detector models.AnomalyDetector, location *time.Location) baseline {
+	switch detector.Method {
+	case models.AnomalyMethodSeasonal:
+		return &seasonalBaseline{
+			location:   location,
+			alpha:      1 / float64(detector.Window),
+			minSamples: detector.MinSamples,
+		}
+	case models.AnomalyMethodEWMA:
+		return &ewmaBaseline{alpha: detector.Alpha, minSamples: detector.MinSamples}
+	}
+	return &zscoreBaseline{
+		values:     make([]float64, 0, detector.Window),
+		window:     detector.Window,
+		minSamples: detector.MinSamples,
+	}
+}
+
+// anomalyScore returns how many standard deviations value is from mean
+func anomalyScore(value, mean, stdDev float64) float64 {
+	deviation := math.Abs(value - mean)
+	if deviation == 0 {
+		return 0
+	}
+	if stdDev == 0 {
+		return maxAnomalyScore
+	}
+	return math.Min(deviation/stdDev, maxAnomalyScore)
+}
+
+// ewStats is an exponentially weighted mean and variance. Until 1/alpha
+// readings were seen every reading weighs the same, so early readings do not
+// bias the mean towards the first one.
+type ewStats struct {
+	count    int
+	mean     float64
+	variance float64
+}
+
+func (s *ewStats) add(value, alpha float64) {
+	s.count++
+	weight := math.Max(alpha, 1/float64(s.count))
+	diff := value - s.mean
+	increment := weight * diff
+	s.mean += increment
+	s.variance = (1 - weight) * (s.variance + diff*increment)
+}
+
+// zscoreBaseline is the mean and standard deviation of the last window readings
+type zscoreBaseline struct {
+	values     []float64 // ring buffer
+	next       int
+	window     int
+	minSamples int
+	count      int
+}
+
+func (b *zscoreBaseline) expected(time.Time) (float64, float64, bool) {
+	n := len(b.values)
+	if n < b.minSamples {
+		return 0, 0, false
+	}
+	sum := 0.0
+	for _, value := range b.values {
+		sum += value
+	}
+	mean := sum / float64(n)
+	squares := 0.0
+	for _, value := range b.values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(n-1)), true
+}
+
+func (b *zscoreBaseline) add(_ time.Time, value float64) {
+	b.count++
+	if len(b.values) < b.window {
+		b.values = append(b.values, value)
+		return
+	}
+	b.values[b.next] = value
+	b.next = (b.next + 1) % b.window
+}
+
+func (b *zscoreBaseline) samples() int {
+	return b.count
+}
+
+// ewmaBaseline is an exponentially weighted moving average and variance
+type ewmaBaseline struct {
+	stats      ewStats
+	alpha      float64
+	minSamples int
+}
+
+func (b *ewmaBaseline) expected(time.Time) (float64, float64, bool) {
+	return b.stats.mean, math.Sqrt(b.stats.variance), b.stats.count >= b.minSamples
+}
+
+func (b *ewmaBaseline) add(_ time.Time, value float64) {
+	b.stats.add(value, b.alpha)
+}
+
+func (b *ewmaBaseline) samples() int {
+	return b.stats.count
+}
+
+// seasonalBaseline keeps a separate weighted mean and variance for every hour
+// of the day, so a reading is compared with readings at the same time of day
+type seasonalBaseline struct {
+	hours      [24]ewStats
+	location   *time.Location
+	alpha      float64
+	minSamples int
+}
+
+func (b *seasonalBaseline) expected(t time.Time) (float64, float64, bool) {
+	stats := b.hours[t.In(b.location).Hour()]
+	return stats.mean, math.Sqrt(stats.variance), stats.count >= b.minSamples
+}
+
+func (b *seasonalBaseline) add(t time.Time, value float64) {
+	b.hours[t.In(b.location).Hour()].add(value, b.alpha)
+}
+
+func (b *seasonalBaseline) samples() int {
+	total := 0
+	for _, stats := range b.hours {
+		total += stats.count
+	}
+	return total
+}
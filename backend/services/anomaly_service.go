@@ -0,0 +1,269 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// AnomalyListener is notified when a key's readings become anomalous
+type AnomalyListener interface {
+	OnAnomaly(event models.AnomalyEvent)
+}
+
+// detectorState is a detector's baseline for one device
+type detectorState struct {
+	baseline  baseline
+	lastScore *float64
+	lastTs    time.Time
+	anomalous bool
+}
+
+// AnomalyService scores live telemetry with the configured detectors. Scores
+// are recorded as telemetry of the device under each detector's score key,
+// where alarm rules can use them, and an anomaly event is raised whenever a
+// key's readings become anomalous.
+type AnomalyService struct {
+	telemetryService *TelemetryService
+	timezone         string
+	location         *time.Location
+	history          time.Duration
+	detectors        []models.AnomalyDetector
+	states           map[string]map[string]*detectorState // detector name -> device ID -> state
+	events           []models.AnomalyEvent                // oldest first
+	eventLogSize     int
+	listeners        []AnomalyListener // fixed once the simulation starts
+	mutex            sync.RWMutex
+}
+
+// NewAnomalyService creates an anomaly service with the given detectors
+func NewAnomalyService(telemetryService *TelemetryService, cfg config.AnomaliesConfig) *AnomalyService {
+	service := &AnomalyService{
+		telemetryService: telemetryService,
+		states:           make(map[string]map[string]*detectorState),
+		eventLogSize:     cfg.EventLogSize,
+	}
+	service.SetConfig(cfg)
+	return service
+}
+
+// SetConfig replaces the detectors. Baselines of unchanged detectors are
+// kept; changed and new detectors learn again, starting from stored history.
+func (as *AnomalyService) SetConfig(cfg config.AnomaliesConfig) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	previous := make(map[string]models.AnomalyDetector, len(as.detectors))
+	for _, detector := range as.detectors {
+		previous[detector.Name] = detector
+	}
+	keep := make(map[string]bool, len(cfg.Detectors))
+	for _, detector := range cfg.Detectors {
+		old, exists := previous[detector.Name]
+		keep[detector.Name] = exists && reflect.DeepEqual(old, detector) &&
+			(detector.Method != models.AnomalyMethodSeasonal || cfg.Timezone == as.timezone)
+	}
+	for name := range as.states {
+		if !keep[name] {
+			delete(as.states, name)
+		}
+	}
+
+	as.timezone = cfg.Timezone
+	as.location = location
+	as.history = cfg.History
+	as.detectors = append([]models.AnomalyDetector(nil), cfg.Detectors...)
+	logrus.Infof("Loaded %d anomaly detectors", len(cfg.Detectors))
+}
+
+// AddListener registers an anomaly listener
+func (as *AnomalyService) AddListener(listener AnomalyListener) {
+	as.listeners = append(as.listeners, listener)
+}
+
+// Enrich scores a reading with every matching detector and returns the scores
+// to record with it. It implements TelemetryEnricher.
+func (as *AnomalyService) Enrich(telemetryData models.TelemetryData) map[string]interface{} {
+	as.mutex.Lock()
+	scores := make(map[string]interface{})
+	var events []models.AnomalyEvent
+
+	for _, detector := range as.detectors {
+		if !detectorMatchesDevice(detector, telemetryData) {
+			continue
+		}
+		value, ok := numericValue(telemetryData.Values[detector.Key])
+		if !ok {
+			continue
+		}
+
+		devices, exists := as.states[detector.Name]
+		if !exists {
+			devices = make(map[string]*detectorState)
+			as.states[detector.Name] = devices
+		}
+		state, exists := devices[telemetryData.DeviceID]
+		if !exists {
+			state = &detectorState{baseline: newBaseline(detector, as.location)}
+			as.seedLocked(detector, state, telemetryData)
+			devices[telemetryData.DeviceID] = state
+		}
+
+		mean, stdDev, ready := state.baseline.expected(telemetryData.Timestamp)
+		state.baseline.add(telemetryData.Timestamp, value)
+		state.lastTs = telemetryData.Timestamp
+		if !ready {
+			continue
+		}
+
+		score := anomalyScore(value, mean, stdDev)
+		state.lastScore = &score
+		scores[detector.ScoreKey] = math.Round(score*1000) / 1000
+
+		anomalous := score >= detector.Threshold
+		if anomalous && !state.anomalous {
+			event := models.AnomalyEvent{
+				ID:         uuid.New().String(),
+				Detector:   detector.Name,
+				Method:     detector.Method,
+				DeviceID:   telemetryData.DeviceID,
+				DeviceName: telemetryData.DeviceName,
+				Key:        detector.Key,
+				Value:      value,
+				Expected:   mean,
+				StdDev:     stdDev,
+				Score:      score,
+				Threshold:  detector.Threshold,
+				Direction:  models.AnomalyDirectionHigh,
+				Timestamp:  telemetryData.Timestamp,
+			}
+			if value < mean {
+				event.Direction = models.AnomalyDirectionLow
+			}
+			as.recordLocked(event)
+			events = append(events, event)
+			logrus.Warnf("Anomaly detected by %s on %s: %s=%v, expected %.3f ± %.3f (score %.2f)",
+				detector.Name, telemetryData.DeviceID, detector.Key, value, mean, stdDev, score)
+		}
+		state.anomalous = anomalous
+	}
+	as.mutex.Unlock()
+
+	for _, event := range events {
+		for _, listener := range as.listeners {
+			listener.OnAnomaly(event)
+		}
+	}
+	return scores
+}
+
+// seedLocked teaches a new baseline the stored readings preceding the
+// current one, so detectors need not wait for live readings after a restart
+// or reload. Caller must hold as.mutex.
+func (as *AnomalyService) seedLocked(detector models.AnomalyDetector, state *detectorState, telemetryData models.TelemetryData) {
+	if as.history <= 0 {
+		return
+	}
+	end := telemetryData.Timestamp.Add(-time.Millisecond)
+	points := as.telemetryService.GetKeyPoints(telemetryData.DeviceID, detector.Key, telemetryData.Timestamp.Add(-as.history), end)
+	for _, point := range points {
+		state.baseline.add(time.UnixMilli(int64(point[0])), point[1])
+	}
+	if len(points) > 0 {
+		logrus.Debugf("Seeded anomaly detector %s for %s with %d stored readings", detector.Name, telemetryData.DeviceID, len(points))
+	}
+}
+
+// recordLocked appends to the event log, dropping the oldest above its size.
+// Caller must hold as.mutex.
+func (as *AnomalyService) recordLocked(event models.AnomalyEvent) {
+	as.events = append(as.events, event)
+	if excess := len(as.events) - as.eventLogSize; excess > 0 {
+		as.events = append([]models.AnomalyEvent(nil), as.events[excess:]...)
+	}
+}
+
+// GetEvents returns anomaly events newest first, optionally filtered by
+// device ID, key and detector name
+func (as *AnomalyService) GetEvents(deviceID, key, detector string) []models.AnomalyEvent {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	events := []models.AnomalyEvent{}
+	for i := len(as.events) - 1; i >= 0; i-- {
+		event := as.events[i]
+		if (deviceID != "" && event.DeviceID != deviceID) ||
+			(key != "" && event.Key != key) ||
+			(detector != "" && event.Detector != detector) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// GetDetectors returns the detectors in configuration order with the
+// baseline each keeps per device
+func (as *AnomalyService) GetDetectors() []models.AnomalyDetectorStatus {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	statuses := make([]models.AnomalyDetectorStatus, 0, len(as.detectors))
+	for _, detector := range as.detectors {
+		status := models.AnomalyDetectorStatus{
+			AnomalyDetector: detector,
+			Devices:         []models.AnomalyDetectorState{},
+		}
+		for deviceID, state := range as.states[detector.Name] {
+			entry := models.AnomalyDetectorState{
+				DeviceID:  deviceID,
+				Samples:   state.baseline.samples(),
+				LastScore: state.lastScore,
+				Anomalous: state.anomalous,
+			}
+			if !state.lastTs.IsZero() {
+				lastTs := state.lastTs
+				entry.LastTs = &lastTs
+				// The baseline the next reading will be scored against
+				if mean, stdDev, ready := state.baseline.expected(lastTs); ready {
+					entry.Ready = true
+					entry.Expected = &mean
+					entry.StdDev = &stdDev
+				}
+			}
+			status.Devices = append(status.Devices, entry)
+		}
+		sort.Slice(status.Devices, func(i, j int) bool {
+			return status.Devices[i].DeviceID < status.Devices[j].DeviceID
+		})
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// detectorMatchesDevice reports whether a detector applies to the reading's device
+func detectorMatchesDevice(detector models.AnomalyDetector, telemetryData models.TelemetryData) bool {
+	if detector.DeviceID != "" && detector.DeviceID != telemetryData.DeviceID {
+		return false
+	}
+	if detector.DeviceType != "" && detector.DeviceType != telemetryData.DeviceType {
+		return false
+	}
+	if detector.Profile != "" && detector.Profile != telemetryData.Profile {
+		return false
+	}
+	return true
+}
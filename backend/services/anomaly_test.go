@@ -0,0 +1,237 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/spf13/viper"
+)
+
+// closeTo reports whether two values differ by at most tolerance
+func closeTo(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestAnomalyScore(t *testing.T) {
+	tests := []struct {
+		value, mean, stdDev float64
+		want                float64
+	}{
+		{10, 10, 0, 0},
+		{13, 10, 1.5, 2},
+		{7, 10, 1.5, 2},
+		{12, 10, 0, maxAnomalyScore}, // off a baseline without spread
+		{1e12, 0, 1e-9, maxAnomalyScore},
+	}
+	for _, tt := range tests {
+		if got := anomalyScore(tt.value, tt.mean, tt.stdDev); got != tt.want {
+			t.Errorf("anomalyScore(%v, %v, %v) = %v, want %v", tt.value, tt.mean, tt.stdDev, got, tt.want)
+		}
+	}
+}
+
+// checkExpected compares a baseline's prediction at ts with the wanted one
+func checkExpected(t *testing.T, b baseline, ts time.Time, wantMean, wantStdDev float64, wantReady bool) {
+	t.Helper()
+	mean, stdDev, ready := b.expected(ts)
+	if ready != wantReady {
+		t.Fatalf("ready = %v, want %v", ready, wantReady)
+	}
+	if ready && (!closeTo(mean, wantMean, 1e-9) || !closeTo(stdDev, wantStdDev, 1e-9)) {
+		t.Errorf("got %v ± %v, want %v ± %v", mean, stdDev, wantMean, wantStdDev)
+	}
+}
+
+func TestBaselines(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("zscore", func(t *testing.T) {
+		b := newBaseline(models.AnomalyDetector{Method: models.AnomalyMethodZScore, Window: 3, MinSamples: 2}, time.UTC)
+		b.add(now, 1)
+		checkExpected(t, b, now, 0, 0, false)
+		b.add(now, 3)
+		checkExpected(t, b, now, 2, math.Sqrt2, true)
+		// The window keeps the latest three readings
+		b.add(now, 5)
+		b.add(now, 7)
+		checkExpected(t, b, now, 5, 2, true)
+		if b.samples() != 4 {
+			t.Errorf("got %d samples, want 4", b.samples())
+		}
+	})
+
+	t.Run("ewma", func(t *testing.T) {
+		b := newBaseline(models.AnomalyDetector{Method: models.AnomalyMethodEWMA, Alpha: 0.1, MinSamples: 3}, time.UTC)
+		b.add(now, 2)
+		b.add(now, 4)
+		checkExpected(t, b, now, 0, 0, false)
+		// Until 1/alpha readings every reading weighs the same
+		b.add(now, 6)
+		checkExpected(t, b, now, 4, math.Sqrt(8.0/3), true)
+	})
+
+	t.Run("seasonal", func(t *testing.T) {
+		hanoi := time.FixedZone("ICT", 7*60*60)
+		b := newBaseline(models.AnomalyDetector{Method: models.AnomalyMethodSeasonal, Window: 10, MinSamples: 2}, hanoi)
+		for day := 0; day < 3; day++ {
+			b.add(now.AddDate(0, 0, day), 10+float64(day))
+			b.add(now.AddDate(0, 0, day).Add(time.Hour), 50)
+		}
+		// Readings are compared with readings at the same local hour only
+		checkExpected(t, b, now.AddDate(0, 0, 3).Add(15*time.Minute), 11, math.Sqrt(2.0/3), true)
+		checkExpected(t, b, now.Add(time.Hour), 50, 0, true)
+		checkExpected(t, b, now.Add(2*time.Hour), 0, 0, false)
+		if b.samples() != 6 {
+			t.Errorf("got %d samples, want 6", b.samples())
+		}
+	})
+}
+
+// anomalyRecorder collects anomaly events
+type anomalyRecorder struct {
+	events []models.AnomalyEvent
+}
+
+func (ar *anomalyRecorder) OnAnomaly(event models.AnomalyEvent) {
+	ar.events = append(ar.events, event)
+}
+
+// newTestAnomalyService creates an anomaly service with one zscore detector
+// on the temperature of device_001, seeded from history of the given length
+func newTestAnomalyService(t *testing.T, history time.Duration) (*AnomalyService, *TelemetryService) {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	cfg.Anomalies.History = history
+	cfg.Anomalies.Detectors = []models.AnomalyDetector{{
+		Name:       "temperature_zscore",
+		DeviceID:   "device_001",
+		Key:        "temperature",
+		Method:     models.AnomalyMethodZScore,
+		Window:     10,
+		Threshold:  3,
+		MinSamples: 5,
+		ScoreKey:   "temperature_anomaly_zscore",
+	}}
+	ts := NewTelemetryService(cfg.Telemetry)
+	as := NewAnomalyService(ts, cfg.Anomalies)
+	ts.AddEnricher(as)
+	return as, ts
+}
+
+// scoreBroadcasts returns the broadcast readings carrying a temperature score
+func scoreBroadcasts(broadcast []models.TelemetryData) []models.TelemetryData {
+	var scored []models.TelemetryData
+	for _, telemetryData := range broadcast {
+		if _, ok := telemetryData.Values["temperature_anomaly_zscore"]; ok {
+			scored = append(scored, telemetryData)
+		}
+	}
+	return scored
+}
+
+// temperatureAt returns a device_001 temperature reading
+func temperatureAt(ts time.Time, value float64) models.TelemetryData {
+	return models.TelemetryData{
+		DeviceID:  "device_001",
+		Timestamp: ts,
+		Values:    map[string]interface{}{"temperature": value, "humidity": 50.0},
+	}
+}
+
+func TestAnomalyServiceScoresReadings(t *testing.T) {
+	as, ts := newTestAnomalyService(t, 0)
+	telemetry := &telemetryRecorder{}
+	ts.AddBroadcaster(telemetry)
+	anomalies := &anomalyRecorder{}
+	as.AddListener(anomalies)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	values := []float64{20, 21, 20, 21, 20, 20.5, 40, 21}
+	for i, value := range values {
+		ts.RecordTelemetry(temperatureAt(start.Add(time.Duration(i)*time.Minute), value))
+	}
+
+	// Every reading is broadcast once; the first five teach the baseline and
+	// the rest carry their score
+	if len(telemetry.broadcast) != len(values) {
+		t.Fatalf("got %d broadcasts, want %d", len(telemetry.broadcast), len(values))
+	}
+	scored := scoreBroadcasts(telemetry.broadcast)
+	if len(scored) != 3 {
+		t.Fatalf("got %d score broadcasts, want 3", len(scored))
+	}
+	for _, broadcast := range scored {
+		if _, ok := broadcast.Values["temperature"]; !ok {
+			t.Errorf("score broadcast %v lacks the scored reading", broadcast.Values)
+		}
+	}
+	normal := scored[0].Values["temperature_anomaly_zscore"].(float64)
+	high := scored[1].Values["temperature_anomaly_zscore"].(float64)
+	if normal >= 3 || high < 3 {
+		t.Errorf("got scores %v and %v, want below and above the threshold 3", normal, high)
+	}
+
+	// Only the change to anomalous raises an event, not the return to normal
+	if len(anomalies.events) != 1 {
+		t.Fatalf("got %d anomaly events, want 1", len(anomalies.events))
+	}
+	event := anomalies.events[0]
+	if event.Value != 40 || event.Direction != models.AnomalyDirectionHigh || event.Key != "temperature" ||
+		!closeTo(event.Expected, 122.5/6, 1e-9) || !event.Timestamp.Equal(start.Add(6*time.Minute)) {
+		t.Errorf("got event %+v, want a HIGH anomaly of 40 against %v", event, 122.5/6)
+	}
+	if events := as.GetEvents("device_001", "", "temperature_zscore"); len(events) != 1 || events[0].ID != event.ID {
+		t.Errorf("GetEvents returned %v, want the recorded event", events)
+	}
+	if events := as.GetEvents("device_002", "", ""); len(events) != 0 {
+		t.Errorf("GetEvents for another device returned %v", events)
+	}
+
+	latest, ok := ts.GetLatestTelemetry("device_001")
+	if !ok || latest.Values["temperature"] != 21.0 || latest.Values["temperature_anomaly_zscore"] == nil {
+		t.Errorf("latest telemetry %v, want the last reading with its score", latest)
+	}
+
+	statuses := as.GetDetectors()
+	if len(statuses) != 1 || len(statuses[0].Devices) != 1 {
+		t.Fatalf("got detector statuses %+v, want one device", statuses)
+	}
+	if state := statuses[0].Devices[0]; state.Samples != len(values) || state.Anomalous || !state.Ready {
+		t.Errorf("got state %+v, want %d samples, ready and no longer anomalous", state, len(values))
+	}
+}
+
+func TestAnomalyServiceSeedsFromHistory(t *testing.T) {
+	as, ts := newTestAnomalyService(t, time.Hour)
+	telemetry := &telemetryRecorder{}
+	ts.AddBroadcaster(telemetry)
+
+	now := time.Now().Truncate(time.Second)
+	var history []models.TelemetryData
+	for i := 1; i <= 6; i++ {
+		history = append(history, temperatureAt(now.Add(-time.Duration(i)*time.Minute), 20+float64(i%2)))
+	}
+	// Readings older than the seeding history are ignored
+	history = append(history, temperatureAt(now.Add(-2*time.Hour), 100))
+	ts.StoreHistorical(history)
+
+	// The first live reading is scored against the stored ones
+	ts.RecordTelemetry(temperatureAt(now, 20.5))
+	scored := scoreBroadcasts(telemetry.broadcast)
+	if len(scored) != 1 {
+		t.Fatalf("got %d score broadcasts, want 1", len(scored))
+	}
+	if score := scored[0].Values["temperature_anomaly_zscore"]; score != 0.0 {
+		t.Errorf("got score %v, want 0 for the mean of the stored readings", score)
+	}
+	if samples := as.GetDetectors()[0].Devices[0].Samples; samples != 7 {
+		t.Errorf("got %d samples, want 6 stored and 1 live", samples)
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// assetSeriesDelay coalesces the readings of one simulation tick, so an
+// asset's series is recorded once after all of its devices have reported
+const assetSeriesDelay = 100 * time.Millisecond
+
+// supportedSeriesAggregations lists the aggregations asset series can use
+var supportedSeriesAggregations = map[string]bool{
+	models.AggregationSum:   true,
+	models.AggregationAvg:   true,
+	models.AggregationMin:   true,
+	models.AggregationMax:   true,
+	models.AggregationCount: true,
+}
+
+// OnTelemetry schedules the series of every asset above the reporting device
+// to be recomputed. It implements TelemetryListener.
+func (as *AssetService) OnTelemetry(telemetryData models.TelemetryData) {
+	device := models.EntityID{EntityType: models.EntityTypeDevice, ID: telemetryData.DeviceID}
+
+	as.mutex.RLock()
+	var affected []string
+	for assetID, asset := range as.assets {
+		for _, relationType := range seriesRelationTypes(asset) {
+			root := models.EntityID{EntityType: models.EntityTypeAsset, ID: assetID}
+			if as.reachableLocked(root, device, relationType) {
+				affected = append(affected, assetID)
+				break
+			}
+		}
+	}
+	as.mutex.RUnlock()
+	if len(affected) == 0 {
+		return
+	}
+
+	as.pendingMutex.Lock()
+	defer as.pendingMutex.Unlock()
+	for _, assetID := range affected {
+		if telemetryData.Timestamp.After(as.pending[assetID]) {
+			as.pending[assetID] = telemetryData.Timestamp
+		}
+	}
+	if !as.flushScheduled {
+		as.flushScheduled = true
+		time.AfterFunc(assetSeriesDelay, as.flushSeries)
+	}
+}
+
+// flushSeries records the series of the assets whose devices reported
+func (as *AssetService) flushSeries() {
+	as.pendingMutex.Lock()
+	pending := as.pending
+	as.pending = make(map[string]time.Time)
+	as.flushScheduled = false
+	as.pendingMutex.Unlock()
+
+	for assetID, timestamp := range pending {
+		if telemetryData, ok := as.computeSeries(assetID, timestamp); ok {
+			as.telemetryService.RecordTelemetry(telemetryData)
+		}
+	}
+}
+
+// computeSeries aggregates the latest values of the devices below an asset
+// into a reading of its series
+func (as *AssetService) computeSeries(assetID string, timestamp time.Time) (models.TelemetryData, bool) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	asset, exists := as.assets[assetID]
+	if !exists || len(asset.Series) == 0 {
+		return models.TelemetryData{}, false
+	}
+
+	values := make(map[string]interface{}, len(asset.Series))
+	latest := make(map[string]*models.TelemetryData)
+	for _, series := range asset.Series {
+		var acc aggregator
+		for _, deviceID := range as.descendantDevicesLocked(assetID, series.RelationType) {
+			telemetryData, cached := latest[deviceID]
+			if !cached {
+				telemetryData, _ = as.telemetryService.GetLatestTelemetry(deviceID)
+				latest[deviceID] = telemetryData
+			}
+			if telemetryData == nil {
+				continue
+			}
+			if value, ok := numericValue(telemetryData.Values[series.SourceKey]); ok {
+				acc.add(telemetryData.Timestamp.UnixMilli(), value)
+			}
+		}
+		if acc.count > 0 || series.Agg == models.AggregationCount {
+			values[series.Key] = acc.result(series.Agg)
+		}
+	}
+	if len(values) == 0 {
+		return models.TelemetryData{}, false
+	}
+
+	return models.TelemetryData{
+		DeviceID:   asset.ID,
+		Timestamp:  timestamp,
+		Values:     values,
+		DeviceName: asset.Name,
+		DeviceType: asset.Type,
+	}, true
+}
+
+// descendantDevicesLocked returns the sorted IDs of the existing devices below
+// an asset through relations of relationType. Caller must hold as.mutex.
+func (as *AssetService) descendantDevicesLocked(assetID, relationType string) []string {
+	root := models.EntityID{EntityType: models.EntityTypeAsset, ID: assetID}
+	visited := map[models.EntityID]bool{root: true}
+	frontier := []models.EntityID{root}
+	var deviceIDs []string
+	for len(frontier) > 0 {
+		var next []models.EntityID
+		for _, current := range frontier {
+			for _, relation := range as.relations {
+				if relation.Type != relationType || relation.From != current || visited[relation.To] {
+					continue
+				}
+				visited[relation.To] = true
+				next = append(next, relation.To)
+				if relation.To.EntityType != models.EntityTypeDevice {
+					continue
+				}
+				if _, exists := as.telemetryService.GetDevice(relation.To.ID); exists {
+					deviceIDs = append(deviceIDs, relation.To.ID)
+				}
+			}
+		}
+		frontier = next
+	}
+	sort.Strings(deviceIDs)
+	return deviceIDs
+}
+
+// registerSeriesLocked makes an asset's series queryable when it defines any.
+// Caller must hold as.mutex.
+func (as *AssetService) registerSeriesLocked(asset *models.Asset) {
+	if len(asset.Series) > 0 {
+		as.telemetryService.RegisterVirtualEntity(asset.ID)
+	} else {
+		as.telemetryService.UnregisterVirtualEntity(asset.ID)
+	}
+}
+
+// seriesRelationTypes returns the distinct relation types an asset's series follow
+func seriesRelationTypes(asset *models.Asset) []string {
+	var relationTypes []string
+	seen := make(map[string]bool)
+	for _, series := range asset.Series {
+		if !seen[series.RelationType] {
+			seen[series.RelationType] = true
+			relationTypes = append(relationTypes, series.RelationType)
+		}
+	}
+	return relationTypes
+}
+
+// validateAssetSeries checks an asset's series definitions, defaulting the relation type to Contains
+func validateAssetSeries(series []models.AssetSeries) error {
+	keys := make(map[string]bool, len(series))
+	for i := range series {
+		s := &series[i]
+		field := fmt.Sprintf("series[%d]", i)
+		s.Agg = strings.ToUpper(s.Agg)
+		if s.RelationType == "" {
+			s.RelationType = models.RelationContains
+		}
+		switch {
+		case s.Key == "":
+			return fmt.Errorf("%s: key is required", field)
+		case keys[s.Key]:
+			return fmt.Errorf("%s: duplicate key %q", field, s.Key)
+		case s.SourceKey == "":
+			return fmt.Errorf("%s: sourceKey is required", field)
+		case !supportedSeriesAggregations[s.Agg]:
+			return fmt.Errorf("%s: unsupported agg %q (expected SUM, AVG, MIN, MAX or COUNT)", field, s.Agg)
+		case !supportedRelationTypes[s.RelationType]:
+			return fmt.Errorf("%s: unsupported relationType %q", field, s.RelationType)
+		}
+		keys[s.Key] = true
+	}
+	return nil
+}
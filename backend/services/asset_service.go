@@ -0,0 +1,558 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrAssetStorage is returned when the storage file cannot be written
+var ErrAssetStorage = errors.New("failed to save assets")
+
+// supportedAssetTypes lists the asset types that can be created
+var supportedAssetTypes = map[string]bool{
+	models.AssetTypeSite:     true,
+	models.AssetTypeBuilding: true,
+	models.AssetTypeFloor:    true,
+	models.AssetTypeRoom:     true,
+	models.AssetTypePanel:    true,
+}
+
+// supportedRelationTypes lists the relation types that can be created
+var supportedRelationTypes = map[string]bool{
+	models.RelationContains:  true,
+	models.RelationManages:   true,
+	models.RelationFeedsFrom: true,
+}
+
+// AssetService stores assets and the relations between assets and devices,
+// optionally persisted to a JSON file
+type AssetService struct {
+	telemetryService *TelemetryService
+	assets           map[string]*models.Asset
+	relations        []models.EntityRelation
+	storageFile      string
+	mutex            sync.RWMutex
+
+	pending        map[string]time.Time // asset ID -> newest reading of a device below it, awaiting flushSeries
+	flushScheduled bool
+	pendingMutex   sync.Mutex
+}
+
+// assetStore is the on-disk format of the asset storage file
+type assetStore struct {
+	Assets    []*models.Asset         `json:"assets"`
+	Relations []models.EntityRelation `json:"relations"`
+}
+
+// NewAssetService creates an asset service, loading the storage file if configured
+func NewAssetService(telemetryService *TelemetryService, assetsConfig config.AssetsConfig) (*AssetService, error) {
+	as := &AssetService{
+		telemetryService: telemetryService,
+		assets:           make(map[string]*models.Asset),
+		relations:        []models.EntityRelation{},
+		storageFile:      assetsConfig.StorageFile,
+		pending:          make(map[string]time.Time),
+	}
+	if err := as.load(); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+// GetAssets returns all assets sorted by name, optionally only those of a type
+func (as *AssetService) GetAssets(assetType string) []models.Asset {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	assets := make([]models.Asset, 0, len(as.assets))
+	for _, asset := range as.assets {
+		if assetType == "" || asset.Type == assetType {
+			assets = append(assets, *asset)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].Name != assets[j].Name {
+			return assets[i].Name < assets[j].Name
+		}
+		return assets[i].ID < assets[j].ID
+	})
+	return assets
+}
+
+// GetAsset returns a specific asset
+func (as *AssetService) GetAsset(assetID string) (*models.Asset, bool) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	asset, exists := as.assets[assetID]
+	if !exists {
+		return nil, false
+	}
+	copied := *asset
+	return &copied, true
+}
+
+// CreateAsset stores a new asset. An empty ID is generated.
+func (as *AssetService) CreateAsset(asset models.Asset) (*models.Asset, error) {
+	if err := validateAsset(&asset); err != nil {
+		return nil, err
+	}
+	if asset.ID == "" {
+		asset.ID = uuid.New().String()
+	}
+	asset.CreatedTime = time.Now()
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if _, exists := as.assets[asset.ID]; exists {
+		return nil, fmt.Errorf("asset %q already exists", asset.ID)
+	}
+	as.assets[asset.ID] = &asset
+	if err := as.saveLocked(); err != nil {
+		delete(as.assets, asset.ID)
+		return nil, err
+	}
+	as.registerSeriesLocked(&asset)
+	copied := asset
+	return &copied, nil
+}
+
+// UpdateAsset replaces an asset's name, type, label and description
+func (as *AssetService) UpdateAsset(assetID string, asset models.Asset) (*models.Asset, bool, error) {
+	if err := validateAsset(&asset); err != nil {
+		return nil, true, err
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	current, exists := as.assets[assetID]
+	if !exists {
+		return nil, false, nil
+	}
+	asset.ID = current.ID
+	asset.CreatedTime = current.CreatedTime
+	as.assets[assetID] = &asset
+	if err := as.saveLocked(); err != nil {
+		as.assets[assetID] = current
+		return nil, true, err
+	}
+	as.registerSeriesLocked(&asset)
+	copied := asset
+	return &copied, true, nil
+}
+
+// DeleteAsset removes an asset together with its relations
+func (as *AssetService) DeleteAsset(assetID string) (bool, error) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	asset, exists := as.assets[assetID]
+	if !exists {
+		return false, nil
+	}
+	entity := models.EntityID{EntityType: models.EntityTypeAsset, ID: assetID}
+	previous := as.relations
+	kept := make([]models.EntityRelation, 0, len(as.relations))
+	for _, relation := range as.relations {
+		if relation.From != entity && relation.To != entity {
+			kept = append(kept, relation)
+		}
+	}
+	delete(as.assets, assetID)
+	as.relations = kept
+	if err := as.saveLocked(); err != nil {
+		as.assets[assetID] = asset
+		as.relations = previous
+		return true, err
+	}
+	as.telemetryService.UnregisterVirtualEntity(assetID)
+	return true, nil
+}
+
+// GetRelations returns the direct relations from and/or to an entity,
+// optionally only those of a relation type
+func (as *AssetService) GetRelations(from, to *models.EntityID, relationType string) []models.EntityRelation {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	relations := make([]models.EntityRelation, 0)
+	for _, relation := range as.relations {
+		if from != nil && relation.From != *from {
+			continue
+		}
+		if to != nil && relation.To != *to {
+			continue
+		}
+		if relationType != "" && relation.Type != relationType {
+			continue
+		}
+		relations = append(relations, relation)
+	}
+	return relations
+}
+
+// CreateRelation stores a relation. Saving an existing relation returns it unchanged.
+func (as *AssetService) CreateRelation(relation models.EntityRelation) (*models.EntityRelation, error) {
+	relation.From.EntityType = strings.ToUpper(relation.From.EntityType)
+	relation.To.EntityType = strings.ToUpper(relation.To.EntityType)
+	if !supportedRelationTypes[relation.Type] {
+		return nil, fmt.Errorf("unsupported relation type %q (expected Contains, Manages or FeedsFrom)", relation.Type)
+	}
+	if relation.From == relation.To {
+		return nil, fmt.Errorf("an entity cannot be related to itself")
+	}
+	if relation.Type == models.RelationContains && relation.From.EntityType != models.EntityTypeAsset {
+		return nil, fmt.Errorf("only assets can contain other entities")
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	for _, side := range []struct {
+		name   string
+		entity models.EntityID
+	}{{"from", relation.From}, {"to", relation.To}} {
+		if _, _, exists := as.entityInfoLocked(side.entity); !exists {
+			return nil, fmt.Errorf("%s: unknown entity %s %q", side.name, side.entity.EntityType, side.entity.ID)
+		}
+	}
+	for _, existing := range as.relations {
+		if existing.From == relation.From && existing.To == relation.To && existing.Type == relation.Type {
+			return &existing, nil
+		}
+	}
+	if relation.Type == models.RelationContains {
+		if as.reachableLocked(relation.To, relation.From, models.RelationContains) {
+			return nil, fmt.Errorf("%s %q already contains %s %q", relation.To.EntityType, relation.To.ID, relation.From.EntityType, relation.From.ID)
+		}
+		for _, existing := range as.relations {
+			if existing.Type == models.RelationContains && existing.To == relation.To {
+				return nil, fmt.Errorf("%s %q is already contained in %s %q", relation.To.EntityType, relation.To.ID, existing.From.EntityType, existing.From.ID)
+			}
+		}
+	}
+
+	relation.CreatedTime = time.Now()
+	as.relations = append(as.relations, relation)
+	if err := as.saveLocked(); err != nil {
+		as.relations = as.relations[:len(as.relations)-1]
+		return nil, err
+	}
+	return &relation, nil
+}
+
+// DeleteRelation removes a relation
+func (as *AssetService) DeleteRelation(from, to models.EntityID, relationType string) (bool, error) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	for i, relation := range as.relations {
+		if relation.From != from || relation.To != to || relation.Type != relationType {
+			continue
+		}
+		previous := as.relations
+		as.relations = append(append([]models.EntityRelation{}, previous[:i]...), previous[i+1:]...)
+		if err := as.saveLocked(); err != nil {
+			as.relations = previous
+			return true, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// QueryRelations walks the relation graph breadth-first from the root entity.
+// Only relations of the filters' relation types are followed; an entity is
+// returned when it matches a filter's relation type and entity types.
+func (as *AssetService) QueryRelations(query models.RelationsQuery) ([]models.RelatedEntity, error) {
+	query.RootEntity.EntityType = strings.ToUpper(query.RootEntity.EntityType)
+	switch {
+	case query.Direction != models.RelationDirectionFrom && query.Direction != models.RelationDirectionTo:
+		return nil, fmt.Errorf("direction must be FROM or TO, got %q", query.Direction)
+	case query.MaxLevel < 0:
+		return nil, fmt.Errorf("maxLevel must not be negative")
+	}
+
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	if _, _, exists := as.entityInfoLocked(query.RootEntity); !exists {
+		return nil, fmt.Errorf("unknown root entity %s %q", query.RootEntity.EntityType, query.RootEntity.ID)
+	}
+
+	followed := make(map[string]bool)
+	for _, filter := range query.Filters {
+		if filter.RelationType == "" {
+			followed = nil
+			break
+		}
+		followed[filter.RelationType] = true
+	}
+
+	results := make([]models.RelatedEntity, 0)
+	parents := make(map[models.EntityID]bool) // entities the walk continued from
+	visited := map[models.EntityID]bool{query.RootEntity: true}
+	frontier := []models.EntityID{query.RootEntity}
+	for level := 1; len(frontier) > 0 && (query.MaxLevel == 0 || level <= query.MaxLevel); level++ {
+		var next []models.EntityID
+		for _, current := range frontier {
+			for _, relation := range as.relations {
+				if len(followed) > 0 && !followed[relation.Type] {
+					continue
+				}
+				var related models.EntityID
+				switch {
+				case query.Direction == models.RelationDirectionFrom && relation.From == current:
+					related = relation.To
+				case query.Direction == models.RelationDirectionTo && relation.To == current:
+					related = relation.From
+				default:
+					continue
+				}
+				if visited[related] {
+					continue
+				}
+				name, entityType, exists := as.entityInfoLocked(related)
+				if !exists {
+					continue
+				}
+				visited[related] = true
+				parents[current] = true
+				next = append(next, related)
+				if !matchesRelationFilters(query.Filters, relation.Type, related.EntityType) {
+					continue
+				}
+				results = append(results, models.RelatedEntity{
+					Entity:   related,
+					Name:     name,
+					Type:     entityType,
+					Level:    level,
+					Relation: relation,
+				})
+			}
+		}
+		frontier = next
+	}
+
+	if query.FetchLastLevelOnly {
+		lastLevel := make([]models.RelatedEntity, 0, len(results))
+		for _, result := range results {
+			if !parents[result.Entity] {
+				lastLevel = append(lastLevel, result)
+			}
+		}
+		results = lastLevel
+	}
+	return results, nil
+}
+
+// FindRelated implements RelationQuerier for relationsQuery alias filters
+func (as *AssetService) FindRelated(root models.EntityID, filter models.EntityAliasFilter) ([]models.EntityID, error) {
+	related, err := as.QueryRelations(models.RelationsQuery{
+		RootEntity:         root,
+		Direction:          filter.Direction,
+		MaxLevel:           filter.MaxLevel,
+		FetchLastLevelOnly: filter.FetchLastLevelOnly,
+		Filters:            filter.Filters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]models.EntityID, len(related))
+	for i, entity := range related {
+		entities[i] = entity.Entity
+	}
+	return entities, nil
+}
+
+// GetAssetDevices returns the IDs of the devices below an asset through
+// relations of relationType, sorted
+func (as *AssetService) GetAssetDevices(assetID, relationType string) ([]string, bool) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+
+	if _, exists := as.assets[assetID]; !exists {
+		return nil, false
+	}
+	deviceIDs := as.descendantDevicesLocked(assetID, relationType)
+	if deviceIDs == nil {
+		deviceIDs = []string{}
+	}
+	return deviceIDs, true
+}
+
+// GetAssetRollup aggregates the latest numeric telemetry of the devices below
+// an asset. Without keys every numeric key is included.
+func (as *AssetService) GetAssetRollup(assetID, relationType string, keys []string) (*models.AssetRollup, bool) {
+	deviceIDs, exists := as.GetAssetDevices(assetID, relationType)
+	if !exists {
+		return nil, false
+	}
+
+	rollup := &models.AssetRollup{
+		AssetID:   assetID,
+		DeviceIDs: deviceIDs,
+		Values:    make(map[string]models.AssetKeyRollup),
+	}
+	wanted := toSet(keys)
+	for _, deviceID := range deviceIDs {
+		latest, ok := as.telemetryService.GetLatestTelemetry(deviceID)
+		if !ok {
+			continue
+		}
+		if latest.Timestamp.After(rollup.Timestamp) {
+			rollup.Timestamp = latest.Timestamp
+		}
+		for key, value := range latest.Values {
+			if len(wanted) > 0 && !wanted[key] {
+				continue
+			}
+			number, ok := numericValue(value)
+			if !ok {
+				continue
+			}
+			keyRollup, seen := rollup.Values[key]
+			if !seen {
+				keyRollup.Min, keyRollup.Max = number, number
+			}
+			keyRollup.Sum += number
+			keyRollup.Count++
+			if number < keyRollup.Min {
+				keyRollup.Min = number
+			}
+			if number > keyRollup.Max {
+				keyRollup.Max = number
+			}
+			keyRollup.Avg = keyRollup.Sum / float64(keyRollup.Count)
+			rollup.Values[key] = keyRollup
+		}
+	}
+	return rollup, true
+}
+
+// entityInfoLocked returns the name and type of an asset or device. Caller must hold as.mutex.
+func (as *AssetService) entityInfoLocked(entity models.EntityID) (string, string, bool) {
+	switch entity.EntityType {
+	case models.EntityTypeAsset:
+		if asset, exists := as.assets[entity.ID]; exists {
+			return asset.Name, asset.Type, true
+		}
+	case models.EntityTypeDevice:
+		if device, exists := as.telemetryService.GetDevice(entity.ID); exists {
+			return device.Name, device.Type, true
+		}
+	}
+	return "", "", false
+}
+
+// reachableLocked reports whether target can be reached from start by
+// following relations of relationType. Caller must hold as.mutex.
+func (as *AssetService) reachableLocked(start, target models.EntityID, relationType string) bool {
+	visited := map[models.EntityID]bool{start: true}
+	frontier := []models.EntityID{start}
+	for len(frontier) > 0 {
+		var next []models.EntityID
+		for _, current := range frontier {
+			if current == target {
+				return true
+			}
+			for _, relation := range as.relations {
+				if relation.Type == relationType && relation.From == current && !visited[relation.To] {
+					visited[relation.To] = true
+					next = append(next, relation.To)
+				}
+			}
+		}
+		frontier = next
+	}
+	return false
+}
+
+// load reads the storage file, if one is configured and exists
+func (as *AssetService) load() error {
+	if as.storageFile == "" {
+		return nil
+	}
+	var store assetStore
+	found, err := readJSONFile(as.storageFile, &store)
+	if err != nil {
+		return fmt.Errorf("failed to read asset storage %s: %w", as.storageFile, err)
+	}
+	if !found {
+		return nil
+	}
+	for _, asset := range store.Assets {
+		as.assets[asset.ID] = asset
+		as.registerSeriesLocked(asset)
+	}
+	if store.Relations != nil {
+		as.relations = store.Relations
+	}
+	logrus.Infof("Loaded %d assets and %d relations from %s", len(as.assets), len(as.relations), as.storageFile)
+	return nil
+}
+
+// saveLocked writes assets and relations to the storage file. Caller must hold as.mutex.
+func (as *AssetService) saveLocked() error {
+	if as.storageFile == "" {
+		return nil
+	}
+
+	store := assetStore{
+		Assets:    make([]*models.Asset, 0, len(as.assets)),
+		Relations: as.relations,
+	}
+	for _, asset := range as.assets {
+		store.Assets = append(store.Assets, asset)
+	}
+	sort.Slice(store.Assets, func(i, j int) bool {
+		return store.Assets[i].ID < store.Assets[j].ID
+	})
+
+	if err := writeJSONFile(as.storageFile, store); err != nil {
+		return fmt.Errorf("%w: %v", ErrAssetStorage, err)
+	}
+	return nil
+}
+
+// validateAsset checks an asset's name and type
+func validateAsset(asset *models.Asset) error {
+	asset.Name = strings.TrimSpace(asset.Name)
+	asset.Type = strings.ToLower(strings.TrimSpace(asset.Type))
+	if asset.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !supportedAssetTypes[asset.Type] {
+		return fmt.Errorf("unsupported asset type %q (expected site, building, floor, room or panel)", asset.Type)
+	}
+	return validateAssetSeries(asset.Series)
+}
+
+// matchesRelationFilters reports whether an entity reached through a relation
+// of relationType matches any filter. No filters match everything.
+func matchesRelationFilters(filters []models.RelationEntityTypeFilter, relationType, entityType string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if filter.RelationType != "" && filter.RelationType != relationType {
+			continue
+		}
+		if len(filter.EntityTypes) == 0 || containsFold(filter.EntityTypes, entityType) {
+			return true
+		}
+	}
+	return false
+}
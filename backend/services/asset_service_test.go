@@ -0,0 +1,267 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+// newTestAssetService creates an asset service over the default devices,
+// holding the given assets in memory
+func newTestAssetService(t *testing.T, assets ...models.Asset) *AssetService {
+	t.Helper()
+	as, err := NewAssetService(newTestTelemetryService(t), config.AssetsConfig{})
+	if err != nil {
+		t.Fatalf("NewAssetService: %v", err)
+	}
+	for _, asset := range assets {
+		if _, err := as.CreateAsset(asset); err != nil {
+			t.Fatalf("CreateAsset(%s): %v", asset.ID, err)
+		}
+	}
+	return as
+}
+
+// assetID and deviceID build entity IDs
+func assetID(id string) models.EntityID {
+	return models.EntityID{EntityType: models.EntityTypeAsset, ID: id}
+}
+
+func deviceID(id string) models.EntityID {
+	return models.EntityID{EntityType: models.EntityTypeDevice, ID: id}
+}
+
+// relatedIDs returns the entities found by a relation query as ID@level
+func relatedIDs(related []models.RelatedEntity) string {
+	ids := make([]string, 0, len(related))
+	for _, entity := range related {
+		ids = append(ids, fmt.Sprintf("%s@%d", entity.Entity.ID, entity.Level))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRelationCycles(t *testing.T) {
+	as := newTestAssetService(t,
+		models.Asset{ID: "site", Name: "Site", Type: models.AssetTypeSite},
+		models.Asset{ID: "building", Name: "Building", Type: models.AssetTypeBuilding},
+		models.Asset{ID: "floor", Name: "Floor", Type: models.AssetTypeFloor},
+		models.Asset{ID: "annex", Name: "Annex", Type: models.AssetTypeBuilding},
+		models.Asset{ID: "panel", Name: "Panel", Type: models.AssetTypePanel},
+	)
+	// Manages and FeedsFrom may form cycles, Contains may not
+	for _, relation := range []models.EntityRelation{
+		{From: assetID("site"), To: assetID("building"), Type: models.RelationContains},
+		{From: assetID("building"), To: assetID("floor"), Type: models.RelationContains},
+		{From: assetID("floor"), To: deviceID("device_001"), Type: models.RelationContains},
+		{From: assetID("building"), To: assetID("panel"), Type: models.RelationManages},
+		{From: assetID("panel"), To: assetID("building"), Type: models.RelationManages},
+		{From: assetID("panel"), To: deviceID("device_003"), Type: models.RelationFeedsFrom},
+		{From: deviceID("device_003"), To: assetID("panel"), Type: models.RelationFeedsFrom},
+	} {
+		if _, err := as.CreateRelation(relation); err != nil {
+			t.Fatalf("CreateRelation(%s %s %s): %v", relation.From.ID, relation.Type, relation.To.ID, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		relation models.EntityRelation
+		want     string
+	}{
+		{"cycle", models.EntityRelation{From: assetID("floor"), To: assetID("site"), Type: models.RelationContains},
+			`ASSET "site" already contains ASSET "floor"`},
+		{"back edge", models.EntityRelation{From: assetID("floor"), To: assetID("building"), Type: models.RelationContains},
+			`ASSET "building" already contains ASSET "floor"`},
+		{"second parent", models.EntityRelation{From: assetID("annex"), To: assetID("floor"), Type: models.RelationContains},
+			`ASSET "floor" is already contained in ASSET "building"`},
+		{"self", models.EntityRelation{From: assetID("site"), To: assetID("site"), Type: models.RelationManages},
+			"an entity cannot be related to itself"},
+		{"device contains", models.EntityRelation{From: deviceID("device_001"), To: assetID("annex"), Type: models.RelationContains},
+			"only assets can contain other entities"},
+		{"unknown entity", models.EntityRelation{From: assetID("annex"), To: deviceID("missing"), Type: models.RelationContains},
+			`to: unknown entity DEVICE "missing"`},
+		{"unsupported type", models.EntityRelation{From: assetID("annex"), To: assetID("floor"), Type: "Owns"},
+			`unsupported relation type "Owns"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := as.CreateRelation(tt.relation); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// Saving an existing relation is not a second parent
+	existing, err := as.CreateRelation(models.EntityRelation{From: assetID("building"), To: assetID("floor"), Type: models.RelationContains})
+	if err != nil || existing.CreatedTime.IsZero() {
+		t.Errorf("got %+v, %v, want the existing relation", existing, err)
+	}
+	if got := len(as.GetRelations(nil, nil, "")); got != 7 {
+		t.Errorf("got %d relations, want 7", got)
+	}
+
+	// Queries report each entity once, at the level it is first reached
+	queries := []struct {
+		name  string
+		query models.RelationsQuery
+		want  string
+	}{
+		{"from", models.RelationsQuery{RootEntity: assetID("site"), Direction: models.RelationDirectionFrom},
+			"building@1,floor@2,panel@2,device_001@3,device_003@3"},
+		{"to", models.RelationsQuery{RootEntity: deviceID("device_001"), Direction: models.RelationDirectionTo},
+			"floor@1,building@2,site@3,panel@3,device_003@4"},
+		{"cycle root", models.RelationsQuery{RootEntity: assetID("panel"), Direction: models.RelationDirectionFrom},
+			"building@1,device_003@1,floor@2,device_001@3"},
+		{"max level", models.RelationsQuery{RootEntity: assetID("site"), Direction: models.RelationDirectionFrom, MaxLevel: 2},
+			"building@1,floor@2,panel@2"},
+		{"last level", models.RelationsQuery{RootEntity: assetID("site"), Direction: models.RelationDirectionFrom, FetchLastLevelOnly: true},
+			"device_001@3,device_003@3"},
+		{"contains only", models.RelationsQuery{RootEntity: assetID("site"), Direction: models.RelationDirectionFrom,
+			Filters: []models.RelationEntityTypeFilter{{RelationType: models.RelationContains}}}, "building@1,floor@2,device_001@3"},
+	}
+	for _, tt := range queries {
+		t.Run(tt.name, func(t *testing.T) {
+			related, err := as.QueryRelations(tt.query)
+			if err != nil {
+				t.Fatalf("QueryRelations: %v", err)
+			}
+			if got := relatedIDs(related); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if devices, _ := as.GetAssetDevices("panel", models.RelationFeedsFrom); len(devices) != 1 || devices[0] != "device_003" {
+		t.Errorf("got devices %v, want [device_003]", devices)
+	}
+}
+
+func TestAssetRollup(t *testing.T) {
+	as := newTestAssetService(t,
+		models.Asset{ID: "building", Name: "Building", Type: models.AssetTypeBuilding},
+		models.Asset{ID: "floor", Name: "Floor", Type: models.AssetTypeFloor},
+	)
+	for _, relation := range []models.EntityRelation{
+		{From: assetID("building"), To: assetID("floor"), Type: models.RelationContains},
+		{From: assetID("floor"), To: deviceID("device_002"), Type: models.RelationContains},
+		{From: assetID("floor"), To: deviceID("device_001"), Type: models.RelationContains},
+		{From: assetID("building"), To: deviceID("device_003"), Type: models.RelationManages},
+	} {
+		if _, err := as.CreateRelation(relation); err != nil {
+			t.Fatalf("CreateRelation: %v", err)
+		}
+	}
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	as.telemetryService.RecordTelemetry(models.TelemetryData{DeviceID: "device_001", Timestamp: start,
+		Values: map[string]interface{}{"temperature": 20.0, "humidity": 40.0, "status": "ok"}})
+	as.telemetryService.RecordTelemetry(models.TelemetryData{DeviceID: "device_002", Timestamp: start.Add(time.Second),
+		Values: map[string]interface{}{"temperature": 24.0, "humidity": 60.0}})
+
+	rollup, exists := as.GetAssetRollup("building", models.RelationContains, nil)
+	if !exists {
+		t.Fatal("GetAssetRollup did not find the building")
+	}
+	if strings.Join(rollup.DeviceIDs, ",") != "device_001,device_002" || !rollup.Timestamp.Equal(start.Add(time.Second)) {
+		t.Errorf("got devices %v at %v, want both sensors at the newest reading", rollup.DeviceIDs, rollup.Timestamp)
+	}
+	// Non-numeric keys are left out
+	want := map[string]models.AssetKeyRollup{
+		"temperature": {Sum: 44, Avg: 22, Min: 20, Max: 24, Count: 2},
+		"humidity":    {Sum: 100, Avg: 50, Min: 40, Max: 60, Count: 2},
+	}
+	if !reflect.DeepEqual(rollup.Values, want) {
+		t.Errorf("got %+v, want %+v", rollup.Values, want)
+	}
+
+	if rollup, _ := as.GetAssetRollup("building", models.RelationContains, []string{"temperature"}); len(rollup.Values) != 1 {
+		t.Errorf("got %+v, want only temperature", rollup.Values)
+	}
+	// A device without telemetry is listed but adds no values
+	rollup, _ = as.GetAssetRollup("building", models.RelationManages, nil)
+	if strings.Join(rollup.DeviceIDs, ",") != "device_003" || len(rollup.Values) != 0 || !rollup.Timestamp.IsZero() {
+		t.Errorf("got %+v, want device_003 without values", rollup)
+	}
+	if _, exists := as.GetAssetRollup("missing", models.RelationContains, nil); exists {
+		t.Error("GetAssetRollup found a missing asset")
+	}
+}
+
+func TestAssetSeries(t *testing.T) {
+	as := newTestAssetService(t,
+		models.Asset{ID: "panel", Name: "Panel", Type: models.AssetTypePanel, Series: []models.AssetSeries{
+			{Key: "total_power", SourceKey: "power", Agg: "sum"},
+			{Key: "meters", SourceKey: "power", Agg: "count", RelationType: models.RelationFeedsFrom},
+		}},
+		models.Asset{ID: "room", Name: "Room", Type: models.AssetTypeRoom},
+	)
+	for _, relation := range []models.EntityRelation{
+		{From: assetID("panel"), To: deviceID("device_003"), Type: models.RelationContains},
+		{From: assetID("panel"), To: deviceID("power_meter"), Type: models.RelationContains},
+		{From: assetID("room"), To: deviceID("device_001"), Type: models.RelationContains},
+	} {
+		if _, err := as.CreateRelation(relation); err != nil {
+			t.Fatalf("CreateRelation: %v", err)
+		}
+	}
+	ts := as.telemetryService
+	ts.AddListener(as)
+
+	// A device below no asset with series schedules nothing
+	start := time.Now().Truncate(time.Second)
+	ts.RecordTelemetry(models.TelemetryData{DeviceID: "device_001", Timestamp: start, Values: map[string]interface{}{"temperature": 20.0}})
+	as.pendingMutex.Lock()
+	scheduled := as.flushScheduled
+	as.pendingMutex.Unlock()
+	if scheduled {
+		t.Error("a reading of device_001 scheduled the asset series")
+	}
+
+	// The readings of one tick are recorded as one reading of the series
+	ts.RecordTelemetry(models.TelemetryData{DeviceID: "device_003", Timestamp: start, Values: map[string]interface{}{"power": 1500.0}})
+	ts.RecordTelemetry(models.TelemetryData{DeviceID: "power_meter", Timestamp: start.Add(10 * time.Millisecond),
+		Values: map[string]interface{}{"power": 2500.0}})
+	var latest *models.TelemetryData
+	for deadline := time.Now().Add(2 * time.Second); latest == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		latest, _ = ts.GetLatestTelemetry("panel")
+	}
+	if latest == nil {
+		t.Fatal("no reading of the panel series")
+	}
+	want := map[string]interface{}{"total_power": 4000.0, "meters": 0.0} // no device feeds the panel
+	if !latest.Timestamp.Equal(start.Add(10*time.Millisecond)) || !reflect.DeepEqual(latest.Values, want) {
+		t.Errorf("got %v at %v, want %v at the newest reading", latest.Values, latest.Timestamp, want)
+	}
+	ts.mutex.RLock()
+	readings := len(ts.data["panel"])
+	ts.mutex.RUnlock()
+	if readings != 1 {
+		t.Errorf("got %d readings of the panel series, want 1", readings)
+	}
+}
+
+func TestAssetSeriesValidation(t *testing.T) {
+	as := newTestAssetService(t)
+	tests := []struct {
+		series []models.AssetSeries
+		want   string
+	}{
+		{[]models.AssetSeries{{SourceKey: "power", Agg: "SUM"}}, "series[0]: key is required"},
+		{[]models.AssetSeries{{Key: "power", SourceKey: "power", Agg: "SUM"}, {Key: "power", SourceKey: "power", Agg: "MAX"}},
+			`series[1]: duplicate key "power"`},
+		{[]models.AssetSeries{{Key: "power", Agg: "SUM"}}, "series[0]: sourceKey is required"},
+		{[]models.AssetSeries{{Key: "power", SourceKey: "power", Agg: "last"}}, `series[0]: unsupported agg "LAST"`},
+		{[]models.AssetSeries{{Key: "power", SourceKey: "power", Agg: "SUM", RelationType: "Owns"}}, `series[0]: unsupported relationType "Owns"`},
+	}
+	for _, tt := range tests {
+		_, err := as.CreateAsset(models.Asset{Name: "Panel", Type: models.AssetTypePanel, Series: tt.series})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got error %v, want %q", err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// minQueryInterval is the smallest aggregation bucket accepted by queries
+const minQueryInterval = 1000
+
+// PrepareBatchQuery validates a batch request and fills in defaults
+func (ts *TelemetryService) PrepareBatchQuery(request *models.BatchTimeSeriesRequest) error {
+	if len(request.Selectors) == 0 {
+		return fmt.Errorf("at least one selector is required")
+	}
+	for i, selector := range request.Selectors {
+		if selector.DeviceID == "" && selector.DeviceType == "" && selector.Location == "" {
+			return fmt.Errorf("selectors[%d]: one of deviceId, deviceType or location is required", i)
+		}
+		if len(selector.Keys) == 0 {
+			return fmt.Errorf("selectors[%d]: at least one key is required", i)
+		}
+	}
+
+	request.Agg = strings.ToUpper(request.Agg)
+	if request.Agg == "" {
+		request.Agg = models.AggregationNone
+	}
+	if !models.IsValidAggregation(request.Agg) {
+		return fmt.Errorf("unsupported aggregation %q", request.Agg)
+	}
+	if request.Agg != models.AggregationNone && request.Interval < minQueryInterval {
+		return fmt.Errorf("interval must be at least %d ms when aggregating", minQueryInterval)
+	}
+	request.Fill = strings.ToLower(request.Fill)
+	if !models.IsValidFill(request.Fill) {
+		return fmt.Errorf("unsupported fill mode %q (expected null, previous, linear or zero)", request.Fill)
+	}
+	if request.Fill != models.FillNone && request.Agg == models.AggregationNone {
+		return fmt.Errorf("fill requires an aggregation")
+	}
+	// Aggregated series share the bucket grid, so empty buckets are kept as null
+	if request.Agg != models.AggregationNone && request.Fill == models.FillNone {
+		request.Fill = models.FillNull
+	}
+	if request.StaleAfter < 0 {
+		return fmt.Errorf("staleAfter must not be negative")
+	}
+
+	now := time.Now()
+	if request.EndTs == 0 {
+		request.EndTs = now.UnixMilli()
+	}
+	if request.StartTs == 0 {
+		request.StartTs = now.Add(-1 * time.Hour).UnixMilli()
+	}
+	if request.StartTs > request.EndTs {
+		return fmt.Errorf("startTs must not be after endTs")
+	}
+	if request.Agg != models.AggregationNone {
+		return checkBucketCount(request.StartTs, request.EndTs, request.Interval)
+	}
+	return nil
+}
+
+// QueryTimeSeriesBatch evaluates every selector against one consistent
+// snapshot of the store. Problems with individual devices or keys are
+// reported per series instead of failing the whole request.
+func (ts *TelemetryService) QueryTimeSeriesBatch(request models.BatchTimeSeriesRequest) *models.BatchTimeSeriesResponse {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	response := &models.BatchTimeSeriesResponse{
+		StartTs:  request.StartTs,
+		EndTs:    request.EndTs,
+		Interval: request.Interval,
+		Agg:      request.Agg,
+		Series:   []models.SeriesResult{},
+	}
+	start := time.UnixMilli(request.StartTs)
+	end := time.UnixMilli(request.EndTs)
+	seen := make(map[string]bool)
+
+	for _, selector := range request.Selectors {
+		deviceIDs := ts.matchDevicesLocked(selector)
+		if len(deviceIDs) == 0 {
+			response.Series = append(response.Series, models.SeriesResult{
+				DeviceID: selector.DeviceID,
+				Data:     models.SeriesPoints{},
+				Error:    describeSelector(selector) + " matched no devices",
+			})
+			continue
+		}
+
+		for _, deviceID := range deviceIDs {
+			for _, key := range selector.Keys {
+				id := deviceID + "|" + key
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				result := models.SeriesResult{DeviceID: deviceID, Key: key, Data: models.SeriesPoints{}}
+				if _, exists := ts.keys[key]; !exists && !ts.virtual[deviceID] {
+					result.Error = fmt.Sprintf("unknown key %q", key)
+				} else {
+					points := ts.seriesLocked(deviceID, key, start, end, request.Interval, request.Agg)
+					result.Gaps = seriesGaps(points, request.StartTs, request.EndTs, request.Interval, request.Agg, request.StaleAfter)
+					result.Gapped = len(result.Gaps) > 0
+					result.Data = fillBuckets(points, request.StartTs, request.EndTs, request.Interval, request.Fill, request.StaleAfter)
+				}
+				response.Series = append(response.Series, result)
+			}
+		}
+	}
+
+	return response
+}
+
+// matchDevicesLocked returns the sorted IDs of devices matching a selector. A
+// virtual entity is only matched by its ID. Caller must hold ts.mutex.
+func (ts *TelemetryService) matchDevicesLocked(selector models.TimeSeriesSelector) []string {
+	if ts.virtual[selector.DeviceID] && selector.DeviceType == "" && selector.Location == "" {
+		return []string{selector.DeviceID}
+	}
+
+	var deviceIDs []string
+	for id, device := range ts.devices {
+		if selector.DeviceID != "" && id != selector.DeviceID {
+			continue
+		}
+		if selector.DeviceType != "" && device.Type != selector.DeviceType {
+			continue
+		}
+		if selector.Location != "" && device.Location != selector.Location {
+			continue
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	sort.Strings(deviceIDs)
+	return deviceIDs
+}
+
+// seriesLocked returns the numeric [timestamp, value] points of one key in
+// [start, end], aggregated into interval buckets unless agg is NONE.
+// Caller must hold ts.mutex.
+func (ts *TelemetryService) seriesLocked(deviceID, key string, start, end time.Time, interval int64, agg string) [][]float64 {
+	if agg == models.AggregationNone {
+		return ts.pointsLocked(deviceID, key, start, end, interval)
+	}
+
+	points := [][]float64{}
+	for _, bucket := range ts.bucketsLocked(deviceID, key, start, end, interval) {
+		points = append(points, []float64{float64(bucket.start), bucket.acc.result(agg)})
+	}
+	return points
+}
+
+// describeSelector renders a selector for error messages
+func describeSelector(selector models.TimeSeriesSelector) string {
+	var parts []string
+	if selector.DeviceID != "" {
+		parts = append(parts, "deviceId="+selector.DeviceID)
+	}
+	if selector.DeviceType != "" {
+		parts = append(parts, "deviceType="+selector.DeviceType)
+	}
+	if selector.Location != "" {
+		parts = append(parts, "location="+selector.Location)
+	}
+	return "selector " + strings.Join(parts, ",")
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestQueryTimeSeriesBatchAlignsSeries(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	minute := time.Minute.Milliseconds()
+	start := bucketStart(time.Now().Add(-time.Hour).UnixMilli(), minute)
+
+	// Each device reports in different buckets
+	ts.StoreHistorical(testReadings("device_001", "humidity", start, start+2*minute))
+	ts.StoreHistorical(testReadings("device_002", "humidity", start+minute, start+3*minute+5000))
+
+	request := models.BatchTimeSeriesRequest{
+		Selectors: []models.TimeSeriesSelector{
+			{DeviceID: "device_001", Keys: []string{"humidity"}},
+			{DeviceID: "device_002", Keys: []string{"humidity"}},
+		},
+		StartTs:  start,
+		EndTs:    start + 4*minute - 1,
+		Interval: minute,
+		Agg:      models.AggregationAvg,
+	}
+	if err := ts.PrepareBatchQuery(&request); err != nil {
+		t.Fatalf("PrepareBatchQuery: %v", err)
+	}
+	response := ts.QueryTimeSeriesBatch(request)
+	if len(response.Series) != 2 {
+		t.Fatalf("got %d series, want 2", len(response.Series))
+	}
+
+	want := map[string][]float64{
+		"device_001": {0, math.NaN(), 1, math.NaN()},
+		"device_002": {math.NaN(), 0, math.NaN(), 1},
+	}
+	for _, series := range response.Series {
+		if series.Error != "" {
+			t.Fatalf("%s: %s", series.DeviceID, series.Error)
+		}
+		values := want[series.DeviceID]
+		if len(series.Data) != len(values) {
+			t.Fatalf("%s has %d points, want one per bucket (%d)", series.DeviceID, len(series.Data), len(values))
+		}
+		for i, point := range series.Data {
+			if bucket := start + int64(i)*minute; int64(point[0]) != bucket {
+				t.Errorf("%s point %d at %d, want bucket %d", series.DeviceID, i, int64(point[0]), bucket)
+			}
+			if math.IsNaN(values[i]) != math.IsNaN(point[1]) || (!math.IsNaN(values[i]) && point[1] != values[i]) {
+				t.Errorf("%s point %d = %v, want %v", series.DeviceID, i, point[1], values[i])
+			}
+		}
+	}
+}
+
+func TestPrepareBatchQueryRanges(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	day := 24 * time.Hour.Milliseconds()
+	tests := []struct {
+		name       string
+		start, end int64
+		agg        string
+		wantErr    string
+	}{
+		{"inverted range", 2 * day, day, models.AggregationAvg, "startTs must not be after endTs"},
+		{"too many buckets", day, 30 * day, models.AggregationAvg, "more than 10000 buckets"},
+		{"huge range", -1 << 62, 1 << 62, models.AggregationMax, "more than 10000 buckets"},
+		{"raw readings", day, 30 * day, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := models.BatchTimeSeriesRequest{
+				Selectors: []models.TimeSeriesSelector{{DeviceID: "device_001", Keys: []string{"temperature"}}},
+				StartTs:   tt.start,
+				EndTs:     tt.end,
+				Interval:  60000,
+				Agg:       tt.agg,
+			}
+			checkError(t, ts.PrepareBatchQuery(&request), tt.wantErr)
+		})
+	}
+}
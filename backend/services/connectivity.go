@@ -0,0 +1,171 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// connectivityCheckInterval is how often devices are checked for inactivity
+const connectivityCheckInterval = time.Second
+
+// ConnectivityListener is notified when a device becomes active or inactive
+type ConnectivityListener interface {
+	OnConnectivity(event models.ConnectivityEvent)
+}
+
+// ConnectivityMonitor tracks device activity from live telemetry. A device
+// becomes inactive once it has not reported for the inactivity timeout and
+// active again with its next reading.
+type ConnectivityMonitor struct {
+	telemetryService *TelemetryService
+	timeout          time.Duration
+	lastSeen         map[string]time.Time
+	active           map[string]bool
+	listeners        []ConnectivityListener
+	mutex            sync.RWMutex
+	stop             chan bool
+}
+
+// NewConnectivityMonitor creates a connectivity monitor. Devices start active,
+// so the first readings raise no events and a device that never reports
+// becomes inactive after the timeout.
+func NewConnectivityMonitor(telemetryService *TelemetryService, cfg config.ConnectivityConfig) *ConnectivityMonitor {
+	monitor := &ConnectivityMonitor{
+		telemetryService: telemetryService,
+		timeout:          cfg.InactivityTimeout,
+		lastSeen:         make(map[string]time.Time),
+		active:           make(map[string]bool),
+		stop:             make(chan bool),
+	}
+
+	now := time.Now()
+	for _, device := range telemetryService.GetDevices() {
+		monitor.lastSeen[device.ID] = now
+		monitor.active[device.ID] = true
+	}
+	return monitor
+}
+
+// SetInactivityTimeout changes the inactivity timeout of a running monitor
+func (cm *ConnectivityMonitor) SetInactivityTimeout(timeout time.Duration) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.timeout = timeout
+}
+
+// AddListener registers a connectivity listener.
+// Listeners must be added before the monitor starts.
+func (cm *ConnectivityMonitor) AddListener(listener ConnectivityListener) {
+	cm.listeners = append(cm.listeners, listener)
+}
+
+// OnTelemetry records device activity. It implements TelemetryListener.
+func (cm *ConnectivityMonitor) OnTelemetry(telemetryData models.TelemetryData) {
+	cm.mutex.Lock()
+	active, known := cm.active[telemetryData.DeviceID]
+	if !known {
+		// Virtual entities such as assets have no connectivity
+		cm.mutex.Unlock()
+		return
+	}
+	if telemetryData.Timestamp.After(cm.lastSeen[telemetryData.DeviceID]) {
+		cm.lastSeen[telemetryData.DeviceID] = telemetryData.Timestamp
+	}
+	cm.active[telemetryData.DeviceID] = true
+	cm.mutex.Unlock()
+
+	if !active {
+		cm.notify(models.ConnectivityEvent{
+			DeviceID:       telemetryData.DeviceID,
+			DeviceName:     telemetryData.DeviceName,
+			Active:         true,
+			LastActivityTs: telemetryData.Timestamp,
+			Timestamp:      time.Now(),
+		})
+	}
+}
+
+// Start checks devices for inactivity until Stop is called
+func (cm *ConnectivityMonitor) Start() {
+	ticker := time.NewTicker(connectivityCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			cm.check(now)
+		case <-cm.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the inactivity checks
+func (cm *ConnectivityMonitor) Stop() {
+	close(cm.stop)
+}
+
+// check marks devices without readings for the inactivity timeout as inactive
+func (cm *ConnectivityMonitor) check(now time.Time) {
+	cm.mutex.Lock()
+	var events []models.ConnectivityEvent
+	for deviceID, active := range cm.active {
+		if !active || now.Sub(cm.lastSeen[deviceID]) < cm.timeout {
+			continue
+		}
+		cm.active[deviceID] = false
+		events = append(events, models.ConnectivityEvent{
+			DeviceID:       deviceID,
+			Active:         false,
+			LastActivityTs: cm.lastSeen[deviceID],
+			Timestamp:      now,
+		})
+	}
+	cm.mutex.Unlock()
+
+	for _, event := range events {
+		if device, exists := cm.telemetryService.GetDevice(event.DeviceID); exists {
+			event.DeviceName = device.Name
+		}
+		cm.notify(event)
+	}
+}
+
+func (cm *ConnectivityMonitor) notify(event models.ConnectivityEvent) {
+	if event.Active {
+		logrus.Infof("Device %s is active", event.DeviceID)
+	} else {
+		logrus.Warnf("Device %s is inactive, last activity %s", event.DeviceID, event.LastActivityTs.Format(time.RFC3339))
+	}
+	for _, listener := range cm.listeners {
+		listener.OnConnectivity(event)
+	}
+}
+
+// GetConnectivity returns the connectivity state of every device, sorted by device ID
+func (cm *ConnectivityMonitor) GetConnectivity() []models.DeviceConnectivity {
+	cm.mutex.RLock()
+	states := make([]models.DeviceConnectivity, 0, len(cm.active))
+	for deviceID, active := range cm.active {
+		states = append(states, models.DeviceConnectivity{
+			DeviceID:       deviceID,
+			Active:         active,
+			LastActivityTs: cm.lastSeen[deviceID],
+		})
+	}
+	cm.mutex.RUnlock()
+
+	for i := range states {
+		states[i].Reporting = cm.telemetryService.IsReporting(states[i].DeviceID)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].DeviceID < states[j].DeviceID
+	})
+	return states
+}
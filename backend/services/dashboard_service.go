@@ -0,0 +1,513 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDashboardVersions bounds how many previous revisions are kept per dashboard
+const maxDashboardVersions = 50
+
+// Default grid placement for widgets without a layout position
+const (
+	defaultWidgetSizeX   = 8
+	defaultWidgetSizeY   = 5
+	defaultLayoutColumns = 24
+)
+
+// ErrDashboardVersionConflict is returned when an update is based on an outdated version
+var ErrDashboardVersionConflict = errors.New("dashboard was modified concurrently")
+
+// ErrDashboardStorage is returned when the storage file cannot be written
+var ErrDashboardStorage = errors.New("failed to save dashboards")
+
+// DashboardService stores dashboard definitions with their revision history,
+// optionally persisted to a JSON file
+type DashboardService struct {
+	telemetryService *TelemetryService
+	aliasResolver    *EntityAliasResolver
+	dashboards       map[string]*models.Dashboard
+	versions         map[string][]*models.Dashboard // dashboard ID -> previous revisions, oldest first
+	storageFile      string
+	mutex            sync.RWMutex
+}
+
+// dashboardStore is the on-disk format of the dashboard storage file
+type dashboardStore struct {
+	Dashboards []*models.Dashboard            `json:"dashboards"`
+	Versions   map[string][]*models.Dashboard `json:"versions"`
+}
+
+// NewDashboardService creates a dashboard service, loading the storage file if configured
+func NewDashboardService(telemetryService *TelemetryService, aliasResolver *EntityAliasResolver, dashboardsConfig config.DashboardsConfig) (*DashboardService, error) {
+	ds := &DashboardService{
+		telemetryService: telemetryService,
+		aliasResolver:    aliasResolver,
+		dashboards:       make(map[string]*models.Dashboard),
+		versions:         make(map[string][]*models.Dashboard),
+		storageFile:      dashboardsConfig.StorageFile,
+	}
+	if err := ds.load(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// ListDashboards returns dashboard summaries sorted by title, optionally only
+// those assigned to a customer or whose title contains search
+func (ds *DashboardService) ListDashboards(customerID, search string) []models.DashboardInfo {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	search = strings.ToLower(search)
+	infos := make([]models.DashboardInfo, 0, len(ds.dashboards))
+	for _, dashboard := range ds.dashboards {
+		if customerID != "" && !dashboard.IsAssignedTo(customerID) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(dashboard.Title), search) {
+			continue
+		}
+		infos = append(infos, dashboard.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Title != infos[j].Title {
+			return infos[i].Title < infos[j].Title
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// GetDashboard returns a copy of a dashboard
+func (ds *DashboardService) GetDashboard(dashboardID string) (*models.Dashboard, bool) {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	dashboard, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return nil, false
+	}
+	return cloneDashboard(dashboard), true
+}
+
+// CreateDashboard validates and stores a new dashboard as version 1
+func (ds *DashboardService) CreateDashboard(dashboard models.Dashboard) (*models.Dashboard, error) {
+	if err := ds.prepare(&dashboard); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dashboard.ID = uuid.New().String()
+	dashboard.Version = 1
+	dashboard.CreatedTime = now
+	dashboard.UpdatedTime = now
+	if dashboard.AssignedCustomers == nil {
+		dashboard.AssignedCustomers = []models.CustomerInfo{}
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.dashboards[dashboard.ID] = &dashboard
+	if err := ds.saveLocked(); err != nil {
+		delete(ds.dashboards, dashboard.ID)
+		return nil, err
+	}
+	return cloneDashboard(&dashboard), nil
+}
+
+// UpdateDashboard replaces a dashboard's content and increments its version.
+// A non-zero dashboard.Version must match the stored version, otherwise
+// ErrDashboardVersionConflict is returned. Customer assignments are kept.
+func (ds *DashboardService) UpdateDashboard(dashboardID string, dashboard models.Dashboard) (*models.Dashboard, bool, error) {
+	if err := ds.prepare(&dashboard); err != nil {
+		return nil, true, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	current, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return nil, false, nil
+	}
+	if dashboard.Version != 0 && dashboard.Version != current.Version {
+		return nil, true, fmt.Errorf("%w: version %d was requested but the current version is %d", ErrDashboardVersionConflict, dashboard.Version, current.Version)
+	}
+
+	updated, err := ds.replaceLocked(current, dashboard)
+	return updated, true, err
+}
+
+// DeleteDashboard removes a dashboard and its revision history
+func (ds *DashboardService) DeleteDashboard(dashboardID string) (bool, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	dashboard, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return false, nil
+	}
+	versions := ds.versions[dashboardID]
+	delete(ds.dashboards, dashboardID)
+	delete(ds.versions, dashboardID)
+	if err := ds.saveLocked(); err != nil {
+		ds.dashboards[dashboardID] = dashboard
+		ds.versions[dashboardID] = versions
+		return true, err
+	}
+	return true, nil
+}
+
+// ResolveAliases resolves a dashboard's entity aliases to their current devices
+func (ds *DashboardService) ResolveAliases(dashboardID string, stateEntity *models.EntityID) ([]models.ResolvedAlias, bool) {
+	dashboard, exists := ds.GetDashboard(dashboardID)
+	if !exists {
+		return nil, false
+	}
+	return ds.aliasResolver.ResolveDashboard(dashboard, stateEntity), true
+}
+
+// GetVersions lists the stored revisions of a dashboard, newest first, including the current one
+func (ds *DashboardService) GetVersions(dashboardID string) ([]models.DashboardVersionInfo, bool) {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	current, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return nil, false
+	}
+	history := ds.versions[dashboardID]
+	infos := make([]models.DashboardVersionInfo, 0, len(history)+1)
+	infos = append(infos, versionInfo(current))
+	for i := len(history) - 1; i >= 0; i-- {
+		infos = append(infos, versionInfo(history[i]))
+	}
+	return infos, true
+}
+
+// GetVersion returns a specific revision of a dashboard
+func (ds *DashboardService) GetVersion(dashboardID string, version int) (*models.Dashboard, bool) {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	revision := ds.findVersionLocked(dashboardID, version)
+	if revision == nil {
+		return nil, false
+	}
+	return cloneDashboard(revision), true
+}
+
+// RestoreVersion makes the content of an earlier revision the new current version
+func (ds *DashboardService) RestoreVersion(dashboardID string, version int) (*models.Dashboard, bool, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	revision := ds.findVersionLocked(dashboardID, version)
+	if revision == nil {
+		return nil, false, nil
+	}
+	updated, err := ds.replaceLocked(ds.dashboards[dashboardID], *cloneDashboard(revision))
+	return updated, true, err
+}
+
+// AssignCustomer assigns a dashboard to a customer, updating the title of an existing assignment
+func (ds *DashboardService) AssignCustomer(dashboardID string, customer models.CustomerInfo) (*models.Dashboard, bool, error) {
+	return ds.updateAssignments(dashboardID, func(assigned []models.CustomerInfo) []models.CustomerInfo {
+		for i := range assigned {
+			if assigned[i].CustomerID == customer.CustomerID {
+				if customer.Title != "" {
+					assigned[i].Title = customer.Title
+				}
+				return assigned
+			}
+		}
+		return append(assigned, customer)
+	})
+}
+
+// UnassignCustomer removes a customer assignment from a dashboard
+func (ds *DashboardService) UnassignCustomer(dashboardID, customerID string) (*models.Dashboard, bool, error) {
+	return ds.updateAssignments(dashboardID, func(assigned []models.CustomerInfo) []models.CustomerInfo {
+		kept := make([]models.CustomerInfo, 0, len(assigned))
+		for _, customer := range assigned {
+			if customer.CustomerID != customerID {
+				kept = append(kept, customer)
+			}
+		}
+		return kept
+	})
+}
+
+// updateAssignments changes a dashboard's customer assignments. Assignments
+// are not part of the dashboard content, so no new version is created.
+func (ds *DashboardService) updateAssignments(dashboardID string, change func([]models.CustomerInfo) []models.CustomerInfo) (*models.Dashboard, bool, error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	dashboard, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return nil, false, nil
+	}
+	previous := dashboard.AssignedCustomers
+	dashboard.AssignedCustomers = change(append([]models.CustomerInfo{}, previous...))
+	if err := ds.saveLocked(); err != nil {
+		dashboard.AssignedCustomers = previous
+		return nil, true, err
+	}
+	return cloneDashboard(dashboard), true, nil
+}
+
+// replaceLocked stores content as the next version of current, moving current
+// into the revision history. Caller must hold ds.mutex.
+func (ds *DashboardService) replaceLocked(current *models.Dashboard, content models.Dashboard) (*models.Dashboard, error) {
+	content.ID = current.ID
+	content.Version = current.Version + 1
+	content.CreatedTime = current.CreatedTime
+	content.UpdatedTime = time.Now()
+	content.AssignedCustomers = current.AssignedCustomers
+
+	history := ds.versions[current.ID]
+	ds.versions[current.ID] = append(history, current)
+	if excess := len(ds.versions[current.ID]) - maxDashboardVersions; excess > 0 {
+		ds.versions[current.ID] = ds.versions[current.ID][excess:]
+	}
+	ds.dashboards[current.ID] = &content
+
+	if err := ds.saveLocked(); err != nil {
+		ds.dashboards[current.ID] = current
+		ds.versions[current.ID] = history
+		return nil, err
+	}
+	return cloneDashboard(&content), nil
+}
+
+// findVersionLocked returns the current dashboard or a stored revision with the version. Caller must hold ds.mutex.
+func (ds *DashboardService) findVersionLocked(dashboardID string, version int) *models.Dashboard {
+	current, exists := ds.dashboards[dashboardID]
+	if !exists {
+		return nil
+	}
+	if current.Version == version {
+		return current
+	}
+	for _, revision := range ds.versions[dashboardID] {
+		if revision.Version == version {
+			return revision
+		}
+	}
+	return nil
+}
+
+// prepare validates dashboard content, assigning IDs to widgets and aliases
+// without one and placing widgets missing from every layout on the root state
+func (ds *DashboardService) prepare(dashboard *models.Dashboard) error {
+	dashboard.Title = strings.TrimSpace(dashboard.Title)
+	if dashboard.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if dashboard.Widgets == nil {
+		dashboard.Widgets = []models.DashboardWidget{}
+	}
+	if dashboard.EntityAliases == nil {
+		dashboard.EntityAliases = []models.EntityAlias{}
+	}
+
+	aliases := make(map[string]bool, len(dashboard.EntityAliases))
+	for i := range dashboard.EntityAliases {
+		alias := &dashboard.EntityAliases[i]
+		if alias.ID == "" {
+			alias.ID = uuid.New().String()
+		}
+		if aliases[alias.ID] {
+			return fmt.Errorf("entityAliases[%d]: duplicate id %q", i, alias.ID)
+		}
+		if alias.Alias == "" {
+			return fmt.Errorf("entityAliases[%d]: alias is required", i)
+		}
+		if err := validateAliasFilter(alias.Filter); err != nil {
+			return fmt.Errorf("entityAliases[%d]: %w", i, err)
+		}
+		aliases[alias.ID] = true
+	}
+
+	widgets := make(map[string]bool, len(dashboard.Widgets))
+	for i := range dashboard.Widgets {
+		widget := &dashboard.Widgets[i]
+		if widget.ID == "" {
+			widget.ID = uuid.New().String()
+		}
+		if widgets[widget.ID] {
+			return fmt.Errorf("widgets[%d]: duplicate id %q", i, widget.ID)
+		}
+		widgets[widget.ID] = true
+		if widget.Datasources == nil {
+			widget.Datasources = []models.WidgetDatasource{}
+		}
+		for j, datasource := range widget.Datasources {
+			field := fmt.Sprintf("widgets[%d].datasources[%d]", i, j)
+			switch datasource.Type {
+			case models.DatasourceTypeEntity:
+				if !aliases[datasource.EntityAliasID] {
+					return fmt.Errorf("%s: unknown entityAliasId %q", field, datasource.EntityAliasID)
+				}
+			case models.DatasourceTypeDevice:
+				if _, exists := ds.telemetryService.GetDevice(datasource.DeviceID); !exists {
+					return fmt.Errorf("%s: unknown deviceId %q", field, datasource.DeviceID)
+				}
+			default:
+				return fmt.Errorf("%s: unsupported type %q (expected entity or device)", field, datasource.Type)
+			}
+			for k, dataKey := range datasource.DataKeys {
+				if dataKey.Name == "" {
+					return fmt.Errorf("%s.dataKeys[%d]: name is required", field, k)
+				}
+			}
+		}
+	}
+
+	if len(dashboard.States) == 0 {
+		dashboard.States = map[string]models.DashboardState{
+			"default": {Name: dashboard.Title, Root: true},
+		}
+	}
+	placed := make(map[string]bool, len(widgets))
+	rootState := ""
+	for stateID, state := range dashboard.States {
+		if state.Root || (rootState == "" && stateID == "default") {
+			rootState = stateID
+		}
+		for layoutID, layout := range state.Layouts {
+			for widgetID := range layout.Widgets {
+				if !widgets[widgetID] {
+					return fmt.Errorf("states.%s.layouts.%s: unknown widget %q", stateID, layoutID, widgetID)
+				}
+				placed[widgetID] = true
+			}
+		}
+	}
+	if rootState == "" {
+		return fmt.Errorf("states: a root state (or a state with id \"default\") is required")
+	}
+	placeWidgets(dashboard, rootState, placed)
+	return nil
+}
+
+// placeWidgets adds widgets that no layout references to the main layout of the root state
+func placeWidgets(dashboard *models.Dashboard, stateID string, placed map[string]bool) {
+	state := dashboard.States[stateID]
+	if state.Layouts == nil {
+		state.Layouts = make(map[string]models.DashboardLayout)
+	}
+	layout := state.Layouts["main"]
+	if layout.Widgets == nil {
+		layout.Widgets = make(map[string]models.WidgetPosition)
+	}
+
+	nextRow := 0
+	for _, position := range layout.Widgets {
+		if end := position.Row + position.SizeY; end > nextRow {
+			nextRow = end
+		}
+	}
+	col := 0
+	for _, widget := range dashboard.Widgets {
+		if placed[widget.ID] {
+			continue
+		}
+		if col+defaultWidgetSizeX > defaultLayoutColumns {
+			col = 0
+			nextRow += defaultWidgetSizeY
+		}
+		layout.Widgets[widget.ID] = models.WidgetPosition{
+			SizeX: defaultWidgetSizeX,
+			SizeY: defaultWidgetSizeY,
+			Row:   nextRow,
+			Col:   col,
+		}
+		col += defaultWidgetSizeX
+	}
+
+	state.Layouts["main"] = layout
+	dashboard.States[stateID] = state
+}
+
+// load reads the storage file, if one is configured and exists
+func (ds *DashboardService) load() error {
+	if ds.storageFile == "" {
+		return nil
+	}
+	var store dashboardStore
+	found, err := readJSONFile(ds.storageFile, &store)
+	if err != nil {
+		return fmt.Errorf("failed to read dashboard storage %s: %w", ds.storageFile, err)
+	}
+	if !found {
+		return nil
+	}
+	for _, dashboard := range store.Dashboards {
+		ds.dashboards[dashboard.ID] = dashboard
+	}
+	for dashboardID, versions := range store.Versions {
+		ds.versions[dashboardID] = versions
+	}
+	logrus.Infof("Loaded %d dashboards from %s", len(ds.dashboards), ds.storageFile)
+	return nil
+}
+
+// saveLocked writes all dashboards to the storage file. Caller must hold ds.mutex.
+func (ds *DashboardService) saveLocked() error {
+	if ds.storageFile == "" {
+		return nil
+	}
+
+	store := dashboardStore{
+		Dashboards: make([]*models.Dashboard, 0, len(ds.dashboards)),
+		Versions:   ds.versions,
+	}
+	for _, dashboard := range ds.dashboards {
+		store.Dashboards = append(store.Dashboards, dashboard)
+	}
+	sort.Slice(store.Dashboards, func(i, j int) bool {
+		return store.Dashboards[i].ID < store.Dashboards[j].ID
+	})
+
+	if err := writeJSONFile(ds.storageFile, store); err != nil {
+		return fmt.Errorf("%w: %v", ErrDashboardStorage, err)
+	}
+	return nil
+}
+
+// versionInfo summarizes a dashboard revision
+func versionInfo(dashboard *models.Dashboard) models.DashboardVersionInfo {
+	return models.DashboardVersionInfo{
+		Version:     dashboard.Version,
+		Title:       dashboard.Title,
+		UpdatedTime: dashboard.UpdatedTime,
+	}
+}
+
+// cloneDashboard deep-copies a dashboard so callers cannot modify stored state
+func cloneDashboard(dashboard *models.Dashboard) *models.Dashboard {
+	data, err := json.Marshal(dashboard)
+	if err != nil {
+		panic(fmt.Sprintf("dashboard %s cannot be encoded: %v", dashboard.ID, err))
+	}
+	var copied models.Dashboard
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(fmt.Sprintf("dashboard %s cannot be decoded: %v", dashboard.ID, err))
+	}
+	return &copied
+}
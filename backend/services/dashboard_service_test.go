@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+// newTestDashboardService creates a dashboard service persisting to storageFile
+func newTestDashboardService(t *testing.T, storageFile string) *DashboardService {
+	t.Helper()
+	ts := newTestTelemetryService(t)
+	ds, err := NewDashboardService(ts, NewEntityAliasResolver(ts), config.DashboardsConfig{StorageFile: storageFile})
+	if err != nil {
+		t.Fatalf("NewDashboardService: %v", err)
+	}
+	return ds
+}
+
+// versionNumbers returns the versions listed by GetVersions
+func versionNumbers(t *testing.T, ds *DashboardService, dashboardID string) []int {
+	t.Helper()
+	infos, exists := ds.GetVersions(dashboardID)
+	if !exists {
+		t.Fatalf("dashboard %s not found", dashboardID)
+	}
+	versions := make([]int, 0, len(infos))
+	for _, info := range infos {
+		versions = append(versions, info.Version)
+	}
+	return versions
+}
+
+func TestDashboardVersions(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "dashboards.json")
+	ds := newTestDashboardService(t, storageFile)
+
+	created, err := ds.CreateDashboard(models.Dashboard{Title: "Plant"})
+	if err != nil {
+		t.Fatalf("CreateDashboard: %v", err)
+	}
+	if created.Version != 1 {
+		t.Fatalf("created version %d, want 1", created.Version)
+	}
+	id := created.ID
+
+	updated, _, err := ds.UpdateDashboard(id, models.Dashboard{Title: "Plant v2", Version: 1})
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("UpdateDashboard: %+v, %v, want version 2", updated, err)
+	}
+	// An update based on version 1 would overwrite version 2
+	if _, _, err := ds.UpdateDashboard(id, models.Dashboard{Title: "Stale", Version: 1}); !errors.Is(err, ErrDashboardVersionConflict) {
+		t.Errorf("got error %v for a stale update, want a version conflict", err)
+	}
+
+	// Assignments are not content and create no version
+	assigned, _, err := ds.AssignCustomer(id, models.CustomerInfo{CustomerID: "customer_1", Title: "Customer"})
+	if err != nil || assigned.Version != 2 {
+		t.Fatalf("AssignCustomer: %+v, %v, want version 2", assigned, err)
+	}
+	if got := versionNumbers(t, ds, id); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Fatalf("got versions %v, want [2 1]", got)
+	}
+	if first, exists := ds.GetVersion(id, 1); !exists || first.Title != "Plant" {
+		t.Errorf("GetVersion(1) = %+v, %v, want the first title", first, exists)
+	}
+
+	restored, exists, err := ds.RestoreVersion(id, 1)
+	if err != nil || !exists {
+		t.Fatalf("RestoreVersion: %v, %v", exists, err)
+	}
+	if restored.Version != 3 || restored.Title != "Plant" || !restored.CreatedTime.Equal(created.CreatedTime) ||
+		len(restored.AssignedCustomers) != 1 {
+		t.Errorf("got %+v, want version 3 with the first title, creation time and the current assignment", restored)
+	}
+	if got := versionNumbers(t, ds, id); len(got) != 3 || got[0] != 3 || got[2] != 1 {
+		t.Errorf("got versions %v, want [3 2 1]", got)
+	}
+	if _, exists, _ := ds.RestoreVersion(id, 99); exists {
+		t.Error("RestoreVersion found version 99")
+	}
+
+	// The history survives a restart
+	reloaded := newTestDashboardService(t, storageFile)
+	if dashboard, exists := reloaded.GetDashboard(id); !exists || dashboard.Version != 3 || dashboard.Title != "Plant" {
+		t.Fatalf("reloaded %+v, %v, want version 3", dashboard, exists)
+	}
+	if got := versionNumbers(t, reloaded, id); len(got) != 3 {
+		t.Errorf("reloaded versions %v, want 3", got)
+	}
+}
+
+func TestDashboardVersionLimit(t *testing.T) {
+	ds := newTestDashboardService(t, "")
+	created, err := ds.CreateDashboard(models.Dashboard{Title: "Plant"})
+	if err != nil {
+		t.Fatalf("CreateDashboard: %v", err)
+	}
+	for i := 0; i < maxDashboardVersions+10; i++ {
+		if _, _, err := ds.UpdateDashboard(created.ID, models.Dashboard{Title: "Plant"}); err != nil {
+			t.Fatalf("UpdateDashboard: %v", err)
+		}
+	}
+
+	versions := versionNumbers(t, ds, created.ID)
+	current := maxDashboardVersions + 11
+	if len(versions) != maxDashboardVersions+1 || versions[0] != current || versions[len(versions)-1] != current-maxDashboardVersions {
+		t.Errorf("got %d versions from %d to %d, want %d from %d to %d", len(versions), versions[0], versions[len(versions)-1],
+			maxDashboardVersions+1, current, current-maxDashboardVersions)
+	}
+	if _, exists := ds.GetVersion(created.ID, 1); exists {
+		t.Error("version 1 is still stored past the limit")
+	}
+}
+
+func TestDashboardUpdateKeptWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	ds := newTestDashboardService(t, filepath.Join(dir, "dashboards.json"))
+	created, err := ds.CreateDashboard(models.Dashboard{Title: "Plant"})
+	if err != nil {
+		t.Fatalf("CreateDashboard: %v", err)
+	}
+
+	// The storage directory cannot be created under a regular file
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatalf("creating file: %v", err)
+	}
+	ds.storageFile = filepath.Join(blocker, "dashboards.json")
+
+	if _, _, err := ds.UpdateDashboard(created.ID, models.Dashboard{Title: "Plant v2"}); !errors.Is(err, ErrDashboardStorage) {
+		t.Fatalf("got error %v, want a storage error", err)
+	}
+	if _, _, err := ds.RestoreVersion(created.ID, 1); !errors.Is(err, ErrDashboardStorage) {
+		t.Fatalf("got error %v, want a storage error", err)
+	}
+	if dashboard, _ := ds.GetDashboard(created.ID); dashboard.Version != 1 || dashboard.Title != "Plant" {
+		t.Errorf("got %+v after failed saves, want version 1 unchanged", dashboard)
+	}
+	if got := versionNumbers(t, ds, created.ID); len(got) != 1 {
+		t.Errorf("got versions %v after failed saves, want [1]", got)
+	}
+}
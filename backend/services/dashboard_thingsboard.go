@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"thingsboard-widget-backend/models"
+)
+
+// ImportThingsBoard creates a dashboard from a ThingsBoard dashboard export
+func (ds *DashboardService) ImportThingsBoard(tb models.ThingsBoardDashboard) (*models.Dashboard, error) {
+	dashboard, err := fromThingsBoard(tb)
+	if err != nil {
+		return nil, err
+	}
+	return ds.CreateDashboard(dashboard)
+}
+
+// ExportThingsBoard converts a dashboard to the ThingsBoard dashboard export format
+func (ds *DashboardService) ExportThingsBoard(dashboardID string) (*models.ThingsBoardDashboard, bool, error) {
+	dashboard, exists := ds.GetDashboard(dashboardID)
+	if !exists {
+		return nil, false, nil
+	}
+	tb, err := toThingsBoard(dashboard)
+	return tb, true, err
+}
+
+// fromThingsBoard converts a ThingsBoard export. Widget datasources and titles
+// are lifted out of the widget config; the remaining settings are kept as is.
+func fromThingsBoard(tb models.ThingsBoardDashboard) (models.Dashboard, error) {
+	dashboard := models.Dashboard{
+		Title:         tb.Title,
+		Description:   tb.Configuration.Description,
+		States:        tb.Configuration.States,
+		EntityAliases: make([]models.EntityAlias, 0, len(tb.Configuration.EntityAliases)),
+		Timewindow:    tb.Configuration.Timewindow,
+		Settings:      tb.Configuration.Settings,
+	}
+	if dashboard.Title == "" {
+		dashboard.Title = tb.Name
+	}
+
+	aliasIDs := make([]string, 0, len(tb.Configuration.EntityAliases))
+	for aliasID := range tb.Configuration.EntityAliases {
+		aliasIDs = append(aliasIDs, aliasID)
+	}
+	sort.Strings(aliasIDs)
+	for _, aliasID := range aliasIDs {
+		alias := tb.Configuration.EntityAliases[aliasID]
+		if alias.ID == "" {
+			alias.ID = aliasID
+		}
+		dashboard.EntityAliases = append(dashboard.EntityAliases, alias)
+	}
+
+	widgets, err := thingsBoardWidgets(tb.Configuration.Widgets)
+	if err != nil {
+		return dashboard, err
+	}
+	for i, tbWidget := range widgets {
+		widget, err := fromThingsBoardWidget(tbWidget)
+		if err != nil {
+			return dashboard, fmt.Errorf("configuration.widgets[%d]: %w", i, err)
+		}
+		dashboard.Widgets = append(dashboard.Widgets, widget)
+	}
+
+	for _, customer := range tb.AssignedCustomers {
+		if customer.CustomerID.ID == "" {
+			continue
+		}
+		dashboard.AssignedCustomers = append(dashboard.AssignedCustomers, models.CustomerInfo{
+			CustomerID: customer.CustomerID.ID,
+			Title:      customer.Title,
+		})
+	}
+	return dashboard, nil
+}
+
+// thingsBoardWidgets decodes the widgets of an export, which are keyed by ID
+// in current ThingsBoard versions and a plain list in older ones
+func thingsBoardWidgets(raw json.RawMessage) ([]models.ThingsBoardWidget, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var widgets []models.ThingsBoardWidget
+		if err := json.Unmarshal(raw, &widgets); err != nil {
+			return nil, fmt.Errorf("configuration.widgets: %w", err)
+		}
+		return widgets, nil
+	}
+
+	var keyed map[string]models.ThingsBoardWidget
+	if err := json.Unmarshal(raw, &keyed); err != nil {
+		return nil, fmt.Errorf("configuration.widgets: %w", err)
+	}
+	widgetIDs := make([]string, 0, len(keyed))
+	for widgetID := range keyed {
+		widgetIDs = append(widgetIDs, widgetID)
+	}
+	sort.Strings(widgetIDs)
+	widgets := make([]models.ThingsBoardWidget, 0, len(keyed))
+	for _, widgetID := range widgetIDs {
+		widget := keyed[widgetID]
+		if widget.ID == "" {
+			widget.ID = widgetID
+		}
+		widgets = append(widgets, widget)
+	}
+	return widgets, nil
+}
+
+// fromThingsBoardWidget splits a ThingsBoard widget config into typed fields and the remaining settings
+func fromThingsBoardWidget(tbWidget models.ThingsBoardWidget) (models.DashboardWidget, error) {
+	widget := models.DashboardWidget{
+		ID:          tbWidget.ID,
+		Type:        tbWidget.Type,
+		TypeFullFqn: tbWidget.TypeFullFqn,
+	}
+	if len(tbWidget.Config) == 0 {
+		return widget, nil
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(tbWidget.Config, &config); err != nil {
+		return widget, fmt.Errorf("config: %w", err)
+	}
+	if raw, ok := config["datasources"]; ok {
+		if err := json.Unmarshal(raw, &widget.Datasources); err != nil {
+			return widget, fmt.Errorf("config.datasources: %w", err)
+		}
+		delete(config, "datasources")
+	}
+	if raw, ok := config["title"]; ok {
+		if err := json.Unmarshal(raw, &widget.Title); err != nil {
+			return widget, fmt.Errorf("config.title: %w", err)
+		}
+		delete(config, "title")
+	}
+	if len(config) > 0 {
+		remaining, err := json.Marshal(config)
+		if err != nil {
+			return widget, err
+		}
+		widget.Config = remaining
+	}
+	return widget, nil
+}
+
+// toThingsBoard converts a dashboard to the ThingsBoard export format
+func toThingsBoard(dashboard *models.Dashboard) (*models.ThingsBoardDashboard, error) {
+	tb := &models.ThingsBoardDashboard{
+		Title: dashboard.Title,
+		Configuration: models.ThingsBoardConfiguration{
+			Description:   dashboard.Description,
+			States:        dashboard.States,
+			EntityAliases: make(map[string]models.EntityAlias, len(dashboard.EntityAliases)),
+			Timewindow:    dashboard.Timewindow,
+			Settings:      dashboard.Settings,
+		},
+	}
+	for _, alias := range dashboard.EntityAliases {
+		tb.Configuration.EntityAliases[alias.ID] = alias
+	}
+
+	widgets := make(map[string]models.ThingsBoardWidget, len(dashboard.Widgets))
+	for _, widget := range dashboard.Widgets {
+		config := make(map[string]interface{})
+		if len(widget.Config) > 0 {
+			if err := json.Unmarshal(widget.Config, &config); err != nil {
+				return nil, fmt.Errorf("widget %s: invalid config: %w", widget.ID, err)
+			}
+		}
+		config["datasources"] = widget.Datasources
+		if widget.Title != "" {
+			config["title"] = widget.Title
+		}
+		data, err := json.Marshal(config)
+		if err != nil {
+			return nil, fmt.Errorf("widget %s: %w", widget.ID, err)
+		}
+		widgets[widget.ID] = models.ThingsBoardWidget{
+			ID:          widget.ID,
+			Type:        widget.Type,
+			TypeFullFqn: widget.TypeFullFqn,
+			Config:      data,
+		}
+	}
+	data, err := json.Marshal(widgets)
+	if err != nil {
+		return nil, err
+	}
+	tb.Configuration.Widgets = data
+
+	for _, customer := range dashboard.AssignedCustomers {
+		tb.AssignedCustomers = append(tb.AssignedCustomers, models.ThingsBoardCustomerInfo{
+			CustomerID: models.EntityID{ID: customer.CustomerID, EntityType: models.EntityTypeCustomer},
+			Title:      customer.Title,
+		})
+	}
+	return tb, nil
+}
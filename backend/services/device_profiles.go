@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultProfileForType is the profile of configured devices that set none
+// and are not built-in devices, matching what the simulator generates
+var defaultProfileForType = map[string]string{
+	"sensor": "temperature_sensor",
+	"meter":  "power_meter",
+}
+
+// SetProfiles replaces the device profiles and rebuilds the combined key schema
+func (ts *TelemetryService) SetProfiles(profiles []models.DeviceProfile) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	ts.profiles = make(map[string]*models.DeviceProfile, len(profiles))
+	ts.keys = make(map[string]*models.TelemetryKey)
+	for i := range profiles {
+		profile := profiles[i]
+		ts.profiles[profile.Name] = &profile
+
+		for _, key := range profile.Keys {
+			ts.ensureKeyIDLocked(key.Name)
+			existing, exists := ts.keys[key.Name]
+			if !exists {
+				combined := key
+				ts.keys[key.Name] = &combined
+				continue
+			}
+			// Lookups not tied to a device accept whatever any profile accepts
+			existing.MinValue = math.Min(existing.MinValue, key.MinValue)
+			existing.MaxValue = math.Max(existing.MaxValue, key.MaxValue)
+		}
+	}
+
+	for _, device := range ts.devices {
+		if _, exists := ts.profiles[device.Profile]; !exists {
+			logrus.Warnf("Device %s references unknown device profile %q", device.ID, device.Profile)
+		}
+	}
+	logrus.Infof("Loaded %d device profiles", len(profiles))
+}
+
+// GetProfiles returns all device profiles sorted by name
+func (ts *TelemetryService) GetProfiles() []*models.DeviceProfile {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	profiles := make([]*models.DeviceProfile, 0, len(ts.profiles))
+	for _, profile := range ts.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// GetProfile returns a specific device profile
+func (ts *TelemetryService) GetProfile(name string) (*models.DeviceProfile, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	profile, exists := ts.profiles[name]
+	return profile, exists
+}
+
+// GetProfileDevices returns the devices using a profile, sorted by name
+func (ts *TelemetryService) GetProfileDevices(name string) ([]*models.Device, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if _, exists := ts.profiles[name]; !exists {
+		return nil, false
+	}
+	devices := []*models.Device{}
+	for _, device := range ts.devices {
+		if device.Profile == name {
+			devices = append(devices, device)
+		}
+	}
+	sortDevices(devices)
+	return devices, true
+}
+
+// GetDeviceTelemetryKey returns a key as defined by the device's profile.
+// Devices without a known profile fall back to the combined key schema.
+func (ts *TelemetryService) GetDeviceTelemetryKey(deviceID, name string) (*models.TelemetryKey, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if device, exists := ts.devices[deviceID]; exists {
+		if profile, exists := ts.profiles[device.Profile]; exists {
+			return profile.Key(name)
+		}
+	}
+	key, exists := ts.keys[name]
+	return key, exists
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestDeviceTelemetryKeyRanges(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	tests := []struct {
+		deviceID string
+		key      string
+		want     string // the range, or "" when the key is unknown
+	}{
+		{"device_003", "power", "[0, 25]"},
+		{"power_meter", "power", "[0, 5]"},
+		{"power_meter", "voltage", "[220, 240]"},
+		{"device_001", "power", ""}, // not a key of its profile
+		// Devices without a profile accept the widest range of any profile
+		{"missing", "power", "[0, 25]"},
+		{"missing", "voltage", "[200, 250]"},
+		{"missing", "unknown", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if key, exists := ts.GetDeviceTelemetryKey(tt.deviceID, tt.key); exists {
+			got = fmt.Sprintf("[%v, %v]", key.MinValue, key.MaxValue)
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.deviceID, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestImportValidatesProfileRanges(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	imports := NewImportService(ts)
+	options := models.ImportOptions{}
+	if err := imports.PrepareImport(&options); err != nil {
+		t.Fatalf("PrepareImport: %v", err)
+	}
+
+	start := time.Now().Add(-time.Minute).UnixMilli()
+	rows := []struct {
+		row  string
+		want string // the row error, or "" when the row is imported
+	}{
+		{"device_003,%d,10,230", ""},
+		{"power_meter,%d,4.5,230", ""},
+		{"power_meter,%d,10,230", "power: 10 is outside the valid range [0, 5]"},
+		{"power_meter,%d,4.5,210", "voltage: 210 is outside the valid range [220, 240]"},
+		{"device_003,%d,-1,230", "power: -1 is outside the valid range [0, 25]"},
+		{"device_001,%d,1,", `unknown telemetry key "power" for device "device_001"`},
+	}
+	file := "deviceId,ts,power,voltage\n"
+	for i, row := range rows {
+		file += fmt.Sprintf(row.row, start+int64(i)) + "\n"
+	}
+	result, err := imports.Import(strings.NewReader(file), options)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	got := make(map[int]string)
+	for _, rowError := range result.Errors {
+		got[rowError.Row] = rowError.Message
+	}
+	for i, row := range rows {
+		if message := got[i+1]; !strings.Contains(message, row.want) || (row.want == "") != (message == "") {
+			t.Errorf("row %d: got error %q, want %q", i+1, message, row.want)
+		}
+	}
+	if result.RowsImported != 2 {
+		t.Errorf("imported %d rows, want 2", result.RowsImported)
+	}
+}
+
+func TestSetProfilesWidensCombinedRanges(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	ts.SetProfiles([]models.DeviceProfile{
+		{Name: "temperature_sensor", Keys: []models.TelemetryKey{{Name: "temperature", Type: "numeric", MinValue: -10, MaxValue: 50}}},
+		{Name: "freezer_sensor", Keys: []models.TelemetryKey{{Name: "temperature", Type: "numeric", MinValue: -40, MaxValue: 10}}},
+	})
+
+	if key, _ := ts.GetTelemetryKey("temperature"); key.MinValue != -40 || key.MaxValue != 50 {
+		t.Errorf("got combined range [%v, %v], want [-40, 50]", key.MinValue, key.MaxValue)
+	}
+	// The profiles themselves keep their own ranges
+	if key, _ := ts.GetDeviceTelemetryKey("device_001", "temperature"); key.MinValue != -10 || key.MaxValue != 50 {
+		t.Errorf("got device_001 range [%v, %v], want [-10, 50]", key.MinValue, key.MaxValue)
+	}
+	if _, exists := ts.GetDeviceTelemetryKey("device_001", "humidity"); exists {
+		t.Error("humidity is still a key of device_001 after its profile was replaced")
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"thingsboard-widget-backend/models"
+)
+
+// RelationQuerier finds the entities related to a root entity, as selected
+// by a relationsQuery alias filter
+type RelationQuerier interface {
+	FindRelated(root models.EntityID, filter models.EntityAliasFilter) ([]models.EntityID, error)
+}
+
+// EntityAliasResolver resolves entity alias filters to the devices they
+// currently select, so dashboards need not hardcode device IDs
+type EntityAliasResolver struct {
+	telemetryService *TelemetryService
+	relations        RelationQuerier
+	mutex            sync.RWMutex
+}
+
+// NewEntityAliasResolver creates an alias resolver over the telemetry service's devices
+func NewEntityAliasResolver(telemetryService *TelemetryService) *EntityAliasResolver {
+	return &EntityAliasResolver{
+		telemetryService: telemetryService,
+	}
+}
+
+// SetRelationQuerier sets the relation graph used by relationsQuery filters
+func (ar *EntityAliasResolver) SetRelationQuerier(relations RelationQuerier) {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
+	ar.relations = relations
+}
+
+// Resolve returns the devices selected by a filter. stateEntity is the entity
+// the dashboard is opened for and may be nil when no filter needs it.
+func (ar *EntityAliasResolver) Resolve(filter models.EntityAliasFilter, stateEntity *models.EntityID) ([]*models.Device, error) {
+	if err := validateAliasFilter(filter); err != nil {
+		return nil, err
+	}
+
+	var devices []*models.Device
+	switch filter.Type {
+	case models.AliasFilterSingleEntity:
+		devices = ar.devicesByID([]string{filter.SingleEntity.ID})
+	case models.AliasFilterEntityList:
+		devices = ar.devicesByID(filter.EntityList)
+	case models.AliasFilterEntityName:
+		devices = ar.matchDevices(func(device *models.Device) bool {
+			return hasPrefixFold(device.Name, filter.EntityNameFilter)
+		})
+	case models.AliasFilterDeviceType:
+		types := toSet(aliasDeviceTypes(filter))
+		devices = ar.matchDevices(func(device *models.Device) bool {
+			return types[device.Type] && hasPrefixFold(device.Name, filter.DeviceNameFilter)
+		})
+	case models.AliasFilterLocation:
+		types := toSet(aliasDeviceTypes(filter))
+		devices = ar.matchDevices(func(device *models.Device) bool {
+			return containsFold(filter.Locations, device.Location) &&
+				(len(types) == 0 || types[device.Type]) &&
+				hasPrefixFold(device.Name, filter.DeviceNameFilter)
+		})
+	case models.AliasFilterStateEntity:
+		if stateEntity == nil {
+			return nil, fmt.Errorf("stateEntity filter requires a state entity")
+		}
+		if stateEntity.EntityType != models.EntityTypeDevice {
+			return nil, fmt.Errorf("state entity must be a %s, got %s", models.EntityTypeDevice, stateEntity.EntityType)
+		}
+		devices = ar.devicesByID([]string{stateEntity.ID})
+	case models.AliasFilterRelationsQuery:
+		related, err := ar.findRelated(filter, stateEntity)
+		if err != nil {
+			return nil, err
+		}
+		devices = related
+	}
+
+	if !filter.ResolveMultiple && len(devices) > 1 {
+		devices = devices[:1]
+	}
+	return devices, nil
+}
+
+// ResolveDashboard resolves every alias of a dashboard. A failing alias
+// reports its error without affecting the others.
+func (ar *EntityAliasResolver) ResolveDashboard(dashboard *models.Dashboard, stateEntity *models.EntityID) []models.ResolvedAlias {
+	resolved := make([]models.ResolvedAlias, 0, len(dashboard.EntityAliases))
+	for _, alias := range dashboard.EntityAliases {
+		result := models.ResolvedAlias{
+			AliasID: alias.ID,
+			Alias:   alias.Alias,
+			Devices: []*models.Device{},
+		}
+		devices, err := ar.Resolve(alias.Filter, stateEntity)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Devices = devices
+		}
+		resolved = append(resolved, result)
+	}
+	return resolved
+}
+
+// findRelated resolves a relationsQuery filter through the relation graph
+func (ar *EntityAliasResolver) findRelated(filter models.EntityAliasFilter, stateEntity *models.EntityID) ([]*models.Device, error) {
+	ar.mutex.RLock()
+	relations := ar.relations
+	ar.mutex.RUnlock()
+	if relations == nil {
+		return nil, fmt.Errorf("relation queries are not available")
+	}
+
+	root := filter.RootEntity
+	if filter.RootStateEntity {
+		if stateEntity == nil {
+			return nil, fmt.Errorf("rootStateEntity requires a state entity")
+		}
+		root = stateEntity
+	}
+	related, err := relations.FindRelated(*root, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceIDs := make([]string, 0, len(related))
+	for _, entity := range related {
+		if entity.EntityType == models.EntityTypeDevice {
+			deviceIDs = append(deviceIDs, entity.ID)
+		}
+	}
+	devices := ar.devicesByID(deviceIDs)
+	sortDevices(devices)
+	return devices, nil
+}
+
+// devicesByID returns the existing devices among the IDs, in order and without duplicates
+func (ar *EntityAliasResolver) devicesByID(deviceIDs []string) []*models.Device {
+	devices := make([]*models.Device, 0, len(deviceIDs))
+	seen := make(map[string]bool, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		if seen[deviceID] {
+			continue
+		}
+		seen[deviceID] = true
+		if device, exists := ar.telemetryService.GetDevice(deviceID); exists {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// matchDevices returns the devices accepted by match, sorted by name
+func (ar *EntityAliasResolver) matchDevices(match func(*models.Device) bool) []*models.Device {
+	devices := make([]*models.Device, 0)
+	for _, device := range ar.telemetryService.GetDevices() {
+		if match(device) {
+			devices = append(devices, device)
+		}
+	}
+	sortDevices(devices)
+	return devices
+}
+
+// validateAliasFilter checks that a filter has the fields its type needs
+func validateAliasFilter(filter models.EntityAliasFilter) error {
+	deviceEntity := func(entityType string) error {
+		if entityType != "" && entityType != models.EntityTypeDevice {
+			return fmt.Errorf("%s filter: unsupported entityType %q (expected %s)", filter.Type, entityType, models.EntityTypeDevice)
+		}
+		return nil
+	}
+
+	switch filter.Type {
+	case models.AliasFilterSingleEntity:
+		if filter.SingleEntity == nil || filter.SingleEntity.ID == "" {
+			return fmt.Errorf("singleEntity filter: singleEntity.id is required")
+		}
+		return deviceEntity(filter.SingleEntity.EntityType)
+	case models.AliasFilterEntityList:
+		if len(filter.EntityList) == 0 {
+			return fmt.Errorf("entityList filter: entityList must not be empty")
+		}
+		return deviceEntity(filter.EntityType)
+	case models.AliasFilterEntityName:
+		if filter.EntityNameFilter == "" {
+			return fmt.Errorf("entityName filter: entityNameFilter is required")
+		}
+		return deviceEntity(filter.EntityType)
+	case models.AliasFilterDeviceType:
+		if len(aliasDeviceTypes(filter)) == 0 {
+			return fmt.Errorf("deviceType filter: deviceTypes is required")
+		}
+	case models.AliasFilterLocation:
+		if len(filter.Locations) == 0 {
+			return fmt.Errorf("location filter: locations must not be empty")
+		}
+	case models.AliasFilterStateEntity:
+	case models.AliasFilterRelationsQuery:
+		if !filter.RootStateEntity && (filter.RootEntity == nil || filter.RootEntity.ID == "" || filter.RootEntity.EntityType == "") {
+			return fmt.Errorf("relationsQuery filter: rootEntity with entityType and id, or rootStateEntity, is required")
+		}
+		if filter.Direction != models.RelationDirectionFrom && filter.Direction != models.RelationDirectionTo {
+			return fmt.Errorf("relationsQuery filter: direction must be FROM or TO, got %q", filter.Direction)
+		}
+		if filter.MaxLevel < 0 {
+			return fmt.Errorf("relationsQuery filter: maxLevel must not be negative")
+		}
+	case "":
+		return fmt.Errorf("filter type is required")
+	default:
+		return fmt.Errorf("unsupported filter type %q", filter.Type)
+	}
+	return nil
+}
+
+// aliasDeviceTypes returns the device types of a filter, including the single type form
+func aliasDeviceTypes(filter models.EntityAliasFilter) []string {
+	if filter.DeviceType == "" {
+		return filter.DeviceTypes
+	}
+	return append([]string{filter.DeviceType}, filter.DeviceTypes...)
+}
+
+// sortDevices orders devices by name, then ID
+func sortDevices(devices []*models.Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Name != devices[j].Name {
+			return devices[i].Name < devices[j].Name
+		}
+		return devices[i].ID < devices[j].ID
+	})
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
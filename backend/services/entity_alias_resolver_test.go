@@ -0,0 +1,125 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"thingsboard-widget-backend/models"
+)
+
+// fixedRelations is a relation graph answering every query with the same
+// entities, recording the root it was asked about
+type fixedRelations struct {
+	related []models.EntityID
+	root    models.EntityID
+}
+
+func (fr *fixedRelations) FindRelated(root models.EntityID, filter models.EntityAliasFilter) ([]models.EntityID, error) {
+	fr.root = root
+	return fr.related, nil
+}
+
+// deviceIDs returns the IDs of devices, in order
+func deviceIDs(devices []*models.Device) string {
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestResolveAlias(t *testing.T) {
+	resolver := NewEntityAliasResolver(newTestTelemetryService(t))
+	relations := &fixedRelations{related: []models.EntityID{
+		{EntityType: models.EntityTypeDevice, ID: "device_004"},
+		{EntityType: models.EntityTypeAsset, ID: "pump_room"},
+		{EntityType: models.EntityTypeDevice, ID: "device_001"},
+		{EntityType: models.EntityTypeDevice, ID: "removed_device"},
+	}}
+	resolver.SetRelationQuerier(relations)
+
+	device := func(id string) *models.EntityID {
+		return &models.EntityID{EntityType: models.EntityTypeDevice, ID: id}
+	}
+	building := &models.EntityID{EntityType: models.EntityTypeAsset, ID: "building"}
+
+	tests := []struct {
+		name   string
+		filter models.EntityAliasFilter
+		state  *models.EntityID
+		want   string // device IDs, or the error
+	}{
+		{"single entity", models.EntityAliasFilter{Type: models.AliasFilterSingleEntity, SingleEntity: device("device_003")}, nil, "device_003"},
+		{"single unknown entity", models.EntityAliasFilter{Type: models.AliasFilterSingleEntity, SingleEntity: device("missing")}, nil, ""},
+		{"single asset", models.EntityAliasFilter{Type: models.AliasFilterSingleEntity, SingleEntity: building}, nil, `unsupported entityType "ASSET"`},
+		{"entity list", models.EntityAliasFilter{Type: models.AliasFilterEntityList, ResolveMultiple: true,
+			EntityList: []string{"device_004", "device_001", "device_004", "missing"}}, nil, "device_004,device_001"},
+		{"entity list first", models.EntityAliasFilter{Type: models.AliasFilterEntityList, EntityList: []string{"device_004", "device_001"}}, nil, "device_004"},
+		{"entity name", models.EntityAliasFilter{Type: models.AliasFilterEntityName, ResolveMultiple: true, EntityNameFilter: "TEMP"}, nil, "device_001"},
+		{"device type", models.EntityAliasFilter{Type: models.AliasFilterDeviceType, ResolveMultiple: true, DeviceTypes: []string{"sensor"}},
+			nil, "device_002,device_001,device_004"}, // sorted by name
+		{"device type and name", models.EntityAliasFilter{Type: models.AliasFilterDeviceType, ResolveMultiple: true, DeviceType: "meter",
+			DeviceNameFilter: "power"}, nil, "device_003"},
+		{"location", models.EntityAliasFilter{Type: models.AliasFilterLocation, ResolveMultiple: true, Locations: []string{"room a"}},
+			nil, "device_002,device_001"},
+		{"location and type", models.EntityAliasFilter{Type: models.AliasFilterLocation, ResolveMultiple: true,
+			Locations: []string{"Room A", "Main Panel"}, DeviceTypes: []string{"meter"}}, nil, "power_meter"},
+		{"state entity", models.EntityAliasFilter{Type: models.AliasFilterStateEntity}, device("device_002"), "device_002"},
+		{"missing state entity", models.EntityAliasFilter{Type: models.AliasFilterStateEntity}, nil, "requires a state entity"},
+		{"asset state entity", models.EntityAliasFilter{Type: models.AliasFilterStateEntity}, building, "state entity must be a DEVICE"},
+		{"relations", models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery, ResolveMultiple: true, RootEntity: building,
+			Direction: models.RelationDirectionFrom}, nil, "device_001,device_004"},
+		{"relations from state", models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery, RootStateEntity: true,
+			Direction: models.RelationDirectionFrom}, nil, "rootStateEntity requires a state entity"},
+		{"relations direction", models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery, RootEntity: building}, nil, "direction must be FROM or TO"},
+		{"relations level", models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery, RootEntity: building,
+			Direction: models.RelationDirectionTo, MaxLevel: -1}, nil, "maxLevel must not be negative"},
+		{"empty list", models.EntityAliasFilter{Type: models.AliasFilterEntityList}, nil, "entityList must not be empty"},
+		{"no device types", models.EntityAliasFilter{Type: models.AliasFilterDeviceType}, nil, "deviceTypes is required"},
+		{"no type", models.EntityAliasFilter{}, nil, "filter type is required"},
+		{"unknown type", models.EntityAliasFilter{Type: "assetType"}, nil, `unsupported filter type "assetType"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := resolver.Resolve(tt.filter, tt.state)
+			got := deviceIDs(devices)
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.Contains(got, tt.want) || (err == nil && got != tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A relation query rooted at the state entity starts from it
+	filter := models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery, RootStateEntity: true, Direction: models.RelationDirectionTo}
+	if _, err := resolver.Resolve(filter, building); err != nil || relations.root != *building {
+		t.Errorf("got root %+v, %v, want the state entity", relations.root, err)
+	}
+}
+
+func TestResolveDashboardAliases(t *testing.T) {
+	resolver := NewEntityAliasResolver(newTestTelemetryService(t))
+	dashboard := &models.Dashboard{EntityAliases: []models.EntityAlias{
+		{ID: "meters", Alias: "Meters", Filter: models.EntityAliasFilter{Type: models.AliasFilterDeviceType, ResolveMultiple: true, DeviceTypes: []string{"meter"}}},
+		{ID: "related", Alias: "Related", Filter: models.EntityAliasFilter{Type: models.AliasFilterRelationsQuery,
+			RootEntity: &models.EntityID{EntityType: models.EntityTypeAsset, ID: "building"}, Direction: models.RelationDirectionFrom}},
+		{ID: "current", Alias: "Current", Filter: models.EntityAliasFilter{Type: models.AliasFilterStateEntity}},
+	}}
+
+	// Without a relation graph or state entity, only those aliases fail
+	resolved := resolver.ResolveDashboard(dashboard, nil)
+	if len(resolved) != 3 {
+		t.Fatalf("got %d aliases, want 3", len(resolved))
+	}
+	if resolved[0].Error != "" || deviceIDs(resolved[0].Devices) != "device_003,power_meter" {
+		t.Errorf("got %+v, want both meters", resolved[0])
+	}
+	if resolved[1].Error != "relation queries are not available" || resolved[1].Devices == nil || len(resolved[1].Devices) != 0 {
+		t.Errorf("got %+v, want no devices and the missing relation graph", resolved[1])
+	}
+	if !strings.Contains(resolved[2].Error, "requires a state entity") {
+		t.Errorf("got %+v, want the missing state entity", resolved[2])
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// GetDeviceByEntity returns the device ID mapped to an entity UUID
+func (ts *TelemetryService) GetDeviceByEntity(entityID uuid.UUID) (string, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	for deviceID, mapped := range ts.entityMappings {
+		if mapped == entityID {
+			return deviceID, true
+		}
+	}
+	return "", false
+}
+
+// GetEntityHistory returns a page of telemetry rows for an entity, ordered by
+// timestamp and key ID. Pass the previous page's cursor to continue after it.
+func (ts *TelemetryService) GetEntityHistory(request models.EntityHistoryRequest) (*models.EntityHistoryPage, error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	var deviceID string
+	for id, mapped := range ts.entityMappings {
+		if mapped == request.EntityID {
+			deviceID = id
+			break
+		}
+	}
+	if deviceID == "" {
+		return nil, fmt.Errorf("entity %s not found", request.EntityID)
+	}
+
+	// Resolve the requested key IDs to names, in key ID order
+	keyNames := make(map[int]string, len(ts.keyMappings))
+	for name, id := range ts.keyMappings {
+		keyNames[id] = name
+	}
+	keyIDs := request.KeyIDs
+	if len(keyIDs) == 0 {
+		for id := range keyNames {
+			keyIDs = append(keyIDs, id)
+		}
+	}
+	keyIDs = append([]int(nil), keyIDs...)
+	sort.Ints(keyIDs)
+	for _, id := range keyIDs {
+		if _, exists := keyNames[id]; !exists {
+			return nil, fmt.Errorf("unknown key ID %d", id)
+		}
+	}
+
+	page := &models.EntityHistoryPage{
+		EntityID:  request.EntityID,
+		DeviceID:  deviceID,
+		Telemetry: []models.Telemetry{},
+	}
+
+	startMs := request.StartTs
+	if request.Cursor != nil && request.Cursor.Ts > startMs {
+		startMs = request.Cursor.Ts
+	}
+	data := ts.data[deviceID]
+	first := sort.Search(len(data), func(i int) bool {
+		return data[i].Timestamp.UnixMilli() >= startMs
+	})
+
+	for _, record := range data[first:] {
+		recordMs := record.Timestamp.UnixMilli()
+		if recordMs > request.EndTs {
+			break
+		}
+		for _, keyID := range keyIDs {
+			value, exists := record.Values[keyNames[keyID]]
+			if !exists {
+				continue
+			}
+			if request.Cursor != nil && !request.Cursor.After(recordMs, keyID) {
+				continue
+			}
+			if len(page.Telemetry) == request.Limit {
+				page.HasNext = true
+				page.NextCursor = lastRowCursor(page.Telemetry)
+				return page, nil
+			}
+
+			entity, err := models.NewTelemetryEntity(request.EntityID, time.UnixMilli(recordMs), keyID, value)
+			if err != nil {
+				return nil, err
+			}
+			page.Telemetry = append(page.Telemetry, entity)
+		}
+	}
+
+	// Always hand back a cursor so sync clients can poll for newer rows later;
+	// an empty page keeps the cursor it was given
+	if len(page.Telemetry) > 0 {
+		page.NextCursor = lastRowCursor(page.Telemetry)
+	} else if request.Cursor != nil {
+		page.NextCursor = request.Cursor.String()
+	}
+	return page, nil
+}
+
+// lastRowCursor returns the cursor pointing at the last row of a page
+func lastRowCursor(rows []models.Telemetry) string {
+	last := rows[len(rows)-1]
+	return models.EntityCursor{Ts: last.Timestamp.UnixMilli(), Key: last.Key}.String()
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestGetEntityHistoryEmptyPageKeepsCursor(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	ts.data["device_001"] = testReadings("device_001", "temperature", 1000, 2000, 3000)
+	entityID := ts.GetEntityMappings()["device_001"]
+
+	request := models.EntityHistoryRequest{
+		EntityID: entityID,
+		KeyIDs:   []int{ts.GetKeyMappings()["temperature"]},
+		StartTs:  0,
+		EndTs:    10000,
+		Limit:    10,
+	}
+	page, err := ts.GetEntityHistory(request)
+	if err != nil {
+		t.Fatalf("GetEntityHistory: %v", err)
+	}
+	if len(page.Telemetry) != 3 || page.HasNext {
+		t.Fatalf("first page has %d rows (hasNext %v), want 3 and no next page", len(page.Telemetry), page.HasNext)
+	}
+
+	// Polling again with the last cursor finds nothing new yet
+	cursor, err := models.ParseEntityCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("ParseEntityCursor(%q): %v", page.NextCursor, err)
+	}
+	request.Cursor = &cursor
+	empty, err := ts.GetEntityHistory(request)
+	if err != nil {
+		t.Fatalf("GetEntityHistory: %v", err)
+	}
+	if len(empty.Telemetry) != 0 {
+		t.Fatalf("poll returned %d rows, want none", len(empty.Telemetry))
+	}
+	if empty.NextCursor != page.NextCursor {
+		t.Fatalf("empty page cursor = %q, want the incoming %q", empty.NextCursor, page.NextCursor)
+	}
+
+	// Rows arriving later are picked up from the kept cursor
+	ts.data["device_001"] = append(ts.data["device_001"], testReadings("device_001", "temperature", 4000)...)
+	next, err := ts.GetEntityHistory(request)
+	if err != nil {
+		t.Fatalf("GetEntityHistory: %v", err)
+	}
+	if len(next.Telemetry) != 1 || next.Telemetry[0].Timestamp.UnixMilli() != 4000 {
+		t.Fatalf("poll after new reading returned %+v, want the reading at 4000", next.Telemetry)
+	}
+}
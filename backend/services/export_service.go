@@ -0,0 +1,244 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// exportFlushEvery is the number of rows written between flushes to the client
+const exportFlushEvery = 500
+
+// minExportInterval is the smallest aggregation bucket accepted for exports
+const minExportInterval = 1000
+
+// exportChunkBuckets is the number of interval buckets aggregated at a time,
+// bounding what an aggregated export holds in memory
+const exportChunkBuckets = 500
+
+// exportRow is one output row: a device reading or an aggregated bucket
+type exportRow struct {
+	DeviceID  string
+	Timestamp time.Time
+	Values    map[string]interface{}
+}
+
+// exportWriter encodes rows in a specific file format
+type exportWriter interface {
+	WriteHeader(keys []string) error
+	WriteRow(row exportRow) error
+	Flush() error
+	Close() error
+}
+
+// ExportService streams historical telemetry as downloadable files
+type ExportService struct {
+	telemetryService *TelemetryService
+}
+
+// NewExportService creates a new export service
+func NewExportService(telemetryService *TelemetryService) *ExportService {
+	return &ExportService{
+		telemetryService: telemetryService,
+	}
+}
+
+// PrepareExport validates the request, fills in defaults and resolves the timezone
+func (es *ExportService) PrepareExport(request *models.ExportRequest) (*time.Location, error) {
+	if len(request.DeviceIDs) == 0 {
+		return nil, fmt.Errorf("at least one deviceId is required")
+	}
+	for _, deviceID := range request.DeviceIDs {
+		if _, exists := es.telemetryService.GetDevice(deviceID); !exists {
+			return nil, fmt.Errorf("device %q not found", deviceID)
+		}
+	}
+	if len(request.Keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	request.Format = strings.ToLower(request.Format)
+	if request.Format == "" {
+		request.Format = models.ExportFormatCSV
+	}
+	switch request.Format {
+	case models.ExportFormatCSV, models.ExportFormatNDJSON, models.ExportFormatXLSX:
+	default:
+		return nil, fmt.Errorf("unsupported format %q (expected csv, ndjson or xlsx)", request.Format)
+	}
+
+	request.Agg = strings.ToUpper(request.Agg)
+	if request.Agg == "" {
+		request.Agg = models.AggregationNone
+	}
+	if !models.IsValidAggregation(request.Agg) {
+		return nil, fmt.Errorf("unsupported aggregation %q", request.Agg)
+	}
+	if request.Agg != models.AggregationNone && request.Interval < minExportInterval {
+		return nil, fmt.Errorf("interval must be at least %d ms when aggregating", minExportInterval)
+	}
+
+	now := time.Now()
+	if request.EndTs == 0 {
+		request.EndTs = now.UnixMilli()
+	}
+	if request.StartTs == 0 {
+		request.StartTs = now.Add(-24 * time.Hour).UnixMilli()
+	}
+	if request.StartTs > request.EndTs {
+		return nil, fmt.Errorf("startTs must not be after endTs")
+	}
+	if request.Agg != models.AggregationNone {
+		if err := checkBucketCount(request.StartTs, request.EndTs, request.Interval); err != nil {
+			return nil, err
+		}
+	}
+
+	if request.Timezone == "" {
+		request.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(request.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", request.Timezone)
+	}
+
+	return loc, nil
+}
+
+// ExportContentType returns the MIME type for an export format
+func ExportContentType(format string) string {
+	switch format {
+	case models.ExportFormatNDJSON:
+		return "application/x-ndjson"
+	case models.ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Export streams the requested telemetry to w. The request must have been
+// prepared with PrepareExport. Devices are written one after another, each in
+// timestamp order.
+func (es *ExportService) Export(w io.Writer, request models.ExportRequest, loc *time.Location) error {
+	var writer exportWriter
+	switch request.Format {
+	case models.ExportFormatNDJSON:
+		writer = newNDJSONExportWriter(w, loc)
+	case models.ExportFormatXLSX:
+		writer = newXLSXExportWriter(w, loc)
+	default:
+		writer = newCSVExportWriter(w, loc, request.BOM)
+	}
+
+	if err := writer.WriteHeader(request.Keys); err != nil {
+		return err
+	}
+
+	start := time.UnixMilli(request.StartTs)
+	end := time.UnixMilli(request.EndTs)
+	written := 0
+
+	emit := func(row exportRow) error {
+		if err := writer.WriteRow(row); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			return writer.Flush()
+		}
+		return nil
+	}
+
+	for _, deviceID := range request.DeviceIDs {
+		var err error
+		if request.Agg == models.AggregationNone {
+			err = es.exportRaw(deviceID, request.Keys, start, end, emit)
+		} else {
+			err = es.exportAggregated(deviceID, request, start, end, emit)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// exportRaw emits one row per reading that has at least one requested key
+func (es *ExportService) exportRaw(deviceID string, keys []string, start, end time.Time, emit func(exportRow) error) error {
+	return es.telemetryService.ScanTelemetry(deviceID, start, end, func(record models.TelemetryData) error {
+		values := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			if value, exists := record.Values[key]; exists {
+				values[key] = value
+			}
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return emit(exportRow{DeviceID: deviceID, Timestamp: record.Timestamp, Values: values})
+	})
+}
+
+// exportAggregated emits one row per interval bucket with the aggregated value
+// of each key, in timestamp order. The range is aggregated exportChunkBuckets
+// buckets at a time, each chunk being written before the next is read. Buckets
+// are read from the rollup tiers where possible, so ranges older than the raw
+// retention can still be exported.
+func (es *ExportService) exportAggregated(deviceID string, request models.ExportRequest, start, end time.Time, emit func(exportRow) error) error {
+	interval := request.Interval
+	endMs := end.UnixMilli()
+	for from := bucketStart(start.UnixMilli(), interval); ; {
+		to := from + exportChunkBuckets*interval - 1
+		if to < from || to > endMs {
+			to = endMs
+		}
+		chunkStart := time.UnixMilli(from)
+		if chunkStart.Before(start) {
+			chunkStart = start
+		}
+		if err := es.exportChunk(deviceID, request, chunkStart, time.UnixMilli(to), emit); err != nil {
+			return err
+		}
+		if to >= endMs {
+			return nil
+		}
+		from = to + 1
+	}
+}
+
+// exportChunk emits the aggregated rows of the buckets in [start, end]
+func (es *ExportService) exportChunk(deviceID string, request models.ExportRequest, start, end time.Time, emit func(exportRow) error) error {
+	rows := make(map[int64]map[string]interface{})
+	for key, buckets := range es.telemetryService.aggregateBuckets(deviceID, request.Keys, start, end, request.Interval) {
+		for _, bucket := range buckets {
+			values, exists := rows[bucket.start]
+			if !exists {
+				values = make(map[string]interface{})
+				rows[bucket.start] = values
+			}
+			values[key] = bucket.acc.result(request.Agg)
+		}
+	}
+
+	timestamps := make([]int64, 0, len(rows))
+	for ts := range rows {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	for _, ts := range timestamps {
+		if err := emit(exportRow{DeviceID: deviceID, Timestamp: time.UnixMilli(ts), Values: rows[ts]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestExportAggregatedStreamsBucketsInOrder(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	minute := time.Minute.Milliseconds()
+	buckets := 2*exportChunkBuckets + 200
+	first := time.Now().Add(-time.Duration(buckets+10) * time.Minute).Truncate(time.Minute).UnixMilli()
+
+	// One reading 10s into every minute, valued by its minute
+	var readings []models.TelemetryData
+	for i := 0; i < buckets; i++ {
+		readings = append(readings, testReadings("device_001", "level", first+int64(i)*minute+10000)...)
+		readings[i].Values["level"] = float64(i)
+	}
+	ts.StoreHistorical(readings)
+
+	es := NewExportService(ts)
+	request := models.ExportRequest{
+		DeviceIDs: []string{"device_001"},
+		Keys:      []string{"level"},
+		StartTs:   first + 5000, // not aligned to the interval
+		EndTs:     first + int64(buckets)*minute - 1,
+		Agg:       models.AggregationAvg,
+		Interval:  minute,
+	}
+	if _, err := es.PrepareExport(&request); err != nil {
+		t.Fatalf("PrepareExport: %v", err)
+	}
+
+	var rows []exportRow
+	emit := func(row exportRow) error {
+		rows = append(rows, row)
+		return nil
+	}
+	if err := es.exportAggregated("device_001", request, time.UnixMilli(request.StartTs), time.UnixMilli(request.EndTs), emit); err != nil {
+		t.Fatalf("exportAggregated: %v", err)
+	}
+
+	if len(rows) != buckets {
+		t.Fatalf("got %d rows, want %d", len(rows), buckets)
+	}
+	for i, row := range rows {
+		if want := first + int64(i)*minute; row.Timestamp.UnixMilli() != want || row.Values["level"] != float64(i) {
+			t.Fatalf("row %d: got %d %v, want %d %v", i, row.Timestamp.UnixMilli(), row.Values["level"], want, float64(i))
+		}
+	}
+}
+
+func TestPrepareExportLimitsBuckets(t *testing.T) {
+	es := NewExportService(newTestTelemetryService(t))
+	now := time.Now().UnixMilli()
+	request := models.ExportRequest{
+		DeviceIDs: []string{"device_001"},
+		Keys:      []string{"temperature"},
+		StartTs:   now - (maxQueryBuckets+1)*1000,
+		EndTs:     now,
+		Agg:       models.AggregationAvg,
+		Interval:  1000,
+	}
+	_, err := es.PrepareExport(&request)
+	if err == nil || !strings.Contains(err.Error(), "would produce more than") {
+		t.Errorf("got error %v, want the bucket limit", err)
+	}
+
+	// Raw exports are not bucketed
+	request.Agg = models.AggregationNone
+	if _, err := es.PrepareExport(&request); err != nil {
+		t.Errorf("PrepareExport without aggregation: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// exportTimeLayout is used for human-readable timestamps in CSV files
+const exportTimeLayout = "2006-01-02 15:04:05.000"
+
+// exportTimeColumn holds the human-readable timestamp next to "ts"
+const exportTimeColumn = "time"
+
+// formatExportValue renders a telemetry value as text
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// csvExportWriter writes rows as comma-separated values
+type csvExportWriter struct {
+	w    *csv.Writer
+	out  io.Writer
+	loc  *time.Location
+	keys []string
+	bom  bool
+}
+
+func newCSVExportWriter(w io.Writer, loc *time.Location, bom bool) *csvExportWriter {
+	return &csvExportWriter{w: csv.NewWriter(w), out: w, loc: loc, bom: bom}
+}
+
+func (cw *csvExportWriter) WriteHeader(keys []string) error {
+	cw.keys = keys
+	if cw.bom {
+		if _, err := cw.out.Write([]byte("\ufeff")); err != nil {
+			return err
+		}
+	}
+	return cw.w.Write(append([]string{"ts", exportTimeColumn, "deviceId"}, keys...))
+}
+
+func (cw *csvExportWriter) WriteRow(row exportRow) error {
+	record := make([]string, 0, len(cw.keys)+3)
+	record = append(record,
+		strconv.FormatInt(row.Timestamp.UnixMilli(), 10),
+		row.Timestamp.In(cw.loc).Format(exportTimeLayout),
+		row.DeviceID,
+	)
+	for _, key := range cw.keys {
+		record = append(record, formatExportValue(row.Values[key]))
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvExportWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvExportWriter) Close() error {
+	return cw.Flush()
+}
+
+// ndjsonExportWriter writes one JSON object per line
+type ndjsonExportWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+	loc *time.Location
+}
+
+type ndjsonExportRow struct {
+	Ts       int64                  `json:"ts"`
+	Time     string                 `json:"time"`
+	DeviceID string                 `json:"deviceId"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+func newNDJSONExportWriter(w io.Writer, loc *time.Location) *ndjsonExportWriter {
+	buffered := bufio.NewWriter(w)
+	return &ndjsonExportWriter{w: buffered, enc: json.NewEncoder(buffered), loc: loc}
+}
+
+func (nw *ndjsonExportWriter) WriteHeader(keys []string) error {
+	return nil
+}
+
+func (nw *ndjsonExportWriter) WriteRow(row exportRow) error {
+	return nw.enc.Encode(ndjsonExportRow{
+		Ts:       row.Timestamp.UnixMilli(),
+		Time:     row.Timestamp.In(nw.loc).Format(time.RFC3339Nano),
+		DeviceID: row.DeviceID,
+		Values:   row.Values,
+	})
+}
+
+func (nw *ndjsonExportWriter) Flush() error {
+	return nw.w.Flush()
+}
+
+func (nw *ndjsonExportWriter) Close() error {
+	return nw.Flush()
+}
+
+// xlsxExportWriter writes a single-sheet Office Open XML workbook. The sheet is
+// streamed into the zip archive row by row using inline strings, so no shared
+// string table has to be held in memory.
+type xlsxExportWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	loc   *time.Location
+	keys  []string
+}
+
+// excelEpoch is day zero of the Excel 1900 date system
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+var xlsxStaticParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Telemetry" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+func newXLSXExportWriter(w io.Writer, loc *time.Location) *xlsxExportWriter {
+	return &xlsxExportWriter{zw: zip.NewWriter(w), loc: loc}
+}
+
+func (xw *xlsxExportWriter) WriteHeader(keys []string) error {
+	xw.keys = keys
+
+	for _, part := range xlsxStaticParts {
+		f, err := xw.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := xw.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	xw.sheet = bufio.NewWriter(f)
+	xw.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	xw.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	xw.sheet.WriteString("<row>")
+	for _, title := range append([]string{"ts", exportTimeColumn, "deviceId"}, keys...) {
+		xw.writeString(title)
+	}
+	_, err = xw.sheet.WriteString("</row>")
+	return err
+}
+
+func (xw *xlsxExportWriter) WriteRow(row exportRow) error {
+	xw.sheet.WriteString("<row>")
+	xw.writeNumber(float64(row.Timestamp.UnixMilli()))
+	xw.writeDate(row.Timestamp.In(xw.loc))
+	xw.writeString(row.DeviceID)
+	for _, key := range xw.keys {
+		switch v := row.Values[key].(type) {
+		case nil:
+			xw.sheet.WriteString("<c/>")
+		case float64:
+			xw.writeNumber(v)
+		case int:
+			xw.writeNumber(float64(v))
+		case bool:
+			if v {
+				xw.sheet.WriteString(`<c t="b"><v>1</v></c>`)
+			} else {
+				xw.sheet.WriteString(`<c t="b"><v>0</v></c>`)
+			}
+		default:
+			xw.writeString(formatExportValue(v))
+		}
+	}
+	_, err := xw.sheet.WriteString("</row>")
+	return err
+}
+
+func (xw *xlsxExportWriter) writeNumber(value float64) {
+	xw.sheet.WriteString("<c><v>")
+	xw.sheet.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	xw.sheet.WriteString("</v></c>")
+}
+
+// writeDate writes the wall-clock time as an Excel serial date with a date style
+func (xw *xlsxExportWriter) writeDate(t time.Time) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	serial := wall.Sub(excelEpoch).Hours() / 24
+	xw.sheet.WriteString(`<c s="1"><v>`)
+	xw.sheet.WriteString(strconv.FormatFloat(serial, 'f', -1, 64))
+	xw.sheet.WriteString("</v></c>")
+}
+
+func (xw *xlsxExportWriter) writeString(value string) {
+	xw.sheet.WriteString(`<c t="inlineStr"><is><t>`)
+	xml.EscapeText(xw.sheet, []byte(value))
+	xw.sheet.WriteString("</t></is></c>")
+}
+
+func (xw *xlsxExportWriter) Flush() error {
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Flush()
+}
+
+func (xw *xlsxExportWriter) Close() error {
+	xw.sheet.WriteString("</sheetData></worksheet>")
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// maxForecastSamples caps the history buckets a model is fitted on, keeping
+// the Holt-Winters parameter search fast at fine intervals
+const maxForecastSamples = 5000
+
+// forecastResult is the forecast of the steps following the fitted values,
+// with the variance of each step's forecast error
+type forecastResult struct {
+	values    []float64
+	variances []float64
+}
+
+// forecastSeason returns the steps per season of evenly spaced values: a day
+// for intervals dividing it, a week of days for daily values, else none. Models
+// need two seasons of history to learn one.
+func forecastSeason(interval int64, samples int) int {
+	day := (24 * time.Hour).Milliseconds()
+	season := 1
+	switch {
+	case interval < day && day%interval == 0:
+		season = int(day / interval)
+	case interval == day:
+		season = 7
+	}
+	if samples < 2*season {
+		return 1
+	}
+	return season
+}
+
+// fitForecast forecasts steps values following y with the given method
+func fitForecast(method string, y []float64, season, steps int) forecastResult {
+	if method == models.ForecastSeasonalNaive {
+		return seasonalNaive(y, season, steps)
+	}
+	return holtWinters(y, season, steps)
+}
+
+// seasonalNaive repeats the latest season. Its error variance is that of the
+// differences between values one season apart, growing with every season
+// forecast ahead.
+func seasonalNaive(y []float64, season, steps int) forecastResult {
+	n := len(y)
+	squares, count := 0.0, 0
+	for t := season; t < n; t++ {
+		diff := y[t] - y[t-season]
+		squares += diff * diff
+		count++
+	}
+	sigma2 := 0.0
+	if count > 0 {
+		sigma2 = squares / float64(count)
+	}
+
+	result := forecastResult{values: make([]float64, steps), variances: make([]float64, steps)}
+	for h := 0; h < steps; h++ {
+		result.values[h] = y[n-season+h%season]
+		result.variances[h] = sigma2 * float64(h/season+1)
+	}
+	return result
+}
+
+// hwParams are the smoothing parameters of additive Holt-Winters with a damped trend
+type hwParams struct {
+	alpha float64 // level
+	beta  float64 // trend
+	gamma float64 // seasonality
+	phi   float64 // trend damping
+}
+
+// hwState is the fitted state of a Holt-Winters model
+type hwState struct {
+	level    float64
+	trend    float64
+	seasonal []float64 // indexed by position in the season, relative to y[0]
+	sse      float64   // sum of squared one-step errors
+	errors   int
+}
+
+// Parameter grid searched by holtWinters. Damping keeps trends from running
+// away over long horizons.
+var (
+	hwAlphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	hwBetas  = []float64{0, 0.01, 0.05, 0.1, 0.2}
+	hwGammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+	hwPhis   = []float64{0.9, 0.95, 0.98}
+)
+
+// holtWinters fits additive Holt-Winters with a damped trend, choosing the
+// parameters with the smallest one-step errors. Without seasonality it is
+// Holt's linear method.
+func holtWinters(y []float64, season, steps int) forecastResult {
+	gammas := hwGammas
+	if season == 1 {
+		gammas = []float64{0}
+	}
+
+	var best hwState
+	var bestParams hwParams
+	found := false
+	for _, alpha := range hwAlphas {
+		for _, beta := range hwBetas {
+			for _, gamma := range gammas {
+				for _, phi := range hwPhis {
+					params := hwParams{alpha: alpha, beta: beta, gamma: gamma, phi: phi}
+					state := runHoltWinters(y, season, params)
+					if !found || state.sse < best.sse {
+						best, bestParams, found = state, params, true
+					}
+				}
+			}
+		}
+	}
+
+	sigma2 := 0.0
+	if best.errors > 0 {
+		sigma2 = best.sse / float64(best.errors)
+	}
+
+	// Forecast error variance of ETS(A,Ad,A): sigma² (1 + Σ c_j²) over the
+	// steps before h, with c_j = α(1 + βφ_j) + γ once per season
+	n := len(y)
+	result := forecastResult{values: make([]float64, steps), variances: make([]float64, steps)}
+	damped, sumC2 := 0.0, 0.0
+	for h := 1; h <= steps; h++ {
+		damped += math.Pow(bestParams.phi, float64(h))
+		result.values[h-1] = best.level + damped*best.trend + best.seasonal[(n+h-1)%season]
+		result.variances[h-1] = sigma2 * (1 + sumC2)
+
+		c := bestParams.alpha * (1 + bestParams.beta*damped)
+		if season > 1 && h%season == 0 {
+			c += bestParams.gamma
+		}
+		sumC2 += c * c
+	}
+	return result
+}
+
+// runHoltWinters smooths y with the given parameters. The first season
+// initialises the level and seasonal indices and the second the trend;
+// without seasonality the first two values initialise level and trend.
+func runHoltWinters(y []float64, season int, params hwParams) hwState {
+	state := hwState{seasonal: make([]float64, season)}
+	start := 1
+	if season > 1 {
+		first, second := meanOf(y[:season]), meanOf(y[season:2*season])
+		state.level = first
+		state.trend = (second - first) / float64(season)
+		for i := 0; i < season; i++ {
+			state.seasonal[i] = y[i] - first
+		}
+		start = season
+	} else {
+		state.level = y[0]
+		state.trend = y[1] - y[0]
+	}
+
+	for t := start; t < len(y); t++ {
+		s := state.seasonal[t%season]
+		err := y[t] - (state.level + params.phi*state.trend + s)
+		state.sse += err * err
+		state.errors++
+
+		level := params.alpha*(y[t]-s) + (1-params.alpha)*(state.level+params.phi*state.trend)
+		state.trend = params.beta*(level-state.level) + (1-params.beta)*params.phi*state.trend
+		state.seasonal[t%season] = params.gamma*(y[t]-level) + (1-params.gamma)*s
+		state.level = level
+	}
+	return state
+}
+
+// meanOf returns the average of values
+func meanOf(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
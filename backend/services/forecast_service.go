@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+// defaultForecastInterval is the forecast step when a request sets none
+const defaultForecastInterval = int64(time.Hour / time.Millisecond)
+
+// ForecastService forecasts telemetry keys from their stored history. Rate
+// keys such as power are forecast bucket by bucket; cumulative keys such as
+// energy are forecast as the increase per bucket, added up from the latest
+// reading into projected readings.
+type ForecastService struct {
+	telemetryService *TelemetryService
+	config           config.ForecastingConfig
+	mutex            sync.RWMutex
+}
+
+// NewForecastService creates a forecast service reading history from the telemetry service
+func NewForecastService(telemetryService *TelemetryService, cfg config.ForecastingConfig) *ForecastService {
+	return &ForecastService{telemetryService: telemetryService, config: cfg}
+}
+
+// SetConfig replaces the forecasting settings
+func (fs *ForecastService) SetConfig(cfg config.ForecastingConfig) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.config = cfg
+}
+
+// PrepareForecast applies defaults to forecast options and validates them
+func (fs *ForecastService) PrepareForecast(options *models.ForecastOptions) error {
+	fs.mutex.RLock()
+	cfg := fs.config
+	fs.mutex.RUnlock()
+
+	options.Method = strings.ToLower(options.Method)
+	if options.Method == "" {
+		options.Method = models.ForecastHoltWinters
+	}
+	if !models.IsValidForecastMethod(options.Method) {
+		return fmt.Errorf("unsupported forecast method %q (expected seasonal_naive or holt_winters)", options.Method)
+	}
+	if options.Interval == 0 {
+		options.Interval = defaultForecastInterval
+	}
+	if options.Interval < minQueryInterval {
+		return fmt.Errorf("forecast interval must be at least %d ms", minQueryInterval)
+	}
+	if options.Confidence == 0 {
+		options.Confidence = cfg.Confidence
+	}
+	if options.Confidence <= 0 || options.Confidence >= 1 {
+		return fmt.Errorf("forecast confidence must be in (0, 1), got %g", options.Confidence)
+	}
+
+	span := options.Horizon
+	switch {
+	case options.Horizon != 0 && options.UntilTs != 0:
+		return fmt.Errorf("forecast takes either horizon or untilTs, not both")
+	case options.Horizon < 0:
+		return fmt.Errorf("forecast horizon must be positive")
+	case options.UntilTs != 0:
+		span = options.UntilTs - time.Now().UnixMilli()
+		if span <= 0 {
+			return fmt.Errorf("forecast untilTs must be in the future")
+		}
+	case options.Horizon == 0:
+		return fmt.Errorf("forecast needs a horizon or untilTs")
+	}
+	if steps := (span + options.Interval - 1) / options.Interval; steps > int64(cfg.MaxSteps) {
+		return fmt.Errorf("forecast would cover %d intervals, at most %d are allowed; use a longer interval", steps, cfg.MaxSteps)
+	}
+	return nil
+}
+
+// Forecast forecasts keys of a device or asset with options prepared by
+// PrepareForecast. Keys that cannot be forecast carry an error instead.
+func (fs *ForecastService) Forecast(entityID string, keys []string, options models.ForecastOptions) map[string]models.Forecast {
+	fs.mutex.RLock()
+	cfg := fs.config
+	fs.mutex.RUnlock()
+
+	now := time.Now()
+	forecasts := make(map[string]models.Forecast, len(keys))
+	for _, key := range keys {
+		forecasts[key] = fs.forecastKey(entityID, key, options, cfg, now)
+	}
+	return forecasts
+}
+
+// forecastKey forecasts one key from the buckets of its history
+func (fs *ForecastService) forecastKey(entityID, key string, options models.ForecastOptions, cfg config.ForecastingConfig, now time.Time) models.Forecast {
+	forecast := models.Forecast{
+		Method:     options.Method,
+		Interval:   options.Interval,
+		Season:     1,
+		Confidence: options.Confidence,
+		Data:       models.SeriesPoints{},
+	}
+	schema, hasSchema := fs.telemetryService.GetDeviceTelemetryKey(entityID, key)
+	forecast.Cumulative = hasSchema && schema.Cumulative
+
+	// Cumulative keys are read as the last reading of each bucket
+	agg := models.AggregationAvg
+	if forecast.Cumulative {
+		agg = models.AggregationLast
+	}
+	interval := options.Interval
+	var points [][]float64
+	for _, bucket := range fs.telemetryService.aggregateBuckets(entityID, []string{key}, now.Add(-cfg.History), now, interval)[key] {
+		points = append(points, []float64{float64(bucket.start), bucket.acc.result(agg)})
+	}
+	if len(points) == 0 {
+		forecast.Error = "no numeric readings within the forecasting history"
+		return forecast
+	}
+
+	// The bucket of the latest reading is forecast too while it is still
+	// filling; the latest reading anchors cumulative forecasts
+	nowMs := now.UnixMilli()
+	latest := points[len(points)-1]
+	anchor := latest[1]
+	start := int64(latest[0]) + interval
+	anchorTs := start
+	if start > nowMs {
+		start -= interval
+		anchorTs = nowMs
+		points = points[:len(points)-1]
+	}
+	end := options.UntilTs
+	if end == 0 {
+		end = anchorTs + options.Horizon
+	}
+	steps := int((end - start + interval - 1) / interval)
+	if steps < 1 {
+		steps = 1
+	}
+	if steps > cfg.MaxSteps {
+		forecast.Error = fmt.Sprintf("latest reading at %s is too old to forecast until %s",
+			time.UnixMilli(anchorTs).Format(time.RFC3339), time.UnixMilli(end).Format(time.RFC3339))
+		return forecast
+	}
+
+	// Empty buckets are interpolated; a counter's increase is spread evenly
+	// over the buckets since its previous reading
+	var y []float64
+	if forecast.Cumulative {
+		for i := 1; i < len(points); i++ {
+			buckets := (int64(points[i][0]) - int64(points[i-1][0])) / interval
+			increase := points[i][1] - points[i-1][1]
+			if increase < 0 {
+				// The counter was reset
+				increase = points[i][1]
+			}
+			for j := int64(0); j < buckets; j++ {
+				y = append(y, increase/float64(buckets))
+			}
+		}
+	} else if len(points) > 0 {
+		for _, point := range fillBuckets(points, int64(points[0][0]), int64(points[len(points)-1][0]), interval, models.FillLinear, 0) {
+			y = append(y, point[1])
+		}
+	}
+	if len(y) < 2 {
+		forecast.Error = fmt.Sprintf("need at least 2 complete intervals of history, got %d", len(y))
+		return forecast
+	}
+	if len(y) > maxForecastSamples {
+		y = y[len(y)-maxForecastSamples:]
+	}
+	forecast.Samples = len(y)
+	forecast.Season = forecastSeason(interval, len(y))
+	result := fitForecast(options.Method, y, forecast.Season, steps)
+
+	z := math.Sqrt2 * math.Erfinv(options.Confidence)
+	if forecast.Cumulative {
+		// The bucket in progress only has its remaining part left to increase
+		level, variance := anchor, 0.0
+		for h := 0; h < steps; h++ {
+			weight := 1.0
+			if h == 0 {
+				weight = float64(start+interval-anchorTs) / float64(interval)
+			}
+			level += math.Max(0, result.values[h]) * weight
+			variance += result.variances[h] * weight * weight
+			margin := z * math.Sqrt(variance)
+			forecast.Data = append(forecast.Data, []float64{
+				float64(start + int64(h)*interval),
+				roundForecast(level),
+				roundForecast(math.Max(anchor, level-margin)),
+				roundForecast(level + margin),
+			})
+		}
+		return forecast
+	}
+
+	// Rate forecasts stay within the key's valid range
+	bounded := hasSchema && schema.MaxValue > schema.MinValue
+	clamp := func(value float64) float64 {
+		if bounded {
+			value = math.Max(schema.MinValue, math.Min(schema.MaxValue, value))
+		}
+		return roundForecast(value)
+	}
+	for h := 0; h < steps; h++ {
+		margin := z * math.Sqrt(result.variances[h])
+		forecast.Data = append(forecast.Data, []float64{
+			float64(start + int64(h)*interval),
+			clamp(result.values[h]),
+			clamp(result.values[h] - margin),
+			clamp(result.values[h] + margin),
+		})
+	}
+	return forecast
+}
+
+// roundForecast rounds a forecast value to three decimals
+func roundForecast(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/spf13/viper"
+)
+
+// newTestForecastService creates a forecast service with the default configuration
+func newTestForecastService(t *testing.T) (*ForecastService, *TelemetryService) {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	ts := NewTelemetryService(cfg.Telemetry)
+	return NewForecastService(ts, cfg.Forecasting), ts
+}
+
+func TestForecastSeason(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	day := 24 * hour
+	tests := []struct {
+		interval int64
+		samples  int
+		want     int
+	}{
+		{hour, 48, 24},
+		{hour, 47, 1},
+		{15 * time.Minute.Milliseconds(), 192, 96},
+		{7 * hour, 100, 1}, // does not divide a day
+		{day, 14, 7},
+		{day, 13, 1},
+		{2 * day, 100, 1},
+	}
+	for _, tt := range tests {
+		if got := forecastSeason(tt.interval, tt.samples); got != tt.want {
+			t.Errorf("forecastSeason(%d, %d) = %d, want %d", tt.interval, tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestSeasonalNaive(t *testing.T) {
+	result := seasonalNaive([]float64{1, 2, 3, 1, 2, 5}, 3, 4)
+
+	wantValues := []float64{1, 2, 5, 1}
+	// Differences one season apart are 0, 0 and 2; the variance grows every season
+	wantVariances := []float64{4.0 / 3, 4.0 / 3, 4.0 / 3, 8.0 / 3}
+	for h := range wantValues {
+		if result.values[h] != wantValues[h] || !closeTo(result.variances[h], wantVariances[h], 1e-9) {
+			t.Errorf("step %d: got %v ± %v, want %v ± %v", h, result.values[h], result.variances[h], wantValues[h], wantVariances[h])
+		}
+	}
+}
+
+func TestHoltWinters(t *testing.T) {
+	t.Run("trend", func(t *testing.T) {
+		var y []float64
+		for i := 0; i < 30; i++ {
+			y = append(y, 2*float64(i)+1)
+		}
+		result := holtWinters(y, 1, 3)
+		for h, want := range []float64{61, 63, 65} {
+			// The damped trend falls slightly behind the line
+			if !closeTo(result.values[h], want, 0.5*float64(h+1)) {
+				t.Errorf("step %d: got %v, want about %v", h, result.values[h], want)
+			}
+		}
+	})
+
+	t.Run("seasonal", func(t *testing.T) {
+		pattern := []float64{10, 20, 30, 20}
+		var y []float64
+		for i := 0; i < 6*len(pattern); i++ {
+			y = append(y, pattern[i%len(pattern)])
+		}
+		result := holtWinters(y, len(pattern), 6)
+		for h := range result.values {
+			if want := pattern[h%len(pattern)]; !closeTo(result.values[h], want, 0.01) {
+				t.Errorf("step %d: got %v, want %v", h, result.values[h], want)
+			}
+			if result.variances[h] > 1e-6 {
+				t.Errorf("step %d: got variance %v for an exact pattern", h, result.variances[h])
+			}
+		}
+	})
+
+	t.Run("variance grows", func(t *testing.T) {
+		y := []float64{5, 7, 4, 8, 6, 5, 9, 4, 6, 7, 5, 8}
+		result := holtWinters(y, 1, 5)
+		for h := 1; h < len(result.variances); h++ {
+			if result.variances[h] < result.variances[h-1] {
+				t.Errorf("variance shrinks from %v to %v at step %d", result.variances[h-1], result.variances[h], h)
+			}
+		}
+	})
+}
+
+func TestPrepareForecast(t *testing.T) {
+	fs, _ := newTestForecastService(t)
+	hour := time.Hour.Milliseconds()
+
+	options := models.ForecastOptions{Method: "Seasonal_Naive", Horizon: 6 * hour}
+	if err := fs.PrepareForecast(&options); err != nil {
+		t.Fatalf("PrepareForecast: %v", err)
+	}
+	want := models.ForecastOptions{Method: models.ForecastSeasonalNaive, Horizon: 6 * hour, Interval: hour, Confidence: 0.95}
+	if options != want {
+		t.Errorf("got %+v, want %+v", options, want)
+	}
+
+	options = models.ForecastOptions{UntilTs: time.Now().Add(24 * time.Hour).UnixMilli()}
+	if err := fs.PrepareForecast(&options); err != nil || options.Method != models.ForecastHoltWinters {
+		t.Errorf("got %+v, %v, want the holt_winters default", options, err)
+	}
+
+	tests := []struct {
+		name    string
+		options models.ForecastOptions
+		want    string
+	}{
+		{"method", models.ForecastOptions{Method: "arima", Horizon: hour}, `unsupported forecast method "arima"`},
+		{"interval", models.ForecastOptions{Horizon: hour, Interval: 500}, "forecast interval must be at least 1000 ms"},
+		{"confidence", models.ForecastOptions{Horizon: hour, Confidence: 1}, "forecast confidence must be in (0, 1), got 1"},
+		{"both", models.ForecastOptions{Horizon: hour, UntilTs: time.Now().Add(time.Hour).UnixMilli()}, "either horizon or untilTs"},
+		{"negative", models.ForecastOptions{Horizon: -hour}, "forecast horizon must be positive"},
+		{"past", models.ForecastOptions{UntilTs: time.Now().Add(-time.Hour).UnixMilli()}, "untilTs must be in the future"},
+		{"missing", models.ForecastOptions{}, "needs a horizon or untilTs"},
+		{"steps", models.ForecastOptions{Horizon: 2001 * hour}, "would cover 2001 intervals, at most 2000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			err := fs.PrepareForecast(&options)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestForecast(t *testing.T) {
+	fs, ts := newTestForecastService(t)
+	hour := time.Hour.Milliseconds()
+	now := time.Now()
+	// Three complete days of hourly history ending with the previous hour
+	end := now.Truncate(time.Hour).UnixMilli()
+	pattern := func(ts int64) float64 {
+		return 20 + float64(time.UnixMilli(ts).UTC().Hour()%6)
+	}
+
+	var readings []models.TelemetryData
+	energy := 100.0
+	for bucket := end - 72*hour; bucket < end; bucket += hour {
+		readings = append(readings,
+			models.TelemetryData{DeviceID: "device_001", Timestamp: time.UnixMilli(bucket), Values: map[string]interface{}{"temperature": pattern(bucket)}},
+			models.TelemetryData{DeviceID: "device_003", Timestamp: time.UnixMilli(bucket), Values: map[string]interface{}{"energy": energy}},
+		)
+		energy += 10
+	}
+	ts.StoreHistorical(readings)
+
+	t.Run("rate", func(t *testing.T) {
+		options := models.ForecastOptions{Method: models.ForecastSeasonalNaive, Horizon: 6 * hour}
+		if err := fs.PrepareForecast(&options); err != nil {
+			t.Fatalf("PrepareForecast: %v", err)
+		}
+		forecast := fs.Forecast("device_001", []string{"temperature"}, options)["temperature"]
+		if forecast.Error != "" {
+			t.Fatalf("forecast error: %s", forecast.Error)
+		}
+		if forecast.Cumulative || forecast.Season != 24 || forecast.Samples != 72 || len(forecast.Data) != 6 {
+			t.Fatalf("got cumulative %v, season %d, %d samples and %d points, want false, 24, 72 and 6",
+				forecast.Cumulative, forecast.Season, forecast.Samples, len(forecast.Data))
+		}
+		for h, point := range forecast.Data {
+			bucket := end + int64(h)*hour
+			want := pattern(bucket)
+			if int64(point[0]) != bucket || point[1] != want || point[2] != want || point[3] != want {
+				t.Errorf("step %d: got %v, want [%d %v %v %v]", h, point, bucket, want, want, want)
+			}
+		}
+	})
+
+	t.Run("cumulative", func(t *testing.T) {
+		options := models.ForecastOptions{Horizon: 3 * hour}
+		if err := fs.PrepareForecast(&options); err != nil {
+			t.Fatalf("PrepareForecast: %v", err)
+		}
+		forecast := fs.Forecast("device_003", []string{"energy"}, options)["energy"]
+		if forecast.Error != "" {
+			t.Fatalf("forecast error: %s", forecast.Error)
+		}
+		if !forecast.Cumulative || len(forecast.Data) != 3 {
+			t.Fatalf("got cumulative %v and %d points, want true and 3", forecast.Cumulative, len(forecast.Data))
+		}
+		// The latest reading is energy-10, increasing by 10 every hour
+		for h, point := range forecast.Data {
+			want := energy + 10*float64(h)
+			if int64(point[0]) != end+int64(h)*hour || !closeTo(point[1], want, 0.01) {
+				t.Errorf("step %d: got %v, want [%d %v ...]", h, point, end+int64(h)*hour, want)
+			}
+			if point[2] > point[1] || point[3] < point[1] || point[2] < energy-10 {
+				t.Errorf("step %d: band [%v, %v] does not hold %v above the latest reading", h, point[2], point[3], point[1])
+			}
+		}
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		options := models.ForecastOptions{Horizon: hour}
+		if err := fs.PrepareForecast(&options); err != nil {
+			t.Fatalf("PrepareForecast: %v", err)
+		}
+		forecast := fs.Forecast("device_002", []string{"pressure"}, options)["pressure"]
+		if forecast.Error != "no numeric readings within the forecasting history" || len(forecast.Data) != 0 {
+			t.Errorf("got error %q and %d points, want no numeric readings", forecast.Error, len(forecast.Data))
+		}
+	})
+}
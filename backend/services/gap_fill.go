@@ -0,0 +1,120 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// fillBuckets returns one point per interval bucket from the bucket containing
+// start to the one containing end, filling buckets missing from points (which
+// must be ordered bucket starts) according to fill. Buckets that cannot be
+// filled, or that lie in a gap longer than staleAfter, get NaN (null) for the
+// previous and linear modes. Callers bound the number of buckets; at most
+// maxQueryBuckets are allocated up front.
+func fillBuckets(points [][]float64, start, end, interval int64, fill string, staleAfter int64) [][]float64 {
+	if fill == models.FillNone || interval <= 0 || start > end {
+		return points
+	}
+
+	// Counting buckets rather than comparing with end cannot overflow
+	count := bucketCount(start, end, interval)
+	filled := make([][]float64, 0, min(count, maxQueryBuckets))
+	next := 0 // index of the first point at or after the current bucket
+	bucket := bucketStart(start, interval)
+	for i := int64(0); i < count; i, bucket = i+1, bucket+interval {
+		for next < len(points) && int64(points[next][0]) < bucket {
+			next++
+		}
+		if next < len(points) && int64(points[next][0]) == bucket {
+			filled = append(filled, points[next])
+			continue
+		}
+
+		var prev, following []float64
+		if next > 0 {
+			prev = points[next-1]
+		}
+		if next < len(points) {
+			following = points[next]
+		}
+		filled = append(filled, []float64{float64(bucket), fillValue(fill, float64(bucket), prev, following, end, interval, staleAfter)})
+	}
+	return filled
+}
+
+// fillValue computes the value of an empty bucket at ts between the
+// surrounding non-empty buckets prev and next (nil when absent)
+func fillValue(fill string, ts float64, prev, next []float64, end, interval, staleAfter int64) float64 {
+	switch fill {
+	case models.FillZero:
+		return 0
+	case models.FillNull:
+		return math.NaN()
+	}
+
+	if prev == nil {
+		return math.NaN()
+	}
+	if staleAfter > 0 {
+		// Do not carry values across a gap longer than the staleness threshold
+		gapEnd := end
+		if next != nil {
+			gapEnd = int64(next[0])
+		}
+		if gapEnd-(int64(prev[0])+interval) > staleAfter {
+			return math.NaN()
+		}
+	}
+
+	if fill == models.FillPrevious {
+		return prev[1]
+	}
+	if next == nil {
+		return math.NaN()
+	}
+	ratio := (ts - prev[0]) / (next[0] - prev[0])
+	return prev[1] + (next[1]-prev[1])*ratio
+}
+
+// findGaps returns the periods in [start, end] without data for longer than
+// staleAfter. Each point covers [ts, ts+width): width is the bucket size for
+// aggregated series and 0 for raw readings. NaN points do not count as data.
+func findGaps(points [][]float64, start, end, width, staleAfter int64) []models.Gap {
+	if staleAfter <= 0 {
+		return nil
+	}
+
+	var gaps []models.Gap
+	covered := start
+	for _, point := range points {
+		if math.IsNaN(point[1]) {
+			continue
+		}
+		ts := int64(point[0])
+		if ts-covered > staleAfter {
+			gaps = append(gaps, models.Gap{StartTs: covered, EndTs: ts})
+		}
+		if ts+width > covered {
+			covered = ts + width
+		}
+	}
+	if end-covered > staleAfter {
+		gaps = append(gaps, models.Gap{StartTs: covered, EndTs: end})
+	}
+	return gaps
+}
+
+// seriesGaps finds the gaps of a raw or aggregated series, ignoring the part
+// of the range that lies in the future
+func seriesGaps(points [][]float64, start, end, interval int64, agg string, staleAfter int64) []models.Gap {
+	if now := time.Now().UnixMilli(); end > now {
+		end = now
+	}
+	width := interval
+	if agg == models.AggregationNone {
+		width = 0
+	}
+	return findGaps(points, start, end, width, staleAfter)
+}
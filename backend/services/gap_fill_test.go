@@ -0,0 +1,97 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"thingsboard-widget-backend/models"
+)
+
+// nan stands for a null point value in expected series
+var nan = math.NaN()
+
+// sameSeries compares points, treating NaN values as equal
+func sameSeries(got, want [][]float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if len(got[i]) != len(want[i]) {
+			return false
+		}
+		for j := range got[i] {
+			if got[i][j] != want[i][j] && !(math.IsNaN(got[i][j]) && math.IsNaN(want[i][j])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestFillBuckets(t *testing.T) {
+	points := [][]float64{{1000, 10}, {4000, 40}}
+	tests := []struct {
+		name       string
+		fill       string
+		start, end int64
+		staleAfter int64
+		want       [][]float64
+	}{
+		{"none", models.FillNone, 0, 5999, 0, points},
+		{"null", models.FillNull, 0, 5999, 0, [][]float64{{0, nan}, {1000, 10}, {2000, nan}, {3000, nan}, {4000, 40}, {5000, nan}}},
+		{"zero", models.FillZero, 1000, 4999, 0, [][]float64{{1000, 10}, {2000, 0}, {3000, 0}, {4000, 40}}},
+		{"previous", models.FillPrevious, 0, 5999, 0, [][]float64{{0, nan}, {1000, 10}, {2000, 10}, {3000, 10}, {4000, 40}, {5000, 40}}},
+		{"linear", models.FillLinear, 0, 5999, 0, [][]float64{{0, nan}, {1000, 10}, {2000, 20}, {3000, 30}, {4000, 40}, {5000, nan}}},
+		{"previous within staleAfter", models.FillPrevious, 1000, 4999, 2000, [][]float64{{1000, 10}, {2000, 10}, {3000, 10}, {4000, 40}}},
+		{"previous past staleAfter", models.FillPrevious, 1000, 4999, 1000, [][]float64{{1000, 10}, {2000, nan}, {3000, nan}, {4000, 40}}},
+		{"unaligned start", models.FillZero, 1500, 2500, 0, [][]float64{{1000, 10}, {2000, 0}}},
+		{"inverted range", models.FillZero, 5000, 0, 0, points},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fillBuckets(points, tt.start, tt.end, 1000, tt.fill, tt.staleAfter)
+			if !sameSeries(got, tt.want) {
+				t.Errorf("fillBuckets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFillBucketsAtEndOfTime(t *testing.T) {
+	got := fillBuckets(nil, math.MaxInt64-2500, math.MaxInt64, 1000, models.FillZero, 0)
+	if len(got) != 3 {
+		t.Fatalf("got %d buckets, want 3", len(got))
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	tests := []struct {
+		start, end, interval int64
+		want                 int64
+	}{
+		{0, 0, 1000, 1},
+		{0, 999, 1000, 1},
+		{999, 1000, 1000, 2},
+		{-1, 0, 1000, 2},
+		{1000, 0, 1000, 0},
+		{math.MinInt64 / 2, math.MaxInt64 / 2, 1, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		if got := bucketCount(tt.start, tt.end, tt.interval); got != tt.want {
+			t.Errorf("bucketCount(%d, %d, %d) = %d, want %d", tt.start, tt.end, tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestFindGaps(t *testing.T) {
+	points := [][]float64{{1000, 1}, {2000, nan}, {5000, 5}}
+	got := findGaps(points, 0, 10000, 1000, 1500)
+	want := []models.Gap{{StartTs: 2000, EndTs: 5000}, {StartTs: 6000, EndTs: 10000}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findGaps = %+v, want %+v", got, want)
+	}
+	if gaps := findGaps(points, 0, 10000, 1000, 0); gaps != nil {
+		t.Errorf("findGaps without staleAfter = %+v, want none", gaps)
+	}
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// importBatchSize is the number of rows written to the store at once
+const importBatchSize = 1000
+
+// maxReportedImportErrors bounds the error list returned to the client
+const maxReportedImportErrors = 100
+
+// maxImportLineSize is the longest NDJSON line accepted
+const maxImportLineSize = 1 << 20
+
+// ImportService bulk-loads historical telemetry into the store
+type ImportService struct {
+	telemetryService *TelemetryService
+}
+
+// NewImportService creates a new import service
+func NewImportService(telemetryService *TelemetryService) *ImportService {
+	return &ImportService{
+		telemetryService: telemetryService,
+	}
+}
+
+// importJob holds the state of a single import run
+type importJob struct {
+	service *ImportService
+	options models.ImportOptions
+	loc     *time.Location
+	skip    map[string]bool
+	result  *models.ImportResult
+	pending []models.TelemetryData
+}
+
+// PrepareImport validates the options and fills in defaults
+func (is *ImportService) PrepareImport(options *models.ImportOptions) error {
+	options.Format = strings.ToLower(options.Format)
+	if options.Format == "" {
+		options.Format = models.ImportFormatCSV
+	}
+	if options.Format != models.ImportFormatCSV && options.Format != models.ImportFormatNDJSON {
+		return fmt.Errorf("unsupported format %q (expected csv or ndjson)", options.Format)
+	}
+
+	// The device column is skipped even when a fixed device is set, so that
+	// exported files can be imported into another device
+	if options.DeviceID != "" {
+		if _, exists := is.telemetryService.GetDevice(options.DeviceID); !exists {
+			return fmt.Errorf("device %q not found", options.DeviceID)
+		}
+	}
+	if options.DeviceColumn == "" {
+		options.DeviceColumn = "deviceId"
+	}
+
+	if options.TimestampColumn == "" {
+		options.TimestampColumn = "ts"
+	}
+	if options.TimestampFormat == "" {
+		options.TimestampFormat = models.ImportTimestampEpochMs
+	}
+	if options.Timezone == "" {
+		options.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(options.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", options.Timezone)
+	}
+
+	if (options.KeyColumn == "") != (options.ValueColumn == "") {
+		return fmt.Errorf("keyColumn and valueColumn must be set together")
+	}
+	if options.KeyColumn != "" && len(options.Columns) > 0 {
+		return fmt.Errorf("columns mapping cannot be combined with keyColumn/valueColumn")
+	}
+	return nil
+}
+
+// Import reads rows from r and stores them as historical telemetry. Rows with
+// any invalid field are rejected as a whole and reported in the result.
+// Imported rows are never broadcast to live WebSocket clients.
+func (is *ImportService) Import(r io.Reader, options models.ImportOptions) (*models.ImportResult, error) {
+	loc, _ := time.LoadLocation(options.Timezone)
+	job := &importJob{
+		service: is,
+		options: options,
+		loc:     loc,
+		skip:    make(map[string]bool),
+		result:  &models.ImportResult{Errors: []models.ImportRowError{}, DryRun: options.DryRun},
+	}
+	for _, column := range []string{options.DeviceColumn, options.TimestampColumn, options.KeyColumn, options.ValueColumn} {
+		if column != "" {
+			job.skip[column] = true
+		}
+	}
+	for _, column := range options.IgnoreColumns {
+		job.skip[column] = true
+	}
+	// The formatted time written by exports is not a key unless mapped
+	if !job.isMapped(exportTimeColumn) {
+		job.skip[exportTimeColumn] = true
+	}
+
+	var err error
+	if options.Format == models.ImportFormatNDJSON {
+		err = job.readNDJSON(r)
+	} else {
+		err = job.readCSV(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.flush()
+
+	logrus.Infof("Imported %d of %d rows (%d points, %d rejected, dry run: %v)",
+		job.result.RowsImported, job.result.RowsRead, job.result.PointsImported, job.result.RowsRejected, options.DryRun)
+	return job.result, nil
+}
+
+// readCSV parses a CSV file whose first row is the header
+func (job *importJob) readCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := append([]string(nil), header...)
+	columns[0] = strings.TrimPrefix(columns[0], "\ufeff")
+
+	for rowNum := 1; ; rowNum++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		job.result.RowsRead++
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			job.reject(models.ImportRowError{Row: rowNum, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV row %d: %w", rowNum, err)
+		}
+		if len(record) != len(columns) {
+			job.reject(models.ImportRowError{Row: rowNum, Message: fmt.Sprintf("expected %d fields, got %d", len(columns), len(record))})
+			continue
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		job.processRow(rowNum, columns, row)
+	}
+}
+
+// readNDJSON parses one JSON object per line. A nested "values" object, as
+// produced by the NDJSON export, is flattened into the row.
+func (job *importJob) readNDJSON(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+
+	for rowNum := 1; scanner.Scan(); rowNum++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		job.result.RowsRead++
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err != nil {
+			job.reject(models.ImportRowError{Row: rowNum, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+
+		if nested, ok := row["values"].(map[string]interface{}); ok && !job.isMapped("values") {
+			delete(row, "values")
+			for k, v := range nested {
+				row[k] = v
+			}
+		}
+		columns := make([]string, 0, len(row))
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		job.processRow(rowNum, columns, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	return nil
+}
+
+// isMapped reports whether a source column is explicitly mapped to a key
+func (job *importJob) isMapped(column string) bool {
+	_, mapped := job.options.Columns[column]
+	return mapped
+}
+
+// processRow validates one row and queues it for storage. Columns gives the
+// order in which wide-format values are checked and reported.
+func (job *importJob) processRow(rowNum int, columns []string, row map[string]interface{}) {
+	var rowErrors []models.ImportRowError
+	fail := func(column, format string, args ...interface{}) {
+		rowErrors = append(rowErrors, models.ImportRowError{Row: rowNum, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Device
+	deviceID := job.options.DeviceID
+	if deviceID == "" {
+		deviceID = strings.TrimSpace(textValue(row[job.options.DeviceColumn]))
+	}
+	device, deviceExists := job.service.telemetryService.GetDevice(deviceID)
+	if deviceID == "" {
+		fail(job.options.DeviceColumn, "missing device ID")
+	} else if !deviceExists {
+		fail(job.options.DeviceColumn, "unknown device %q", deviceID)
+	}
+
+	// Timestamp
+	timestamp, err := job.parseTimestamp(row[job.options.TimestampColumn])
+	if err != nil {
+		fail(job.options.TimestampColumn, "%v", err)
+	} else if timestamp.After(time.Now()) {
+		// A future reading would stay the latest one until live readings catch up
+		fail(job.options.TimestampColumn, "timestamp %s is in the future", timestamp.Format(time.RFC3339))
+	}
+
+	// Values
+	values := make(map[string]interface{})
+	addValue := func(column, key string, raw interface{}) {
+		if isEmptyImportValue(raw) {
+			return
+		}
+		value, err := job.convertValue(deviceID, key, raw)
+		if err != nil {
+			fail(column, "%v", err)
+			return
+		}
+		values[key] = value
+	}
+
+	if job.options.KeyColumn != "" {
+		key := strings.TrimSpace(textValue(row[job.options.KeyColumn]))
+		if key == "" {
+			fail(job.options.KeyColumn, "missing key")
+		} else if isEmptyImportValue(row[job.options.ValueColumn]) {
+			fail(job.options.ValueColumn, "missing value")
+		} else {
+			addValue(job.options.ValueColumn, key, row[job.options.ValueColumn])
+		}
+	} else {
+		for _, column := range columns {
+			raw := row[column]
+			if job.skip[column] {
+				continue
+			}
+			key := column
+			if len(job.options.Columns) > 0 {
+				mapped, ok := job.options.Columns[column]
+				if !ok {
+					continue
+				}
+				key = mapped
+			}
+			addValue(column, key, raw)
+		}
+	}
+
+	if len(rowErrors) == 0 && len(values) == 0 {
+		fail("", "row has no telemetry values")
+	}
+	if len(rowErrors) > 0 {
+		job.reject(rowErrors...)
+		return
+	}
+
+	job.result.RowsImported++
+	job.result.PointsImported += len(values)
+	job.pending = append(job.pending, models.TelemetryData{
+		DeviceID:   deviceID,
+		Timestamp:  timestamp,
+		Values:     values,
+		DeviceName: device.Name,
+		DeviceType: device.Type,
+		Location:   device.Location,
+		Profile:    device.Profile,
+	})
+	if len(job.pending) >= importBatchSize {
+		job.flush()
+	}
+}
+
+// reject records the errors of a rejected row
+func (job *importJob) reject(rowErrors ...models.ImportRowError) {
+	job.result.RowsRejected++
+	job.result.ErrorCount += len(rowErrors)
+	for _, rowError := range rowErrors {
+		if len(job.result.Errors) < maxReportedImportErrors {
+			job.result.Errors = append(job.result.Errors, rowError)
+		}
+	}
+}
+
+// flush writes pending rows to the store
+func (job *importJob) flush() {
+	if len(job.pending) == 0 {
+		return
+	}
+	if !job.options.DryRun {
+		job.result.PointsEvicted += job.service.telemetryService.StoreHistorical(job.pending)
+	}
+	job.pending = job.pending[:0]
+}
+
+// parseTimestamp converts a raw timestamp according to the configured format
+func (job *importJob) parseTimestamp(raw interface{}) (time.Time, error) {
+	text := strings.TrimSpace(textValue(raw))
+	if text == "" {
+		return time.Time{}, fmt.Errorf("missing timestamp")
+	}
+
+	switch job.options.TimestampFormat {
+	case models.ImportTimestampEpochMs, models.ImportTimestampEpochSec:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s timestamp %q", job.options.TimestampFormat, text)
+		}
+		if job.options.TimestampFormat == models.ImportTimestampEpochSec {
+			value *= 1000
+		}
+		return time.UnixMilli(int64(value)), nil
+	case models.ImportTimestampRFC3339:
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid RFC 3339 timestamp %q", text)
+		}
+		return parsed, nil
+	default:
+		parsed, err := time.ParseInLocation(job.options.TimestampFormat, text, job.loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timestamp %q does not match layout %q", text, job.options.TimestampFormat)
+		}
+		return parsed, nil
+	}
+}
+
+// convertValue validates a raw value against the type and range the device's
+// profile defines for the key
+func (job *importJob) convertValue(deviceID, keyName string, raw interface{}) (interface{}, error) {
+	key, exists := job.service.telemetryService.GetDeviceTelemetryKey(deviceID, keyName)
+	if !exists {
+		return nil, fmt.Errorf("unknown telemetry key %q for device %q", keyName, deviceID)
+	}
+
+	switch key.Type {
+	case "numeric":
+		var value float64
+		switch v := raw.(type) {
+		case json.Number:
+			parsed, err := v.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a number", keyName, v)
+			}
+			value = parsed
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a number", keyName, v)
+			}
+			value = parsed
+		default:
+			return nil, fmt.Errorf("%s: expected a number, got %T", keyName, raw)
+		}
+		if key.MaxValue > key.MinValue && (value < key.MinValue || value > key.MaxValue) {
+			return nil, fmt.Errorf("%s: %v is outside the valid range [%v, %v]", keyName, value, key.MinValue, key.MaxValue)
+		}
+		return value, nil
+
+	case "boolean":
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string, json.Number:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(textValue(v)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not a boolean", keyName, textValue(v))
+			}
+			return parsed, nil
+		default:
+			return nil, fmt.Errorf("%s: expected a boolean, got %T", keyName, raw)
+		}
+
+	case "string":
+		return textValue(raw), nil
+
+	case "json":
+		var encoded []byte
+		if text, ok := raw.(string); ok {
+			encoded = []byte(strings.TrimSpace(text))
+		} else {
+			encoded, _ = json.Marshal(raw)
+		}
+		if !json.Valid(encoded) {
+			return nil, fmt.Errorf("%s: value is not valid JSON", keyName)
+		}
+		return json.RawMessage(encoded), nil
+	}
+
+	return raw, nil
+}
+
+// textValue renders a raw CSV or JSON value as text
+func textValue(raw interface{}) string {
+	switch v := raw.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// isEmptyImportValue reports whether a raw value is absent
+func isEmptyImportValue(raw interface{}) bool {
+	if raw == nil {
+		return true
+	}
+	if text, ok := raw.(string); ok {
+		return strings.TrimSpace(text) == ""
+	}
+	return false
+}
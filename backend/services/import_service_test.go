@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestImportReadsBackExports(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	var readings []models.TelemetryData
+	for i := 0; i < 5; i++ {
+		readings = append(readings, models.TelemetryData{
+			DeviceID:  "device_001",
+			Timestamp: now.Add(time.Duration(i-10) * time.Minute),
+			Values:    map[string]interface{}{"temperature": 20 + float64(i)/4, "humidity": 40 + float64(i)},
+		})
+	}
+
+	for _, format := range []string{models.ExportFormatCSV, models.ExportFormatNDJSON} {
+		for _, deviceID := range []string{"", "device_001"} {
+			t.Run(format+"/deviceId="+deviceID, func(t *testing.T) {
+				source := newTestTelemetryService(t)
+				source.data["device_001"] = readings
+
+				request := models.ExportRequest{
+					DeviceIDs: []string{"device_001"},
+					Keys:      []string{"temperature", "humidity"},
+					StartTs:   now.Add(-time.Hour).UnixMilli(),
+					EndTs:     now.UnixMilli(),
+					Format:    format,
+				}
+				exports := NewExportService(source)
+				loc, err := exports.PrepareExport(&request)
+				if err != nil {
+					t.Fatalf("PrepareExport: %v", err)
+				}
+				var file bytes.Buffer
+				if err := exports.Export(&file, request, loc); err != nil {
+					t.Fatalf("Export: %v", err)
+				}
+
+				target := newTestTelemetryService(t)
+				imports := NewImportService(target)
+				options := models.ImportOptions{Format: format, DeviceID: deviceID}
+				if err := imports.PrepareImport(&options); err != nil {
+					t.Fatalf("PrepareImport: %v", err)
+				}
+				result, err := imports.Import(&file, options)
+				if err != nil {
+					t.Fatalf("Import: %v", err)
+				}
+				if result.RowsRejected != 0 {
+					t.Fatalf("rejected %d rows: %+v", result.RowsRejected, result.Errors)
+				}
+				if result.RowsImported != len(readings) {
+					t.Fatalf("imported %d rows, want %d", result.RowsImported, len(readings))
+				}
+
+				imported := target.data["device_001"]
+				if len(imported) != len(readings) {
+					t.Fatalf("stored %d readings, want %d", len(imported), len(readings))
+				}
+				for i, reading := range imported {
+					if !reading.Timestamp.Equal(readings[i].Timestamp) {
+						t.Errorf("reading %d at %v, want %v", i, reading.Timestamp, readings[i].Timestamp)
+					}
+					if !reflect.DeepEqual(reading.Values, readings[i].Values) {
+						t.Errorf("reading %d values = %v, want %v", i, reading.Values, readings[i].Values)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestImportRejectsFutureRows(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	imports := NewImportService(ts)
+	options := models.ImportOptions{}
+	if err := imports.PrepareImport(&options); err != nil {
+		t.Fatalf("PrepareImport: %v", err)
+	}
+
+	now := time.Now()
+	file := fmt.Sprintf("deviceId,ts,power\ndevice_003,%d,1.5\ndevice_003,%d,2.5\n",
+		now.Add(-time.Minute).UnixMilli(), now.Add(time.Hour).UnixMilli())
+	result, err := imports.Import(strings.NewReader(file), options)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.RowsImported != 1 || result.RowsRejected != 1 {
+		t.Fatalf("imported %d and rejected %d rows, want 1 and 1", result.RowsImported, result.RowsRejected)
+	}
+	if rowError := result.Errors[0]; rowError.Row != 2 || rowError.Column != "ts" || !strings.Contains(rowError.Message, "in the future") {
+		t.Errorf("got row error %+v, want row 2 ts in the future", rowError)
+	}
+}
+
+func TestGeneratedReadingsStaySorted(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	// A reading stored ahead of the simulation clock, e.g. by an earlier import
+	ahead := time.Now().Add(time.Hour)
+	ts.StoreHistorical([]models.TelemetryData{{
+		DeviceID:  "device_003",
+		Timestamp: ahead,
+		Values:    map[string]interface{}{"power": 1.5},
+	}})
+
+	ts.generateTelemetryData()
+
+	data := ts.data["device_003"]
+	if len(data) != 2 || !data[0].Timestamp.Before(data[1].Timestamp) || !data[1].Timestamp.Equal(ahead) {
+		t.Fatalf("got readings at %v, want the generated one before %v", data, ahead)
+	}
+	since := time.Now().Add(-time.Minute).UnixMilli()
+	if points := ts.GetKeyPoints("device_003", "voltage", time.UnixMilli(since), time.Now()); len(points) != 1 {
+		t.Errorf("got %d recent voltage points, want the generated one", len(points))
+	}
+}
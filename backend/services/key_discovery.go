@@ -0,0 +1,167 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+// keyObservation tracks where a key was found while scanning storage
+type keyObservation struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+	valueType string // stored type of the latest raw value
+}
+
+// see widens the observed time range to include timestamp
+func (ko *keyObservation) see(timestamp time.Time) {
+	if ko.firstSeen.IsZero() || timestamp.Before(ko.firstSeen) {
+		ko.firstSeen = timestamp
+	}
+	if timestamp.After(ko.lastSeen) {
+		ko.lastSeen = timestamp
+	}
+}
+
+// GetDeviceKeys lists the keys of a device or virtual entity: every key its
+// profile defines and every key found in its raw readings or rollups, sorted
+// by name. Keys whose oldest readings are only kept as rollups report the
+// start of their oldest rollup bucket as firstSeen.
+func (ts *TelemetryService) GetDeviceKeys(entityID string) ([]models.DeviceKey, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if !ts.hasSeriesLocked(entityID) {
+		return nil, false
+	}
+
+	observed := make(map[string]*keyObservation)
+	observation := func(name string) *keyObservation {
+		ko, exists := observed[name]
+		if !exists {
+			ko = &keyObservation{}
+			observed[name] = ko
+		}
+		return ko
+	}
+	for _, record := range ts.data[entityID] {
+		for name, value := range record.Values {
+			ko := observation(name)
+			ko.see(record.Timestamp)
+			ko.valueType = models.ValueType(value)
+		}
+	}
+	for name, series := range ts.rollups[entityID] {
+		for i, buckets := range series {
+			if len(buckets) == 0 {
+				continue
+			}
+			ko := observation(name)
+			ko.see(time.UnixMilli(buckets[len(buckets)-1].lastTs))
+			// A bucket ending before the oldest raw reading holds readings
+			// past raw retention; its start approximates the first of them
+			if end := time.UnixMilli(buckets[0].start).Add(config.RollupTiers[i].Size); ko.firstSeen.IsZero() || !end.After(ko.firstSeen) {
+				ko.see(time.UnixMilli(buckets[0].start))
+			}
+		}
+	}
+
+	keys := make(map[string]*models.DeviceKey)
+	if device, exists := ts.devices[entityID]; exists {
+		if profile, exists := ts.profiles[device.Profile]; exists {
+			for _, key := range profile.Keys {
+				keys[key.Name] = &models.DeviceKey{
+					Name:      key.Name,
+					Type:      key.Type,
+					Unit:      key.Unit,
+					MinValue:  key.MinValue,
+					MaxValue:  key.MaxValue,
+					InProfile: true,
+				}
+			}
+		}
+	}
+
+	for name, ko := range observed {
+		key, exists := keys[name]
+		if !exists {
+			// Not in the profile: infer the type from the stored value and
+			// the unit from any profile defining the key
+			key = &models.DeviceKey{Name: name, Type: models.KeyType(ko.valueType)}
+			if known, exists := ts.keys[name]; exists {
+				key.Unit = known.Unit
+				if ko.valueType == "" {
+					key.Type = known.Type
+				}
+			} else if ko.valueType == "" {
+				key.Type = "numeric" // only rollups, which hold numbers
+			}
+			keys[name] = key
+		}
+		firstSeen, lastSeen := ko.firstSeen, ko.lastSeen
+		key.ValueType = ko.valueType
+		key.Observed = true
+		key.FirstSeen = &firstSeen
+		key.LastSeen = &lastSeen
+	}
+
+	result := make([]models.DeviceKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, true
+}
+
+// GetTelemetryKeyMappings returns the key ID mappings sorted by ID. Keys are
+// typed by the device profiles, or by their latest stored value for keys no
+// profile defines, such as asset series.
+func (ts *TelemetryService) GetTelemetryKeyMappings() []models.TelemetryKeyMapping {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	inferred := make(map[string]string)
+	for _, data := range ts.data {
+		if len(data) == 0 {
+			continue
+		}
+		for name, value := range data[len(data)-1].Values {
+			inferred[name] = models.KeyType(models.ValueType(value))
+		}
+	}
+
+	mappings := make([]models.TelemetryKeyMapping, 0, len(ts.keyMappings))
+	for name, id := range ts.keyMappings {
+		mapping := models.TelemetryKeyMapping{ID: id, Name: name, Type: "numeric"}
+		if key, exists := ts.keys[name]; exists {
+			mapping.Type = key.Type
+			mapping.Unit = key.Unit
+		} else if keyType, exists := inferred[name]; exists {
+			mapping.Type = keyType
+		}
+		mappings = append(mappings, mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].ID < mappings[j].ID
+	})
+	return mappings
+}
+
+// ensureKeyIDLocked assigns the next free integer ID to a key without one.
+// Caller must hold ts.mutex.
+func (ts *TelemetryService) ensureKeyIDLocked(name string) {
+	if _, exists := ts.keyMappings[name]; exists {
+		return
+	}
+	next := 1
+	for _, id := range ts.keyMappings {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	ts.keyMappings[name] = next
+}
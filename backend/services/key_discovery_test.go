@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// describeKey summarizes a discovered key for comparison
+func describeKey(key models.DeviceKey) string {
+	return fmt.Sprintf("%s %s %s %q profile=%v observed=%v", key.Name, key.Type, key.ValueType, key.Unit, key.InProfile, key.Observed)
+}
+
+func TestGetDeviceKeys(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	day := (24 * time.Hour).Milliseconds()
+	oldest := time.UnixMilli(bucketStart(time.Now().Add(-72*time.Hour).UnixMilli(), day))
+	recent := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	// Humidity was first reported past raw retention and is only kept as rollups
+	if evicted := ts.StoreHistorical([]models.TelemetryData{humidityAt(oldest, 40)}); evicted != 1 {
+		t.Fatalf("%d readings past raw retention, want 1", evicted)
+	}
+	ts.RecordTelemetry(models.TelemetryData{DeviceID: "device_001", Timestamp: recent, Values: map[string]interface{}{
+		"temperature": 21.5, "humidity": 45.0, "battery": int64(90), "mode": "auto", "power": 1.0,
+	}})
+
+	keys, exists := ts.GetDeviceKeys("device_001")
+	if !exists {
+		t.Fatal("GetDeviceKeys did not find device_001")
+	}
+	want := []struct {
+		key       string
+		firstSeen time.Time
+	}{
+		{`battery numeric LONG "" profile=false observed=true`, recent},
+		{`humidity numeric DOUBLE "%" profile=true observed=true`, oldest},
+		{`mode string STRING "" profile=false observed=true`, recent},
+		{`power numeric DOUBLE "kW" profile=false observed=true`, recent}, // unit from another profile
+		{`temperature numeric DOUBLE "°C" profile=true observed=true`, recent},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("got %d keys, want %d: %+v", len(keys), len(want), keys)
+	}
+	for i, key := range keys {
+		if got := describeKey(key); got != want[i].key {
+			t.Errorf("key %d: got %s, want %s", i, got, want[i].key)
+		}
+		if key.FirstSeen == nil || !key.FirstSeen.Equal(want[i].firstSeen) || key.LastSeen == nil || !key.LastSeen.Equal(recent) {
+			t.Errorf("%s: seen from %v to %v, want from %v to %v", key.Name, key.FirstSeen, key.LastSeen, want[i].firstSeen, recent)
+		}
+	}
+
+	// Profile keys without readings are listed but not observed
+	keys, _ = ts.GetDeviceKeys("device_002")
+	if len(keys) != 2 || describeKey(keys[0]) != `humidity numeric  "%" profile=true observed=false` ||
+		keys[1].Name != "pressure" || keys[1].MinValue != 900 || keys[1].MaxValue != 1100 || keys[1].FirstSeen != nil {
+		t.Errorf("got %+v, want the humidity sensor profile keys", keys)
+	}
+
+	// Keys of virtual entities only kept as rollups hold numbers
+	ts.RegisterVirtualEntity("panel")
+	ts.StoreHistorical([]models.TelemetryData{{DeviceID: "panel", Timestamp: oldest, Values: map[string]interface{}{"total_power": 3.5}}})
+	keys, exists = ts.GetDeviceKeys("panel")
+	if !exists || len(keys) != 1 || describeKey(keys[0]) != `total_power numeric  "" profile=false observed=true` {
+		t.Errorf("got %+v, %v, want total_power from rollups", keys, exists)
+	}
+
+	if _, exists := ts.GetDeviceKeys("missing"); exists {
+		t.Error("GetDeviceKeys found a missing device")
+	}
+}
+
+func TestGetTelemetryKeyMappings(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	ts.RecordTelemetry(models.TelemetryData{DeviceID: "device_001", Timestamp: time.Now(), Values: map[string]interface{}{
+		"mode": "auto", "power": 1.0,
+	}})
+
+	mappings := make(map[string]models.TelemetryKeyMapping)
+	previousID := 0
+	for _, mapping := range ts.GetTelemetryKeyMappings() {
+		if mapping.ID <= previousID {
+			t.Errorf("got ID %d after %d, want mappings sorted by ID", mapping.ID, previousID)
+		}
+		previousID = mapping.ID
+		mappings[mapping.Name] = mapping
+	}
+	tests := []struct {
+		name string
+		want models.TelemetryKeyMapping
+	}{
+		{"temperature", models.TelemetryKeyMapping{ID: 1, Name: "temperature", Type: "numeric", Unit: "°C"}},
+		{"pump_status", models.TelemetryKeyMapping{ID: 11, Name: "pump_status", Type: "boolean"}},
+		{"tariff", models.TelemetryKeyMapping{ID: 13, Name: "tariff", Type: "json"}},
+		// Keys no profile defines get the next ID and the type of their stored value
+		{"mode", models.TelemetryKeyMapping{ID: 14, Name: "mode", Type: "string"}},
+	}
+	for _, tt := range tests {
+		if got := mappings[tt.name]; got != tt.want {
+			t.Errorf("got %+v, want %+v", got, tt.want)
+		}
+	}
+}
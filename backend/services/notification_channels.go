@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/config"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// SMSProvider sends text messages for the SMS channel. The log and http
+// providers are selected by configuration; other gateways can be plugged in
+// with NotificationService.SetSMSProvider.
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, message string) error
+}
+
+// newSMSProvider creates the SMS provider named in the configuration
+func newSMSProvider(cfg config.SMSConfig) SMSProvider {
+	if cfg.Provider == "http" {
+		return &httpSMSProvider{
+			client:  &http.Client{},
+			url:     cfg.URL,
+			from:    cfg.From,
+			headers: cfg.Headers,
+		}
+	}
+	return logSMSProvider{from: cfg.From}
+}
+
+// logSMSProvider writes messages to the log instead of sending them
+type logSMSProvider struct {
+	from string
+}
+
+// SendSMS logs the message
+func (p logSMSProvider) SendSMS(ctx context.Context, to, message string) error {
+	logrus.WithFields(logrus.Fields{"from": p.from, "to": to}).Infof("SMS: %s", message)
+	return nil
+}
+
+// httpSMSProvider posts {"from", "to", "message"} as JSON to an SMS gateway
+type httpSMSProvider struct {
+	client  *http.Client
+	url     string
+	from    string
+	headers map[string]string
+}
+
+// SendSMS posts the message to the gateway; any 2xx response counts as sent
+func (p *httpSMSProvider) SendSMS(ctx context.Context, to, message string) error {
+	body, err := json.Marshal(map[string]string{"from": p.from, "to": to, "message": message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("SMS gateway returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// smtpMailer sends plain-text email through an SMTP server
+type smtpMailer struct {
+	cfg config.SMTPConfig
+}
+
+// Send delivers one message to one recipient. STARTTLS is used whenever the
+// server offers it, so PLAIN auth is only sent over TLS or to localhost.
+func (m *smtpMailer) Send(to, subject, body string) error {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.cfg.From, err)
+	}
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, m.cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(buildMessage(from, recipient, subject, body)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage formats a UTF-8 plain-text message with CRLF line endings
+func buildMessage(from, to *mail.Address, subject, body string) []byte {
+	var buf bytes.Buffer
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + uuid.New().String() + "@" + domainOf(from.Address) + ">"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=UTF-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	for _, header := range headers {
+		buf.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		// Dot-stuffing is done by the SMTP data writer
+		buf.WriteString(strings.TrimRight(line, "\r") + "\r\n")
+	}
+	return buf.Bytes()
+}
+
+// domainOf returns the domain part of an email address
+func domainOf(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return address[at+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+)
+
+// smtpSession is what a test SMTP server received in one session
+type smtpSession struct {
+	auth string // decoded PLAIN credentials
+	from string
+	to   []string
+	data string
+}
+
+// newTestSMTPServer accepts one SMTP session on a local port, offering PLAIN
+// auth but not STARTTLS, and returns the port and the received session
+func newTestSMTPServer(t *testing.T) (int, <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(conn)
+		reply := func(lines ...string) {
+			for _, line := range lines {
+				conn.Write([]byte(line + "\r\n"))
+			}
+		}
+
+		var session smtpSession
+		reply("220 localhost test SMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"):
+				reply("250-localhost", "250-8BITMIME", "250 AUTH PLAIN")
+			case strings.HasPrefix(command, "AUTH PLAIN "):
+				decoded, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+				session.auth = string(decoded)
+				reply("235 2.7.0 Authentication successful")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = line[len("MAIL FROM:"):]
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = append(session.to, line[len("RCPT TO:"):])
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				session.data = data.String()
+				reply("250 OK queued")
+			case command == "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	port, sessions := newTestSMTPServer(t)
+	mailer := &smtpMailer{cfg: config.SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "alerts",
+		Password: "secret",
+		From:     "Widget Alerts <alerts@example.com>",
+		Timeout:  5 * time.Second,
+	}}
+
+	subject := "[CRITICAL] Nhiệt độ cao on Phòng 1"
+	body := "Value: 42\n.hidden line\nlast line\n"
+	if err := mailer.Send("Ops <ops@example.com>", subject, body); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var session smtpSession
+	select {
+	case session = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the SMTP server received no complete session")
+	}
+	if session.auth != "\x00alerts\x00secret" {
+		t.Errorf("got PLAIN credentials %q", session.auth)
+	}
+	if !strings.HasPrefix(session.from, "<alerts@example.com>") || len(session.to) != 1 || session.to[0] != "<ops@example.com>" {
+		t.Errorf("got envelope from %s to %v, want alerts@example.com to ops@example.com", session.from, session.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("parsing message %q: %v", session.data, err)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || decoded != subject {
+		t.Errorf("got subject %q (%v), want %q", decoded, err, subject)
+	}
+	if message.Header.Get("From") != `"Widget Alerts" <alerts@example.com>` || message.Header.Get("To") != `"Ops" <ops@example.com>` {
+		t.Errorf("got From %q and To %q", message.Header.Get("From"), message.Header.Get("To"))
+	}
+	if !strings.HasSuffix(message.Header.Get("Message-Id"), "@example.com>") {
+		t.Errorf("got Message-ID %q, want one in the sender's domain", message.Header.Get("Message-Id"))
+	}
+	// A line starting with a dot is stuffed on the wire
+	if want := "Value: 42\r\n..hidden line\r\nlast line\r\n"; !strings.HasSuffix(session.data, "\r\n\r\n"+want) {
+		t.Errorf("got data %q, want the body %q", session.data, want)
+	}
+}
+
+func TestSMTPMailerRejectsInvalidAddresses(t *testing.T) {
+	mailer := &smtpMailer{cfg: config.SMTPConfig{Host: "127.0.0.1", Port: 1, From: "not an address", Timeout: time.Second}}
+	if err := mailer.Send("ops@example.com", "subject", "body"); err == nil || !strings.Contains(err.Error(), "invalid sender") {
+		t.Errorf("got error %v, want invalid sender", err)
+	}
+	mailer.cfg.From = "alerts@example.com"
+	if err := mailer.Send("ops", "subject", "body"); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("got error %v, want invalid recipient", err)
+	}
+}
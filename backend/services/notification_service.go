@@ -0,0 +1,528 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// escalationCheckInterval is how often escalation chains are advanced
+const escalationCheckInterval = time.Second
+
+// escalation tracks one policy's escalation chain for one alarm
+type escalation struct {
+	alarm    models.Alarm // latest state
+	policy   string
+	started  time.Time
+	next     int      // index of the next step
+	notified []string // groups notified so far, in order
+}
+
+// NotificationService emails and texts recipient groups about alarms. Each
+// matching policy escalates an alarm step by step until it is acknowledged
+// or cleared; quiet hours and a per-recipient rate limit suppress messages.
+type NotificationService struct {
+	location    *time.Location
+	groups      map[string]models.RecipientGroup
+	policies    []models.NotificationPolicy
+	rateLimit   config.RateLimitConfig
+	mailer      *smtpMailer // nil when email is not configured
+	sms         SMSProvider
+	smsTimeout  time.Duration
+	customSMS   bool                   // SMS provider plugged in by code, kept across reloads
+	escalations map[string]*escalation // alarm ID + policy name -> escalation
+	sent        map[string][]time.Time // channel + recipient -> send times within the rate limit window
+	log         []models.Notification  // oldest first
+	logSize     int
+	mutex       sync.RWMutex
+	stop        chan bool
+}
+
+// NewNotificationService creates a notification service; Start advances its escalations
+func NewNotificationService(cfg config.NotificationsConfig) *NotificationService {
+	service := &NotificationService{
+		escalations: make(map[string]*escalation),
+		sent:        make(map[string][]time.Time),
+		logSize:     cfg.LogSize,
+		stop:        make(chan bool),
+	}
+	service.SetConfig(cfg)
+	return service
+}
+
+// SetConfig replaces channels, recipient groups and policies. Running
+// escalations continue under the new policy of the same name, or stop if it
+// was removed.
+func (ns *NotificationService) SetConfig(cfg config.NotificationsConfig) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+	groups := make(map[string]models.RecipientGroup, len(cfg.Groups))
+	for _, group := range cfg.Groups {
+		groups[group.Name] = group
+	}
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	ns.location = location
+	ns.groups = groups
+	ns.policies = append([]models.NotificationPolicy(nil), cfg.Policies...)
+	ns.rateLimit = cfg.RateLimit
+	ns.mailer = nil
+	if cfg.SMTP.Host != "" {
+		ns.mailer = &smtpMailer{cfg: cfg.SMTP}
+	}
+	ns.smsTimeout = cfg.SMS.Timeout
+	if !ns.customSMS {
+		ns.sms = newSMSProvider(cfg.SMS)
+	}
+	logrus.Infof("Loaded %d recipient groups and %d notification policies", len(cfg.Groups), len(cfg.Policies))
+}
+
+// SetSMSProvider installs an SMS provider in place of the configured one
+func (ns *NotificationService) SetSMSProvider(provider SMSProvider) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	ns.sms = provider
+	ns.customSMS = true
+}
+
+// Start advances escalation chains until Stop is called
+func (ns *NotificationService) Start() {
+	ticker := time.NewTicker(escalationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ns.mutex.Lock()
+			pending := ns.dueLocked(now)
+			ns.mutex.Unlock()
+			ns.dispatch(pending)
+		case <-ns.stop:
+			return
+		}
+	}
+}
+
+// Stop stops advancing escalation chains
+func (ns *NotificationService) Stop() {
+	close(ns.stop)
+}
+
+// BroadcastAlarm starts, updates or ends escalations. It implements AlarmBroadcaster.
+func (ns *NotificationService) BroadcastAlarm(alarm models.Alarm) {
+	now := time.Now()
+	var pending []models.Notification
+
+	ns.mutex.Lock()
+	switch {
+	case alarm.Status == models.AlarmStatusActiveUnack:
+		for _, policy := range ns.policies {
+			if !policy.Matches(alarm) {
+				continue
+			}
+			key := alarm.ID + "|" + policy.Name
+			if state, exists := ns.escalations[key]; exists {
+				state.alarm = alarm
+				continue
+			}
+			ns.escalations[key] = &escalation{alarm: alarm, policy: policy.Name, started: now}
+		}
+		// Steps without a delay go out right away
+		pending = ns.dueLocked(now)
+
+	case alarm.IsActive():
+		// Acknowledged: stop escalating, but remember who was told for the clear notice
+		for _, state := range ns.escalationsForLocked(alarm.ID) {
+			state.alarm = alarm
+		}
+
+	default:
+		for key, state := range ns.escalationsForLocked(alarm.ID) {
+			delete(ns.escalations, key)
+			policy, exists := ns.policyLocked(state.policy)
+			if !exists || !policy.NotifyOnClear {
+				continue
+			}
+			subject, email, sms := clearMessages(alarm)
+			for _, groupName := range state.notified {
+				pending = append(pending, ns.notificationsLocked(now, alarm, policy.Name, 0, groupName,
+					[]string{models.ChannelEmail, models.ChannelSMS}, subject, email, sms)...)
+			}
+		}
+	}
+	ns.mutex.Unlock()
+
+	ns.dispatch(pending)
+}
+
+// dueLocked runs every escalation step that has come due and returns the
+// notifications to send. Caller must hold ns.mutex.
+func (ns *NotificationService) dueLocked(now time.Time) []models.Notification {
+	var pending []models.Notification
+	for key, state := range ns.escalations {
+		if state.alarm.Status != models.AlarmStatusActiveUnack {
+			continue
+		}
+		policy, exists := ns.policyLocked(state.policy)
+		if !exists {
+			delete(ns.escalations, key)
+			continue
+		}
+		for state.next < len(policy.Steps) && !now.Before(state.started.Add(policy.Steps[state.next].After)) {
+			step := policy.Steps[state.next]
+			state.next++
+			subject, email, sms := alarmMessages(state.alarm, policy, state.next, now.Sub(state.started))
+			for _, groupName := range step.Groups {
+				pending = append(pending, ns.notificationsLocked(now, state.alarm, policy.Name, state.next, groupName,
+					step.Channels, subject, email, sms)...)
+				state.notified = appendUnique(state.notified, groupName)
+			}
+			logrus.Infof("Alarm %s (%s on %s): escalation step %d of %d of policy %s",
+				state.alarm.ID, state.alarm.RuleName, state.alarm.DeviceID, state.next, len(policy.Steps), policy.Name)
+		}
+	}
+	return pending
+}
+
+// notificationsLocked builds one notification per recipient of a group on
+// each channel. Notifications suppressed by quiet hours or the rate limit are
+// logged right away; the rest are returned to be sent. Caller must hold ns.mutex.
+func (ns *NotificationService) notificationsLocked(now time.Time, alarm models.Alarm, policy string, step int, groupName string, channels []string, subject, email, sms string) []models.Notification {
+	group, exists := ns.groups[groupName]
+	if !exists {
+		return nil
+	}
+	quiet := ns.inQuietHoursLocked(group, alarm.Severity, now)
+
+	var pending []models.Notification
+	for _, channel := range channels {
+		recipients, message := group.Emails, email
+		if channel == models.ChannelSMS {
+			recipients, message = group.Phones, sms
+		}
+		for _, recipient := range recipients {
+			notification := models.Notification{
+				ID:        uuid.New().String(),
+				AlarmID:   alarm.ID,
+				Policy:    policy,
+				Step:      step,
+				Group:     groupName,
+				Channel:   channel,
+				Recipient: recipient,
+				Message:   message,
+				Timestamp: now,
+			}
+			if channel == models.ChannelEmail {
+				notification.Subject = subject
+			}
+
+			switch {
+			case quiet:
+				notification.Status = models.NotificationStatusQuietHours
+				ns.recordLocked(notification)
+			case !ns.allowLocked(channel+"|"+recipient, now):
+				notification.Status = models.NotificationStatusRateLimited
+				ns.recordLocked(notification)
+				logrus.Warnf("Rate limit reached for %s %s, notification suppressed", channel, recipient)
+			default:
+				pending = append(pending, notification)
+			}
+		}
+	}
+	return pending
+}
+
+// inQuietHoursLocked reports whether a group is in its quiet hours and the
+// severity is not allowed through. Caller must hold ns.mutex.
+func (ns *NotificationService) inQuietHoursLocked(group models.RecipientGroup, severity string, now time.Time) bool {
+	quiet := group.QuietHours
+	if quiet == nil {
+		return false
+	}
+	for _, allowed := range quiet.AllowSeverities {
+		if allowed == severity {
+			return false
+		}
+	}
+
+	// Quiet hours are validated with the configuration
+	start, _ := time.Parse("15:04", quiet.Start)
+	end, _ := time.Parse("15:04", quiet.End)
+	local := now.In(ns.location)
+	minute := local.Hour()*60 + local.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from < to {
+		return minute >= from && minute < to
+	}
+	// The window wraps past midnight, e.g. 22:00-07:00
+	return minute >= from || minute < to
+}
+
+// allowLocked counts a notification against the rate limit of a recipient
+// and reports whether it may be sent. Caller must hold ns.mutex.
+func (ns *NotificationService) allowLocked(key string, now time.Time) bool {
+	if ns.rateLimit.MaxNotifications == 0 {
+		return true
+	}
+	cutoff := now.Add(-ns.rateLimit.Window)
+	times := ns.sent[key]
+	for len(times) > 0 && !times[0].After(cutoff) {
+		times = times[1:]
+	}
+	if len(times) >= ns.rateLimit.MaxNotifications {
+		ns.sent[key] = times
+		return false
+	}
+	ns.sent[key] = append(times, now)
+	return true
+}
+
+// dispatch sends notifications in the background, so slow mail servers and
+// gateways never hold up alarm processing
+func (ns *NotificationService) dispatch(notifications []models.Notification) {
+	for _, notification := range notifications {
+		go func(notification models.Notification) {
+			notification = ns.deliver(notification)
+			ns.mutex.Lock()
+			ns.recordLocked(notification)
+			ns.mutex.Unlock()
+		}(notification)
+	}
+}
+
+// deliver sends one notification over its channel and returns it with the outcome
+func (ns *NotificationService) deliver(notification models.Notification) models.Notification {
+	ns.mutex.RLock()
+	mailer, sms, timeout := ns.mailer, ns.sms, ns.smsTimeout
+	ns.mutex.RUnlock()
+
+	var err error
+	switch {
+	case notification.Channel == models.ChannelSMS:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = sms.SendSMS(ctx, notification.Recipient, notification.Message)
+		cancel()
+	case mailer == nil:
+		err = fmt.Errorf("email is not configured (notifications.smtp.host)")
+	default:
+		err = mailer.Send(notification.Recipient, notification.Subject, notification.Message)
+	}
+
+	if err != nil {
+		notification.Status = models.NotificationStatusFailed
+		notification.Error = err.Error()
+		logrus.Errorf("Failed to send %s notification to %s: %v", notification.Channel, notification.Recipient, err)
+	} else {
+		notification.Status = models.NotificationStatusSent
+	}
+	return notification
+}
+
+// recordLocked appends to the notification log, dropping the oldest above
+// the log size. Caller must hold ns.mutex.
+func (ns *NotificationService) recordLocked(notification models.Notification) {
+	ns.log = append(ns.log, notification)
+	if excess := len(ns.log) - ns.logSize; excess > 0 {
+		ns.log = append([]models.Notification(nil), ns.log[excess:]...)
+	}
+}
+
+// Test sends a test message to every recipient of a group, on one channel or
+// on both when channel is empty, and waits for the outcome. Tests ignore
+// quiet hours and the rate limit. It reports whether the group exists.
+func (ns *NotificationService) Test(groupName, channel string) ([]models.Notification, bool) {
+	ns.mutex.RLock()
+	group, exists := ns.groups[groupName]
+	ns.mutex.RUnlock()
+	if !exists {
+		return nil, false
+	}
+
+	channels := []string{models.ChannelEmail, models.ChannelSMS}
+	if channel != "" {
+		channels = []string{channel}
+	}
+	subject := "Test notification"
+	message := fmt.Sprintf("Test notification for recipient group %q from the ThingsBoard widget backend.", groupName)
+
+	results := []models.Notification{}
+	for _, channel := range channels {
+		recipients := group.Emails
+		if channel == models.ChannelSMS {
+			recipients = group.Phones
+		}
+		for _, recipient := range recipients {
+			notification := ns.deliver(models.Notification{
+				ID:        uuid.New().String(),
+				Group:     groupName,
+				Channel:   channel,
+				Recipient: recipient,
+				Subject:   subject,
+				Message:   message,
+				Timestamp: time.Now(),
+			})
+			ns.mutex.Lock()
+			ns.recordLocked(notification)
+			ns.mutex.Unlock()
+			results = append(results, notification)
+		}
+	}
+	return results, true
+}
+
+// GetNotifications returns the notification log newest first, optionally
+// filtered by alarm ID, status and channel
+func (ns *NotificationService) GetNotifications(alarmID, status, channel string) []models.Notification {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	notifications := []models.Notification{}
+	for i := len(ns.log) - 1; i >= 0; i-- {
+		notification := ns.log[i]
+		if (alarmID != "" && notification.AlarmID != alarmID) ||
+			(status != "" && notification.Status != status) ||
+			(channel != "" && notification.Channel != channel) {
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications
+}
+
+// GetGroups returns the recipient groups sorted by name
+func (ns *NotificationService) GetGroups() []models.RecipientGroup {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	groups := make([]models.RecipientGroup, 0, len(ns.groups))
+	for _, group := range ns.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// GetPolicies returns the notification policies in configuration order
+func (ns *NotificationService) GetPolicies() []models.NotificationPolicy {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+	return append([]models.NotificationPolicy(nil), ns.policies...)
+}
+
+// GetEscalations returns the running escalations, oldest first
+func (ns *NotificationService) GetEscalations() []models.Escalation {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	escalations := make([]models.Escalation, 0, len(ns.escalations))
+	for _, state := range ns.escalations {
+		entry := models.Escalation{
+			AlarmID:      state.alarm.ID,
+			RuleName:     state.alarm.RuleName,
+			DeviceID:     state.alarm.DeviceID,
+			Policy:       state.policy,
+			StartedAt:    state.started,
+			StepsDone:    state.next,
+			Acknowledged: state.alarm.IsAcknowledged(),
+		}
+		if policy, exists := ns.policyLocked(state.policy); exists && !entry.Acknowledged && state.next < len(policy.Steps) {
+			next := state.started.Add(policy.Steps[state.next].After)
+			entry.NextStepAt = &next
+		}
+		escalations = append(escalations, entry)
+	}
+	sort.Slice(escalations, func(i, j int) bool {
+		if !escalations[i].StartedAt.Equal(escalations[j].StartedAt) {
+			return escalations[i].StartedAt.Before(escalations[j].StartedAt)
+		}
+		return escalations[i].Policy < escalations[j].Policy
+	})
+	return escalations
+}
+
+// escalationsForLocked returns the escalations of an alarm by key. Caller must hold ns.mutex.
+func (ns *NotificationService) escalationsForLocked(alarmID string) map[string]*escalation {
+	matches := make(map[string]*escalation)
+	for key, state := range ns.escalations {
+		if state.alarm.ID == alarmID {
+			matches[key] = state
+		}
+	}
+	return matches
+}
+
+// policyLocked returns a policy by name. Caller must hold ns.mutex.
+func (ns *NotificationService) policyLocked(name string) (models.NotificationPolicy, bool) {
+	for _, policy := range ns.policies {
+		if policy.Name == name {
+			return policy, true
+		}
+	}
+	return models.NotificationPolicy{}, false
+}
+
+// alarmMessages returns the email subject, email body and SMS text for an escalation step
+func alarmMessages(alarm models.Alarm, policy models.NotificationPolicy, step int, waited time.Duration) (string, string, string) {
+	subject := fmt.Sprintf("[%s] %s on %s", alarm.Severity, alarm.RuleName, alarm.DeviceName)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Alarm:    %s\n", alarm.RuleName)
+	fmt.Fprintf(&body, "Severity: %s\n", alarm.Severity)
+	fmt.Fprintf(&body, "Device:   %s (%s)\n", alarm.DeviceName, alarm.DeviceID)
+	fmt.Fprintf(&body, "Value:    %s = %v (%s %v)\n", alarm.Key, alarm.Value, alarm.Condition, alarm.Threshold)
+	fmt.Fprintf(&body, "Status:   %s\n", alarm.Status)
+	fmt.Fprintf(&body, "Raised:   %s\n", alarm.StartTs.Format(time.RFC3339))
+	fmt.Fprintf(&body, "Alarm ID: %s\n", alarm.ID)
+	if step > 1 {
+		fmt.Fprintf(&body, "\nEscalation step %d of %d (policy %s): unacknowledged for %s.\n",
+			step, len(policy.Steps), policy.Name, waited.Round(time.Second))
+	}
+
+	sms := fmt.Sprintf("%s: %s=%v (%s %v)", subject, alarm.Key, alarm.Value, alarm.Condition, alarm.Threshold)
+	if step > 1 {
+		sms += fmt.Sprintf(", unacknowledged for %s", waited.Round(time.Second))
+	}
+	return subject, body.String(), sms
+}
+
+// clearMessages returns the email subject, email body and SMS text for a cleared alarm
+func clearMessages(alarm models.Alarm) (string, string, string) {
+	subject := fmt.Sprintf("[CLEARED] %s on %s", alarm.RuleName, alarm.DeviceName)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Alarm:    %s\n", alarm.RuleName)
+	fmt.Fprintf(&body, "Device:   %s (%s)\n", alarm.DeviceName, alarm.DeviceID)
+	fmt.Fprintf(&body, "Value:    %s = %v\n", alarm.Key, alarm.Value)
+	fmt.Fprintf(&body, "Raised:   %s\n", alarm.StartTs.Format(time.RFC3339))
+	if alarm.EndTs != nil {
+		fmt.Fprintf(&body, "Cleared:  %s\n", alarm.EndTs.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&body, "Alarm ID: %s\n", alarm.ID)
+
+	return subject, body.String(), fmt.Sprintf("%s: %s=%v", subject, alarm.Key, alarm.Value)
+}
+
+// appendUnique appends value unless it is already listed
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
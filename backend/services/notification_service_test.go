@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/spf13/viper"
+)
+
+// smsRecorder collects the text messages sent through it
+type smsRecorder struct {
+	messages []string // "<to>: <message>"
+	mutex    sync.Mutex
+}
+
+func (sr *smsRecorder) SendSMS(ctx context.Context, to, message string) error {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	sr.messages = append(sr.messages, to+": "+message)
+	return nil
+}
+
+// newTestNotificationService creates a notification service reading quiet
+// hours in UTC and sending text messages to a recorder
+func newTestNotificationService(t *testing.T, configure func(*config.NotificationsConfig)) (*NotificationService, *smsRecorder) {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	cfg.Notifications.Timezone = "UTC"
+	if configure != nil {
+		configure(&cfg.Notifications)
+	}
+	ns := NewNotificationService(cfg.Notifications)
+	sms := &smsRecorder{}
+	ns.SetSMSProvider(sms)
+	return ns, sms
+}
+
+// waitForNotifications waits until the log holds count notifications with the given status
+func waitForNotifications(t *testing.T, ns *NotificationService, status string, count int) []models.Notification {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if notifications := ns.GetNotifications("", status, ""); len(notifications) >= count {
+			return notifications
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("got notifications %+v, want %d %s", ns.GetNotifications("", "", ""), count, status)
+	return nil
+}
+
+// testAlarm returns an unacknowledged MAJOR alarm raised now
+func testAlarm() models.Alarm {
+	return models.Alarm{
+		ID:         "alarm_1",
+		RuleName:   "High temperature",
+		DeviceID:   "device_001",
+		DeviceName: "Room 1",
+		Key:        "temperature",
+		Value:      42,
+		Threshold:  40,
+		Condition:  ">",
+		Severity:   models.AlarmSeverityMajor,
+		Status:     models.AlarmStatusActiveUnack,
+		StartTs:    time.Now(),
+	}
+}
+
+func TestNotificationEscalation(t *testing.T) {
+	ns, sms := newTestNotificationService(t, func(cfg *config.NotificationsConfig) {
+		cfg.Groups = []models.RecipientGroup{
+			{Name: "operators", Phones: []string{"+84900000001"}},
+			{Name: "managers", Phones: []string{"+84900000002"}},
+		}
+		cfg.Policies = []models.NotificationPolicy{{
+			Name: "escalate",
+			Steps: []models.EscalationStep{
+				{Groups: []string{"operators"}, Channels: []string{models.ChannelSMS}},
+				{After: 10 * time.Minute, Groups: []string{"managers"}, Channels: []string{models.ChannelSMS}},
+				{After: 30 * time.Minute, Groups: []string{"operators", "managers"}, Channels: []string{models.ChannelSMS}},
+			},
+			NotifyOnClear: true,
+		}}
+	})
+
+	// The first step has no delay and goes out with the alarm
+	alarm := testAlarm()
+	ns.BroadcastAlarm(alarm)
+	waitForNotifications(t, ns, models.NotificationStatusSent, 1)
+	escalations := ns.GetEscalations()
+	if len(escalations) != 1 || escalations[0].StepsDone != 1 || escalations[0].NextStepAt == nil ||
+		!escalations[0].NextStepAt.Equal(escalations[0].StartedAt.Add(10*time.Minute)) {
+		t.Fatalf("got escalations %+v, want one waiting 10m for step 2", escalations)
+	}
+
+	// Nothing is due before the second step, which then reaches the managers
+	ns.mutex.Lock()
+	early := ns.dueLocked(time.Now().Add(5 * time.Minute))
+	pending := ns.dueLocked(escalations[0].StartedAt.Add(10 * time.Minute))
+	ns.mutex.Unlock()
+	if len(early) != 0 {
+		t.Errorf("got %d notifications 5 minutes in, want none", len(early))
+	}
+	if len(pending) != 1 || pending[0].Recipient != "+84900000002" || pending[0].Step != 2 ||
+		!strings.Contains(pending[0].Message, "unacknowledged for 10m0s") {
+		t.Fatalf("got %+v, want step 2 to the managers", pending)
+	}
+	ns.dispatch(pending)
+	waitForNotifications(t, ns, models.NotificationStatusSent, 2)
+
+	// Acknowledging stops the chain before the third step
+	alarm.Status = models.AlarmStatusActiveAck
+	ns.BroadcastAlarm(alarm)
+	ns.mutex.Lock()
+	pending = ns.dueLocked(time.Now().Add(time.Hour))
+	ns.mutex.Unlock()
+	if len(pending) != 0 {
+		t.Errorf("got %d notifications after the acknowledgement, want none", len(pending))
+	}
+	if escalations := ns.GetEscalations(); len(escalations) != 1 || !escalations[0].Acknowledged || escalations[0].NextStepAt != nil {
+		t.Errorf("got escalations %+v, want an acknowledged one without a next step", escalations)
+	}
+
+	// Clearing tells both groups notified so far and ends the escalation
+	alarm.Status = models.AlarmStatusClearedAck
+	ns.BroadcastAlarm(alarm)
+	waitForNotifications(t, ns, models.NotificationStatusSent, 4)
+	if escalations := ns.GetEscalations(); len(escalations) != 0 {
+		t.Errorf("got escalations %+v after the clear", escalations)
+	}
+
+	sms.mutex.Lock()
+	defer sms.mutex.Unlock()
+	want := []string{"+84900000001: [MAJOR]", "+84900000002: [MAJOR]", "[CLEARED]", "[CLEARED]"}
+	if len(sms.messages) != len(want) {
+		t.Fatalf("sent %v, want %d messages", sms.messages, len(want))
+	}
+	for i, prefix := range want[:2] {
+		if !strings.HasPrefix(sms.messages[i], prefix) {
+			t.Errorf("message %d is %q, want it to start with %q", i, sms.messages[i], prefix)
+		}
+	}
+	for _, message := range sms.messages[2:] {
+		if !strings.Contains(message, "[CLEARED] High temperature on Room 1") {
+			t.Errorf("got %q, want a clear notice", message)
+		}
+	}
+}
+
+func TestNotificationQuietHours(t *testing.T) {
+	ns, _ := newTestNotificationService(t, nil)
+	overnight := models.RecipientGroup{Name: "night", QuietHours: &models.QuietHours{
+		Start: "22:00", End: "07:00", AllowSeverities: []string{models.AlarmSeverityCritical},
+	}}
+	office := models.RecipientGroup{Name: "office", QuietHours: &models.QuietHours{Start: "09:00", End: "17:00"}}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		group    models.RecipientGroup
+		severity string
+		now      time.Time
+		want     bool
+	}{
+		{"before midnight", overnight, models.AlarmSeverityMajor, at(23, 30), true},
+		{"after midnight", overnight, models.AlarmSeverityMajor, at(6, 59), true},
+		{"window end", overnight, models.AlarmSeverityMajor, at(7, 0), false},
+		{"daytime", overnight, models.AlarmSeverityMajor, at(12, 0), false},
+		{"allowed severity", overnight, models.AlarmSeverityCritical, at(23, 30), false},
+		{"window start", office, models.AlarmSeverityMajor, at(9, 0), true},
+		{"before window", office, models.AlarmSeverityMajor, at(8, 59), false},
+		{"last minute", office, models.AlarmSeverityMajor, at(16, 59), true},
+		{"after window", office, models.AlarmSeverityMajor, at(17, 0), false},
+		{"no quiet hours", models.RecipientGroup{Name: "always"}, models.AlarmSeverityMajor, at(23, 30), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ns.inQuietHoursLocked(tt.group, tt.severity, tt.now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The window is read in the configured timezone: 15:30 UTC is 22:30 in Hanoi
+	ns.SetConfig(config.NotificationsConfig{Timezone: "Asia/Ho_Chi_Minh"})
+	if !ns.inQuietHoursLocked(overnight, models.AlarmSeverityMajor, at(15, 30)) {
+		t.Error("15:30 UTC is not in the 22:00-07:00 Asia/Ho_Chi_Minh quiet hours")
+	}
+}
+
+func TestNotificationQuietHoursSuppressMessages(t *testing.T) {
+	ns, sms := newTestNotificationService(t, func(cfg *config.NotificationsConfig) {
+		cfg.Groups = []models.RecipientGroup{{
+			Name:   "operators",
+			Phones: []string{"+84900000001"},
+			// Quiet all day but the last minute
+			QuietHours: &models.QuietHours{Start: "00:00", End: "23:59"},
+		}}
+	})
+
+	ns.mutex.Lock()
+	pending := ns.notificationsLocked(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), testAlarm(), "escalate", 1, "operators",
+		[]string{models.ChannelSMS}, "subject", "email", "sms")
+	ns.mutex.Unlock()
+	if len(pending) != 0 {
+		t.Fatalf("got %d notifications to send in quiet hours, want none", len(pending))
+	}
+	logged := ns.GetNotifications("alarm_1", models.NotificationStatusQuietHours, models.ChannelSMS)
+	if len(logged) != 1 || logged[0].Recipient != "+84900000001" {
+		t.Errorf("got log %+v, want one QUIET_HOURS notification", logged)
+	}
+	if len(sms.messages) != 0 {
+		t.Errorf("sent %v in quiet hours", sms.messages)
+	}
+}
+
+func TestNotificationRateLimit(t *testing.T) {
+	ns, _ := newTestNotificationService(t, func(cfg *config.NotificationsConfig) {
+		cfg.RateLimit = config.RateLimitConfig{MaxNotifications: 2, Window: time.Minute}
+		cfg.Groups = []models.RecipientGroup{{Name: "operators", Emails: []string{"ops@example.com"}, Phones: []string{"+84900000001"}}}
+	})
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	// Two messages per recipient and channel within a sliding minute
+	tests := []struct {
+		key   string
+		after time.Duration
+		want  bool
+	}{
+		{"SMS|+84900000001", 0, true},
+		{"SMS|+84900000001", 10 * time.Second, true},
+		{"SMS|+84900000001", 20 * time.Second, false},
+		{"EMAIL|+84900000001", 20 * time.Second, true}, // another channel
+		{"SMS|+84900000002", 20 * time.Second, true},   // another recipient
+		{"SMS|+84900000001", time.Minute, true},        // the first has left the window
+		{"SMS|+84900000001", time.Minute + time.Second, false},
+		{"SMS|+84900000001", time.Minute + 10*time.Second, true},
+	}
+	for i, tt := range tests {
+		if got := ns.allowLocked(tt.key, start.Add(tt.after)); got != tt.want {
+			t.Errorf("check %d: %s after %s allowed = %v, want %v", i, tt.key, tt.after, got, tt.want)
+		}
+	}
+
+	// Suppressed notifications are logged, each channel counting on its own
+	ns.sent = make(map[string][]time.Time)
+	send := func(now time.Time, channels ...string) int {
+		return len(ns.notificationsLocked(now, testAlarm(), "escalate", 1, "operators", channels, "subject", "email", "sms"))
+	}
+	if sent := send(start, models.ChannelSMS) + send(start, models.ChannelSMS); sent != 2 {
+		t.Fatalf("sent %d text messages, want 2", sent)
+	}
+	if sent := send(start, models.ChannelEmail, models.ChannelSMS); sent != 1 {
+		t.Errorf("sent %d notifications once the SMS limit was reached, want the email only", sent)
+	}
+	limited := 0
+	for _, notification := range ns.log {
+		if notification.Status == models.NotificationStatusRateLimited {
+			if notification.Channel != models.ChannelSMS {
+				t.Errorf("got a rate-limited %s notification, want SMS only", notification.Channel)
+			}
+			limited++
+		}
+	}
+	if limited != 1 {
+		t.Errorf("got %d RATE_LIMITED notifications, want 1", limited)
+	}
+}
@@ -0,0 +1,576 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/promql"
+)
+
+const (
+	// promLookbackDelta is how far back an instant selector looks for a sample
+	promLookbackDelta = 5 * time.Minute
+	// maxPromPoints bounds the number of steps of a range query, as Prometheus does
+	maxPromPoints = 11000
+)
+
+// promPoint is one numeric sample of a series
+type promPoint struct {
+	t int64 // milliseconds
+	v float64
+}
+
+// promSeries is a telemetry key of one device exposed as a Prometheus series
+type promSeries struct {
+	labels map[string]string
+	points []promPoint
+}
+
+// promElement is one entry of an instant vector
+type promElement struct {
+	labels map[string]string
+	value  float64
+}
+
+// promValue is the result of evaluating an expression at one timestamp
+type promValue struct {
+	isScalar bool
+	scalar   float64
+	vector   []promElement
+}
+
+// promEvaluator evaluates an expression against series loaded up front
+type promEvaluator struct {
+	series map[*promql.VectorSelector][]*promSeries
+}
+
+// PromQueryRange evaluates a PromQL expression at every step between start
+// and end, returning a Prometheus matrix result
+func (ts *TelemetryService) PromQueryRange(expr promql.Expr, start, end time.Time, step time.Duration) (*models.PromQueryData, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("zero or negative query resolution step widths are not accepted")
+	}
+	// Steps are evaluated in whole milliseconds
+	stepMs := step.Milliseconds()
+	if stepMs < 1 {
+		return nil, fmt.Errorf("query resolution step must be at least 1ms")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end timestamp must not be before start time")
+	}
+	if (end.UnixMilli()-start.UnixMilli())/stepMs > maxPromPoints {
+		return nil, fmt.Errorf("exceeded maximum resolution of %d points per timeseries; try decreasing the query resolution (?step=XX)", maxPromPoints)
+	}
+
+	ev := ts.newPromEvaluator(expr, start.UnixMilli(), end.UnixMilli())
+
+	bySignature := make(map[string]*models.PromSeries)
+	for t := start.UnixMilli(); t <= end.UnixMilli(); t += stepMs {
+		value := ev.eval(expr, t)
+		if value.isScalar {
+			value.vector = []promElement{{labels: map[string]string{}, value: value.scalar}}
+		}
+		for _, element := range value.vector {
+			signature := labelSignature(element.labels, true)
+			series, exists := bySignature[signature]
+			if !exists {
+				series = &models.PromSeries{Metric: element.labels}
+				bySignature[signature] = series
+			}
+			series.Values = append(series.Values, models.PromSample{Ts: t, Value: element.value})
+		}
+	}
+
+	result := make([]models.PromSeries, 0, len(bySignature))
+	for _, signature := range sortedKeys(bySignature) {
+		result = append(result, *bySignature[signature])
+	}
+	return &models.PromQueryData{ResultType: models.PromResultMatrix, Result: result}, nil
+}
+
+// PromQuery evaluates a PromQL expression at a single timestamp
+func (ts *TelemetryService) PromQuery(expr promql.Expr, at time.Time) *models.PromQueryData {
+	t := at.UnixMilli()
+	ev := ts.newPromEvaluator(expr, t, t)
+	value := ev.eval(expr, t)
+
+	if value.isScalar {
+		return &models.PromQueryData{
+			ResultType: models.PromResultScalar,
+			Result:     models.PromSample{Ts: t, Value: value.scalar},
+		}
+	}
+
+	sort.Slice(value.vector, func(i, j int) bool {
+		return labelSignature(value.vector[i].labels, true) < labelSignature(value.vector[j].labels, true)
+	})
+	result := make([]models.PromSeries, 0, len(value.vector))
+	for _, element := range value.vector {
+		sample := models.PromSample{Ts: t, Value: element.value}
+		result = append(result, models.PromSeries{Metric: element.labels, Value: &sample})
+	}
+	return &models.PromQueryData{ResultType: models.PromResultVector, Result: result}
+}
+
+// PromSeries returns the label sets of all series matching any of the
+// selectors and having numeric samples between start and end
+func (ts *TelemetryService) PromSeries(selectors [][]*promql.Matcher, start, end time.Time) []map[string]string {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	bySignature := make(map[string]map[string]string)
+	for _, matchers := range selectors {
+		for _, series := range ts.selectPromSeriesLocked(matchers, start.UnixMilli(), end.UnixMilli()) {
+			bySignature[labelSignature(series.labels, true)] = series.labels
+		}
+	}
+
+	result := make([]map[string]string, 0, len(bySignature))
+	for _, signature := range sortedKeys(bySignature) {
+		result = append(result, bySignature[signature])
+	}
+	return result
+}
+
+// PromLabelNames returns the label names exposed on every series
+func (ts *TelemetryService) PromLabelNames() []string {
+	return []string{promql.MetricNameLabel, "device", "location", "type"}
+}
+
+// PromLabelValues returns the known values of a label
+func (ts *TelemetryService) PromLabelValues(name string) []string {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	values := make(map[string]bool)
+	if name == promql.MetricNameLabel {
+		for key := range ts.keys {
+			values[key] = true
+		}
+	}
+	for _, device := range ts.devices {
+		if value := promDeviceLabels(device)[name]; value != "" {
+			values[value] = true
+		}
+	}
+	return sortedKeys(values)
+}
+
+// newPromEvaluator loads every series referenced by the expression from one
+// snapshot of the store, covering [minT - lookback, maxT]
+func (ts *TelemetryService) newPromEvaluator(expr promql.Expr, minT, maxT int64) *promEvaluator {
+	lookback := promLookbackDelta
+	ranges := make(map[*promql.VectorSelector]time.Duration)
+	collectPromRanges(expr, ranges)
+	for _, rng := range ranges {
+		if rng > lookback {
+			lookback = rng
+		}
+	}
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	ev := &promEvaluator{series: make(map[*promql.VectorSelector][]*promSeries)}
+	for _, selector := range promql.Selectors(expr) {
+		ev.series[selector] = ts.selectPromSeriesLocked(selector.Matchers, minT-lookback.Milliseconds(), maxT)
+	}
+	return ev
+}
+
+// collectPromRanges records the range of every matrix selector
+func collectPromRanges(expr promql.Expr, ranges map[*promql.VectorSelector]time.Duration) {
+	switch e := expr.(type) {
+	case *promql.MatrixSelector:
+		ranges[e.Vector] = e.Range
+	case *promql.Call:
+		for _, arg := range e.Args {
+			collectPromRanges(arg, ranges)
+		}
+	case *promql.AggregateExpr:
+		collectPromRanges(e.Expr, ranges)
+	case *promql.BinaryExpr:
+		collectPromRanges(e.LHS, ranges)
+		collectPromRanges(e.RHS, ranges)
+	}
+}
+
+// promDeviceLabels returns the labels a device contributes to its series
+func promDeviceLabels(device *models.Device) map[string]string {
+	return map[string]string{
+		"device":   device.ID,
+		"type":     device.Type,
+		"location": device.Location,
+	}
+}
+
+// selectPromSeriesLocked returns the numeric series matching all matchers
+// with their samples in [minT, maxT], including rollup averages for the part
+// of the range past raw retention.
+// Caller must hold ts.mutex.
+func (ts *TelemetryService) selectPromSeriesLocked(matchers []*promql.Matcher, minT, maxT int64) []*promSeries {
+	var nameMatchers, deviceMatchers []*promql.Matcher
+	for _, m := range matchers {
+		if m.Name == promql.MetricNameLabel {
+			nameMatchers = append(nameMatchers, m)
+		} else {
+			deviceMatchers = append(deviceMatchers, m)
+		}
+	}
+
+	deviceIDs := make([]string, 0, len(ts.devices))
+	for id := range ts.devices {
+		deviceIDs = append(deviceIDs, id)
+	}
+	sort.Strings(deviceIDs)
+
+	var result []*promSeries
+	for _, deviceID := range deviceIDs {
+		deviceLabels := promDeviceLabels(ts.devices[deviceID])
+		if !matchAll(deviceMatchers, deviceLabels) {
+			continue
+		}
+
+		// Keys with raw readings are in ts.keys; older ones may only have rollups
+		keys := make(map[string]bool, len(ts.keys))
+		for key := range ts.keys {
+			keys[key] = true
+		}
+		for key := range ts.rollups[deviceID] {
+			keys[key] = true
+		}
+
+		for _, key := range sortedKeys(keys) {
+			if !matchAll(nameMatchers, map[string]string{promql.MetricNameLabel: key}) {
+				continue
+			}
+			points := ts.pointsLocked(deviceID, key, time.UnixMilli(minT), time.UnixMilli(maxT), 0)
+			if len(points) == 0 {
+				continue
+			}
+
+			labels := map[string]string{promql.MetricNameLabel: key}
+			for name, value := range deviceLabels {
+				labels[name] = value
+			}
+			series := &promSeries{labels: labels, points: make([]promPoint, len(points))}
+			for k, point := range points {
+				series.points[k] = promPoint{t: int64(point[0]), v: point[1]}
+			}
+			result = append(result, series)
+		}
+	}
+	return result
+}
+
+// matchAll reports whether a label set satisfies every matcher
+func matchAll(matchers []*promql.Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// eval evaluates an expression at timestamp t (milliseconds)
+func (ev *promEvaluator) eval(expr promql.Expr, t int64) promValue {
+	switch e := expr.(type) {
+	case *promql.NumberLiteral:
+		return promValue{isScalar: true, scalar: e.Value}
+
+	case *promql.VectorSelector:
+		var vector []promElement
+		for _, series := range ev.series[e] {
+			points := window(series.points, t-promLookbackDelta.Milliseconds(), t)
+			if len(points) > 0 {
+				vector = append(vector, promElement{labels: series.labels, value: points[len(points)-1].v})
+			}
+		}
+		return promValue{vector: vector}
+
+	case *promql.Call:
+		return ev.evalCall(e, t)
+
+	case *promql.AggregateExpr:
+		return promValue{vector: aggregateVector(e, ev.eval(e.Expr, t).vector)}
+
+	case *promql.BinaryExpr:
+		return binaryOp(e.Op, ev.eval(e.LHS, t), ev.eval(e.RHS, t))
+	}
+	return promValue{}
+}
+
+func (ev *promEvaluator) evalCall(call *promql.Call, t int64) promValue {
+	var vector []promElement
+
+	if ms, ok := call.Args[0].(*promql.MatrixSelector); ok {
+		rangeStart := t - ms.Range.Milliseconds()
+		for _, series := range ev.series[ms.Vector] {
+			value, ok := rangeFunction(call.Func, window(series.points, rangeStart, t), rangeStart, t)
+			if !ok {
+				continue
+			}
+			labels := series.labels
+			if call.Func != "last_over_time" {
+				labels = dropMetricName(labels)
+			}
+			vector = append(vector, promElement{labels: labels, value: value})
+		}
+		return promValue{vector: vector}
+	}
+
+	var fn func(float64) float64
+	switch call.Func {
+	case "abs":
+		fn = math.Abs
+	case "ceil":
+		fn = math.Ceil
+	case "floor":
+		fn = math.Floor
+	case "round":
+		fn = math.Round
+	}
+	for _, element := range ev.eval(call.Args[0], t).vector {
+		vector = append(vector, promElement{labels: dropMetricName(element.labels), value: fn(element.value)})
+	}
+	return promValue{vector: vector}
+}
+
+// window returns the points with timestamps in (from, to]
+func window(points []promPoint, from, to int64) []promPoint {
+	first := sort.Search(len(points), func(i int) bool { return points[i].t > from })
+	last := sort.Search(len(points), func(i int) bool { return points[i].t > to })
+	return points[first:last]
+}
+
+// rangeFunction applies a range-vector function to the points of one window
+func rangeFunction(name string, points []promPoint, rangeStart, rangeEnd int64) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+
+	switch name {
+	case "rate":
+		return extrapolatedDelta(points, rangeStart, rangeEnd, true, true)
+	case "increase":
+		return extrapolatedDelta(points, rangeStart, rangeEnd, true, false)
+	case "delta":
+		return extrapolatedDelta(points, rangeStart, rangeEnd, false, false)
+	case "irate":
+		if len(points) < 2 {
+			return 0, false
+		}
+		prev, last := points[len(points)-2], points[len(points)-1]
+		dv := last.v - prev.v
+		if last.v < prev.v {
+			dv = last.v // counter reset
+		}
+		return dv / (float64(last.t-prev.t) / 1000), true
+	}
+
+	acc := &aggregator{}
+	for _, p := range points {
+		acc.add(p.t, p.v)
+	}
+	switch name {
+	case "avg_over_time":
+		return acc.result(models.AggregationAvg), true
+	case "min_over_time":
+		return acc.result(models.AggregationMin), true
+	case "max_over_time":
+		return acc.result(models.AggregationMax), true
+	case "sum_over_time":
+		return acc.result(models.AggregationSum), true
+	case "count_over_time":
+		return acc.result(models.AggregationCount), true
+	case "last_over_time":
+		return acc.result(models.AggregationLast), true
+	}
+	return 0, false
+}
+
+// extrapolatedDelta implements Prometheus' rate, increase and delta: the
+// change over the samples, extrapolated towards the window boundaries
+func extrapolatedDelta(points []promPoint, rangeStart, rangeEnd int64, isCounter, isRate bool) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	first, last := points[0], points[len(points)-1]
+
+	result := last.v - first.v
+	if isCounter {
+		// Add back the value lost at each counter reset
+		for i := 1; i < len(points); i++ {
+			if points[i].v < points[i-1].v {
+				result += points[i-1].v
+			}
+		}
+	}
+
+	sampledInterval := float64(last.t-first.t) / 1000
+	averageBetweenSamples := sampledInterval / float64(len(points)-1)
+	durationToStart := float64(first.t-rangeStart) / 1000
+	durationToEnd := float64(rangeEnd-last.t) / 1000
+
+	// A counter cannot extrapolate below zero
+	if isCounter && result > 0 && first.v >= 0 {
+		if durationToZero := sampledInterval * (first.v / result); durationToZero < durationToStart {
+			durationToStart = durationToZero
+		}
+	}
+
+	threshold := averageBetweenSamples * 1.1
+	extrapolateTo := sampledInterval
+	if durationToStart < threshold {
+		extrapolateTo += durationToStart
+	} else {
+		extrapolateTo += averageBetweenSamples / 2
+	}
+	if durationToEnd < threshold {
+		extrapolateTo += durationToEnd
+	} else {
+		extrapolateTo += averageBetweenSamples / 2
+	}
+
+	result *= extrapolateTo / sampledInterval
+	if isRate {
+		result /= float64(rangeEnd-rangeStart) / 1000
+	}
+	return result, true
+}
+
+// aggregateVector applies sum/avg/min/max/count with by/without grouping
+func aggregateVector(agg *promql.AggregateExpr, vector []promElement) []promElement {
+	grouping := make(map[string]bool, len(agg.Grouping))
+	for _, label := range agg.Grouping {
+		grouping[label] = true
+	}
+
+	type group struct {
+		labels map[string]string
+		acc    *aggregator
+	}
+	groups := make(map[string]*group)
+	for _, element := range vector {
+		labels := make(map[string]string)
+		for name, value := range element.labels {
+			if name == promql.MetricNameLabel && agg.Without {
+				continue
+			}
+			if grouping[name] != agg.Without {
+				labels[name] = value
+			}
+		}
+		signature := labelSignature(labels, true)
+		g, exists := groups[signature]
+		if !exists {
+			g = &group{labels: labels, acc: &aggregator{}}
+			groups[signature] = g
+		}
+		g.acc.add(0, element.value) // elements share the evaluation time
+	}
+
+	result := make([]promElement, 0, len(groups))
+	for _, signature := range sortedKeys(groups) {
+		g := groups[signature]
+		result = append(result, promElement{labels: g.labels, value: g.acc.result(strings.ToUpper(agg.Op))})
+	}
+	return result
+}
+
+// binaryOp applies an arithmetic operator. Vector/vector operations match
+// elements one-to-one on their labels, ignoring the metric name.
+func binaryOp(op string, lhs, rhs promValue) promValue {
+	switch {
+	case lhs.isScalar && rhs.isScalar:
+		return promValue{isScalar: true, scalar: arithmetic(op, lhs.scalar, rhs.scalar)}
+
+	case rhs.isScalar:
+		vector := make([]promElement, 0, len(lhs.vector))
+		for _, element := range lhs.vector {
+			vector = append(vector, promElement{labels: dropMetricName(element.labels), value: arithmetic(op, element.value, rhs.scalar)})
+		}
+		return promValue{vector: vector}
+
+	case lhs.isScalar:
+		vector := make([]promElement, 0, len(rhs.vector))
+		for _, element := range rhs.vector {
+			vector = append(vector, promElement{labels: dropMetricName(element.labels), value: arithmetic(op, lhs.scalar, element.value)})
+		}
+		return promValue{vector: vector}
+	}
+
+	right := make(map[string]float64, len(rhs.vector))
+	for _, element := range rhs.vector {
+		right[labelSignature(element.labels, false)] = element.value
+	}
+	var vector []promElement
+	for _, element := range lhs.vector {
+		value, ok := right[labelSignature(element.labels, false)]
+		if !ok {
+			continue
+		}
+		vector = append(vector, promElement{labels: dropMetricName(element.labels), value: arithmetic(op, element.value, value)})
+	}
+	return promValue{vector: vector}
+}
+
+func arithmetic(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "%":
+		return math.Mod(a, b)
+	}
+	return math.NaN()
+}
+
+// dropMetricName returns the labels without __name__
+func dropMetricName(labels map[string]string) map[string]string {
+	if _, ok := labels[promql.MetricNameLabel]; !ok {
+		return labels
+	}
+	result := make(map[string]string, len(labels)-1)
+	for name, value := range labels {
+		if name != promql.MetricNameLabel {
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// labelSignature renders a label set as a stable string
+func labelSignature(labels map[string]string, withName bool) string {
+	var sb strings.Builder
+	for _, name := range sortedKeys(labels) {
+		if !withName && name == promql.MetricNameLabel {
+			continue
+		}
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(labels[name])
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
+
+// sortedKeys returns the keys of a string-keyed map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
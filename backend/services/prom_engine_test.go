@@ -0,0 +1,65 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/promql"
+)
+
+func TestPromQueryRangeRejectsInvalidSteps(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	expr, err := promql.ParseExpr("temperature")
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+	start := time.UnixMilli(1_700_000_000_000)
+
+	tests := []struct {
+		name    string
+		end     time.Time
+		step    time.Duration
+		wantErr string
+	}{
+		{"zero step", start.Add(time.Minute), 0, "zero or negative"},
+		{"sub-millisecond step", start.Add(time.Second), 100 * time.Microsecond, "at least 1ms"},
+		{"too many steps", start.Add(time.Hour), 100 * time.Millisecond, "maximum resolution"},
+		{"end before start", start.Add(-time.Second), time.Second, "before start"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ts.PromQueryRange(expr, start, tt.end, tt.step)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("PromQueryRange error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromQueryRangeSteps(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	ts.data["device_001"] = testReadings("device_001", "temperature", 1000, 2000, 3000)
+	expr, err := promql.ParseExpr(`temperature{device="device_001"}`)
+	if err != nil {
+		t.Fatalf("ParseExpr: %v", err)
+	}
+
+	data, err := ts.PromQueryRange(expr, time.UnixMilli(1000), time.UnixMilli(3000), time.Second)
+	if err != nil {
+		t.Fatalf("PromQueryRange: %v", err)
+	}
+	series := data.Result.([]models.PromSeries)
+	if len(series) != 1 {
+		t.Fatalf("got %d series, want 1", len(series))
+	}
+	for i, sample := range series[0].Values {
+		if sample.Ts != int64(1000*(i+1)) || sample.Value != float64(i) {
+			t.Errorf("sample %d = %+v, want {%d %d}", i, sample, 1000*(i+1), i)
+		}
+	}
+	if len(series[0].Values) != 3 {
+		t.Errorf("got %d samples, want 3", len(series[0].Values))
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+	"thingsboard-widget-backend/query"
+)
+
+// maxQueryBuckets bounds the number of buckets a query may produce per series
+const maxQueryBuckets = 10000
+
+// queryGroup accumulates the buckets of one group-by combination
+type queryGroup struct {
+	labels  map[string]string
+	devices []string
+	buckets map[string]map[int64]*aggregator // series name -> bucket start -> accumulator
+}
+
+// RunQuery parses, plans and executes a telemetry query against one
+// consistent snapshot of the store
+func (ts *TelemetryService) RunQuery(text string) (*models.QueryResponse, error) {
+	q, err := query.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plan the time range and bucketing
+	end := time.Now()
+	start := end.Add(-q.Range.Last)
+	if q.Range.IsAbsolute() {
+		start, end = q.Range.Start, q.Range.End
+	}
+	interval := q.Bucket.Milliseconds()
+	if interval == 0 {
+		interval = end.Sub(start).Milliseconds() + 1
+	} else if (end.Sub(start).Milliseconds() / interval) > maxQueryBuckets {
+		return nil, fmt.Errorf("query would produce more than %d buckets per series; use a larger bucket or a shorter range", maxQueryBuckets)
+	}
+
+	var deviceFilters, valueFilters []query.Condition
+	for _, condition := range q.Filters {
+		if condition.IsDeviceFilter() {
+			deviceFilters = append(deviceFilters, condition)
+		} else {
+			valueFilters = append(valueFilters, condition)
+		}
+	}
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	for _, sel := range q.Selects {
+		if _, exists := ts.keys[sel.Key]; !exists {
+			return nil, fmt.Errorf("unknown telemetry key %q in %s", sel.Key, sel.Name())
+		}
+	}
+	for _, condition := range valueFilters {
+		if _, exists := ts.keys[condition.Field]; !exists {
+			return nil, fmt.Errorf("unknown telemetry key %q in where clause", condition.Field)
+		}
+	}
+
+	// Execute: scan every matching device and accumulate into its group
+	groups := make(map[string]*queryGroup)
+	deviceIDs := make([]string, 0, len(ts.devices))
+	for id := range ts.devices {
+		deviceIDs = append(deviceIDs, id)
+	}
+	sort.Strings(deviceIDs)
+
+	for _, deviceID := range deviceIDs {
+		device := ts.devices[deviceID]
+		if !matchesDeviceFilters(device, deviceFilters) {
+			continue
+		}
+
+		labels := make(map[string]string, len(q.GroupBy))
+		labelParts := make([]string, 0, len(q.GroupBy))
+		for _, attr := range q.GroupBy {
+			value := deviceAttribute(device, attr)
+			labels[attr] = value
+			labelParts = append(labelParts, attr+"="+value)
+		}
+		groupKey := strings.Join(labelParts, "|")
+		group, exists := groups[groupKey]
+		if !exists {
+			group = &queryGroup{labels: labels, buckets: make(map[string]map[int64]*aggregator)}
+			groups[groupKey] = group
+		}
+
+		matched := false
+		seriesFor := func(name string) map[int64]*aggregator {
+			series, exists := group.buckets[name]
+			if !exists {
+				series = make(map[int64]*aggregator)
+				group.buckets[name] = series
+			}
+			return series
+		}
+
+		// Without per-reading filters, bucketed queries can read the rollup tiers
+		if len(valueFilters) == 0 && q.Bucket > 0 {
+			for _, sel := range q.Selects {
+				series := seriesFor(sel.Name())
+				for _, bucket := range ts.bucketsLocked(deviceID, sel.Key, start, end, interval) {
+					acc, exists := series[bucket.start]
+					if !exists {
+						acc = &aggregator{}
+						series[bucket.start] = acc
+					}
+					acc.merge(bucket.acc)
+					matched = true
+				}
+			}
+			if matched {
+				group.devices = append(group.devices, deviceID)
+			}
+			continue
+		}
+
+		data := ts.data[deviceID]
+		first := sort.Search(len(data), func(i int) bool {
+			return !data[i].Timestamp.Before(start)
+		})
+		for _, record := range data[first:] {
+			if record.Timestamp.After(end) {
+				break
+			}
+			if !matchesValueFilters(record.Values, valueFilters) {
+				continue
+			}
+
+			bucket := start.UnixMilli()
+			if q.Bucket > 0 {
+				bucket = bucketStart(record.Timestamp.UnixMilli(), interval)
+			}
+			for _, sel := range q.Selects {
+				value, ok := numericValue(record.Values[sel.Key])
+				if !ok {
+					continue
+				}
+				series := seriesFor(sel.Name())
+				acc, exists := series[bucket]
+				if !exists {
+					acc = &aggregator{}
+					series[bucket] = acc
+				}
+				acc.add(record.Timestamp.UnixMilli(), value)
+				matched = true
+			}
+		}
+		if matched {
+			group.devices = append(group.devices, deviceID)
+		}
+	}
+
+	// Render groups in a stable order
+	response := &models.QueryResponse{
+		Query:    text,
+		StartTs:  start.UnixMilli(),
+		EndTs:    end.UnixMilli(),
+		Interval: interval,
+		Results:  []models.QueryResult{},
+	}
+	groupKeys := make([]string, 0, len(groups))
+	for key, group := range groups {
+		if len(group.devices) > 0 {
+			groupKeys = append(groupKeys, key)
+		}
+	}
+	sort.Strings(groupKeys)
+
+	for _, key := range groupKeys {
+		group := groups[key]
+		result := models.QueryResult{
+			Group:     group.labels,
+			DeviceIDs: group.devices,
+			Data:      make(map[string][][]float64, len(q.Selects)),
+		}
+		for _, sel := range q.Selects {
+			points := [][]float64{}
+			series := group.buckets[sel.Name()]
+			bucketTimes := make([]int64, 0, len(series))
+			for bucket := range series {
+				bucketTimes = append(bucketTimes, bucket)
+			}
+			sort.Slice(bucketTimes, func(i, j int) bool { return bucketTimes[i] < bucketTimes[j] })
+			for _, bucket := range bucketTimes {
+				points = append(points, []float64{float64(bucket), series[bucket].result(sel.Agg)})
+			}
+			result.Data[sel.Name()] = points
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	return response, nil
+}
+
+// deviceAttribute returns a device field by its query attribute name
+func deviceAttribute(device *models.Device, attr string) string {
+	switch attr {
+	case "device":
+		return device.ID
+	case "name":
+		return device.Name
+	case "type":
+		return device.Type
+	case "location":
+		return device.Location
+	}
+	return ""
+}
+
+// matchesDeviceFilters reports whether a device satisfies all attribute conditions
+func matchesDeviceFilters(device *models.Device, conditions []query.Condition) bool {
+	for _, condition := range conditions {
+		equal := deviceAttribute(device, condition.Field) == condition.Value.(string)
+		if equal != (condition.Op == "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesValueFilters reports whether a reading satisfies all key conditions.
+// A reading without the key does not match.
+func matchesValueFilters(values map[string]interface{}, conditions []query.Condition) bool {
+	for _, condition := range conditions {
+		value, exists := values[condition.Field]
+		if !exists || !compareValue(value, condition.Op, condition.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValue applies a comparison between a stored value and a query literal
+func compareValue(value interface{}, op string, literal interface{}) bool {
+	var cmp int
+	switch lit := literal.(type) {
+	case string:
+		text, ok := value.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(text, lit)
+	case bool:
+		b, ok := value.(bool)
+		if !ok {
+			return false
+		}
+		if op != "=" && op != "!=" {
+			return false
+		}
+		if b == lit {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	case float64:
+		v, ok := numericValue(value)
+		if !ok {
+			return false
+		}
+		switch {
+		case v < lit:
+			cmp = -1
+		case v > lit:
+			cmp = 1
+		}
+	default:
+		return false
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retentionCheckInterval is how often expired raw readings and rollups are dropped
+const retentionCheckInterval = time.Minute
+
+// rawTier marks raw readings when choosing a tier to answer a query
+const rawTier = -1
+
+// retentionRule is the resolved retention of one device type and key
+type retentionRule struct {
+	raw     time.Duration
+	rollups []time.Duration // indexed like config.RollupTiers, 0 disables the tier
+}
+
+// rollupBucket aggregates the numeric values of one key over one tier bucket
+type rollupBucket struct {
+	aggregator
+	start int64 // milliseconds
+}
+
+// rollupSeries holds the rollup buckets of one key, per tier, ordered by start
+type rollupSeries [][]rollupBucket
+
+// timeBucket is one interval bucket of a query result
+type timeBucket struct {
+	start int64
+	acc   aggregator
+}
+
+// SetRetention replaces the retention policies and applies them immediately
+func (ts *TelemetryService) SetRetention(retention config.RetentionConfig) {
+	ts.mutex.Lock()
+	ts.retention = retention
+	ts.mutex.Unlock()
+
+	ts.enforceRetention()
+}
+
+// retentionRuleLocked resolves the retention of a device's key. The most
+// specific matching policy wins: device type and key, then key, then device
+// type. Caller must hold ts.mutex.
+func (ts *TelemetryService) retentionRuleLocked(deviceID, key string) retentionRule {
+	deviceType := ""
+	if device, exists := ts.devices[deviceID]; exists {
+		deviceType = device.Type
+	}
+
+	rule := retentionRule{raw: ts.retention.Raw, rollups: make([]time.Duration, len(config.RollupTiers))}
+	for i, tier := range config.RollupTiers {
+		rule.rollups[i] = ts.retention.Rollups[tier.Name]
+	}
+
+	var best *config.RetentionPolicy
+	bestScore := 0
+	for i := range ts.retention.Policies {
+		policy := &ts.retention.Policies[i]
+		if (policy.DeviceType != "" && policy.DeviceType != deviceType) || (policy.Key != "" && policy.Key != key) {
+			continue
+		}
+		score := 0
+		if policy.Key != "" {
+			score += 2
+		}
+		if policy.DeviceType != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = policy, score
+		}
+	}
+
+	if best != nil {
+		if best.Raw > 0 {
+			rule.raw = best.Raw
+		}
+		for i, tier := range config.RollupTiers {
+			if retention, ok := best.Rollups[tier.Name]; ok {
+				rule.rollups[i] = retention
+			}
+		}
+	}
+	return rule
+}
+
+// shortestRawLocked returns the shortest raw retention any key of a device can
+// have. Readings newer than that are never expired. Caller must hold ts.mutex.
+func (ts *TelemetryService) shortestRawLocked(deviceID string) time.Duration {
+	deviceType := ""
+	if device, exists := ts.devices[deviceID]; exists {
+		deviceType = device.Type
+	}
+
+	shortest := ts.retention.Raw
+	for _, policy := range ts.retention.Policies {
+		if policy.Raw > 0 && policy.Raw < shortest && (policy.DeviceType == "" || policy.DeviceType == deviceType) {
+			shortest = policy.Raw
+		}
+	}
+	return shortest
+}
+
+// rollupRef identifies one rollup bucket of a key
+type rollupRef struct {
+	key   string
+	tier  int
+	start int64
+}
+
+// rollupLocked adds readings already merged into a device's raw data to every
+// enabled rollup tier. previous[i], if given, holds the values stored at the
+// timestamp of records[i] before the merge, which the reading replaced. A
+// bucket with replaced values is rebuilt from the raw readings while they
+// still cover it; past raw retention the old value is subtracted instead, so
+// the bucket's min and max can only widen. Caller must hold ts.mutex.
+func (ts *TelemetryService) rollupLocked(deviceID string, records []models.TelemetryData, previous []map[string]interface{}) {
+	byKey := ts.rollups[deviceID]
+	if byKey == nil {
+		byKey = make(map[string]rollupSeries)
+		ts.rollups[deviceID] = byKey
+	}
+	now := time.Now()
+	rebuilt := make(map[rollupRef]bool)
+
+	for i, record := range records {
+		recordMs := record.Timestamp.UnixMilli()
+		for key, raw := range record.Values {
+			value, ok := numericValue(raw)
+			var old float64
+			replacing := false
+			if previous != nil {
+				old, replacing = numericValue(previous[i][key])
+			}
+			if (!ok && !replacing) || (ok && replacing && value == old) {
+				continue
+			}
+			rule := ts.retentionRuleLocked(deviceID, key)
+			series := byKey[key]
+			if series == nil {
+				series = make(rollupSeries, len(config.RollupTiers))
+				byKey[key] = series
+			}
+			rawFrom := now.Add(-rule.raw).UnixMilli()
+
+			for t, tier := range config.RollupTiers {
+				if rule.rollups[t] <= 0 {
+					continue
+				}
+				size := tier.Size.Milliseconds()
+				start := bucketStart(recordMs, size)
+				ref := rollupRef{key: key, tier: t, start: start}
+				switch {
+				case rebuilt[ref]:
+					// Already rebuilt from the merged readings, this one included
+				case replacing && start >= rawFrom:
+					series[t] = ts.rebuildRollupLocked(series[t], deviceID, key, start, size)
+					rebuilt[ref] = true
+				case replacing:
+					series[t] = replaceInRollup(series[t], start, recordMs, old, raw)
+				default:
+					series[t] = addToRollup(series[t], start, recordMs, value)
+				}
+			}
+		}
+	}
+}
+
+// rebuildRollupLocked recomputes the bucket starting at start from the raw
+// readings of a key, inserting or dropping it as needed. Caller must hold ts.mutex.
+func (ts *TelemetryService) rebuildRollupLocked(buckets []rollupBucket, deviceID, key string, start, size int64) []rollupBucket {
+	var acc aggregator
+	data := ts.data[deviceID]
+	first := sort.Search(len(data), func(i int) bool { return data[i].Timestamp.UnixMilli() >= start })
+	for _, record := range data[first:] {
+		recordMs := record.Timestamp.UnixMilli()
+		if recordMs >= start+size {
+			break
+		}
+		if value, ok := numericValue(record.Values[key]); ok {
+			acc.add(recordMs, value)
+		}
+	}
+
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= start })
+	exists := i < len(buckets) && buckets[i].start == start
+	switch {
+	case exists && acc.count == 0:
+		return append(buckets[:i], buckets[i+1:]...)
+	case exists:
+		buckets[i].aggregator = acc
+	case acc.count > 0:
+		buckets = append(buckets, rollupBucket{})
+		copy(buckets[i+1:], buckets[i:])
+		buckets[i] = rollupBucket{aggregator: acc, start: start}
+	}
+	return buckets
+}
+
+// replaceInRollup replaces old, the numeric value read at the time at (ms), by
+// raw in the bucket starting at start. A raw value that is not numeric only
+// removes old.
+func replaceInRollup(buckets []rollupBucket, start, at int64, old float64, raw interface{}) []rollupBucket {
+	value, ok := numericValue(raw)
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= start })
+	if i == len(buckets) || buckets[i].start != start {
+		// The old value's bucket has expired or its tier was enabled later
+		if ok {
+			return addToRollup(buckets, start, at, value)
+		}
+		return buckets
+	}
+
+	acc := &buckets[i].aggregator
+	acc.sum -= old
+	acc.count--
+	if acc.count == 0 {
+		*acc = aggregator{}
+	}
+	if ok {
+		acc.add(at, value)
+	}
+	if acc.count == 0 {
+		return append(buckets[:i], buckets[i+1:]...)
+	}
+	return buckets
+}
+
+// addToRollup adds a value to the bucket starting at start, inserting the
+// bucket in order if it does not exist yet
+func addToRollup(buckets []rollupBucket, start, ts int64, value float64) []rollupBucket {
+	n := len(buckets)
+	switch {
+	case n > 0 && buckets[n-1].start == start:
+		buckets[n-1].add(ts, value)
+		return buckets
+	case n == 0 || buckets[n-1].start < start:
+		buckets = append(buckets, rollupBucket{start: start})
+		buckets[n].add(ts, value)
+		return buckets
+	}
+
+	// Historical reading: find or insert its bucket
+	i := sort.Search(n, func(i int) bool { return buckets[i].start >= start })
+	if buckets[i].start != start {
+		buckets = append(buckets, rollupBucket{})
+		copy(buckets[i+1:], buckets[i:])
+		buckets[i] = rollupBucket{start: start}
+	}
+	buckets[i].add(ts, value)
+	return buckets
+}
+
+// enforceRetention drops expired raw readings and rollup buckets of every device
+func (ts *TelemetryService) enforceRetention() {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	now := time.Now()
+	droppedReadings, droppedBuckets := 0, 0
+	for deviceID := range ts.data {
+		droppedReadings += ts.expireRawLocked(deviceID, now)
+	}
+	for deviceID := range ts.rollups {
+		droppedBuckets += ts.expireRollupsLocked(deviceID, now)
+	}
+
+	if droppedReadings > 0 || droppedBuckets > 0 {
+		logrus.Debugf("Retention dropped %d raw readings and %d rollup buckets", droppedReadings, droppedBuckets)
+	}
+}
+
+// expireRawLocked removes raw values older than their key's raw retention and
+// returns how many readings were removed entirely. Caller must hold ts.mutex.
+func (ts *TelemetryService) expireRawLocked(deviceID string, now time.Time) int {
+	data := ts.data[deviceID]
+	horizon := now.Add(-ts.shortestRawLocked(deviceID))
+	stop := sort.Search(len(data), func(i int) bool {
+		return !data[i].Timestamp.Before(horizon)
+	})
+	if stop == 0 {
+		return 0
+	}
+
+	cutoffs := make(map[string]time.Time)
+	kept := make([]models.TelemetryData, 0, len(data))
+	changed := false
+	for _, record := range data[:stop] {
+		var values map[string]interface{}
+		for key, value := range record.Values {
+			cutoff, known := cutoffs[key]
+			if !known {
+				cutoff = now.Add(-ts.retentionRuleLocked(deviceID, key).raw)
+				cutoffs[key] = cutoff
+			}
+			if record.Timestamp.Before(cutoff) {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]interface{}, len(record.Values))
+			}
+			values[key] = value
+		}
+
+		switch {
+		case len(values) == 0:
+			changed = true
+		case len(values) < len(record.Values):
+			// Copy rather than modify: published readings share the map
+			record.Values = values
+			kept = append(kept, record)
+			changed = true
+		default:
+			kept = append(kept, record)
+		}
+	}
+	if !changed {
+		return 0
+	}
+
+	ts.data[deviceID] = append(kept, data[stop:]...)
+	return stop - len(kept)
+}
+
+// expireRollupsLocked removes rollup buckets that ended before their tier's
+// retention and returns how many were removed. Caller must hold ts.mutex.
+func (ts *TelemetryService) expireRollupsLocked(deviceID string, now time.Time) int {
+	dropped := 0
+	for key, series := range ts.rollups[deviceID] {
+		rule := ts.retentionRuleLocked(deviceID, key)
+		for i, tier := range config.RollupTiers {
+			horizon := now.Add(-rule.rollups[i]).UnixMilli()
+			buckets := series[i]
+			first := sort.Search(len(buckets), func(j int) bool {
+				return buckets[j].start+tier.Size.Milliseconds() > horizon
+			})
+			if first > 0 {
+				series[i] = append([]rollupBucket(nil), buckets[first:]...)
+				dropped += first
+			}
+		}
+	}
+	return dropped
+}
+
+// queryTierLocked chooses where to read a key for an aggregated query: the
+// coarsest rollup tier whose bucket size divides interval and whose retention
+// reaches back to start, or raw readings. When no tier reaches start, the one
+// reaching furthest back is used. Caller must hold ts.mutex.
+func (ts *TelemetryService) queryTierLocked(deviceID, key string, start time.Time, interval int64) int {
+	rule := ts.retentionRuleLocked(deviceID, key)
+	now := time.Now()
+
+	best, bestHorizon := rawTier, now.Add(-rule.raw)
+	for i := len(config.RollupTiers) - 1; i >= 0; i-- {
+		size := config.RollupTiers[i].Size.Milliseconds()
+		if rule.rollups[i] <= 0 || interval < size || interval%size != 0 {
+			continue
+		}
+		horizon := now.Add(-rule.rollups[i])
+		if !horizon.After(start) {
+			return i
+		}
+		if horizon.Before(bestHorizon) {
+			best, bestHorizon = i, horizon
+		}
+	}
+	// Raw readings are the finest source; bestHorizon is raw's unless a tier
+	// reaches further back
+	return best
+}
+
+// bucketsLocked aggregates a key's numeric values in [start, end] into
+// interval buckets, reading from the tier chosen by queryTierLocked.
+// Caller must hold ts.mutex.
+func (ts *TelemetryService) bucketsLocked(deviceID, key string, start, end time.Time, interval int64) []timeBucket {
+	var buckets []timeBucket
+	accumulate := func(bucket int64, acc aggregator) {
+		if n := len(buckets); n > 0 && buckets[n-1].start == bucket {
+			buckets[n-1].acc.merge(acc)
+			return
+		}
+		buckets = append(buckets, timeBucket{start: bucket, acc: acc})
+	}
+
+	tier := ts.queryTierLocked(deviceID, key, start, interval)
+	if tier == rawTier {
+		data := ts.data[deviceID]
+		first := sort.Search(len(data), func(i int) bool {
+			return !data[i].Timestamp.Before(start)
+		})
+		for _, record := range data[first:] {
+			if record.Timestamp.After(end) {
+				break
+			}
+			if value, ok := numericValue(record.Values[key]); ok {
+				var acc aggregator
+				acc.add(record.Timestamp.UnixMilli(), value)
+				accumulate(bucketStart(record.Timestamp.UnixMilli(), interval), acc)
+			}
+		}
+		return buckets
+	}
+
+	for _, rb := range ts.rollupRangeLocked(deviceID, key, tier, start.UnixMilli(), end.UnixMilli()+1) {
+		accumulate(bucketStart(rb.start, interval), rb.aggregator)
+	}
+	return buckets
+}
+
+// rollupRangeLocked returns the buckets of a tier containing data in [from, to).
+// Caller must hold ts.mutex.
+func (ts *TelemetryService) rollupRangeLocked(deviceID, key string, tier int, from, to int64) []rollupBucket {
+	series := ts.rollups[deviceID][key]
+	if series == nil {
+		return nil
+	}
+	buckets := series[tier]
+	size := config.RollupTiers[tier].Size.Milliseconds()
+	first := sort.Search(len(buckets), func(i int) bool { return buckets[i].start+size > from })
+	last := sort.Search(len(buckets), func(i int) bool { return buckets[i].start >= to })
+	if first >= last {
+		return nil
+	}
+	return buckets[first:last]
+}
+
+// pointsLocked returns a key's numeric [timestamp, value] points in
+// [start, end]: raw readings where they are still kept, preceded by the
+// averages of rollup tiers covering the older part of the range. The tiers are
+// tried from the one queryTierLocked picks for interval, or the finest one when
+// it picks raw readings, towards coarser ones. Caller must hold ts.mutex.
+func (ts *TelemetryService) pointsLocked(deviceID, key string, start, end time.Time, interval int64) [][]float64 {
+	points := [][]float64{}
+	data := ts.data[deviceID]
+	first := sort.Search(len(data), func(i int) bool {
+		return !data[i].Timestamp.Before(start)
+	})
+	for _, record := range data[first:] {
+		if record.Timestamp.After(end) {
+			break
+		}
+		if value, ok := numericValue(record.Values[key]); ok {
+			points = append(points, []float64{float64(record.Timestamp.UnixMilli()), value})
+		}
+	}
+
+	// Fill the part before the first raw point from successively coarser tiers
+	rule := ts.retentionRuleLocked(deviceID, key)
+	cutoff := end.UnixMilli() + 1
+	if len(points) > 0 {
+		cutoff = int64(points[0][0])
+	}
+	if !start.Before(time.Now().Add(-rule.raw)) && len(points) > 0 {
+		return points
+	}
+
+	finest := ts.queryTierLocked(deviceID, key, start, interval)
+	if finest == rawTier {
+		finest = 0
+	}
+	for i := finest; i < len(config.RollupTiers); i++ {
+		if rule.rollups[i] <= 0 {
+			continue
+		}
+		var older [][]float64
+		for _, rb := range ts.rollupRangeLocked(deviceID, key, i, start.UnixMilli(), cutoff) {
+			// Skip buckets overlapping data already taken from a finer source
+			if rb.start+config.RollupTiers[i].Size.Milliseconds() > cutoff {
+				continue
+			}
+			older = append(older, []float64{float64(rb.start), rb.result(models.AggregationAvg)})
+		}
+		if len(older) > 0 {
+			cutoff = int64(older[0][0])
+			points = append(older, points...)
+		}
+	}
+	return points
+}
+
+// GetKeyPoints returns a key's numeric [timestamp, value] points in [start,
+// end], from raw readings and, before raw retention, the finest rollup averages
+func (ts *TelemetryService) GetKeyPoints(deviceID, key string, start, end time.Time) [][]float64 {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return ts.pointsLocked(deviceID, key, start, end, 0)
+}
+
+// aggregateBuckets aggregates keys of a device in [start, end] into interval
+// buckets, reading each key from the most suitable tier
+func (ts *TelemetryService) aggregateBuckets(deviceID string, keys []string, start, end time.Time, interval int64) map[string][]timeBucket {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	result := make(map[string][]timeBucket, len(keys))
+	for _, key := range keys {
+		result[key] = ts.bucketsLocked(deviceID, key, start, end, interval)
+	}
+	return result
+}
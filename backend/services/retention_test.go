@@ -0,0 +1,148 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// humidityAt returns a humidity reading of device_001
+func humidityAt(ts time.Time, value float64) models.TelemetryData {
+	return models.TelemetryData{DeviceID: "device_001", Timestamp: ts, Values: map[string]interface{}{"humidity": value}}
+}
+
+func TestQueryTierLocked(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	now := time.Now()
+	minute, hour := time.Minute.Milliseconds(), time.Hour.Milliseconds()
+
+	tests := []struct {
+		name     string
+		start    time.Time
+		interval int64
+		want     int
+	}{
+		{"within raw retention, no tier dividing interval", now.Add(-time.Hour), 30 * 1000, rawTier},
+		{"minute tier reaching start", now.Add(-time.Hour), minute, 0},
+		{"interval finer than every tier", now.Add(-72 * time.Hour), 1000, rawTier},
+		{"minute buckets past raw retention", now.Add(-72 * time.Hour), minute, 0},
+		{"hour buckets use the coarsest dividing tier", now.Add(-72 * time.Hour), hour, 1},
+		{"90 minute buckets", now.Add(-72 * time.Hour), 90 * minute, 0},
+		{"no tier reaches start", now.Add(-30 * 24 * time.Hour), minute, 0},
+		{"daily buckets", now.Add(-365 * 24 * time.Hour), 24 * hour, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ts.queryTierLocked("device_001", "humidity", tt.start, tt.interval); got != tt.want {
+				t.Errorf("queryTierLocked = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTimeSeriesDataPicksTierByInterval(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	hour := time.Hour.Milliseconds()
+	start := bucketStart(time.Now().Add(-72*time.Hour).UnixMilli(), hour)
+
+	// Two hours of minute readings, past raw retention and only kept as rollups
+	var readings []models.TelemetryData
+	for i := int64(0); i < 120; i++ {
+		readings = append(readings, humidityAt(time.UnixMilli(start+i*time.Minute.Milliseconds()), float64(i%60)))
+	}
+	if evicted := ts.StoreHistorical(readings); evicted != len(readings) {
+		t.Fatalf("%d readings past raw retention, want %d", evicted, len(readings))
+	}
+
+	tests := []struct {
+		interval int64
+		want     int
+	}{
+		{time.Minute.Milliseconds(), 120},
+		{hour, 2},
+	}
+	for _, tt := range tests {
+		request := models.TimeSeriesRequest{
+			DeviceID: "device_001",
+			Keys:     []string{"humidity"},
+			StartTs:  start,
+			EndTs:    start + 2*hour - 1,
+			Interval: tt.interval,
+		}
+		if err := ts.PrepareTimeSeriesQuery(&request); err != nil {
+			t.Fatalf("PrepareTimeSeriesQuery: %v", err)
+		}
+		points := ts.GetTimeSeriesData(request).Data["humidity"]
+		if len(points) != tt.want {
+			t.Errorf("interval %d: got %d points, want %d", tt.interval, len(points), tt.want)
+			continue
+		}
+		if tt.interval == hour && points[0][1] != 29.5 {
+			t.Errorf("hourly average = %v, want 29.5", points[0][1])
+		}
+	}
+}
+
+func TestStoreHistoricalReplacesOverwrittenValues(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	// Raw readings reach back to half past the previous full hour, so its last
+	// minutes are covered by raw readings but the hour bucket is not
+	hour := time.UnixMilli(bucketStart(time.Now().UnixMilli(), time.Hour.Milliseconds())).Add(-time.Hour)
+	ts.retention.Raw = time.Since(hour) - 30*time.Minute
+	start := hour.Add(50 * time.Minute)
+
+	ts.StoreHistorical([]models.TelemetryData{
+		humidityAt(start, 10),
+		humidityAt(start.Add(10*time.Second), 30),
+		humidityAt(start.Add(20*time.Second), 20),
+	})
+	ts.StoreHistorical([]models.TelemetryData{humidityAt(start.Add(10*time.Second), 15)})
+
+	tests := []struct {
+		tier          string
+		count         int
+		sum, min, max float64
+	}{
+		// Rebuilt from the raw readings
+		{"1m", 3, 45, 10, 20},
+		// The old value is subtracted; the max cannot shrink
+		{"1h", 3, 45, 10, 30},
+	}
+	series := ts.rollups["device_001"]["humidity"]
+	for i, tt := range tests {
+		if len(series[i]) != 1 {
+			t.Fatalf("%s: got %d buckets, want 1", tt.tier, len(series[i]))
+		}
+		acc := series[i][0].aggregator
+		if acc.count != tt.count || acc.sum != tt.sum || acc.min != tt.min || acc.max != tt.max || acc.last != 20 {
+			t.Errorf("%s bucket count=%d sum=%v min=%v max=%v last=%v, want count=%d sum=%v min=%v max=%v last=20",
+				tt.tier, acc.count, acc.sum, acc.min, acc.max, acc.last, tt.count, tt.sum, tt.min, tt.max)
+		}
+	}
+
+	// Re-storing an unchanged value leaves the rollups alone
+	before := series[1][0].aggregator
+	ts.StoreHistorical([]models.TelemetryData{humidityAt(start, 10)})
+	if after := ts.rollups["device_001"]["humidity"][1][0].aggregator; after != before {
+		t.Errorf("re-storing an unchanged value changed the hour bucket from %+v to %+v", before, after)
+	}
+}
+
+func TestStoreHistoricalRebuildsBucketsWithNewReadings(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	start := time.UnixMilli(bucketStart(time.Now().Add(-2*time.Hour).UnixMilli(), time.Minute.Milliseconds()))
+	ts.StoreHistorical([]models.TelemetryData{humidityAt(start.Add(10*time.Second), 30)})
+
+	// One batch adding readings around an overwritten one in the same bucket
+	ts.StoreHistorical([]models.TelemetryData{
+		humidityAt(start, 10),
+		humidityAt(start.Add(10*time.Second), 15),
+		humidityAt(start.Add(20*time.Second), 20),
+	})
+
+	acc := ts.rollups["device_001"]["humidity"][0][0].aggregator
+	if acc.count != 3 || acc.sum != 45 || acc.max != 20 || acc.last != 20 {
+		t.Errorf("bucket = %+v, want count 3, sum 45, max 20 and last 20", acc)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+)
+
+// RPCListener is notified of every RPC result
+type RPCListener interface {
+	OnRPCResult(result models.RPCResult)
+}
+
+// RPCService answers two-way RPC calls on behalf of the simulated devices
+type RPCService struct {
+	telemetryService *TelemetryService
+	listeners        []RPCListener
+}
+
+// NewRPCService creates a new RPC service
+func NewRPCService(telemetryService *TelemetryService) *RPCService {
+	return &RPCService{
+		telemetryService: telemetryService,
+	}
+}
+
+// AddListener registers an RPC result listener.
+// Listeners must be added before the server starts.
+func (rs *RPCService) AddListener(listener RPCListener) {
+	rs.listeners = append(rs.listeners, listener)
+}
+
+// Call sends an RPC to a device and returns its answer. It reports whether the device exists.
+func (rs *RPCService) Call(deviceID string, request models.RPCRequest) (*models.RPCResult, bool) {
+	device, exists := rs.telemetryService.GetDevice(deviceID)
+	if !exists {
+		return nil, false
+	}
+
+	result := models.RPCResult{
+		ID:         uuid.New().String(),
+		DeviceID:   deviceID,
+		DeviceName: device.Name,
+		Method:     request.Method,
+		Params:     request.Params,
+		RequestTs:  time.Now(),
+	}
+	response, err := rs.execute(deviceID, request)
+	result.ResponseTs = time.Now()
+	if err != nil {
+		result.Status = models.RPCStatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = models.RPCStatusSuccessful
+		result.Response = response
+	}
+
+	for _, listener := range rs.listeners {
+		listener.OnRPCResult(result)
+	}
+	return &result, true
+}
+
+// execute runs an RPC method against the simulated device
+func (rs *RPCService) execute(deviceID string, request models.RPCRequest) (interface{}, error) {
+	switch request.Method {
+	case models.RPCMethodPing:
+		return map[string]interface{}{"pong": true}, nil
+
+	case models.RPCMethodGetTelemetry:
+		latest, exists := rs.telemetryService.GetLatestTelemetry(deviceID)
+		if !exists {
+			return nil, fmt.Errorf("device has not reported telemetry yet")
+		}
+		return latest.Values, nil
+
+	case models.RPCMethodSetReporting:
+		enabled, ok := request.Params["enabled"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("params.enabled must be a boolean")
+		}
+		rs.telemetryService.SetDeviceReporting(deviceID, enabled)
+		return map[string]interface{}{"reporting": enabled}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported method %q (expected ping, getTelemetry or setReporting)", request.Method)
+}
@@ -0,0 +1,69 @@
+package services
+
+// sequenceBuffer numbers broadcast events and keeps the most recent ones so
+// reconnecting clients can replay what they missed. It is not safe for
+// concurrent use; callers guard it with their own mutex.
+type sequenceBuffer struct {
+	events []StreamEvent // ring buffer indexed by (ID-1) % size
+	size   int
+	nextID uint64
+}
+
+// newSequenceBuffer creates a buffer keeping up to size events
+func newSequenceBuffer(size int) *sequenceBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &sequenceBuffer{
+		events: make([]StreamEvent, 0, size),
+		size:   size,
+		nextID: 1,
+	}
+}
+
+// add assigns the next ID to an event and stores it, evicting the oldest event when full
+func (sb *sequenceBuffer) add(eventType string, payload interface{}) StreamEvent {
+	event := StreamEvent{ID: sb.nextID, Type: eventType, Payload: payload}
+	sb.nextID++
+	if len(sb.events) < sb.size {
+		sb.events = append(sb.events, event)
+	} else {
+		sb.events[(event.ID-1)%uint64(sb.size)] = event
+	}
+	return event
+}
+
+// lastID returns the ID of the most recent event, 0 before the first one
+func (sb *sequenceBuffer) lastID() uint64 {
+	return sb.nextID - 1
+}
+
+// since returns the buffered events after lastID, oldest first. ok is false
+// when some of them were already evicted or lastID was never assigned (IDs
+// restart with the server).
+func (sb *sequenceBuffer) since(lastID uint64) (events []StreamEvent, ok bool) {
+	if lastID >= sb.nextID {
+		return nil, false
+	}
+	oldest := sb.nextID
+	if len(sb.events) > 0 {
+		oldest = sb.at(0).ID
+	}
+	if lastID+1 < oldest {
+		return nil, false
+	}
+	for i := 0; i < len(sb.events); i++ {
+		if event := sb.at(i); event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events, true
+}
+
+// at returns the i-th oldest buffered event
+func (sb *sequenceBuffer) at(i int) StreamEvent {
+	if len(sb.events) < sb.size {
+		return sb.events[i]
+	}
+	return sb.events[(sb.nextID-1+uint64(i))%uint64(sb.size)]
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+// streamSubscriberBuffer is how many events a stream subscriber may fall behind
+// before it is disconnected; the client then resumes with Last-Event-ID
+const streamSubscriberBuffer = 256
+
+// StreamEvent is a numbered update delivered to Server-Sent Events clients
+type StreamEvent struct {
+	ID      uint64
+	Type    string
+	Payload interface{}
+}
+
+// StreamFilter restricts a stream subscription to devices and telemetry keys.
+// Empty lists match everything.
+type StreamFilter struct {
+	DeviceIDs []string
+	Keys      []string
+}
+
+// StreamSubscription receives the events matching its filter. Events is closed
+// when the subscriber is removed, could not keep up or the server shuts down.
+type StreamSubscription struct {
+	Events   chan StreamEvent
+	devices  map[string]bool
+	keys     map[string]bool
+	shutdown bool // set before Events is closed by Shutdown
+}
+
+// StreamManager fans telemetry and alarm updates out to Server-Sent Events
+// clients and keeps a bounded history so reconnecting clients can resume
+type StreamManager struct {
+	history           *sequenceBuffer
+	heartbeatInterval time.Duration
+	subscribers       map[*StreamSubscription]bool
+	closed            bool
+	mutex             sync.Mutex
+}
+
+// NewStreamManager creates a stream manager keeping streamConfig.BufferSize events for resume
+func NewStreamManager(streamConfig config.StreamConfig) *StreamManager {
+	return &StreamManager{
+		history:           newSequenceBuffer(streamConfig.BufferSize),
+		heartbeatInterval: streamConfig.HeartbeatInterval,
+		subscribers:       make(map[*StreamSubscription]bool),
+	}
+}
+
+// HeartbeatInterval returns how often idle streams receive a heartbeat comment
+func (sm *StreamManager) HeartbeatInterval() time.Duration {
+	return sm.heartbeatInterval
+}
+
+// BroadcastTelemetry publishes a telemetry update to matching subscribers
+func (sm *StreamManager) BroadcastTelemetry(telemetryData models.TelemetryData) {
+	sm.publish("telemetry_update", telemetryData)
+}
+
+// BroadcastAlarm publishes an alarm change to matching subscribers
+func (sm *StreamManager) BroadcastAlarm(alarm models.Alarm) {
+	sm.publish("alarm_update", alarm)
+}
+
+// Subscribe registers a subscriber. When resume is set, the events after
+// lastEventID that match the filter are returned; resumed is false if some of
+// them are no longer buffered (or the ID is unknown), in which case the
+// client should be sent a fresh snapshot instead.
+func (sm *StreamManager) Subscribe(filter StreamFilter, lastEventID uint64, resume bool) (subscription *StreamSubscription, missed []StreamEvent, resumed bool) {
+	subscription = &StreamSubscription{
+		Events:  make(chan StreamEvent, streamSubscriberBuffer),
+		devices: toSet(filter.DeviceIDs),
+		keys:    toSet(filter.Keys),
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if sm.closed {
+		subscription.shutdown = true
+		close(subscription.Events)
+		return subscription, nil, false
+	}
+	sm.subscribers[subscription] = true
+	if !resume {
+		return subscription, nil, false
+	}
+	events, ok := sm.history.since(lastEventID)
+	if !ok {
+		return subscription, nil, false
+	}
+	for _, event := range events {
+		if matched, ok := subscription.match(event); ok {
+			missed = append(missed, matched)
+		}
+	}
+	return subscription, missed, true
+}
+
+// Unsubscribe removes a subscriber and closes its event channel
+func (sm *StreamManager) Unsubscribe(subscription *StreamSubscription) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.removeLocked(subscription)
+}
+
+// Shutdown closes every subscription so that open streams end and the HTTP
+// server can shut down; later subscriptions are closed immediately
+func (sm *StreamManager) Shutdown() {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.closed = true
+	for subscription := range sm.subscribers {
+		subscription.shutdown = true
+		sm.removeLocked(subscription)
+	}
+}
+
+// ServerShutdown reports whether Events was closed because the server is
+// shutting down. It may be called once Events is closed.
+func (ss *StreamSubscription) ServerShutdown() bool {
+	return ss.shutdown
+}
+
+// GetConnectedClientsCount returns the number of connected stream clients
+func (sm *StreamManager) GetConnectedClientsCount() int {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return len(sm.subscribers)
+}
+
+// publish numbers an event, stores it for resume and delivers it without
+// blocking; subscribers whose buffer is full are disconnected
+func (sm *StreamManager) publish(eventType string, payload interface{}) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	event := sm.history.add(eventType, payload)
+	for subscription := range sm.subscribers {
+		matched, ok := subscription.match(event)
+		if !ok {
+			continue
+		}
+		select {
+		case subscription.Events <- matched:
+		default:
+			sm.removeLocked(subscription)
+		}
+	}
+}
+
+// removeLocked drops a subscriber. Caller must hold sm.mutex.
+func (sm *StreamManager) removeLocked(subscription *StreamSubscription) {
+	if sm.subscribers[subscription] {
+		delete(sm.subscribers, subscription)
+		close(subscription.Events)
+	}
+}
+
+// match applies the subscription filter to an event. Telemetry updates are
+// reduced to the filtered keys and skipped when none of them are present.
+func (ss *StreamSubscription) match(event StreamEvent) (StreamEvent, bool) {
+	switch payload := event.Payload.(type) {
+	case models.TelemetryData:
+		if len(ss.devices) > 0 && !ss.devices[payload.DeviceID] {
+			return event, false
+		}
+		if len(ss.keys) == 0 {
+			return event, true
+		}
+		values := make(map[string]interface{}, len(ss.keys))
+		for key, value := range payload.Values {
+			if ss.keys[key] {
+				values[key] = value
+			}
+		}
+		if len(values) == 0 {
+			return event, false
+		}
+		payload.Values = values
+		event.Payload = payload
+		return event, true
+
+	case models.Alarm:
+		if len(ss.devices) > 0 && !ss.devices[payload.DeviceID] {
+			return event, false
+		}
+		if len(ss.keys) > 0 && !ss.keys[payload.Key] {
+			return event, false
+		}
+		return event, true
+	}
+	return event, true
+}
+
+// toSet converts a list to a lookup map, returning nil for an empty list
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
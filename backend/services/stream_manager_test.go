@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+)
+
+func TestStreamManagerShutdownClosesSubscriptions(t *testing.T) {
+	sm := NewStreamManager(config.StreamConfig{BufferSize: 10, HeartbeatInterval: time.Second})
+	subscription, _, _ := sm.Subscribe(StreamFilter{}, 0, false)
+
+	sm.BroadcastTelemetry(models.TelemetryData{DeviceID: "device_001", Values: map[string]interface{}{"temperature": 21.5}})
+	sm.Shutdown()
+
+	if _, ok := <-subscription.Events; !ok {
+		t.Fatal("buffered event was dropped by the shutdown")
+	}
+	if _, ok := <-subscription.Events; ok {
+		t.Fatal("subscription still open after shutdown")
+	}
+	if !subscription.ServerShutdown() {
+		t.Error("ServerShutdown = false for a subscription closed by the shutdown")
+	}
+	if count := sm.GetConnectedClientsCount(); count != 0 {
+		t.Errorf("%d clients connected after shutdown", count)
+	}
+
+	late, _, _ := sm.Subscribe(StreamFilter{}, 0, false)
+	if _, ok := <-late.Events; ok || !late.ServerShutdown() {
+		t.Error("subscription after shutdown was not closed")
+	}
+	sm.Unsubscribe(late) // must not close the channel twice
+}
@@ -1,11 +1,16 @@
 package services
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"thingsboard-widget-backend/config"
 	"thingsboard-widget-backend/models"
 
 	"github.com/google/uuid"
@@ -17,37 +22,115 @@ type TelemetryBroadcaster interface {
 	BroadcastTelemetry(telemetryData models.TelemetryData)
 }
 
+// TelemetryListener is notified of every new live telemetry reading
+type TelemetryListener interface {
+	OnTelemetry(telemetryData models.TelemetryData)
+}
+
+// TelemetryEnricher derives values such as anomaly scores from a live reading.
+// They are stored with the reading and published as part of it.
+type TelemetryEnricher interface {
+	Enrich(telemetryData models.TelemetryData) map[string]interface{}
+}
+
+// defaultSimulationInterval is used when no interval is configured
+const defaultSimulationInterval = 5 * time.Second
+
+// electricityRate is the simulated flat electricity price in VND per kWh
+const electricityRate = 2500.0
+
+// electricityTariff is reported by the smart power meter as a JSON value
+var electricityTariff = json.RawMessage(`{"plan":"flat","rate":2500,"currency":"VND"}`)
+
+// entityNamespace is used to derive stable entity UUIDs for configured devices
+var entityNamespace = uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+
 // TelemetryService handles telemetry data generation and management
 type TelemetryService struct {
 	devices        map[string]*models.Device
-	keys           map[string]*models.TelemetryKey
+	profiles       map[string]*models.DeviceProfile
+	keys           map[string]*models.TelemetryKey // every profile key, with the widest range any profile allows
 	data           map[string][]models.TelemetryData
+	rollups        map[string]map[string]rollupSeries // device -> key -> tiers
+	virtual        map[string]bool                    // non-device entities with recorded series, e.g. assets
+	paused         map[string]bool                    // devices whose simulated reporting is disabled
+	retention      config.RetentionConfig
 	keyMappings    map[string]int       // String key -> Integer ID mapping
 	entityMappings map[string]uuid.UUID // Device ID -> Entity UUID mapping
 	mutex          sync.RWMutex
 	stop           chan bool
-	broadcaster    TelemetryBroadcaster
+	// Added before the simulation starts and read without the mutex
+	broadcasters   []TelemetryBroadcaster
+	listeners      []TelemetryListener
+	enrichers      []TelemetryEnricher
+	interval       time.Duration
+	intervalUpdate chan time.Duration
 }
 
-// NewTelemetryService creates a new telemetry service
-func NewTelemetryService() *TelemetryService {
+// NewTelemetryService creates a new telemetry service.
+// Devices listed in the configuration replace the built-in demo devices.
+func NewTelemetryService(cfg config.TelemetryConfig) *TelemetryService {
+	interval := cfg.SimulationInterval
+	if interval <= 0 {
+		interval = defaultSimulationInterval
+	}
+
 	service := &TelemetryService{
 		devices:        make(map[string]*models.Device),
+		profiles:       make(map[string]*models.DeviceProfile),
 		keys:           make(map[string]*models.TelemetryKey),
 		data:           make(map[string][]models.TelemetryData),
+		rollups:        make(map[string]map[string]rollupSeries),
+		virtual:        make(map[string]bool),
+		paused:         make(map[string]bool),
+		retention:      cfg.Retention,
 		keyMappings:    make(map[string]int),
 		entityMappings: make(map[string]uuid.UUID),
 		stop:           make(chan bool),
-		broadcaster:    nil,
+		interval:       interval,
+		intervalUpdate: make(chan time.Duration, 1),
 	}
 
 	// Initialize devices and telemetry keys
 	service.initializeDevices()
 	service.initializeKeyMappings()
 	service.initializeEntityMappings()
+	if len(cfg.Devices) > 0 {
+		service.applyDeviceConfig(cfg.Devices)
+	}
+	service.SetProfiles(cfg.Profiles)
 	return service
 }
 
+// applyDeviceConfig replaces the built-in devices with the configured ones
+func (ts *TelemetryService) applyDeviceConfig(devices []config.DeviceConfig) {
+	builtinDevices := ts.devices
+	builtinEntities := ts.entityMappings
+	ts.devices = make(map[string]*models.Device, len(devices))
+	ts.entityMappings = make(map[string]uuid.UUID, len(devices))
+
+	for _, dc := range devices {
+		device := dc.ToModel()
+		if device.Profile == "" {
+			if builtin, ok := builtinDevices[device.ID]; ok && builtin.Type == device.Type {
+				device.Profile = builtin.Profile
+			} else {
+				device.Profile = defaultProfileForType[device.Type]
+			}
+		}
+		ts.devices[device.ID] = &device
+
+		switch {
+		case dc.EntityID != "":
+			ts.entityMappings[device.ID] = uuid.MustParse(dc.EntityID)
+		case builtinEntities[device.ID] != uuid.Nil:
+			ts.entityMappings[device.ID] = builtinEntities[device.ID]
+		default:
+			ts.entityMappings[device.ID] = uuid.NewSHA1(entityNamespace, []byte(device.ID))
+		}
+	}
+}
+
 // initializeKeyMappings sets up mapping from string keys to integer IDs
 func (ts *TelemetryService) initializeKeyMappings() {
 	// Temperature and humidity keys
@@ -66,6 +149,10 @@ func (ts *TelemetryService) initializeKeyMappings() {
 	ts.keyMappings["flow_rate"] = 9
 	ts.keyMappings["total_volume"] = 10
 	ts.keyMappings["pump_status"] = 11
+	ts.keyMappings["pump_mode"] = 12
+
+	// Billing keys
+	ts.keyMappings["tariff"] = 13
 }
 
 // initializeEntityMappings sets up mapping from device IDs to entity UUIDs
@@ -77,7 +164,8 @@ func (ts *TelemetryService) initializeEntityMappings() {
 	ts.entityMappings["power_meter"] = uuid.MustParse("550e8400-e29b-41d4-a716-446655440005")
 }
 
-// initializeDevices sets up default devices and telemetry keys
+// initializeDevices sets up the default devices. Their keys are defined by
+// the device profiles they reference.
 func (ts *TelemetryService) initializeDevices() {
 	// Temperature Sensor
 	tempDevice := &models.Device{
@@ -85,14 +173,9 @@ func (ts *TelemetryService) initializeDevices() {
 		Name:     "Temperature Sensor 1",
 		Type:     "sensor",
 		Location: "Room A",
+		Profile:  "temperature_sensor",
 	}
 	ts.devices[tempDevice.ID] = tempDevice
-	ts.keys["temperature"] = &models.TelemetryKey{
-		Name: "temperature", Type: "numeric", Unit: "°C", MinValue: -10, MaxValue: 50,
-	}
-	ts.keys["humidity"] = &models.TelemetryKey{
-		Name: "humidity", Type: "numeric", Unit: "%", MinValue: 0, MaxValue: 100,
-	}
 
 	// Humidity Sensor
 	humidityDevice := &models.Device{
@@ -100,14 +183,9 @@ func (ts *TelemetryService) initializeDevices() {
 		Name:     "Humidity Sensor 1",
 		Type:     "sensor",
 		Location: "Room A",
+		Profile:  "humidity_sensor",
 	}
 	ts.devices[humidityDevice.ID] = humidityDevice
-	ts.keys["humidity"] = &models.TelemetryKey{
-		Name: "humidity", Type: "numeric", Unit: "%", MinValue: 0, MaxValue: 100,
-	}
-	ts.keys["pressure"] = &models.TelemetryKey{
-		Name: "pressure", Type: "numeric", Unit: "hPa", MinValue: 900, MaxValue: 1100,
-	}
 
 	// Power Meter
 	powerDevice := &models.Device{
@@ -115,20 +193,9 @@ func (ts *TelemetryService) initializeDevices() {
 		Name:     "Power Meter 1",
 		Type:     "meter",
 		Location: "Electrical Room",
+		Profile:  "power_meter",
 	}
 	ts.devices[powerDevice.ID] = powerDevice
-	ts.keys["voltage"] = &models.TelemetryKey{
-		Name: "voltage", Type: "numeric", Unit: "V", MinValue: 200, MaxValue: 250,
-	}
-	ts.keys["current"] = &models.TelemetryKey{
-		Name: "current", Type: "numeric", Unit: "A", MinValue: 0, MaxValue: 100,
-	}
-	ts.keys["power"] = &models.TelemetryKey{
-		Name: "power", Type: "numeric", Unit: "kW", MinValue: 0, MaxValue: 25,
-	}
-	ts.keys["energy"] = &models.TelemetryKey{
-		Name: "energy", Type: "numeric", Unit: "kWh", MinValue: 0, MaxValue: 1000000,
-	}
 
 	// Water Flow Sensor
 	waterDevice := &models.Device{
@@ -136,17 +203,9 @@ func (ts *TelemetryService) initializeDevices() {
 		Name:     "Water Flow Sensor 1",
 		Type:     "sensor",
 		Location: "Pump Station",
+		Profile:  "water_flow_sensor",
 	}
 	ts.devices[waterDevice.ID] = waterDevice
-	ts.keys["flow_rate"] = &models.TelemetryKey{
-		Name: "flow_rate", Type: "numeric", Unit: "L/min", MinValue: 0, MaxValue: 1000,
-	}
-	ts.keys["total_volume"] = &models.TelemetryKey{
-		Name: "total_volume", Type: "numeric", Unit: "L", MinValue: 0, MaxValue: 1000000,
-	}
-	ts.keys["pump_status"] = &models.TelemetryKey{
-		Name: "pump_status", Type: "boolean", Default: false,
-	}
 
 	// Smart Power Meter for Power Consumption Widget
 	smartPowerDevice := &models.Device{
@@ -154,36 +213,33 @@ func (ts *TelemetryService) initializeDevices() {
 		Name:     "Smart Power Meter",
 		Type:     "meter",
 		Location: "Main Panel",
+		Profile:  "smart_power_meter",
 	}
 	ts.devices[smartPowerDevice.ID] = smartPowerDevice
-	ts.keys["voltage"] = &models.TelemetryKey{
-		Name: "voltage", Type: "numeric", Unit: "V", MinValue: 220, MaxValue: 240,
-	}
-	ts.keys["current"] = &models.TelemetryKey{
-		Name: "current", Type: "numeric", Unit: "A", MinValue: 0, MaxValue: 50,
-	}
-	ts.keys["power"] = &models.TelemetryKey{
-		Name: "power", Type: "numeric", Unit: "kW", MinValue: 0, MaxValue: 5,
-	}
-	ts.keys["energy"] = &models.TelemetryKey{
-		Name: "energy", Type: "numeric", Unit: "kWh", MinValue: 0, MaxValue: 1000000,
-	}
-	ts.keys["cost"] = &models.TelemetryKey{
-		Name: "cost", Type: "numeric", Unit: "VND", MinValue: 0, MaxValue: 1000000,
-	}
 }
 
 // StartSimulation starts the telemetry data simulation
 func (ts *TelemetryService) StartSimulation() {
-	ticker := time.NewTicker(5 * time.Second)
+	ts.mutex.RLock()
+	interval := ts.interval
+	ts.mutex.RUnlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	retentionTicker := time.NewTicker(retentionCheckInterval)
+	defer retentionTicker.Stop()
 
-	logrus.Info("Starting telemetry simulation (5 second interval)")
+	logrus.Infof("Starting telemetry simulation (%s interval)", interval)
 
 	for {
 		select {
 		case <-ticker.C:
 			ts.generateTelemetryData()
+		case <-retentionTicker.C:
+			ts.enforceRetention()
+		case interval := <-ts.intervalUpdate:
+			ticker.Reset(interval)
+			logrus.Infof("Telemetry simulation interval changed to %s", interval)
 		case <-ts.stop:
 			logrus.Info("Stopping telemetry simulation")
 			return
@@ -191,44 +247,65 @@ func (ts *TelemetryService) StartSimulation() {
 	}
 }
 
+// SetSimulationInterval changes the simulation tick of a running simulation
+func (ts *TelemetryService) SetSimulationInterval(interval time.Duration) {
+	ts.mutex.Lock()
+	if interval == ts.interval {
+		ts.mutex.Unlock()
+		return
+	}
+	ts.interval = interval
+	ts.mutex.Unlock()
+
+	// Keep only the most recent pending update
+	select {
+	case <-ts.intervalUpdate:
+	default:
+	}
+	ts.intervalUpdate <- interval
+}
+
 // generateTelemetryData generates new telemetry data for all devices
 func (ts *TelemetryService) generateTelemetryData() {
 	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
-
 	now := time.Now()
+	generated := make([]models.TelemetryData, 0, len(ts.devices))
 
 	for deviceID, device := range ts.devices {
+		if ts.paused[deviceID] {
+			continue
+		}
 		values := make(map[string]interface{})
 
 		// Generate values based on device type
 		switch device.Type {
 		case "sensor":
-			if deviceID == "device_001" {
-				// Temperature and humidity sensor
-				values["temperature"] = ts.generateTemperature(now)
-				values["humidity"] = ts.generateHumidity(values["temperature"].(float64))
-			} else if deviceID == "device_002" {
+			switch deviceID {
+			case "device_002":
 				// Humidity and pressure sensor
 				values["humidity"] = 50.0 + rand.Float64()*20.0
 				values["pressure"] = ts.generatePressure()
-			} else if deviceID == "device_004" {
+			case "device_004":
 				// Water flow sensor
 				values["flow_rate"] = ts.generateFlowRate(now)
 				values["total_volume"] = ts.generateTotalVolume(deviceID, values["flow_rate"].(float64))
 				values["pump_status"] = ts.generatePumpStatus(now)
+				values["pump_mode"] = ts.generatePumpMode(values["pump_status"].(bool))
+			default:
+				// Temperature and humidity sensor
+				values["temperature"] = ts.generateTemperature(now)
+				values["humidity"] = ts.generateHumidity(values["temperature"].(float64))
 			}
 		case "meter":
-			if deviceID == "device_003" || deviceID == "power_meter" {
-				// Power meters
-				values["voltage"] = ts.generateVoltage()
-				values["current"] = ts.generateCurrent(now)
-				values["power"] = values["voltage"].(float64) * values["current"].(float64) / 1000.0
-				values["energy"] = ts.generateEnergy(deviceID, values["power"].(float64))
-
-				if deviceID == "power_meter" {
-					values["cost"] = values["energy"].(float64) * 2500.0
-				}
+			// Power meters
+			values["voltage"] = ts.generateVoltage()
+			values["current"] = ts.generateCurrent(now)
+			values["power"] = values["voltage"].(float64) * values["current"].(float64) / 1000.0
+			values["energy"] = ts.generateEnergy(deviceID, values["power"].(float64))
+
+			if deviceID == "power_meter" {
+				values["cost"] = values["energy"].(float64) * electricityRate
+				values["tariff"] = electricityTariff
 			}
 		}
 
@@ -239,20 +316,228 @@ func (ts *TelemetryService) generateTelemetryData() {
 			DeviceName: device.Name,
 			DeviceType: device.Type,
 			Location:   device.Location,
+			Profile:    device.Profile,
 		}
 
-		ts.data[deviceID] = append(ts.data[deviceID], telemetryData)
+		// Imported or recorded readings may already be stored at or after now
+		ts.storeLocked(telemetryData)
+
+		generated = append(generated, telemetryData)
+	}
+	ts.mutex.Unlock()
+
+	for _, telemetryData := range generated {
+		ts.publish(telemetryData)
+	}
+}
+
+// SetDeviceReporting enables or disables the simulated readings of a device,
+// as if it went offline. It reports whether the device exists.
+func (ts *TelemetryService) SetDeviceReporting(deviceID string, enabled bool) bool {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if _, exists := ts.devices[deviceID]; !exists {
+		return false
+	}
+	if enabled {
+		delete(ts.paused, deviceID)
+	} else {
+		ts.paused[deviceID] = true
+	}
+	return true
+}
+
+// IsReporting reports whether a device's simulated readings are enabled
+func (ts *TelemetryService) IsReporting(deviceID string) bool {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return !ts.paused[deviceID]
+}
+
+// RegisterVirtualEntity makes a non-device entity, such as an asset with
+// aggregated series, available to telemetry queries and subscriptions
+func (ts *TelemetryService) RegisterVirtualEntity(entityID string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.virtual[entityID] = true
+}
+
+// UnregisterVirtualEntity removes a virtual entity. Its stored readings expire with retention.
+func (ts *TelemetryService) UnregisterVirtualEntity(entityID string) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	delete(ts.virtual, entityID)
+}
+
+// RecordTelemetry stores a live reading of a virtual entity and publishes it
+// like device telemetry. A reading for the timestamp of the latest record is
+// combined into that record. Keys without an integer ID are assigned one.
+func (ts *TelemetryService) RecordTelemetry(telemetryData models.TelemetryData) {
+	ts.store(telemetryData)
+	ts.publish(telemetryData)
+}
+
+// store writes a live reading, combining it into the record of its timestamp
+func (ts *TelemetryService) store(telemetryData models.TelemetryData) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.storeLocked(telemetryData)
+}
+
+// storeLocked is store for callers holding ts.mutex. The records of an entity
+// stay sorted by timestamp, which range queries rely on.
+func (ts *TelemetryService) storeLocked(telemetryData models.TelemetryData) {
+	entityID := telemetryData.DeviceID
+	for key := range telemetryData.Values {
+		ts.ensureKeyIDLocked(key)
+	}
+	previous := ts.storedValuesLocked(entityID, telemetryData.Timestamp)
+	data := ts.data[entityID]
+	if n := len(data); n == 0 || !telemetryData.Timestamp.Before(data[n-1].Timestamp) {
+		ts.data[entityID] = appendOrCombine(data, telemetryData)
+	} else {
+		ts.data[entityID] = mergeTelemetry(data, []models.TelemetryData{telemetryData})
+	}
+	ts.rollupLocked(entityID, []models.TelemetryData{telemetryData}, []map[string]interface{}{previous})
+}
+
+// StoreHistorical writes readings into the store in timestamp order without
+// broadcasting them to live clients or listeners. Readings for a timestamp that
+// already exists are merged into the existing record, and every reading is
+// added to the rollup tiers, replacing the values it overwrites. It returns how many of the given readings were
+// already past their raw retention and are only kept as rollups.
+func (ts *TelemetryService) StoreHistorical(records []models.TelemetryData) int {
+	byDevice := make(map[string][]models.TelemetryData)
+	for _, record := range records {
+		byDevice[record.DeviceID] = append(byDevice[record.DeviceID], record)
+	}
 
-		// Keep only last 1000 data points per device
-		if len(ts.data[deviceID]) > 1000 {
-			ts.data[deviceID] = ts.data[deviceID][len(ts.data[deviceID])-1000:]
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	now := time.Now()
+	evicted := 0
+	for deviceID, incoming := range byDevice {
+		sort.SliceStable(incoming, func(i, j int) bool {
+			return incoming[i].Timestamp.Before(incoming[j].Timestamp)
+		})
+		previous := make([]map[string]interface{}, len(incoming))
+		for i, record := range incoming {
+			previous[i] = ts.storedValuesLocked(deviceID, record.Timestamp)
+		}
+		ts.data[deviceID] = mergeTelemetry(ts.data[deviceID], incoming)
+		ts.rollupLocked(deviceID, incoming, previous)
+
+		// Count readings none of whose values survive the raw retention
+		for _, record := range incoming {
+			expired := true
+			for key := range record.Values {
+				if !record.Timestamp.Before(now.Add(-ts.retentionRuleLocked(deviceID, key).raw)) {
+					expired = false
+					break
+				}
+			}
+			if expired {
+				evicted++
+			}
+		}
+		ts.expireRawLocked(deviceID, now)
+	}
+	return evicted
+}
+
+// storedValuesLocked returns the values stored for a device at exactly
+// timestamp, so that a reading overwriting them can replace them in the
+// rollups. Merging never modifies the returned map. Caller must hold ts.mutex.
+func (ts *TelemetryService) storedValuesLocked(deviceID string, timestamp time.Time) map[string]interface{} {
+	data := ts.data[deviceID]
+	i := sort.Search(len(data), func(i int) bool {
+		return !data[i].Timestamp.Before(timestamp)
+	})
+	if i == len(data) || !data[i].Timestamp.Equal(timestamp) {
+		return nil
+	}
+	return data[i].Values
+}
+
+// mergeTelemetry merges two timestamp-ordered slices. Records sharing a
+// timestamp are combined, with values from incoming taking precedence.
+func mergeTelemetry(existing, incoming []models.TelemetryData) []models.TelemetryData {
+	merged := make([]models.TelemetryData, 0, len(existing)+len(incoming))
+	i, j := 0, 0
+	for i < len(existing) || j < len(incoming) {
+		switch {
+		case j == len(incoming) || (i < len(existing) && existing[i].Timestamp.Before(incoming[j].Timestamp)):
+			merged = append(merged, existing[i])
+			i++
+		case i == len(existing) || incoming[j].Timestamp.Before(existing[i].Timestamp):
+			merged = appendOrCombine(merged, incoming[j])
+			j++
+		default:
+			merged = append(merged, existing[i])
+			i++
 		}
+	}
+	return merged
+}
 
-		// Broadcast telemetry data to WebSocket clients if broadcaster is available
-		if ts.broadcaster != nil {
-			ts.broadcaster.BroadcastTelemetry(telemetryData)
+// appendOrCombine appends a record, combining its values into the last record
+// if both share the same timestamp
+func appendOrCombine(data []models.TelemetryData, record models.TelemetryData) []models.TelemetryData {
+	if n := len(data); n > 0 && data[n-1].Timestamp.Equal(record.Timestamp) {
+		values := make(map[string]interface{}, len(data[n-1].Values)+len(record.Values))
+		for k, v := range data[n-1].Values {
+			values[k] = v
+		}
+		for k, v := range record.Values {
+			values[k] = v
 		}
+		data[n-1].Values = values
+		return data
 	}
+	return append(data, record)
+}
+
+// publish hands a live reading, with the values enrichers derive from it, to
+// all broadcasters and listeners. Must be called without holding ts.mutex.
+func (ts *TelemetryService) publish(telemetryData models.TelemetryData) {
+	telemetryData = ts.enrich(telemetryData)
+
+	// Broadcast telemetry data to WebSocket and SSE clients
+	for _, broadcaster := range ts.broadcasters {
+		broadcaster.BroadcastTelemetry(telemetryData)
+	}
+
+	for _, listener := range ts.listeners {
+		listener.OnTelemetry(telemetryData)
+	}
+}
+
+// enrich stores the values enrichers derive from a stored live reading and
+// returns the reading with them merged in
+func (ts *TelemetryService) enrich(telemetryData models.TelemetryData) models.TelemetryData {
+	derived := make(map[string]interface{})
+	for _, enricher := range ts.enrichers {
+		for key, value := range enricher.Enrich(telemetryData) {
+			derived[key] = value
+		}
+	}
+	if len(derived) == 0 {
+		return telemetryData
+	}
+
+	values := make(map[string]interface{}, len(telemetryData.Values)+len(derived))
+	for key, value := range telemetryData.Values {
+		values[key] = value
+	}
+	for key, value := range derived {
+		values[key] = value
+	}
+	telemetryData.Values = derived
+	ts.store(telemetryData)
+	telemetryData.Values = values
+	return telemetryData
 }
 
 // Helper methods for generating specific telemetry values
@@ -302,7 +587,7 @@ func (ts *TelemetryService) generateTotalVolume(deviceID string, flowRate float6
 			lastVolume = lastVal.(float64)
 		}
 	}
-	newVolume := lastVolume + flowRate/60.0 // Convert L/min to L/s
+	newVolume := lastVolume + flowRate*ts.interval.Minutes() // L/min over one tick
 	return math.Max(0, math.Min(1000000, newVolume))
 }
 
@@ -311,6 +596,13 @@ func (ts *TelemetryService) generatePumpStatus(now time.Time) bool {
 	return hour >= 6 && hour <= 22 // Pump runs from 6 AM to 10 PM
 }
 
+func (ts *TelemetryService) generatePumpMode(running bool) string {
+	if running {
+		return "auto"
+	}
+	return "idle"
+}
+
 func (ts *TelemetryService) generateEnergy(deviceID string, power float64) float64 {
 	lastEnergy := 0.0
 	if len(ts.data[deviceID]) > 0 {
@@ -318,7 +610,7 @@ func (ts *TelemetryService) generateEnergy(deviceID string, power float64) float
 			lastEnergy = lastVal.(float64)
 		}
 	}
-	newEnergy := lastEnergy + power/3600.0 // Convert kW to kWh (5 second interval)
+	newEnergy := lastEnergy + power*ts.interval.Hours() // kW over one tick gives kWh
 	return math.Max(0, math.Min(1000000, newEnergy))
 }
 
@@ -333,45 +625,152 @@ func (ts *TelemetryService) GetLatestTelemetry(deviceID string) (*models.Telemet
 	return nil, false
 }
 
-// GetTimeSeriesData returns historical telemetry data
+// PrepareTimeSeriesQuery validates the aggregation and gap-filling options of a
+// timeseries request. Fill without an aggregation buckets values by AVG.
+func (ts *TelemetryService) PrepareTimeSeriesQuery(request *models.TimeSeriesRequest) error {
+	request.Agg = strings.ToUpper(request.Agg)
+	request.Fill = strings.ToLower(request.Fill)
+	if !models.IsValidFill(request.Fill) {
+		return fmt.Errorf("unsupported fill mode %q (expected null, previous, linear or zero)", request.Fill)
+	}
+	if request.Agg == "" || request.Agg == models.AggregationNone {
+		request.Agg = models.AggregationNone
+		if request.Fill != models.FillNone {
+			request.Agg = models.AggregationAvg
+		}
+	}
+	if !models.IsValidAggregation(request.Agg) {
+		return fmt.Errorf("unsupported aggregation %q", request.Agg)
+	}
+	if request.Typed && (request.Agg != models.AggregationNone || request.StaleAfter > 0) {
+		return fmt.Errorf("agg, fill and staleAfter are not supported with typed responses")
+	}
+	if request.Agg != models.AggregationNone && request.Interval < minQueryInterval {
+		return fmt.Errorf("interval must be at least %d ms when aggregating", minQueryInterval)
+	}
+	if request.StaleAfter < 0 {
+		return fmt.Errorf("staleAfter must not be negative")
+	}
+	if request.StartTs > request.EndTs {
+		return fmt.Errorf("startTs must not be after endTs")
+	}
+	if request.Agg != models.AggregationNone {
+		return checkBucketCount(request.StartTs, request.EndTs, request.Interval)
+	}
+	return nil
+}
+
+// GetTimeSeriesData returns historical telemetry data. Untyped responses carry
+// numeric and boolean (as 0/1) keys in Data, optionally aggregated into
+// interval buckets with gap filling; typed responses carry every key with its
+// original value type in Series.
 func (ts *TelemetryService) GetTimeSeriesData(request models.TimeSeriesRequest) *models.TimeSeriesResponse {
 	ts.mutex.RLock()
 	defer ts.mutex.RUnlock()
 
 	response := &models.TimeSeriesResponse{
 		DeviceID: request.DeviceID,
-		Data:     make(map[string][][]float64),
+		Data:     make(map[string]models.SeriesPoints),
+	}
+	if request.Typed {
+		response.Series = make(map[string][]models.TimeSeriesPoint)
+		response.Types = make(map[string]string)
+	}
+
+	startTime := time.UnixMilli(request.StartTs)
+	endTime := time.UnixMilli(request.EndTs)
+
+	// Untyped series also read rollups for the part of the range past raw retention
+	if !request.Typed {
+		if !ts.hasSeriesLocked(request.DeviceID) {
+			return response
+		}
+		for _, key := range request.Keys {
+			points := ts.seriesLocked(request.DeviceID, key, startTime, endTime, request.Interval, request.Agg)
+			if gaps := seriesGaps(points, request.StartTs, request.EndTs, request.Interval, request.Agg, request.StaleAfter); len(gaps) > 0 {
+				if response.Gaps == nil {
+					response.Gaps = make(map[string][]models.Gap)
+				}
+				response.Gaps[key] = gaps
+			}
+			response.Data[key] = fillBuckets(points, request.StartTs, request.EndTs, request.Interval, request.Fill, request.StaleAfter)
+		}
+		return response
 	}
 
 	if data, exists := ts.data[request.DeviceID]; exists {
-		startTime := time.Unix(request.StartTs/1000, 0)
-		endTime := time.Unix(request.EndTs/1000, 0)
+		first := sort.Search(len(data), func(i int) bool {
+			return !data[i].Timestamp.Before(startTime)
+		})
 
 		for _, key := range request.Keys {
-			var keyData [][]float64
-			for _, record := range data {
-				if record.Timestamp.After(startTime) && record.Timestamp.Before(endTime) {
-					if value, exists := record.Values[key]; exists {
-						switch v := value.(type) {
-						case float64:
-							keyData = append(keyData, []float64{float64(record.Timestamp.UnixMilli()), v})
-						case bool:
-							if v {
-								keyData = append(keyData, []float64{float64(record.Timestamp.UnixMilli()), 1.0})
-							} else {
-								keyData = append(keyData, []float64{float64(record.Timestamp.UnixMilli()), 0.0})
-							}
-						}
-					}
+			var points []models.TimeSeriesPoint
+			for _, record := range data[first:] {
+				if record.Timestamp.After(endTime) {
+					break
+				}
+				if value, exists := record.Values[key]; exists {
+					points = append(points, models.TimeSeriesPoint{Ts: record.Timestamp.UnixMilli(), Value: value})
+					response.Types[key] = models.ValueType(value)
 				}
 			}
-			response.Data[key] = keyData
+			response.Series[key] = points
 		}
 	}
 
 	return response
 }
 
+// scanBatchSize is the number of readings copied per lock acquisition while scanning
+const scanBatchSize = 500
+
+// ScanTelemetry calls fn for every reading of a device with start <= timestamp <= end,
+// in timestamp order. Readings are copied in small batches so the store is not locked
+// while fn runs. Scanning stops at the first error returned by fn.
+func (ts *TelemetryService) ScanTelemetry(deviceID string, start, end time.Time, fn func(models.TelemetryData) error) error {
+	// The cursor is a timestamp and how many readings at that timestamp were
+	// already scanned, so readings sharing a timestamp across a batch
+	// boundary are neither skipped nor repeated
+	cursor := start
+	seen := 0
+
+	for {
+		ts.mutex.RLock()
+		data := ts.data[deviceID]
+		i := sort.Search(len(data), func(i int) bool {
+			return !data[i].Timestamp.Before(cursor)
+		})
+		for skip := seen; skip > 0 && i < len(data) && data[i].Timestamp.Equal(cursor); skip-- {
+			i++
+		}
+		batch := make([]models.TelemetryData, 0, scanBatchSize)
+		for ; i < len(data) && len(batch) < scanBatchSize; i++ {
+			if data[i].Timestamp.After(end) {
+				break
+			}
+			batch = append(batch, data[i])
+		}
+		ts.mutex.RUnlock()
+
+		for _, record := range batch {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < scanBatchSize {
+			return nil
+		}
+		last := batch[len(batch)-1].Timestamp
+		if !last.Equal(cursor) {
+			cursor, seen = last, 0
+		}
+		for j := len(batch) - 1; j >= 0 && batch[j].Timestamp.Equal(cursor); j-- {
+			seen++
+		}
+	}
+}
+
 // GetDevices returns all available devices
 func (ts *TelemetryService) GetDevices() []*models.Device {
 	ts.mutex.RLock()
@@ -393,6 +792,29 @@ func (ts *TelemetryService) GetDevice(deviceID string) (*models.Device, bool) {
 	return device, exists
 }
 
+// HasSeries reports whether telemetry can be queried for an entity: a device,
+// or a virtual entity with recorded readings
+func (ts *TelemetryService) HasSeries(entityID string) bool {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return ts.hasSeriesLocked(entityID)
+}
+
+// hasSeriesLocked implements HasSeries. Caller must hold ts.mutex.
+func (ts *TelemetryService) hasSeriesLocked(entityID string) bool {
+	_, isDevice := ts.devices[entityID]
+	return isDevice || ts.virtual[entityID]
+}
+
+// GetTelemetryKey returns the configuration of a telemetry key
+func (ts *TelemetryService) GetTelemetryKey(name string) (*models.TelemetryKey, bool) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	key, exists := ts.keys[name]
+	return key, exists
+}
+
 // GetKeyMappings returns the telemetry key mappings
 func (ts *TelemetryService) GetKeyMappings() map[string]int {
 	ts.mutex.RLock()
@@ -417,9 +839,19 @@ func (ts *TelemetryService) GetEntityMappings() map[string]uuid.UUID {
 	return mappings
 }
 
-// SetBroadcaster sets the telemetry broadcaster for broadcasting telemetry data
-func (ts *TelemetryService) SetBroadcaster(broadcaster TelemetryBroadcaster) {
-	ts.broadcaster = broadcaster
+// AddBroadcaster registers a broadcaster for live telemetry data
+func (ts *TelemetryService) AddBroadcaster(broadcaster TelemetryBroadcaster) {
+	ts.broadcasters = append(ts.broadcasters, broadcaster)
+}
+
+// AddListener registers a listener for live telemetry readings
+func (ts *TelemetryService) AddListener(listener TelemetryListener) {
+	ts.listeners = append(ts.listeners, listener)
+}
+
+// AddEnricher registers an enricher of live telemetry readings
+func (ts *TelemetryService) AddEnricher(enricher TelemetryEnricher) {
+	ts.enrichers = append(ts.enrichers, enricher)
 }
 
 // Stop stops the telemetry service
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/spf13/viper"
+)
+
+// newTestTelemetryService creates a telemetry service with the default
+// configuration: the built-in demo devices and profiles, without simulation
+func newTestTelemetryService(t *testing.T) *TelemetryService {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	return NewTelemetryService(cfg.Telemetry)
+}
+
+// testReadings returns readings of one key at the given timestamps (ms)
+func testReadings(deviceID, key string, timestamps ...int64) []models.TelemetryData {
+	readings := make([]models.TelemetryData, 0, len(timestamps))
+	for i, ts := range timestamps {
+		readings = append(readings, models.TelemetryData{
+			DeviceID:  deviceID,
+			Timestamp: time.UnixMilli(ts),
+			Values:    map[string]interface{}{key: float64(i)},
+		})
+	}
+	return readings
+}
+
+func TestScanTelemetryReadingsSharingTimestamps(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamps func() []int64
+	}{
+		{"groups across batch boundaries", func() []int64 {
+			var timestamps []int64
+			for i := 0; i < 3*scanBatchSize; i++ {
+				timestamps = append(timestamps, int64(1000+i/3))
+			}
+			return timestamps
+		}},
+		{"group longer than a batch", func() []int64 {
+			var timestamps []int64
+			for i := 0; i < 2*scanBatchSize+10; i++ {
+				timestamps = append(timestamps, 5000)
+			}
+			return append(timestamps, 5001, 5002)
+		}},
+		{"exactly one batch", func() []int64 {
+			var timestamps []int64
+			for i := 0; i < scanBatchSize; i++ {
+				timestamps = append(timestamps, int64(i))
+			}
+			return timestamps
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestTelemetryService(t)
+			timestamps := tt.timestamps()
+			ts.data["device_001"] = testReadings("device_001", "temperature", timestamps...)
+
+			var scanned []float64
+			err := ts.ScanTelemetry("device_001", time.UnixMilli(0), time.UnixMilli(1<<40), func(record models.TelemetryData) error {
+				scanned = append(scanned, record.Values["temperature"].(float64))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ScanTelemetry: %v", err)
+			}
+			if len(scanned) != len(timestamps) {
+				t.Fatalf("scanned %d readings, want %d", len(scanned), len(timestamps))
+			}
+			for i, value := range scanned {
+				if value != float64(i) {
+					t.Fatalf("reading %d has value %v, want %d (skipped or repeated)", i, value, i)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareTimeSeriesQueryRanges(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	day := 24 * time.Hour.Milliseconds()
+	tests := []struct {
+		name       string
+		start, end int64
+		interval   int64
+		agg        string
+		wantErr    string
+	}{
+		{"inverted range", 2 * day, day, 60000, models.AggregationAvg, "startTs must not be after endTs"},
+		{"inverted raw range", 2 * day, day, 60000, "", "startTs must not be after endTs"},
+		{"too many buckets", 0, 365 * day, 1000, models.AggregationAvg, "more than 10000 buckets"},
+		{"huge range", -1 << 62, 1 << 62, 1000, models.AggregationAvg, "more than 10000 buckets"},
+		{"raw points over a year", 0, 365 * day, 1000, "", ""},
+		{"exactly the bucket limit", 0, maxQueryBuckets*1000 - 1, 1000, models.AggregationAvg, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := models.TimeSeriesRequest{
+				DeviceID: "device_001",
+				Keys:     []string{"temperature"},
+				StartTs:  tt.start,
+				EndTs:    tt.end,
+				Interval: tt.interval,
+				Agg:      tt.agg,
+			}
+			checkError(t, ts.PrepareTimeSeriesQuery(&request), tt.wantErr)
+		})
+	}
+}
+
+// checkError fails unless err contains want, or is nil when want is empty
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+	switch {
+	case want == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+		t.Fatalf("error = %v, want one containing %q", err, want)
+	}
+}
+
+// telemetryRecorder collects the readings it is handed as a broadcaster and as a listener
+type telemetryRecorder struct {
+	broadcast []models.TelemetryData
+	received  []models.TelemetryData
+}
+
+func (tr *telemetryRecorder) BroadcastTelemetry(telemetryData models.TelemetryData) {
+	tr.broadcast = append(tr.broadcast, telemetryData)
+}
+
+func (tr *telemetryRecorder) OnTelemetry(telemetryData models.TelemetryData) {
+	tr.received = append(tr.received, telemetryData)
+}
+
+// fixedEnricher derives the same values from every reading
+type fixedEnricher map[string]interface{}
+
+func (fe fixedEnricher) Enrich(models.TelemetryData) map[string]interface{} {
+	return fe
+}
+
+func TestPublishEnrichesReadings(t *testing.T) {
+	ts := newTestTelemetryService(t)
+	recorder := &telemetryRecorder{}
+	ts.AddBroadcaster(recorder)
+	ts.AddListener(recorder)
+	ts.AddEnricher(fixedEnricher{"temperature_anomaly_zscore": 1.2})
+
+	now := time.Now().Truncate(time.Millisecond)
+	reading := models.TelemetryData{
+		DeviceID:   "device_001",
+		DeviceName: "Temperature Sensor 1",
+		Timestamp:  now,
+		Values:     map[string]interface{}{"temperature": 21.5, "humidity": 40.0},
+	}
+	ts.RecordTelemetry(reading)
+
+	// One reading carrying the derived values goes out
+	want := map[string]interface{}{"temperature": 21.5, "humidity": 40.0, "temperature_anomaly_zscore": 1.2}
+	if len(recorder.broadcast) != 1 || !reflect.DeepEqual(recorder.broadcast[0].Values, want) {
+		t.Errorf("broadcast %v, want one reading with values %v", recorder.broadcast, want)
+	} else if recorder.broadcast[0].DeviceName != reading.DeviceName {
+		t.Errorf("broadcast device name %q, want %q", recorder.broadcast[0].DeviceName, reading.DeviceName)
+	}
+	if len(recorder.received) != 1 || !reflect.DeepEqual(recorder.received[0].Values, want) {
+		t.Errorf("listeners got %v, want one reading with values %v", recorder.received, want)
+	}
+	if len(reading.Values) != 2 {
+		t.Errorf("source reading was modified: %v", reading.Values)
+	}
+
+	latest, ok := ts.GetLatestTelemetry("device_001")
+	if !ok || !reflect.DeepEqual(latest.Values, want) {
+		t.Errorf("latest telemetry %v, want values %v", latest, want)
+	}
+}
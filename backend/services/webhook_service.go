@@ -0,0 +1,457 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWebhookResponseBody bounds how much of a response body is read before the connection is reused
+const maxWebhookResponseBody = 64 * 1024
+
+// ErrWebhookTargetNotFound is returned when a dead letter's target is no longer configured
+var ErrWebhookTargetNotFound = errors.New("webhook target is no longer configured")
+
+// webhookDelivery is one event on its way to one target. The payload is
+// rendered once, so every attempt sends the same body.
+type webhookDelivery struct {
+	id      string
+	target  models.WebhookTarget
+	event   models.DeviceEvent
+	payload []byte
+	attempt int // attempts made so far
+}
+
+// WebhookService posts device events to the configured webhook targets,
+// retrying failed deliveries with exponential backoff. Deliveries that fail
+// every attempt are kept in a dead-letter queue and can be replayed.
+type WebhookService struct {
+	targets        []models.WebhookTarget
+	templates      map[string]*template.Template // target name -> parsed payload template
+	queue          chan *webhookDelivery
+	client         *http.Client
+	workers        int
+	attempts       []models.WebhookAttempt // delivery log, oldest first
+	logSize        int
+	deadLetters    []models.WebhookDeadLetter // oldest first
+	deadLetterSize int
+	mutex          sync.RWMutex
+}
+
+// NewWebhookService creates a webhook service; Start launches its delivery workers
+func NewWebhookService(cfg config.WebhooksConfig) *WebhookService {
+	service := &WebhookService{
+		queue:          make(chan *webhookDelivery, cfg.QueueSize),
+		client:         &http.Client{},
+		workers:        cfg.Workers,
+		logSize:        cfg.LogSize,
+		deadLetterSize: cfg.DeadLetterSize,
+	}
+	service.SetTargets(cfg.Targets)
+	return service
+}
+
+// SetTargets replaces the webhook targets. Deliveries already queued keep
+// the settings they were created with.
+func (ws *WebhookService) SetTargets(targets []models.WebhookTarget) {
+	templates := make(map[string]*template.Template, len(targets))
+	for _, target := range targets {
+		if target.Template == "" {
+			continue
+		}
+		// Templates are validated with the configuration
+		templates[target.Name] = template.Must(template.New(target.Name).Funcs(models.TemplateFuncs).Parse(target.Template))
+	}
+
+	ws.mutex.Lock()
+	ws.targets = append([]models.WebhookTarget(nil), targets...)
+	ws.templates = templates
+	ws.mutex.Unlock()
+	logrus.Infof("Loaded %d webhook targets", len(targets))
+}
+
+// Start launches the delivery workers
+func (ws *WebhookService) Start() {
+	for i := 0; i < ws.workers; i++ {
+		go func() {
+			for delivery := range ws.queue {
+				ws.attempt(delivery)
+			}
+		}()
+	}
+}
+
+// GetTargets returns the configured webhook targets; secrets are never serialized
+func (ws *WebhookService) GetTargets() []models.WebhookTarget {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+	return append([]models.WebhookTarget(nil), ws.targets...)
+}
+
+// BroadcastAlarm posts an alarm change. It implements AlarmBroadcaster.
+func (ws *WebhookService) BroadcastAlarm(alarm models.Alarm) {
+	ws.publish(models.DeviceEvent{
+		Type:       models.EventTypeAlarm,
+		DeviceID:   alarm.DeviceID,
+		DeviceName: alarm.DeviceName,
+		Alarm:      &alarm,
+	})
+}
+
+// OnConnectivity posts a connectivity change. It implements ConnectivityListener.
+func (ws *WebhookService) OnConnectivity(event models.ConnectivityEvent) {
+	ws.publish(models.DeviceEvent{
+		Type:         models.EventTypeConnectivity,
+		DeviceID:     event.DeviceID,
+		DeviceName:   event.DeviceName,
+		Connectivity: &event,
+	})
+}
+
+// OnRPCResult posts an RPC result. It implements RPCListener.
+func (ws *WebhookService) OnRPCResult(result models.RPCResult) {
+	ws.publish(models.DeviceEvent{
+		Type:       models.EventTypeRPC,
+		DeviceID:   result.DeviceID,
+		DeviceName: result.DeviceName,
+		RPC:        &result,
+	})
+}
+
+// OnAnomaly posts an anomaly event. It implements AnomalyListener.
+func (ws *WebhookService) OnAnomaly(event models.AnomalyEvent) {
+	ws.publish(models.DeviceEvent{
+		Type:       models.EventTypeAnomaly,
+		DeviceID:   event.DeviceID,
+		DeviceName: event.DeviceName,
+		Anomaly:    &event,
+	})
+}
+
+// Test sends a TEST event to one target and returns the delivery ID. It
+// reports whether the target exists.
+func (ws *WebhookService) Test(targetName string) (string, bool) {
+	ws.mutex.RLock()
+	target, exists := ws.targetLocked(targetName)
+	ws.mutex.RUnlock()
+	if !exists {
+		return "", false
+	}
+
+	delivery := ws.newDelivery(target, stampEvent(models.DeviceEvent{Type: models.EventTypeTest}))
+	return delivery.id, true
+}
+
+// publish queues an event for every target subscribed to its type
+func (ws *WebhookService) publish(event models.DeviceEvent) {
+	event = stampEvent(event)
+
+	ws.mutex.RLock()
+	var targets []models.WebhookTarget
+	for _, target := range ws.targets {
+		if target.Subscribes(event.Type) {
+			targets = append(targets, target)
+		}
+	}
+	ws.mutex.RUnlock()
+
+	for _, target := range targets {
+		ws.newDelivery(target, event)
+	}
+}
+
+// newDelivery renders the event for a target and queues it. Events that
+// cannot be rendered go straight to the dead-letter queue.
+func (ws *WebhookService) newDelivery(target models.WebhookTarget, event models.DeviceEvent) *webhookDelivery {
+	delivery := &webhookDelivery{
+		id:     uuid.New().String(),
+		target: target,
+		event:  event,
+	}
+
+	payload, err := ws.render(target.Name, event)
+	if err != nil {
+		ws.deadLetter(delivery, 0, fmt.Sprintf("rendering payload: %v", err))
+		return delivery
+	}
+	delivery.payload = payload
+	ws.enqueue(delivery)
+	return delivery
+}
+
+// render builds the request body from the target's template, or the event JSON without one
+func (ws *WebhookService) render(targetName string, event models.DeviceEvent) ([]byte, error) {
+	ws.mutex.RLock()
+	tmpl := ws.templates[targetName]
+	ws.mutex.RUnlock()
+
+	if tmpl == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// enqueue hands a delivery to the workers without blocking the event source
+func (ws *WebhookService) enqueue(delivery *webhookDelivery) {
+	select {
+	case ws.queue <- delivery:
+	default:
+		ws.deadLetter(delivery, 0, "delivery queue full")
+	}
+}
+
+// attempt posts a delivery once and records the outcome. Failures are retried
+// after an exponential backoff, except for client errors other than 408 and
+// 429, which would fail again.
+func (ws *WebhookService) attempt(delivery *webhookDelivery) {
+	delivery.attempt++
+	target := delivery.target
+	start := time.Now()
+	statusCode, err := ws.post(delivery)
+
+	record := models.WebhookAttempt{
+		DeliveryID: delivery.id,
+		Target:     target.Name,
+		EventID:    delivery.event.ID,
+		EventType:  delivery.event.Type,
+		DeviceID:   delivery.event.DeviceID,
+		Attempt:    delivery.attempt,
+		StatusCode: statusCode,
+		DurationMs: time.Since(start).Milliseconds(),
+		Timestamp:  start,
+	}
+
+	permanent := statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+	switch {
+	case err == nil:
+		record.Status = models.DeliveryStatusDelivered
+		ws.record(record)
+
+	case delivery.attempt < target.MaxAttempts && !permanent:
+		record.Status = models.DeliveryStatusRetrying
+		record.Error = err.Error()
+		ws.record(record)
+		backoff := webhookBackoff(target, delivery.attempt)
+		logrus.Warnf("Webhook %s delivery %s failed (attempt %d/%d), retrying in %s: %v",
+			target.Name, delivery.id, delivery.attempt, target.MaxAttempts, backoff, err)
+		time.AfterFunc(backoff, func() {
+			ws.enqueue(delivery)
+		})
+
+	default:
+		record.Status = models.DeliveryStatusFailed
+		record.Error = err.Error()
+		ws.record(record)
+		ws.deadLetter(delivery, statusCode, err.Error())
+	}
+}
+
+// post sends one HTTP request for a delivery and returns the response status
+func (ws *WebhookService) post(delivery *webhookDelivery) (int, error) {
+	target := delivery.target
+	ctx, cancel := context.WithTimeout(context.Background(), target.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range target.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", target.ContentType)
+	req.Header.Set("User-Agent", "thingsboard-widget-backend")
+	req.Header.Set("X-Webhook-Event", delivery.event.Type)
+	req.Header.Set("X-Webhook-Delivery", delivery.id)
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(delivery.attempt))
+	if target.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(target.Secret, timestamp, delivery.payload))
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// record appends an attempt to the delivery log, dropping the oldest above the log size
+func (ws *WebhookService) record(attempt models.WebhookAttempt) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	ws.attempts = append(ws.attempts, attempt)
+	if excess := len(ws.attempts) - ws.logSize; excess > 0 {
+		ws.attempts = append([]models.WebhookAttempt(nil), ws.attempts[excess:]...)
+	}
+}
+
+// deadLetter moves a failed delivery to the dead-letter queue, dropping the oldest above its size
+func (ws *WebhookService) deadLetter(delivery *webhookDelivery, statusCode int, reason string) {
+	logrus.Errorf("Webhook %s delivery %s moved to the dead-letter queue: %s", delivery.target.Name, delivery.id, reason)
+
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	ws.deadLetters = append(ws.deadLetters, models.WebhookDeadLetter{
+		DeliveryID:     delivery.id,
+		Target:         delivery.target.Name,
+		Event:          delivery.event,
+		Payload:        string(delivery.payload),
+		Attempts:       delivery.attempt,
+		LastStatusCode: statusCode,
+		LastError:      reason,
+		FailedAt:       time.Now(),
+	})
+	if excess := len(ws.deadLetters) - ws.deadLetterSize; excess > 0 {
+		ws.deadLetters = append([]models.WebhookDeadLetter(nil), ws.deadLetters[excess:]...)
+	}
+}
+
+// GetDeliveries returns the delivery log newest first, optionally filtered by
+// target, status and delivery ID
+func (ws *WebhookService) GetDeliveries(target, status, deliveryID string) []models.WebhookAttempt {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+
+	attempts := []models.WebhookAttempt{}
+	for i := len(ws.attempts) - 1; i >= 0; i-- {
+		attempt := ws.attempts[i]
+		if (target != "" && attempt.Target != target) ||
+			(status != "" && attempt.Status != status) ||
+			(deliveryID != "" && attempt.DeliveryID != deliveryID) {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts
+}
+
+// GetDeadLetters returns the dead-letter queue newest first, optionally filtered by target
+func (ws *WebhookService) GetDeadLetters(target string) []models.WebhookDeadLetter {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+
+	deadLetters := []models.WebhookDeadLetter{}
+	for i := len(ws.deadLetters) - 1; i >= 0; i-- {
+		if target != "" && ws.deadLetters[i].Target != target {
+			continue
+		}
+		deadLetters = append(deadLetters, ws.deadLetters[i])
+	}
+	return deadLetters
+}
+
+// RetryDeadLetter removes a dead letter and delivers its event again with the
+// target's current settings, starting over with the first attempt. It
+// reports whether the dead letter exists.
+func (ws *WebhookService) RetryDeadLetter(deliveryID string) (bool, error) {
+	ws.mutex.Lock()
+	index := ws.deadLetterIndexLocked(deliveryID)
+	if index < 0 {
+		ws.mutex.Unlock()
+		return false, nil
+	}
+	deadLetter := ws.deadLetters[index]
+	target, exists := ws.targetLocked(deadLetter.Target)
+	if !exists {
+		ws.mutex.Unlock()
+		return true, ErrWebhookTargetNotFound
+	}
+	ws.deadLetters = append(ws.deadLetters[:index:index], ws.deadLetters[index+1:]...)
+	ws.mutex.Unlock()
+
+	ws.newDelivery(target, deadLetter.Event)
+	return true, nil
+}
+
+// DeleteDeadLetter discards a dead letter. It reports whether it existed.
+func (ws *WebhookService) DeleteDeadLetter(deliveryID string) bool {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	index := ws.deadLetterIndexLocked(deliveryID)
+	if index < 0 {
+		return false
+	}
+	ws.deadLetters = append(ws.deadLetters[:index:index], ws.deadLetters[index+1:]...)
+	return true
+}
+
+// deadLetterIndexLocked returns the position of a dead letter, or -1. Caller must hold ws.mutex.
+func (ws *WebhookService) deadLetterIndexLocked(deliveryID string) int {
+	for i, deadLetter := range ws.deadLetters {
+		if deadLetter.DeliveryID == deliveryID {
+			return i
+		}
+	}
+	return -1
+}
+
+// targetLocked returns a configured target by name. Caller must hold ws.mutex.
+func (ws *WebhookService) targetLocked(name string) (models.WebhookTarget, bool) {
+	for _, target := range ws.targets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return models.WebhookTarget{}, false
+}
+
+// stampEvent assigns an event its ID and timestamp
+func stampEvent(event models.DeviceEvent) models.DeviceEvent {
+	event.ID = uuid.New().String()
+	event.Timestamp = time.Now()
+	return event
+}
+
+// webhookBackoff returns the delay before the attempt following the given
+// one: the initial backoff doubled per failed attempt, capped at the maximum
+func webhookBackoff(target models.WebhookTarget, attempt int) time.Duration {
+	backoff := target.InitialBackoff
+	for i := 1; i < attempt && backoff < target.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > target.MaxBackoff {
+		backoff = target.MaxBackoff
+	}
+	return backoff
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<payload>"
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/spf13/viper"
+)
+
+// webhookRequest is a request received by a test webhook endpoint
+type webhookRequest struct {
+	header   http.Header
+	body     []byte
+	received time.Time
+}
+
+// webhookEndpoint records requests and answers them with respond
+type webhookEndpoint struct {
+	respond  func(attempt int, w http.ResponseWriter, r *http.Request)
+	requests []webhookRequest
+	mutex    sync.Mutex
+}
+
+func (we *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	we.mutex.Lock()
+	we.requests = append(we.requests, webhookRequest{header: r.Header.Clone(), body: body, received: time.Now()})
+	attempt := len(we.requests)
+	we.mutex.Unlock()
+	we.respond(attempt, w, r)
+}
+
+// received returns the requests received so far
+func (we *webhookEndpoint) received() []webhookRequest {
+	we.mutex.Lock()
+	defer we.mutex.Unlock()
+	return append([]webhookRequest(nil), we.requests...)
+}
+
+// newTestWebhookService starts a webhook service posting to one target served
+// by endpoint, with short backoffs
+func newTestWebhookService(t *testing.T, endpoint *webhookEndpoint, configure func(*models.WebhookTarget)) *WebhookService {
+	t.Helper()
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	target := models.WebhookTarget{
+		Name:           "hooks",
+		URL:            server.URL,
+		ContentType:    "application/json",
+		MaxAttempts:    3,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		Timeout:        time.Second,
+	}
+	if configure != nil {
+		configure(&target)
+	}
+	cfg.Webhooks.Targets = []models.WebhookTarget{target}
+	ws := NewWebhookService(cfg.Webhooks)
+	ws.Start()
+	return ws
+}
+
+// waitForAttempts waits until the delivery log holds an attempt with the given status
+func waitForAttempts(t *testing.T, ws *WebhookService, status string) []models.WebhookAttempt {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(ws.GetDeliveries("", status, "")) > 0 {
+			return ws.GetDeliveries("", "", "")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no %s attempt after 2s, got %+v", status, ws.GetDeliveries("", "", ""))
+	return nil
+}
+
+// attemptStatuses returns the statuses of a delivery log, oldest first
+func attemptStatuses(attempts []models.WebhookAttempt) []string {
+	statuses := make([]string, 0, len(attempts))
+	for i := len(attempts) - 1; i >= 0; i-- {
+		statuses = append(statuses, attempts[i].Status)
+	}
+	return statuses
+}
+
+func TestWebhookSignsPayload(t *testing.T) {
+	endpoint := &webhookEndpoint{respond: func(int, http.ResponseWriter, *http.Request) {}}
+	ws := newTestWebhookService(t, endpoint, func(target *models.WebhookTarget) {
+		target.Secret = "s3cret"
+		target.Headers = map[string]string{"Authorization": "Bearer token"}
+	})
+
+	before := time.Now().Unix()
+	deliveryID, ok := ws.Test("hooks")
+	if !ok {
+		t.Fatal("Test did not find the target")
+	}
+	waitForAttempts(t, ws, models.DeliveryStatusDelivered)
+
+	requests := endpoint.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	header := requests[0].header
+	timestamp := header.Get("X-Webhook-Timestamp")
+	if unix, err := strconv.ParseInt(timestamp, 10, 64); err != nil || unix < before || unix > time.Now().Unix() {
+		t.Errorf("got timestamp %q, want the sending time", timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + string(requests[0].body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-Webhook-Signature") != want {
+		t.Errorf("got signature %q, want %q", header.Get("X-Webhook-Signature"), want)
+	}
+	if header.Get("X-Webhook-Delivery") != deliveryID || header.Get("X-Webhook-Event") != models.EventTypeTest ||
+		header.Get("Authorization") != "Bearer token" {
+		t.Errorf("got headers %v, want the delivery, event and configured headers", header)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}},
+		{"too many requests", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := &webhookEndpoint{respond: func(attempt int, w http.ResponseWriter, r *http.Request) {
+				if attempt < 3 {
+					tt.fail(w, r)
+				}
+			}}
+			ws := newTestWebhookService(t, endpoint, func(target *models.WebhookTarget) {
+				target.Timeout = 50 * time.Millisecond
+			})
+			ws.Test("hooks")
+			attempts := waitForAttempts(t, ws, models.DeliveryStatusDelivered)
+
+			want := []string{models.DeliveryStatusRetrying, models.DeliveryStatusRetrying, models.DeliveryStatusDelivered}
+			if got := attemptStatuses(attempts); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+				t.Fatalf("got attempts %v, want %v", got, want)
+			}
+
+			// The backoff doubles from 20ms after every failure
+			requests := endpoint.received()
+			for i, backoff := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+				if header := requests[i+1].header.Get("X-Webhook-Attempt"); header != strconv.Itoa(i+2) {
+					t.Errorf("request %d has attempt %q, want %d", i+1, header, i+2)
+				}
+				if gap := requests[i+1].received.Sub(requests[i].received); gap < backoff {
+					t.Errorf("attempt %d followed after %s, want at least %s", i+2, gap, backoff)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	target := models.WebhookTarget{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := webhookBackoff(target, attempt); got != want {
+			t.Errorf("webhookBackoff after attempt %d = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	t.Run("attempts exhausted", func(t *testing.T) {
+		var healthy bool
+		var mutex sync.Mutex
+		endpoint := &webhookEndpoint{respond: func(_ int, w http.ResponseWriter, _ *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !healthy {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}}
+		ws := newTestWebhookService(t, endpoint, nil)
+		deliveryID, _ := ws.Test("hooks")
+		attempts := waitForAttempts(t, ws, models.DeliveryStatusFailed)
+
+		if len(attempts) != 3 || len(endpoint.received()) != 3 {
+			t.Fatalf("got %d attempts and %d requests, want 3", len(attempts), len(endpoint.received()))
+		}
+		deadLetters := ws.GetDeadLetters("hooks")
+		if len(deadLetters) != 1 {
+			t.Fatalf("got %d dead letters, want 1", len(deadLetters))
+		}
+		deadLetter := deadLetters[0]
+		if deadLetter.DeliveryID != deliveryID || deadLetter.Attempts != 3 || deadLetter.LastStatusCode != http.StatusBadGateway ||
+			deadLetter.Payload != string(endpoint.received()[2].body) {
+			t.Errorf("got dead letter %+v, want 3 attempts ending with 502 and the posted payload", deadLetter)
+		}
+
+		// Replaying starts a new delivery of the same event
+		mutex.Lock()
+		healthy = true
+		mutex.Unlock()
+		if exists, err := ws.RetryDeadLetter(deliveryID); !exists || err != nil {
+			t.Fatalf("RetryDeadLetter: %v, %v", exists, err)
+		}
+		waitForAttempts(t, ws, models.DeliveryStatusDelivered)
+		if deadLetters := ws.GetDeadLetters(""); len(deadLetters) != 0 {
+			t.Errorf("got dead letters %+v after a successful replay", deadLetters)
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		endpoint := &webhookEndpoint{respond: func(_ int, w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}}
+		ws := newTestWebhookService(t, endpoint, nil)
+		ws.Test("hooks")
+		attempts := waitForAttempts(t, ws, models.DeliveryStatusFailed)
+
+		// A client error would fail again, so it is not retried
+		if len(attempts) != 1 {
+			t.Fatalf("got %d attempts, want 1", len(attempts))
+		}
+		if deadLetters := ws.GetDeadLetters(""); len(deadLetters) != 1 || deadLetters[0].LastStatusCode != http.StatusUnauthorized {
+			t.Errorf("got dead letters %+v, want one ending with 401", deadLetters)
+		}
+	})
+}
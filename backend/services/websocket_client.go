@@ -0,0 +1,434 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// Reasons a WebSocket connection ended, reported in logs and metrics
+const (
+	disconnectClientClosed   = "client_closed"
+	disconnectPongTimeout    = "pong_timeout"
+	disconnectIdleTimeout    = "idle_timeout"
+	disconnectMessageTooBig  = "message_too_large"
+	disconnectWriteError     = "write_error"
+	disconnectReadError      = "read_error"
+	disconnectResumeFailed   = "resume_failed"
+	disconnectServerShutdown = "server_shutdown"
+)
+
+// wsClient is a connected WebSocket client. Writes from the broadcast loop and
+// the client's own goroutine are serialized by writeMutex.
+type wsClient struct {
+	id           uint64
+	conn         *websocket.Conn
+	remoteAddr   string
+	encoding     string
+	delta        bool
+	connectedAt  time.Time
+	writeTimeout time.Duration
+	metrics      *wsMetrics
+
+	writeMutex   sync.Mutex
+	lastSeq      uint64                            // highest sequence number sent to the client
+	resuming     bool                              // broadcasts are held until the resume replay is written
+	held         []models.WebSocketMessage         // broadcasts held while resuming
+	devices      map[string]map[string]interface{} // delta mode: device ID -> values the client has
+	messagesSent uint64
+	bytesSent    uint64
+
+	subscriptions      []*wsSubscription // in subscription order
+	nextSubscriptionID int
+
+	activityMutex    sync.Mutex
+	lastActivity     time.Time // last message or pong received
+	lastMessage      time.Time // last message received, pongs do not count as activity for the idle timeout
+	messagesReceived uint64
+
+	closeOnce   sync.Once
+	closeReason string
+	done        chan struct{}
+}
+
+// send writes a message, skipping broadcasts the client already received and
+// holding back broadcasts while the client resumes
+func (wc *wsClient) send(message models.WebSocketMessage) error {
+	wc.writeMutex.Lock()
+	defer wc.writeMutex.Unlock()
+	if wc.resuming && message.Seq != 0 {
+		wc.held = append(wc.held, message)
+		return nil
+	}
+	return wc.sendLocked(message)
+}
+
+// sendLocked is send for callers holding wc.writeMutex
+func (wc *wsClient) sendLocked(message models.WebSocketMessage) error {
+	if message.Seq != 0 {
+		if message.Seq <= wc.lastSeq {
+			return nil
+		}
+		wc.lastSeq = message.Seq
+	}
+	if telemetryData, ok := message.Payload.(models.TelemetryData); ok && message.Type == "telemetry_update" && len(wc.subscriptions) > 0 {
+		return wc.routeLocked(message, telemetryData)
+	}
+	return wc.writeLocked(message)
+}
+
+// routeLocked delivers a telemetry update to a client with subscriptions: the
+// raw update once if a subscription without options selects the device, and a
+// subscription_update for every subscription with options that lets it
+// through. Devices without subscriptions are skipped. Caller must hold wc.writeMutex.
+func (wc *wsClient) routeLocked(message models.WebSocketMessage, telemetryData models.TelemetryData) error {
+	raw := false
+	for _, subscription := range wc.subscriptions {
+		if subscription.options.DeviceID != telemetryData.DeviceID {
+			continue
+		}
+		if subscription.raw() {
+			raw = true
+			continue
+		}
+		values, ok := subscription.apply(telemetryData)
+		if !ok {
+			continue
+		}
+		update := models.WebSocketMessage{
+			Type: "subscription_update",
+			Seq:  message.Seq,
+			Payload: models.SubscriptionUpdate{
+				SubscriptionID: subscription.options.SubscriptionID,
+				DeviceID:       telemetryData.DeviceID,
+				Timestamp:      telemetryData.Timestamp,
+				Values:         values,
+			},
+		}
+		if err := wc.writeLocked(update); err != nil {
+			return err
+		}
+	}
+	if raw {
+		return wc.writeLocked(message)
+	}
+	return nil
+}
+
+// writeLocked encodes and writes a message, reducing telemetry updates to
+// deltas in delta mode. Caller must hold wc.writeMutex.
+func (wc *wsClient) writeLocked(message models.WebSocketMessage) error {
+	if wc.delta {
+		var changed bool
+		if message, changed = wc.deltaLocked(message); !changed {
+			return nil
+		}
+	}
+
+	frameType, data, err := encodeMessage(wc.encoding, message)
+	if err != nil {
+		return err
+	}
+	wc.conn.SetWriteDeadline(time.Now().Add(wc.writeTimeout))
+	if err := wc.conn.WriteMessage(frameType, data); err != nil {
+		if !wc.closed() {
+			wc.metrics.writeFailed()
+		}
+		return err
+	}
+	wc.messagesSent++
+	wc.bytesSent += uint64(len(data))
+	wc.metrics.sent(len(data))
+	return nil
+}
+
+// subscribe adds a subscription, replacing one with the same ID, and returns its ID
+func (wc *wsClient) subscribe(options models.WebSocketSubscription) (string, error) {
+	subscription, err := newWSSubscription(options)
+	if err != nil {
+		return "", err
+	}
+
+	wc.writeMutex.Lock()
+	defer wc.writeMutex.Unlock()
+
+	if subscription.options.SubscriptionID == "" {
+		wc.nextSubscriptionID++
+		subscription.options.SubscriptionID = fmt.Sprintf("sub-%d", wc.nextSubscriptionID)
+	}
+	for i, existing := range wc.subscriptions {
+		if existing.options.SubscriptionID == subscription.options.SubscriptionID {
+			wc.subscriptions[i] = subscription
+			return subscription.options.SubscriptionID, nil
+		}
+	}
+	wc.subscriptions = append(wc.subscriptions, subscription)
+	return subscription.options.SubscriptionID, nil
+}
+
+// unsubscribe removes the subscription with the ID, or all subscriptions to
+// the device, and returns how many were removed
+func (wc *wsClient) unsubscribe(subscriptionID, deviceID string) int {
+	wc.writeMutex.Lock()
+	defer wc.writeMutex.Unlock()
+
+	kept := wc.subscriptions[:0]
+	for _, subscription := range wc.subscriptions {
+		if (subscriptionID != "" && subscription.options.SubscriptionID == subscriptionID) ||
+			(subscriptionID == "" && subscription.options.DeviceID == deviceID) {
+			continue
+		}
+		kept = append(kept, subscription)
+	}
+	removed := len(wc.subscriptions) - len(kept)
+	wc.subscriptions = kept
+	return removed
+}
+
+// ping sends a protocol-level ping. WriteControl may be called concurrently
+// with the other write methods, so the write mutex is not needed.
+func (wc *wsClient) ping() error {
+	err := wc.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wc.writeTimeout))
+	if err != nil {
+		if !wc.closed() {
+			wc.metrics.writeFailed()
+		}
+		return err
+	}
+	wc.metrics.pinged()
+	return nil
+}
+
+// touch records activity from the client, extending the read deadline
+func (wc *wsClient) touch(readTimeout time.Duration, message bool) {
+	now := time.Now()
+	wc.conn.SetReadDeadline(now.Add(readTimeout))
+
+	wc.activityMutex.Lock()
+	wc.lastActivity = now
+	if message {
+		wc.lastMessage = now
+		wc.messagesReceived++
+	}
+	wc.activityMutex.Unlock()
+	if message {
+		wc.metrics.received()
+	}
+}
+
+// idleSince returns when the client last sent a message
+func (wc *wsClient) idleSince() time.Time {
+	wc.activityMutex.Lock()
+	defer wc.activityMutex.Unlock()
+	return wc.lastMessage
+}
+
+// close closes the connection once, recording why. A close frame is sent on a
+// best-effort basis for reasons decided by the server.
+func (wc *wsClient) close(reason string, closeCode int) {
+	wc.closeOnce.Do(func() {
+		wc.closeReason = reason
+		if closeCode != 0 {
+			message := websocket.FormatCloseMessage(closeCode, reason)
+			wc.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wc.writeTimeout))
+		}
+		wc.conn.Close()
+		close(wc.done)
+	})
+}
+
+// closed reports whether the connection was already closed, so failed writes
+// racing with the close are not counted as write errors
+func (wc *wsClient) closed() bool {
+	select {
+	case <-wc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// readErrorReason classifies the error that ended the read loop
+func readErrorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		return disconnectMessageTooBig
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived):
+		return disconnectClientClosed
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return disconnectPongTimeout
+	}
+	return disconnectReadError
+}
+
+// logFields identifies the client in lifecycle log entries
+func (wc *wsClient) logFields() logrus.Fields {
+	return logrus.Fields{
+		"client":   wc.id,
+		"remote":   wc.remoteAddr,
+		"encoding": wc.encoding,
+		"delta":    wc.delta,
+	}
+}
+
+// info describes the client for the metrics endpoint
+func (wc *wsClient) info() models.WebSocketClientInfo {
+	wc.writeMutex.Lock()
+	messagesSent, bytesSent := wc.messagesSent, wc.bytesSent
+	wc.writeMutex.Unlock()
+
+	wc.activityMutex.Lock()
+	lastActivity, messagesReceived := wc.lastActivity, wc.messagesReceived
+	wc.activityMutex.Unlock()
+
+	return models.WebSocketClientInfo{
+		ID:               wc.id,
+		RemoteAddr:       wc.remoteAddr,
+		Encoding:         wc.encoding,
+		Delta:            wc.delta,
+		ConnectedAt:      wc.connectedAt,
+		LastActivity:     lastActivity,
+		MessagesSent:     messagesSent,
+		MessagesReceived: messagesReceived,
+		BytesSent:        bytesSent,
+	}
+}
+
+// deltaLocked reduces a telemetry update to the keys whose value changed and
+// records what the client has seen. changed is false when nothing changed and
+// the update can be skipped. Caller must hold wc.writeMutex.
+func (wc *wsClient) deltaLocked(message models.WebSocketMessage) (models.WebSocketMessage, bool) {
+	switch payload := message.Payload.(type) {
+	case models.TelemetryData:
+		if message.Type != "telemetry_update" {
+			wc.remember(payload)
+			return message, true
+		}
+		previous, seen := wc.devices[payload.DeviceID]
+		delta := models.TelemetryDelta{
+			DeviceID:  payload.DeviceID,
+			Timestamp: payload.Timestamp,
+			Values:    make(map[string]interface{}),
+		}
+		if !seen {
+			delta.DeviceName = payload.DeviceName
+			delta.DeviceType = payload.DeviceType
+			delta.Location = payload.Location
+			previous = make(map[string]interface{}, len(payload.Values))
+			wc.devices[payload.DeviceID] = previous
+		}
+		for key, value := range payload.Values {
+			if old, ok := previous[key]; ok && reflect.DeepEqual(old, value) {
+				continue
+			}
+			delta.Values[key] = value
+			previous[key] = value
+		}
+		if seen && len(delta.Values) == 0 {
+			return message, false
+		}
+		message.Payload = delta
+		return message, true
+
+	case *models.TelemetryData:
+		wc.remember(*payload)
+
+	case models.WebSocketSnapshot:
+		wc.devices = make(map[string]map[string]interface{}, len(payload.Telemetry))
+		for _, telemetryData := range payload.Telemetry {
+			wc.remember(telemetryData)
+		}
+	}
+	return message, true
+}
+
+// remember records a full telemetry reading sent to a delta mode client
+func (wc *wsClient) remember(telemetryData models.TelemetryData) {
+	values := make(map[string]interface{}, len(telemetryData.Values))
+	for key, value := range telemetryData.Values {
+		values[key] = value
+	}
+	wc.devices[telemetryData.DeviceID] = values
+}
+
+// wsMetrics counts WebSocket connection lifecycle events and traffic
+type wsMetrics struct {
+	mutex            sync.Mutex
+	totalConnections uint64
+	disconnects      map[string]uint64
+	messagesSent     uint64
+	messagesReceived uint64
+	bytesSent        uint64
+	pingsSent        uint64
+	writeErrors      uint64
+}
+
+func newWSMetrics() *wsMetrics {
+	return &wsMetrics{disconnects: make(map[string]uint64)}
+}
+
+func (m *wsMetrics) connected() {
+	m.mutex.Lock()
+	m.totalConnections++
+	m.mutex.Unlock()
+}
+
+func (m *wsMetrics) disconnected(reason string) {
+	m.mutex.Lock()
+	m.disconnects[reason]++
+	m.mutex.Unlock()
+}
+
+func (m *wsMetrics) sent(bytes int) {
+	m.mutex.Lock()
+	m.messagesSent++
+	m.bytesSent += uint64(bytes)
+	m.mutex.Unlock()
+}
+
+func (m *wsMetrics) received() {
+	m.mutex.Lock()
+	m.messagesReceived++
+	m.mutex.Unlock()
+}
+
+func (m *wsMetrics) pinged() {
+	m.mutex.Lock()
+	m.pingsSent++
+	m.mutex.Unlock()
+}
+
+func (m *wsMetrics) writeFailed() {
+	m.mutex.Lock()
+	m.writeErrors++
+	m.mutex.Unlock()
+}
+
+// snapshot copies the counters into the metrics model
+func (m *wsMetrics) snapshot() models.WebSocketMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	disconnects := make(map[string]uint64, len(m.disconnects))
+	for reason, count := range m.disconnects {
+		disconnects[reason] = count
+	}
+	return models.WebSocketMetrics{
+		TotalConnections: m.totalConnections,
+		Disconnects:      disconnects,
+		MessagesSent:     m.messagesSent,
+		MessagesReceived: m.messagesReceived,
+		BytesSent:        m.bytesSent,
+		PingsSent:        m.pingsSent,
+		WriteErrors:      m.writeErrors,
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// startTestWebSocketServer runs a manager behind a test server, pinging every
+// 20ms and giving up on clients silent for 100ms, and dials one client
+func startTestWebSocketServer(t *testing.T, configure func(*config.WebSocketConfig)) (*WebSocketManager, *websocket.Conn) {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	cfg.WebSocket.PingInterval = 20 * time.Millisecond
+	cfg.WebSocket.PongTimeout = 100 * time.Millisecond
+	cfg.WebSocket.WriteTimeout = time.Second
+	cfg.WebSocket.IdleTimeout = 0
+	if configure != nil {
+		configure(&cfg.WebSocket)
+	}
+	wm := NewWebSocketManager(newTestTelemetryService(t), nil, cfg.WebSocket)
+	go wm.Start()
+
+	server := httptest.NewServer(http.HandlerFunc(wm.HandleWebSocket))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return wm, conn
+}
+
+// readUntilClosed reads, answering pings, until the connection ends, and
+// returns the error that ended it
+func readUntilClosed(conn *websocket.Conn) <-chan error {
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+	return closed
+}
+
+// waitForDisconnect waits until the manager counted one disconnect for reason
+// and has no clients left
+func waitForDisconnect(t *testing.T, wm *WebSocketManager, reason string) models.WebSocketMetrics {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		metrics := wm.GetMetrics()
+		if metrics.Disconnects[reason] == 1 && metrics.ActiveConnections == 0 {
+			return metrics
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("got metrics %+v, want one %s disconnect", wm.GetMetrics(), reason)
+	return models.WebSocketMetrics{}
+}
+
+func TestWebSocketDisconnectReasons(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.WebSocketConfig)
+		client    func(conn *websocket.Conn) // what the client writes
+		reason    string
+		closeCode int // close code the client reads, 0 when the client does not read
+	}{
+		{
+			// The client never reads, so pings go unanswered
+			name:   "pong timeout",
+			reason: disconnectPongTimeout,
+		},
+		{
+			name:      "idle timeout",
+			configure: func(cfg *config.WebSocketConfig) { cfg.IdleTimeout = 150 * time.Millisecond },
+			reason:    disconnectIdleTimeout,
+			closeCode: websocket.ClosePolicyViolation,
+		},
+		{
+			name:      "message too large",
+			configure: func(cfg *config.WebSocketConfig) { cfg.MaxMessageSize = 64 },
+			client: func(conn *websocket.Conn) {
+				conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping","payload":"`+strings.Repeat("x", 100)+`"}`))
+			},
+			reason:    disconnectMessageTooBig,
+			closeCode: websocket.CloseMessageTooBig,
+		},
+		{
+			name: "client closed",
+			client: func(conn *websocket.Conn) {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			},
+			reason: disconnectClientClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm, conn := startTestWebSocketServer(t, tt.configure)
+			var closed <-chan error
+			if tt.closeCode != 0 {
+				closed = readUntilClosed(conn)
+			}
+			if tt.client != nil {
+				tt.client(conn)
+			}
+
+			metrics := waitForDisconnect(t, wm, tt.reason)
+			if metrics.TotalConnections != 1 || len(metrics.Disconnects) != 1 {
+				t.Errorf("got %d connections and disconnects %v, want 1 and only %s", metrics.TotalConnections, metrics.Disconnects, tt.reason)
+			}
+			if closed != nil {
+				select {
+				case err := <-closed:
+					if !websocket.IsCloseError(err, tt.closeCode) {
+						t.Errorf("client read ended with %v, want close code %d", err, tt.closeCode)
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatal("the client connection was not closed")
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketPongsKeepClientConnected(t *testing.T) {
+	wm, conn := startTestWebSocketServer(t, nil)
+	messages := make(chan models.WebSocketMessage, 10)
+	go func() {
+		for {
+			// Reading answers the server's pings with pongs
+			var message models.WebSocketMessage
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			messages <- message
+		}
+	}()
+
+	// Three pong timeouts pass without a message from the client
+	time.Sleep(300 * time.Millisecond)
+	metrics := wm.GetMetrics()
+	if metrics.ActiveConnections != 1 || len(metrics.Disconnects) != 0 {
+		t.Fatalf("got %d connections and disconnects %v, want the client still connected", metrics.ActiveConnections, metrics.Disconnects)
+	}
+	if metrics.PingsSent < 5 {
+		t.Errorf("got %d pings in 300ms, want one every 20ms", metrics.PingsSent)
+	}
+
+	if err := conn.WriteJSON(models.WebSocketMessage{Type: "ping"}); err != nil {
+		t.Fatalf("writing ping: %v", err)
+	}
+	select {
+	case message := <-messages:
+		if message.Type != "pong" {
+			t.Fatalf("got %s, want pong", message.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no pong message")
+	}
+
+	metrics = wm.GetMetrics()
+	if metrics.MessagesReceived != 1 || metrics.MessagesSent != 1 || metrics.BytesSent == 0 || metrics.WriteErrors != 0 {
+		t.Errorf("got %d received, %d sent, %d bytes and %d write errors, want 1, 1, some and 0",
+			metrics.MessagesReceived, metrics.MessagesSent, metrics.BytesSent, metrics.WriteErrors)
+	}
+	if len(metrics.Clients) != 1 {
+		t.Fatalf("got clients %+v, want one", metrics.Clients)
+	}
+	info := metrics.Clients[0]
+	if info.ID != 1 || info.Encoding != EncodingJSON || info.MessagesReceived != 1 || info.MessagesSent != 1 ||
+		info.BytesSent != metrics.BytesSent || info.LastActivity.Before(info.ConnectedAt) {
+		t.Errorf("got client %+v, want client 1 with the connection's counters", info)
+	}
+}
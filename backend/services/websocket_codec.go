@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"thingsboard-widget-backend/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// WebSocket message encodings, negotiated as a Sec-WebSocket-Protocol or with
+// the encoding query parameter
+const (
+	EncodingJSON    = "json"
+	EncodingMsgpack = "msgpack"
+	EncodingCBOR    = "cbor"
+)
+
+// webSocketEncodings lists the supported encodings in server preference order
+var webSocketEncodings = []string{EncodingMsgpack, EncodingCBOR, EncodingJSON}
+
+var (
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+	cborHandle    = &codec.CborHandle{}
+)
+
+func init() {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+	msgpackHandle.MapType = mapType
+	msgpackHandle.RawToString = true
+	cborHandle.MapType = mapType
+}
+
+// IsValidEncoding reports whether encoding is a supported WebSocket encoding
+func IsValidEncoding(encoding string) bool {
+	for _, supported := range webSocketEncodings {
+		if encoding == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeMessage serializes a message for the encoding and returns the frame type to send it as
+func encodeMessage(encoding string, message models.WebSocketMessage) (int, []byte, error) {
+	var handle codec.Handle
+	switch encoding {
+	case EncodingMsgpack:
+		handle = msgpackHandle
+	case EncodingCBOR:
+		handle = cborHandle
+	default:
+		data, err := json.Marshal(message)
+		return websocket.TextMessage, data, err
+	}
+
+	message.Payload = binaryPayload(message.Payload)
+	var data []byte
+	err := codec.NewEncoderBytes(&data, handle).Encode(message)
+	return websocket.BinaryMessage, data, err
+}
+
+// decodeMessage parses a client message. Text frames are always JSON; binary
+// frames use the connection's encoding.
+func decodeMessage(encoding string, frameType int, data []byte, message *models.WebSocketMessage) error {
+	if frameType == websocket.TextMessage {
+		return json.Unmarshal(data, message)
+	}
+	switch encoding {
+	case EncodingMsgpack:
+		return codec.NewDecoderBytes(data, msgpackHandle).Decode(message)
+	case EncodingCBOR:
+		return codec.NewDecoderBytes(data, cborHandle).Decode(message)
+	}
+	return fmt.Errorf("binary frames are not supported with the %s encoding", encoding)
+}
+
+// decodePayload converts a decoded command payload into a typed struct
+func decodePayload(payload interface{}, target interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// binaryPayload replaces JSON telemetry values, which are kept as raw JSON
+// text, with their decoded form so binary encodings carry them as maps and
+// arrays rather than opaque bytes
+func binaryPayload(payload interface{}) interface{} {
+	switch p := payload.(type) {
+	case models.TelemetryData:
+		p.Values = binaryValues(p.Values)
+		return p
+	case *models.TelemetryData:
+		copied := *p
+		copied.Values = binaryValues(p.Values)
+		return copied
+	case models.TelemetryDelta:
+		p.Values = binaryValues(p.Values)
+		return p
+	case models.SubscriptionUpdate:
+		p.Values = binaryValues(p.Values)
+		return p
+	case models.WebSocketSnapshot:
+		telemetry := make([]models.TelemetryData, len(p.Telemetry))
+		for i, telemetryData := range p.Telemetry {
+			telemetryData.Values = binaryValues(telemetryData.Values)
+			telemetry[i] = telemetryData
+		}
+		p.Telemetry = telemetry
+		return p
+	}
+	return payload
+}
+
+// binaryValues decodes json.RawMessage values, copying the map only when needed
+func binaryValues(values map[string]interface{}) map[string]interface{} {
+	var converted map[string]interface{}
+	for key, value := range values {
+		raw, ok := value.(json.RawMessage)
+		if !ok {
+			continue
+		}
+		if converted == nil {
+			converted = make(map[string]interface{}, len(values))
+			for k, v := range values {
+				converted[k] = v
+			}
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err == nil {
+			converted[key] = decoded
+		} else {
+			converted[key] = string(raw)
+		}
+	}
+	if converted == nil {
+		return values
+	}
+	return converted
+}
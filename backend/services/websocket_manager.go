@@ -1,35 +1,62 @@
 package services
 
 import (
-	"encoding/json"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 
+	"thingsboard-widget-backend/config"
 	"thingsboard-widget-backend/models"
 
 	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
 )
 
 // WebSocketManager handles WebSocket connections for real-time telemetry
 type WebSocketManager struct {
 	telemetryService *TelemetryService
-	clients          map[*websocket.Conn]bool
-	broadcast        chan models.TelemetryData
-	register         chan *websocket.Conn
-	unregister       chan *websocket.Conn
+	alarmService     *AlarmService
+	clients          map[*wsClient]bool
+	broadcast        chan models.WebSocketMessage
+	register         chan *wsClient
+	unregister       chan *wsClient
 	mutex            sync.RWMutex
+	history          *sequenceBuffer
+	historyMutex     sync.Mutex
+	enqueueMutex     sync.Mutex // keeps broadcasts queued in sequence order
+	compressionLevel int
+	pingInterval     time.Duration
+	pongTimeout      time.Duration
+	writeTimeout     time.Duration
+	idleTimeout      time.Duration
+	maxMessageSize   int64
+	nextClientID     uint64
+	metrics          *wsMetrics
 	upgrader         websocket.Upgrader
 }
 
-// NewWebSocketManager creates a new WebSocket manager
-func NewWebSocketManager(telemetryService *TelemetryService) *WebSocketManager {
+// NewWebSocketManager creates a new WebSocket manager keeping the last
+// websocketConfig.BufferSize broadcasts for resume
+func NewWebSocketManager(telemetryService *TelemetryService, alarmService *AlarmService, websocketConfig config.WebSocketConfig) *WebSocketManager {
 	return &WebSocketManager{
 		telemetryService: telemetryService,
-		clients:          make(map[*websocket.Conn]bool),
-		broadcast:        make(chan models.TelemetryData, 100),
-		register:         make(chan *websocket.Conn),
-		unregister:       make(chan *websocket.Conn),
+		alarmService:     alarmService,
+		clients:          make(map[*wsClient]bool),
+		broadcast:        make(chan models.WebSocketMessage, 100),
+		register:         make(chan *wsClient),
+		unregister:       make(chan *wsClient),
+		history:          newSequenceBuffer(websocketConfig.BufferSize),
+		compressionLevel: websocketConfig.CompressionLevel,
+		pingInterval:     websocketConfig.PingInterval,
+		pongTimeout:      websocketConfig.PongTimeout,
+		writeTimeout:     websocketConfig.WriteTimeout,
+		idleTimeout:      websocketConfig.IdleTimeout,
+		maxMessageSize:   websocketConfig.MaxMessageSize,
+		metrics:          newWSMetrics(),
 		upgrader: websocket.Upgrader{
+			Subprotocols:      webSocketEncodings,
+			EnableCompression: websocketConfig.Compression,
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for demo
 			},
@@ -51,78 +78,172 @@ func (wm *WebSocketManager) Start() {
 			delete(wm.clients, client)
 			wm.mutex.Unlock()
 
-		case telemetryData := <-wm.broadcast:
+		case message := <-wm.broadcast:
 			wm.mutex.RLock()
-			clients := make([]*websocket.Conn, 0, len(wm.clients))
+			clients := make([]*wsClient, 0, len(wm.clients))
 			for client := range wm.clients {
 				clients = append(clients, client)
 			}
 			wm.mutex.RUnlock()
 
-			message := models.WebSocketMessage{
-				Type:    "telemetry_update",
-				Payload: telemetryData,
-			}
-
 			for _, client := range clients {
-				err := client.WriteJSON(message)
+				err := client.send(message)
 				if err != nil {
-					client.Close()
-					wm.unregister <- client
+					// The client's read loop ends and logs the disconnect
+					client.close(disconnectWriteError, 0)
+					wm.mutex.Lock()
+					delete(wm.clients, client)
+					wm.mutex.Unlock()
 				}
 			}
 		}
 	}
 }
 
-// HandleWebSocket handles incoming WebSocket connections
+// HandleWebSocket handles incoming WebSocket connections. The message encoding
+// is negotiated as a Sec-WebSocket-Protocol (msgpack, cbor or json) or set with
+// the encoding query parameter, and delta=true enables delta telemetry updates.
+// permessage-deflate is used when enabled and offered by the client.
 func (wm *WebSocketManager) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	encoding := query.Get("encoding")
+	if encoding == "" {
+		encoding = EncodingJSON
+	} else if !IsValidEncoding(encoding) {
+		http.Error(w, "unsupported encoding (expected json, msgpack or cbor)", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := wm.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		logrus.Warnf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
 		return
 	}
+	if protocol := conn.Subprotocol(); protocol != "" {
+		encoding = protocol
+	}
+	conn.SetCompressionLevel(wm.compressionLevel)
+	conn.SetReadLimit(wm.maxMessageSize)
 
-	wm.register <- conn
+	wm.mutex.Lock()
+	wm.nextClientID++
+	clientID := wm.nextClientID
+	wm.mutex.Unlock()
 
-	// Start goroutine to handle client messages
-	go wm.handleClient(conn)
+	now := time.Now()
+	client := &wsClient{
+		id:           clientID,
+		conn:         conn,
+		remoteAddr:   r.RemoteAddr,
+		encoding:     encoding,
+		delta:        query.Get("delta") == "true",
+		connectedAt:  now,
+		writeTimeout: wm.writeTimeout,
+		metrics:      wm.metrics,
+		devices:      make(map[string]map[string]interface{}),
+		lastActivity: now,
+		lastMessage:  now,
+		done:         make(chan struct{}),
+	}
+	conn.SetReadDeadline(now.Add(wm.pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		client.touch(wm.pongTimeout, false)
+		return nil
+	})
+
+	wm.metrics.connected()
+	wm.register <- client
+	logrus.WithFields(client.logFields()).Info("WebSocket client connected")
+
+	// Start goroutines to handle client messages and keep the connection alive
+	go wm.handleClient(client)
+	go wm.keepAlive(client)
 }
 
 // handleClient handles individual client connections
-func (wm *WebSocketManager) handleClient(conn *websocket.Conn) {
+func (wm *WebSocketManager) handleClient(client *wsClient) {
+	reason := disconnectReadError
 	defer func() {
-		wm.unregister <- conn
-		conn.Close()
+		wm.unregister <- client
+		client.close(reason, 0)
+		// A reason recorded by the server (idle, write error) takes precedence
+		wm.metrics.disconnected(client.closeReason)
+		fields := client.logFields()
+		fields["reason"] = client.closeReason
+		fields["duration"] = time.Since(client.connectedAt).Round(time.Millisecond).String()
+		logrus.WithFields(fields).Info("WebSocket client disconnected")
 	}()
 
 	for {
 		// Read message from client
-		_, message, err := conn.ReadMessage()
+		frameType, message, err := client.conn.ReadMessage()
 		if err != nil {
+			reason = readErrorReason(err)
+			if reason == disconnectMessageTooBig {
+				client.close(reason, websocket.CloseMessageTooBig)
+			}
 			break
 		}
+		client.touch(wm.pongTimeout, true)
 
 		// Parse message
 		var wsMessage models.WebSocketMessage
-		if err := json.Unmarshal(message, &wsMessage); err != nil {
+		if err := decodeMessage(client.encoding, frameType, message, &wsMessage); err != nil {
 			continue
 		}
 
 		// Handle different message types
 		switch wsMessage.Type {
 		case "subscribe":
-			// Handle subscription to specific device
-			if payload, ok := wsMessage.Payload.(map[string]interface{}); ok {
-				if deviceID, exists := payload["deviceId"]; exists {
-					// Send latest data immediately
-					if telemetryData, exists := wm.telemetryService.GetLatestTelemetry(deviceID.(string)); exists {
-						response := models.WebSocketMessage{
-							Type:    "telemetry_data",
-							Payload: telemetryData,
-						}
-						conn.WriteJSON(response)
-					}
+			var options models.WebSocketSubscription
+			if err := decodePayload(wsMessage.Payload, &options); err != nil {
+				client.send(errorMessage("subscribe", "invalid subscription: "+err.Error()))
+				continue
+			}
+			if !wm.telemetryService.HasSeries(options.DeviceID) {
+				client.send(errorMessage("subscribe", "device not found: "+options.DeviceID))
+				continue
+			}
+			subscriptionID, err := client.subscribe(options)
+			if err != nil {
+				client.send(errorMessage("subscribe", err.Error()))
+				continue
+			}
+			client.send(models.WebSocketMessage{
+				Type:    "subscribed",
+				Payload: map[string]string{"subscriptionId": subscriptionID, "deviceId": options.DeviceID},
+			})
+
+			// Send latest data immediately
+			if telemetryData, exists := wm.telemetryService.GetLatestTelemetry(options.DeviceID); exists {
+				response := models.WebSocketMessage{
+					Type:    "telemetry_data",
+					Payload: telemetryData,
 				}
+				client.send(response)
+			}
+
+		case "unsubscribe":
+			var options models.WebSocketSubscription
+			if err := decodePayload(wsMessage.Payload, &options); err != nil || (options.SubscriptionID == "" && options.DeviceID == "") {
+				client.send(errorMessage("unsubscribe", "subscriptionId or deviceId is required"))
+				continue
+			}
+			removed := client.unsubscribe(options.SubscriptionID, options.DeviceID)
+			client.send(models.WebSocketMessage{
+				Type:    "unsubscribed",
+				Payload: map[string]int{"removed": removed},
+			})
+
+		case "resume":
+			// Replay broadcasts missed since the client's last sequence number
+			var lastSeq uint64
+			if payload, ok := wsMessage.Payload.(map[string]interface{}); ok {
+				lastSeq = payloadUint(payload["lastSeq"])
+			}
+			if err := wm.resume(client, lastSeq); err != nil {
+				reason = disconnectResumeFailed
+				return
 			}
 
 		case "ping":
@@ -131,14 +252,213 @@ func (wm *WebSocketManager) handleClient(conn *websocket.Conn) {
 				Type:    "pong",
 				Payload: "pong",
 			}
-			conn.WriteJSON(response)
+			client.send(response)
 		}
 	}
 }
 
+// keepAlive pings the client every pingInterval and closes connections that
+// sent no message within idleTimeout. Dead connections are detected by the
+// read deadline, which only pongs and messages extend.
+func (wm *WebSocketManager) keepAlive(client *wsClient) {
+	ticker := time.NewTicker(wm.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-ticker.C:
+			if wm.idleTimeout > 0 && time.Since(client.idleSince()) > wm.idleTimeout {
+				client.close(disconnectIdleTimeout, websocket.ClosePolicyViolation)
+				return
+			}
+			if err := client.ping(); err != nil {
+				client.close(disconnectWriteError, 0)
+				return
+			}
+		}
+	}
+}
+
+// resume replays the buffered broadcasts after lastSeq, followed by a
+// "resumed" message. When some of them were already evicted a "snapshot" of
+// the latest telemetry and active alarms is sent instead. Live broadcasts are
+// held back while the client resumes and written after the replay; those
+// already replayed or covered by the snapshot are not sent twice. The history
+// is copied without holding the client's writeMutex so resume never waits on
+// a broadcast in progress.
+func (wm *WebSocketManager) resume(client *wsClient, lastSeq uint64) error {
+	client.writeMutex.Lock()
+	client.resuming = true
+	client.writeMutex.Unlock()
+
+	wm.historyMutex.Lock()
+	events, ok := wm.history.since(lastSeq)
+	currentSeq := wm.history.lastID()
+	wm.historyMutex.Unlock()
+
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	held := client.held
+	client.resuming, client.held = false, nil
+
+	if err := wm.replayLocked(client, lastSeq, currentSeq, events, ok); err != nil {
+		return err
+	}
+	for _, message := range held {
+		if err := client.sendLocked(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayLocked writes the replay or snapshot of a resume. Caller must hold
+// client.writeMutex.
+func (wm *WebSocketManager) replayLocked(client *wsClient, lastSeq, currentSeq uint64, events []StreamEvent, ok bool) error {
+	if !ok {
+		// Broadcasts up to currentSeq are part of the snapshot
+		client.lastSeq = currentSeq
+		return client.writeLocked(models.WebSocketMessage{
+			Type:    "snapshot",
+			Seq:     currentSeq,
+			Payload: wm.snapshot(),
+		})
+	}
+
+	// The client may have seen newer broadcasts than lastSeq on this connection
+	client.lastSeq = lastSeq
+	for _, event := range events {
+		message := models.WebSocketMessage{Type: event.Type, Payload: event.Payload, Seq: event.ID}
+		if err := client.sendLocked(message); err != nil {
+			return err
+		}
+	}
+	return client.sendLocked(models.WebSocketMessage{
+		Type: "resumed",
+		Payload: models.WebSocketResume{
+			FromSeq:  lastSeq,
+			ToSeq:    currentSeq,
+			Replayed: len(events),
+		},
+	})
+}
+
+// errorMessage reports a rejected client command
+func errorMessage(command, text string) models.WebSocketMessage {
+	return models.WebSocketMessage{
+		Type:    "error",
+		Payload: map[string]string{"command": command, "error": text},
+	}
+}
+
+// payloadUint reads a non-negative integer sent by a JSON or binary client
+func payloadUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 {
+			return uint64(v)
+		}
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	case uint64:
+		return v
+	}
+	return 0
+}
+
+// snapshot collects the latest telemetry of every device and the active alarms
+func (wm *WebSocketManager) snapshot() models.WebSocketSnapshot {
+	snapshot := models.WebSocketSnapshot{
+		Telemetry: []models.TelemetryData{},
+		Alarms:    []models.Alarm{},
+	}
+	for _, device := range wm.telemetryService.GetDevices() {
+		if telemetryData, exists := wm.telemetryService.GetLatestTelemetry(device.ID); exists {
+			snapshot.Telemetry = append(snapshot.Telemetry, *telemetryData)
+		}
+	}
+	if wm.alarmService != nil {
+		for _, alarm := range wm.alarmService.GetAlarms("", "") {
+			if alarm.IsActive() {
+				snapshot.Alarms = append(snapshot.Alarms, alarm)
+			}
+		}
+	}
+	return snapshot
+}
+
 // BroadcastTelemetry broadcasts telemetry data to all connected clients
 func (wm *WebSocketManager) BroadcastTelemetry(telemetryData models.TelemetryData) {
-	wm.broadcast <- telemetryData
+	wm.enqueue("telemetry_update", telemetryData)
+}
+
+// BroadcastAlarm broadcasts an alarm change to all connected clients
+func (wm *WebSocketManager) BroadcastAlarm(alarm models.Alarm) {
+	wm.enqueue("alarm_update", alarm)
+}
+
+// enqueue stamps a broadcast with the next sequence number, buffers it for
+// resume and queues it for delivery in sequence order. historyMutex is released
+// before the send so a full queue never blocks resume.
+func (wm *WebSocketManager) enqueue(messageType string, payload interface{}) {
+	wm.enqueueMutex.Lock()
+	defer wm.enqueueMutex.Unlock()
+
+	wm.historyMutex.Lock()
+	event := wm.history.add(messageType, payload)
+	wm.historyMutex.Unlock()
+
+	wm.broadcast <- models.WebSocketMessage{
+		Type:    messageType,
+		Seq:     event.ID,
+		Payload: payload,
+	}
+}
+
+// SetOriginChecker sets the function used to validate the Origin of upgrade requests
+func (wm *WebSocketManager) SetOriginChecker(checkOrigin func(r *http.Request) bool) {
+	wm.upgrader.CheckOrigin = checkOrigin
+}
+
+// Shutdown closes every client connection with a going-away close frame.
+// Hijacked WebSocket connections are not closed by http.Server.Shutdown.
+func (wm *WebSocketManager) Shutdown() {
+	wm.mutex.RLock()
+	clients := make([]*wsClient, 0, len(wm.clients))
+	for client := range wm.clients {
+		clients = append(clients, client)
+	}
+	wm.mutex.RUnlock()
+
+	for _, client := range clients {
+		client.close(disconnectServerShutdown, websocket.CloseGoingAway)
+	}
+}
+
+// GetMetrics returns connection lifecycle and traffic counters and the connected clients
+func (wm *WebSocketManager) GetMetrics() models.WebSocketMetrics {
+	metrics := wm.metrics.snapshot()
+
+	wm.mutex.RLock()
+	clients := make([]*wsClient, 0, len(wm.clients))
+	for client := range wm.clients {
+		clients = append(clients, client)
+	}
+	wm.mutex.RUnlock()
+
+	metrics.ActiveConnections = len(clients)
+	metrics.Clients = make([]models.WebSocketClientInfo, 0, len(clients))
+	for _, client := range clients {
+		metrics.Clients = append(metrics.Clients, client.info())
+	}
+	sort.Slice(metrics.Clients, func(i, j int) bool {
+		return metrics.Clients[i].ID < metrics.Clients[j].ID
+	})
+	return metrics
 }
 
 // GetConnectedClientsCount returns the number of connected clients
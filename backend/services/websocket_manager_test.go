@@ -0,0 +1,179 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/config"
+	"thingsboard-widget-backend/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// newTestWebSocketManager returns a manager keeping bufferSize broadcasts.
+// Its broadcast loop is not started.
+func newTestWebSocketManager(t *testing.T, bufferSize int) *WebSocketManager {
+	t.Helper()
+	cfg, err := config.NewManager(viper.New()).Load()
+	if err != nil {
+		t.Fatalf("loading default configuration: %v", err)
+	}
+	cfg.WebSocket.BufferSize = bufferSize
+	return NewWebSocketManager(newTestTelemetryService(t), nil, cfg.WebSocket)
+}
+
+// newTestWSClient returns a JSON client wrapping the server side of a real
+// connection, and the connection's client side
+func newTestWSClient(t *testing.T) (*wsClient, *websocket.Conn) {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrading connection: %v", err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	serverConn := <-serverConns
+	t.Cleanup(func() { serverConn.Close() })
+	return &wsClient{
+		conn:         serverConn,
+		encoding:     EncodingJSON,
+		writeTimeout: time.Second,
+		metrics:      newWSMetrics(),
+		devices:      make(map[string]map[string]interface{}),
+		done:         make(chan struct{}),
+	}, conn
+}
+
+// readWSMessage reads the next message sent to a test client
+func readWSMessage(t *testing.T, conn *websocket.Conn) models.WebSocketMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message models.WebSocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	return message
+}
+
+func TestResumeWhileBroadcastQueueIsFull(t *testing.T) {
+	wm := newTestWebSocketManager(t, 1000)
+	client, conn := newTestWSClient(t)
+
+	// Nothing drains the queue, so the last broadcast blocks in enqueue
+	for i := 0; i < cap(wm.broadcast); i++ {
+		wm.BroadcastAlarm(models.Alarm{ID: "alarm"})
+	}
+	go wm.BroadcastAlarm(models.Alarm{ID: "blocked"})
+	time.Sleep(20 * time.Millisecond)
+
+	resumed := make(chan error, 1)
+	go func() { resumed <- wm.resume(client, 0) }()
+	select {
+	case err := <-resumed:
+		if err != nil {
+			t.Fatalf("resume: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("resume blocked behind a broadcast waiting for the queue")
+	}
+
+	// Drain the replay and the resumed message so the blocked broadcast finishes
+	for {
+		if message := readWSMessage(t, conn); message.Type == "resumed" {
+			break
+		}
+	}
+	<-wm.broadcast
+}
+
+func TestResumeSnapshotSkipsCoveredBroadcasts(t *testing.T) {
+	wm := newTestWebSocketManager(t, 2)
+	client, conn := newTestWSClient(t)
+
+	for i := 0; i < 5; i++ {
+		wm.BroadcastAlarm(models.Alarm{ID: "alarm"})
+	}
+	// Broadcast 2 was evicted, so the client gets a snapshot
+	if err := wm.resume(client, 1); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	snapshot := readWSMessage(t, conn)
+	if snapshot.Type != "snapshot" || snapshot.Seq != 5 {
+		t.Fatalf("got %s at seq %d, want snapshot at seq 5", snapshot.Type, snapshot.Seq)
+	}
+
+	// The queued broadcasts are already part of the snapshot
+	for len(wm.broadcast) > 0 {
+		if err := client.send(<-wm.broadcast); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	wm.BroadcastAlarm(models.Alarm{ID: "after"})
+	if err := client.send(<-wm.broadcast); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	message := readWSMessage(t, conn)
+	if message.Seq != 6 {
+		t.Fatalf("got broadcast %d after the snapshot, want 6", message.Seq)
+	}
+	var alarm models.Alarm
+	payload, _ := json.Marshal(message.Payload)
+	if err := json.Unmarshal(payload, &alarm); err != nil || alarm.ID != "after" {
+		t.Fatalf("got payload %s, want alarm \"after\"", payload)
+	}
+}
+
+func TestResumeHoldsBroadcastsUntilReplayed(t *testing.T) {
+	for _, inHistory := range []bool{false, true} {
+		wm := newTestWebSocketManager(t, 1000)
+		client, conn := newTestWSClient(t)
+		for i := 0; i < 3; i++ {
+			wm.BroadcastAlarm(models.Alarm{ID: "alarm"})
+		}
+		if inHistory {
+			wm.BroadcastAlarm(models.Alarm{ID: "live"})
+		}
+
+		// A live broadcast reaching the client while resume copies the history
+		client.resuming = true
+		if err := client.send(models.WebSocketMessage{Type: "alarm_update", Seq: 4, Payload: models.Alarm{ID: "live"}}); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if err := wm.resume(client, 1); err != nil {
+			t.Fatalf("resume: %v", err)
+		}
+		if err := client.send(models.WebSocketMessage{Type: "alarm_update", Seq: 5, Payload: models.Alarm{ID: "next"}}); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+
+		// The held broadcast follows the replay, or is part of it
+		want := []string{"alarm_update 2", "alarm_update 3", "resumed 0", "alarm_update 4", "alarm_update 5"}
+		if inHistory {
+			want = []string{"alarm_update 2", "alarm_update 3", "alarm_update 4", "resumed 0", "alarm_update 5"}
+		}
+		for i, w := range want {
+			message := readWSMessage(t, conn)
+			if got := fmt.Sprintf("%s %d", message.Type, message.Seq); got != w {
+				t.Fatalf("inHistory=%v: message %d is %s, want %s", inHistory, i, got, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+// throttleTolerance lets an update through slightly before minInterval has
+// elapsed, so timestamp jitter between ticks does not skip a whole tick
+const throttleTolerance = 10 * time.Millisecond
+
+// windowSample is a numeric value held in a subscription's aggregation window
+type windowSample struct {
+	ts    time.Time
+	value float64
+}
+
+// wsSubscription is a client's subscription to a device. Without options it
+// only selects the device's raw telemetry_update messages; with options each
+// update is filtered by key, aggregated over a rolling window, throttled and
+// checked for changes before it is sent as a subscription_update.
+// Timing uses the telemetry timestamps, so replays on resume behave the same.
+type wsSubscription struct {
+	options     models.WebSocketSubscription
+	keys        map[string]bool
+	minInterval time.Duration
+	window      time.Duration
+	onChange    bool
+
+	lastSent   time.Time
+	sentValues map[string]interface{}
+	samples    map[string][]windowSample
+}
+
+// newWSSubscription validates subscription options. Agg defaults to AVG when
+// a window is set, and a deadband implies onChange.
+func newWSSubscription(options models.WebSocketSubscription) (*wsSubscription, error) {
+	options.Agg = strings.ToUpper(options.Agg)
+	switch {
+	case options.DeviceID == "":
+		return nil, fmt.Errorf("deviceId is required")
+	case options.MinInterval < 0:
+		return nil, fmt.Errorf("minInterval must not be negative")
+	case options.Window < 0:
+		return nil, fmt.Errorf("window must not be negative")
+	case options.Deadband < 0:
+		return nil, fmt.Errorf("deadband must not be negative")
+	case options.Agg != "" && options.Window == 0:
+		return nil, fmt.Errorf("agg requires a window")
+	}
+	if options.Window > 0 {
+		if options.Agg == "" {
+			options.Agg = models.AggregationAvg
+		}
+		switch options.Agg {
+		case models.AggregationAvg, models.AggregationMin, models.AggregationMax, models.AggregationLast:
+		default:
+			return nil, fmt.Errorf("unsupported agg %q (expected AVG, MIN, MAX or LAST)", options.Agg)
+		}
+	}
+	if options.Deadband > 0 {
+		options.OnChange = true
+	}
+
+	return &wsSubscription{
+		options:     options,
+		keys:        toSet(options.Keys),
+		minInterval: time.Duration(options.MinInterval) * time.Millisecond,
+		window:      time.Duration(options.Window) * time.Millisecond,
+		onChange:    options.OnChange,
+		sentValues:  make(map[string]interface{}),
+		samples:     make(map[string][]windowSample),
+	}, nil
+}
+
+// raw reports whether the subscription has no options and passes the device's
+// telemetry_update messages through unchanged
+func (ws *wsSubscription) raw() bool {
+	return len(ws.keys) == 0 && ws.minInterval == 0 && ws.window == 0 && !ws.onChange
+}
+
+// apply evaluates a telemetry reading and returns the values to send, or
+// false when the update is filtered out, throttled or unchanged
+func (ws *wsSubscription) apply(telemetryData models.TelemetryData) (map[string]interface{}, bool) {
+	values := make(map[string]interface{}, len(telemetryData.Values))
+	for key, value := range telemetryData.Values {
+		if len(ws.keys) == 0 || ws.keys[key] {
+			values[key] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+
+	// Every reading enters the window, including those that are throttled
+	ts := telemetryData.Timestamp
+	if ws.window > 0 {
+		for key, value := range values {
+			number, ok := numericValue(value)
+			if !ok {
+				continue
+			}
+			samples := append(ws.samples[key], windowSample{ts: ts, value: number})
+			start := 0
+			for start < len(samples) && !samples[start].ts.After(ts.Add(-ws.window)) {
+				start++
+			}
+			samples = samples[start:]
+			ws.samples[key] = samples
+			values[key] = aggregateSamples(ws.options.Agg, samples)
+		}
+	}
+
+	if ws.minInterval > 0 && !ws.lastSent.IsZero() && ts.Sub(ws.lastSent) < ws.minInterval-throttleTolerance {
+		return nil, false
+	}
+
+	if ws.onChange {
+		for key, value := range values {
+			if previous, sent := ws.sentValues[key]; sent && !valueChanged(previous, value, ws.options.Deadband) {
+				delete(values, key)
+			}
+		}
+		if len(values) == 0 {
+			return nil, false
+		}
+	}
+
+	ws.lastSent = ts
+	for key, value := range values {
+		ws.sentValues[key] = value
+	}
+	return values, true
+}
+
+// aggregateSamples applies a window aggregation to the samples, oldest first
+func aggregateSamples(agg string, samples []windowSample) float64 {
+	result := samples[len(samples)-1].value
+	switch agg {
+	case models.AggregationAvg:
+		sum := 0.0
+		for _, sample := range samples {
+			sum += sample.value
+		}
+		result = sum / float64(len(samples))
+	case models.AggregationMin:
+		for _, sample := range samples {
+			result = math.Min(result, sample.value)
+		}
+	case models.AggregationMax:
+		for _, sample := range samples {
+			result = math.Max(result, sample.value)
+		}
+	}
+	return result
+}
+
+// valueChanged reports whether a value differs from the last one sent. Numeric
+// values must move by more than the deadband.
+func valueChanged(previous, current interface{}, deadband float64) bool {
+	previousNumber, ok1 := numericValue(previous)
+	currentNumber, ok2 := numericValue(current)
+	if ok1 && ok2 {
+		if deadband == 0 {
+			return previousNumber != currentNumber
+		}
+		return math.Abs(currentNumber-previousNumber) > deadband
+	}
+	return !reflect.DeepEqual(previous, current)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"thingsboard-widget-backend/models"
+)
+
+func TestNewWSSubscription(t *testing.T) {
+	subscription, err := newWSSubscription(models.WebSocketSubscription{DeviceID: "device_001", Window: 1000, Deadband: 0.5})
+	if err != nil {
+		t.Fatalf("newWSSubscription: %v", err)
+	}
+	if subscription.options.Agg != models.AggregationAvg || !subscription.onChange || subscription.raw() {
+		t.Errorf("got %+v, want AVG, on change and not raw", subscription.options)
+	}
+	if raw, _ := newWSSubscription(models.WebSocketSubscription{DeviceID: "device_001"}); !raw.raw() {
+		t.Error("a subscription without options is not raw")
+	}
+
+	tests := []struct {
+		options models.WebSocketSubscription
+		want    string
+	}{
+		{models.WebSocketSubscription{}, "deviceId is required"},
+		{models.WebSocketSubscription{DeviceID: "device_001", MinInterval: -1}, "minInterval must not be negative"},
+		{models.WebSocketSubscription{DeviceID: "device_001", Window: -1}, "window must not be negative"},
+		{models.WebSocketSubscription{DeviceID: "device_001", Deadband: -1}, "deadband must not be negative"},
+		{models.WebSocketSubscription{DeviceID: "device_001", Agg: "max"}, "agg requires a window"},
+		{models.WebSocketSubscription{DeviceID: "device_001", Window: 1000, Agg: "sum"}, `unsupported agg "SUM"`},
+	}
+	for _, tt := range tests {
+		if _, err := newWSSubscription(tt.options); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("newWSSubscription(%+v) returned %v, want %q", tt.options, err, tt.want)
+		}
+	}
+}
+
+func TestWSSubscriptionApply(t *testing.T) {
+	type reading struct {
+		after  int64 // ms after the first reading
+		values map[string]interface{}
+		want   map[string]interface{} // nil when the reading is not sent
+	}
+	value := func(key string, v interface{}) map[string]interface{} {
+		return map[string]interface{}{key: v}
+	}
+	temperature := func(v float64) map[string]interface{} {
+		return value("temperature", v)
+	}
+
+	tests := []struct {
+		name     string
+		options  models.WebSocketSubscription
+		readings []reading
+	}{
+		{
+			name:    "keys",
+			options: models.WebSocketSubscription{Keys: []string{"temperature"}},
+			readings: []reading{
+				{0, map[string]interface{}{"temperature": 20.0, "humidity": 50.0}, temperature(20)},
+				{1000, value("humidity", 51.0), nil},
+			},
+		},
+		{
+			name:    "throttle",
+			options: models.WebSocketSubscription{MinInterval: 10000},
+			readings: []reading{
+				{0, temperature(20), temperature(20)},
+				{5000, temperature(21), nil},
+				{9995, temperature(22), temperature(22)}, // within the tolerance
+				{15000, temperature(23), nil},
+				{20000, temperature(24), temperature(24)},
+			},
+		},
+		{
+			name:    "window average",
+			options: models.WebSocketSubscription{Window: 3000},
+			readings: []reading{
+				{0, temperature(10), temperature(10)},
+				{1000, temperature(20), temperature(15)},
+				{2000, temperature(30), temperature(20)},
+				{3000, temperature(40), temperature(30)}, // the first reading left the window
+				{3000, value("mode", "auto"), value("mode", "auto")},
+			},
+		},
+		{
+			name:    "window min",
+			options: models.WebSocketSubscription{Window: 2000, Agg: "min"},
+			readings: []reading{
+				{0, temperature(10), temperature(10)},
+				{1000, temperature(20), temperature(10)},
+				{2500, temperature(30), temperature(20)},
+			},
+		},
+		{
+			name:    "window last",
+			options: models.WebSocketSubscription{Window: 2000, Agg: "LAST"},
+			readings: []reading{
+				{0, temperature(10), temperature(10)},
+				{1000, temperature(5), temperature(5)},
+			},
+		},
+		{
+			// Throttled readings still enter the window
+			name:    "throttled window max",
+			options: models.WebSocketSubscription{MinInterval: 2000, Window: 5000, Agg: "MAX"},
+			readings: []reading{
+				{0, temperature(5), temperature(5)},
+				{1000, temperature(9), nil},
+				{2000, temperature(1), temperature(9)},
+			},
+		},
+		{
+			name:    "on change",
+			options: models.WebSocketSubscription{OnChange: true},
+			readings: []reading{
+				{0, temperature(20), temperature(20)},
+				{1000, temperature(20), nil},
+				{2000, temperature(20.1), temperature(20.1)},
+			},
+		},
+		{
+			name:    "deadband",
+			options: models.WebSocketSubscription{Deadband: 0.5},
+			readings: []reading{
+				{0, map[string]interface{}{"temperature": 20.0, "mode": "auto"}, map[string]interface{}{"temperature": 20.0, "mode": "auto"}},
+				{1000, map[string]interface{}{"temperature": 20.4, "mode": "auto"}, nil},
+				{2000, map[string]interface{}{"temperature": 20.6, "mode": "auto"}, temperature(20.6)}, // moved from 20, the last value sent
+				{3000, map[string]interface{}{"temperature": 21.0, "mode": "manual"}, value("mode", "manual")},
+			},
+		},
+	}
+
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			options.DeviceID = "device_001"
+			subscription, err := newWSSubscription(options)
+			if err != nil {
+				t.Fatalf("newWSSubscription: %v", err)
+			}
+			for i, r := range tt.readings {
+				values, ok := subscription.apply(models.TelemetryData{
+					DeviceID:  "device_001",
+					Timestamp: start.Add(time.Duration(r.after) * time.Millisecond),
+					Values:    r.values,
+				})
+				if !ok {
+					values = nil
+				}
+				if !reflect.DeepEqual(values, r.want) {
+					t.Errorf("reading %d: got %v, want %v", i, values, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResubscribeAfterResume(t *testing.T) {
+	wm := newTestWebSocketManager(t, 1000)
+	client, conn := newTestWSClient(t)
+	start := time.Now().Truncate(time.Second)
+	telemetryAt := func(deviceID string, after time.Duration, value float64) models.TelemetryData {
+		return models.TelemetryData{
+			DeviceID:  deviceID,
+			Timestamp: start.Add(after),
+			Values:    map[string]interface{}{"temperature": value, "humidity": 50.0},
+		}
+	}
+	deliver := func(telemetryData models.TelemetryData) {
+		t.Helper()
+		wm.BroadcastTelemetry(telemetryData)
+		if err := client.send(<-wm.broadcast); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	// A reconnected client has no subscriptions, so the replay is raw
+	wm.BroadcastTelemetry(telemetryAt("device_001", 0, 20))
+	wm.BroadcastTelemetry(telemetryAt("device_002", 0, 30))
+	<-wm.broadcast
+	<-wm.broadcast
+	if err := wm.resume(client, 0); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	// Subscribing again after the replay filters the live updates
+	if _, err := client.subscribe(models.WebSocketSubscription{
+		SubscriptionID: "temperature", DeviceID: "device_001", Keys: []string{"temperature"}, MinInterval: 10000,
+	}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	deliver(telemetryAt("device_001", time.Second, 21))
+	deliver(telemetryAt("device_002", time.Second, 31)) // not subscribed
+	deliver(telemetryAt("device_001", 5*time.Second, 22))
+	deliver(telemetryAt("device_001", 11*time.Second, 23))
+
+	// Subscribing with the same ID replaces the options and the throttle state
+	if id, err := client.subscribe(models.WebSocketSubscription{SubscriptionID: "temperature", DeviceID: "device_001", OnChange: true}); err != nil || id != "temperature" {
+		t.Fatalf("subscribe: %q, %v", id, err)
+	}
+	deliver(telemetryAt("device_001", 12*time.Second, 23))
+
+	want := []string{
+		"telemetry_update 1 device_001",
+		"telemetry_update 2 device_002",
+		"resumed 0",
+		"subscription_update 3 temperature map[temperature:21]",
+		"subscription_update 6 temperature map[temperature:23]",
+		"subscription_update 7 temperature map[humidity:50 temperature:23]",
+	}
+	for i, w := range want {
+		message := readWSMessage(t, conn)
+		got := fmt.Sprintf("%s %d", message.Type, message.Seq)
+		payload, _ := message.Payload.(map[string]interface{})
+		switch message.Type {
+		case "telemetry_update":
+			got += fmt.Sprintf(" %v", payload["deviceId"])
+		case "subscription_update":
+			got += fmt.Sprintf(" %v %v", payload["subscriptionId"], payload["values"])
+		}
+		if got != w {
+			t.Fatalf("message %d is %s, want %s", i, got, w)
+		}
+	}
+}
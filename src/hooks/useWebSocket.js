@@ -6,6 +6,17 @@ export const useWebSocket = (deviceId) => {
   const [error, setError] = useState(null);
   const wsRef = useRef(null);
   const reconnectTimeoutRef = useRef(null);
+  const lastSeqRef = useRef(0);
+
+  // Subscribe to device telemetry; subscriptions do not survive a reconnect
+  const subscribe = useCallback((ws) => {
+    if (deviceId) {
+      ws.send(JSON.stringify({
+        type: 'subscribe',
+        payload: { deviceId }
+      }));
+    }
+  }, [deviceId]);
 
   const connect = useCallback(() => {
     try {
@@ -17,18 +28,28 @@ export const useWebSocket = (deviceId) => {
         setIsConnected(true);
         setError(null);
         
-        // Subscribe to device telemetry
-        if (deviceId) {
+        // After a reconnect, replay the updates missed while disconnected and
+        // subscribe again once the replay is done
+        if (lastSeqRef.current > 0) {
           ws.send(JSON.stringify({
-            type: 'subscribe',
-            payload: { deviceId }
+            type: 'resume',
+            payload: { lastSeq: lastSeqRef.current }
           }));
+        } else {
+          subscribe(ws);
         }
       };
 
       ws.onmessage = (event) => {
         try {
           const message = JSON.parse(event.data);
+          // A snapshot restarts the sequence, e.g. after a server restart;
+          // otherwise keep the highest sequence number seen
+          if (message.type === 'snapshot') {
+            lastSeqRef.current = message.seq || 0;
+          } else if (message.seq > lastSeqRef.current) {
+            lastSeqRef.current = message.seq;
+          }
           
           switch (message.type) {
             case 'telemetry_update':
@@ -43,6 +64,24 @@ export const useWebSocket = (deviceId) => {
               }
               break;
               
+            case 'snapshot': {
+              // Too many updates were missed to replay; use the current state
+              const snapshot = message.payload && message.payload.telemetry;
+              const current = snapshot && snapshot.find((data) => data.deviceId === deviceId);
+              if (current) {
+                setLatestData(current);
+              }
+              subscribe(ws);
+              break;
+            }
+
+            case 'resumed':
+              subscribe(ws);
+              break;
+
+            case 'subscribed':
+              break;
+
             case 'pong':
               // Handle pong response
               break;
@@ -80,7 +119,7 @@ export const useWebSocket = (deviceId) => {
       console.error('Error creating WebSocket connection:', err);
       setError('Failed to create WebSocket connection');
     }
-  }, [deviceId]);
+  }, [deviceId, subscribe]);
 
   const disconnect = useCallback(() => {
     if (wsRef.current) {
@@ -109,6 +148,7 @@ export const useWebSocket = (deviceId) => {
   }, [sendMessage]);
 
   useEffect(() => {
+    lastSeqRef.current = 0;
     if (deviceId) {
       connect();
     }